@@ -1,13 +1,28 @@
 import resolve from 'rollup-plugin-node-resolve';
 
-export default {
-    input: 'src/main.js',
-    output: {
-        file: 'public/met-atlas-viewer.js',
-        format: 'umd',
-        name: 'MetAtlasViewer'
+export default [
+    {
+        input: 'src/main.js',
+        output: {
+            file: 'public/met-atlas-viewer.js',
+            format: 'umd',
+            name: 'MetAtlasViewer'
+        },
+        plugins: [
+            resolve()
+        ]
     },
-    plugins: [
-        resolve()
-    ]
-};
+    {
+        // the <met-atlas-3d-viewer> custom element, for embedding without a
+        // build step
+        input: 'src/web-component.js',
+        output: {
+            file: 'public/met-atlas-3d-viewer.js',
+            format: 'iife',
+            name: 'MetAtlas3DViewerElement'
+        },
+        plugins: [
+            resolve()
+        ]
+    }
+];
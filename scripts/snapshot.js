@@ -0,0 +1,105 @@
+#!/usr/bin/env node
+/**
+ * @file Headless snapshot rendering for the Metabolic Atlas 3D Viewer.
+ *
+ * Renders a network file with a view config to a PNG image, using a headless
+ * browser. The viewer has to be built first (`npm run build`), and puppeteer
+ * has to be installed (`npm install`, it's a development dependency).
+ *
+ * Usage:
+ *   node scripts/snapshot.js <network.json> <output.png> [view-config.json]
+ *
+ * The network file holds the graph data as {nodes: [], links: []}, in the
+ * format used by `setData`. The view config may contain:
+ *   {width, height, nodeSize, nodeTextures, background, colors,
+ *    camera: {position, up, target}, select}
+ */
+
+const fs = require('fs');
+const http = require('http');
+const path = require('path');
+
+const publicDir = path.join(__dirname, '..', 'public');
+
+const defaultConfig = {
+  width: 800,
+  height: 600,
+  nodeSize: 15,
+  nodeTextures: [{group: 'e', sprite: 'sprite_round.png'},
+                 {group: 'r', sprite: 'sprite_square.png'},
+                 {group: 'm', sprite: 'sprite_triangle.png'}],
+  background: '#ffffff'
+};
+
+const mimeTypes = {
+  '.html': 'text/html',
+  '.js': 'application/javascript',
+  '.png': 'image/png'
+};
+
+/**
+ * Serves the public directory on a random local port, so that the viewer and
+ * its sprites can be loaded without cross-origin restrictions.
+ */
+function serve() {
+  let server = http.createServer((req, res) => {
+    let file = path.join(publicDir, path.normalize(decodeURIComponent(req.url.split('?')[0])));
+    if (!file.startsWith(publicDir) || !fs.existsSync(file) || fs.statSync(file).isDirectory()) {
+      res.writeHead(404);
+      res.end();
+      return;
+    }
+    res.writeHead(200, {'Content-Type': mimeTypes[path.extname(file)] || 'application/octet-stream'});
+    fs.createReadStream(file).pipe(res);
+  });
+  return new Promise(resolve => {
+    server.listen(0, '127.0.0.1', () => resolve(server));
+  });
+}
+
+async function main() {
+  let [networkFile, outputFile, configFile] = process.argv.slice(2);
+  if (!networkFile || !outputFile) {
+    console.error('usage: node scripts/snapshot.js <network.json> <output.png> [view-config.json]');
+    process.exit(1);
+  }
+  if (!fs.existsSync(path.join(publicDir, 'met-atlas-viewer.js'))) {
+    console.error("public/met-atlas-viewer.js not found, run 'npm run build' first.");
+    process.exit(1);
+  }
+
+  let puppeteer;
+  try {
+    puppeteer = require('puppeteer');
+  } catch (e) {
+    console.error("puppeteer is required, install the development dependencies with 'npm install'.");
+    process.exit(1);
+  }
+
+  let graphData = JSON.parse(fs.readFileSync(networkFile, 'utf8'));
+  let config = Object.assign({}, defaultConfig,
+    configFile ? JSON.parse(fs.readFileSync(configFile, 'utf8')) : {});
+
+  let server = await serve();
+  let browser = await puppeteer.launch({
+    args: ['--use-gl=swiftshader', '--enable-webgl', '--ignore-gpu-blocklist']
+  });
+  try {
+    let page = await browser.newPage();
+    await page.setViewport({width: config.width, height: config.height});
+    page.on('console', msg => console.log('[viewer]', msg.text()));
+    await page.goto('http://127.0.0.1:' + server.address().port + '/snapshot.html');
+    let dataUrl = await page.evaluate((data, conf) => window.renderSnapshot(data, conf),
+                                      graphData, config);
+    fs.writeFileSync(outputFile, Buffer.from(dataUrl.split(',')[1], 'base64'));
+    console.log('wrote ' + outputFile);
+  } finally {
+    await browser.close();
+    server.close();
+  }
+}
+
+main().catch(error => {
+  console.error(error);
+  process.exit(1);
+});
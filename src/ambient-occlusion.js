@@ -0,0 +1,54 @@
+/**
+ * @file This file contains a baked ambient occlusion approximation for the
+ * Metabolic Atlas 3D Viewer. Nodes in dense regions of the graph are darkened
+ * according to how many other nodes are nearby, which gives a cheap depth cue
+ * in dense clusters.
+ */
+
+/**
+ * Calculates an occlusion factor for each node, from 1 (unoccluded) down to
+ * `1 - strength` for the nodes with the most neighbors within `radius`.
+ *
+ * @param {Array} positions - node positions as [[x, y, z], ...]
+ * @param {number} radius - neighborhood radius in graph coordinates
+ * @param {number} strength - maximum darkening, between 0 and 1
+ * @returns {Array} A list of occlusion factors, one per node.
+ */
+function computeOcclusion(positions, radius, strength) {
+  // bin the nodes in a grid of `radius` sized cells so that only the
+  // neighboring cells need to be searched.
+  let grid = {};
+  let key = (x, y, z) => x + ':' + y + ':' + z;
+  let cells = positions.map(pos => pos.map(v => Math.floor(v / radius)));
+  cells.forEach((c, i) => {
+    let k = key(c[0], c[1], c[2]);
+    (grid[k] = grid[k] || []).push(i);
+  });
+
+  let r2 = radius * radius;
+  let counts = positions.map((pos, i) => {
+    let count = 0;
+    let c = cells[i];
+    for (let x = c[0]-1; x <= c[0]+1; x++) {
+      for (let y = c[1]-1; y <= c[1]+1; y++) {
+        for (let z = c[2]-1; z <= c[2]+1; z++) {
+          (grid[key(x, y, z)] || []).forEach(j => {
+            if (j == i) return;
+            let dx = positions[j][0]-pos[0];
+            let dy = positions[j][1]-pos[1];
+            let dz = positions[j][2]-pos[2];
+            if (dx*dx + dy*dy + dz*dz < r2) {
+              count += 1;
+            }
+          });
+        }
+      }
+    }
+    return count;
+  });
+
+  let max = counts.reduce((a, b) => Math.max(a, b), 1);
+  return counts.map(count => 1 - strength * count / max);
+}
+
+export { computeOcclusion };
@@ -0,0 +1,193 @@
+/**
+ * @file This file contains the annotation layer of the Metabolic Atlas 3D
+ * Viewer. Annotations are short notes pinned to nodes or links, shown as
+ * callouts next to them, with a leader line to the node or the middle of the
+ * link. An annotation is formatted as:
+ *
+ *   {id, text, node, link, offset, color, created}
+ *
+ * where node is the ID of the annotated node, or link the annotated link as
+ * {s, t} (the IDs of its source and target nodes), and offset the position
+ * of the callout relative to the node or link, in pixels.
+ */
+
+const defaultOffset = [40, -40];
+const defaultColor = '#333333';
+
+/**
+ * Creates a unique annotation ID.
+ *
+ * @returns {string} The ID.
+ */
+function annotationId() {
+  return 'a' + Date.now().toString(36) + Math.random().toString(36).slice(2, 6);
+}
+
+/**
+ * Checks and cleans imported annotations. Annotations without text, or
+ * without a node or link to pin them to, are dropped.
+ *
+ * @param {Array} list - the annotations
+ * @returns {Array} The valid annotations.
+ */
+function validAnnotations(list) {
+  if (!Array.isArray(list)) return [];
+  return list.filter(a => a && typeof a.text == 'string' &&
+                          (a.node !== undefined || (a.link && a.link.s !== undefined &&
+                                                    a.link.t !== undefined)))
+    .map(a => {
+      let annotation = {
+        id: a.id !== undefined ? String(a.id) : annotationId(),
+        text: a.text,
+        offset: Array.isArray(a.offset) && a.offset.length == 2 ?
+          a.offset.map(Number) : defaultOffset.slice(),
+        color: typeof a.color == 'string' ? a.color : defaultColor,
+        created: a.created || new Date().toISOString()
+      };
+      if (a.node !== undefined) {
+        annotation.node = String(a.node);
+      } else {
+        annotation.link = {s: String(a.link.s), t: String(a.link.t)};
+      }
+      return annotation;
+    });
+}
+
+/**
+ * Creates the annotation layer over the canvas.
+ *
+ * @param {Object} container - the viewer container element
+ * @param {Function} onClick - called with the annotation ID and the event
+ *     when a callout is clicked
+ * @returns {Object} An object with functions to place, show and hide the
+ *     callouts.
+ */
+function AnnotationLayer(container, onClick) {
+  let layer = document.createElement('div');
+  layer.className = 'met-atlas-annotations';
+  Object.assign(layer.style, {
+    position: 'absolute',
+    left: '0',
+    top: '0',
+    width: '100%',
+    height: '100%',
+    overflow: 'hidden',
+    pointerEvents: 'none',
+  });
+  const svgNS = 'http://www.w3.org/2000/svg';
+  let leaders = document.createElementNS(svgNS, 'svg');
+  leaders.style.position = 'absolute';
+  leaders.style.width = '100%';
+  leaders.style.height = '100%';
+  layer.appendChild(leaders);
+  container.appendChild(layer);
+
+  // the elements of each callout, by annotation ID
+  let callouts = new Map();
+
+  /**
+   * Creates the elements of a callout: the leader line, a dot on the node or
+   * link, and the note.
+   *
+   * @param {string} id - the annotation ID
+   * @returns {Object} The elements, formatted as {line, dot, note}.
+   */
+  function makeCallout(id) {
+    let line = document.createElementNS(svgNS, 'line');
+    line.setAttribute('stroke-width', '1.5');
+    let dot = document.createElementNS(svgNS, 'circle');
+    dot.setAttribute('r', '3');
+    leaders.appendChild(line);
+    leaders.appendChild(dot);
+
+    let note = document.createElement('div');
+    note.className = 'met-atlas-annotation';
+    Object.assign(note.style, {
+      position: 'absolute',
+      transform: 'translate(-50%, -50%)',
+      maxWidth: '200px',
+      padding: '4px 8px',
+      borderRadius: '4px',
+      borderWidth: '1px',
+      borderStyle: 'solid',
+      backgroundColor: 'rgba(255,255,255,0.9)',
+      color: '#000000',
+      font: '12px sans-serif',
+      whiteSpace: 'pre-wrap',
+      cursor: 'pointer',
+      pointerEvents: 'auto',
+    });
+    note.addEventListener('click', event => onClick(id, event));
+    layer.appendChild(note);
+    return {line, dot, note};
+  }
+
+  /**
+   * Places the callouts, and removes the callouts of annotations which are
+   * no longer shown.
+   *
+   * @param {Array} shown - the annotations to show, each with the extra key
+   *     anchor, the screen position of its node or link as [x, y]
+   */
+  function update(shown) {
+    let ids = new Set(shown.map(a => a.id));
+    callouts.forEach((callout, id) => {
+      if (!ids.has(id)) {
+        callout.line.remove();
+        callout.dot.remove();
+        callout.note.remove();
+        callouts.delete(id);
+      }
+    });
+    shown.forEach(annotation => {
+      if (!callouts.has(annotation.id)) {
+        callouts.set(annotation.id, makeCallout(annotation.id));
+      }
+      let {line, dot, note} = callouts.get(annotation.id);
+      let [x, y] = annotation.anchor;
+      let x2 = x + annotation.offset[0];
+      let y2 = y + annotation.offset[1];
+      line.setAttribute('x1', x);
+      line.setAttribute('y1', y);
+      line.setAttribute('x2', x2);
+      line.setAttribute('y2', y2);
+      line.setAttribute('stroke', annotation.color);
+      dot.setAttribute('cx', x);
+      dot.setAttribute('cy', y);
+      dot.setAttribute('fill', annotation.color);
+      note.style.left = x2 + 'px';
+      note.style.top = y2 + 'px';
+      note.style.borderColor = annotation.color;
+      if (note.textContent != annotation.text) {
+        note.textContent = annotation.text;
+      }
+    });
+  }
+
+  /**
+   * Shows or hides all callouts.
+   *
+   * @param {boolean} visible - whether to show the callouts
+   */
+  function setVisible(visible) {
+    layer.hidden = !visible;
+  }
+
+  /**
+   * Returns whether the callouts are shown.
+   */
+  function isVisible() {
+    return !layer.hidden;
+  }
+
+  /**
+   * Removes the layer from the container.
+   */
+  function dispose() {
+    layer.remove();
+  }
+
+  return {dispose, isVisible, setVisible, update};
+}
+
+export { AnnotationLayer, annotationId, validAnnotations };
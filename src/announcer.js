@@ -0,0 +1,77 @@
+/**
+ * @file This file contains the screen reader announcements of the Metabolic
+ * Atlas 3D Viewer. The canvas has no content a screen reader can read, so
+ * changes such as a new selection are described in words and put in a
+ * visually hidden ARIA live region, which screen readers read out.
+ */
+
+/**
+ * Creates a live region in the viewer container.
+ *
+ * @param {Object} container - the viewer container element
+ * @returns {Object} An object with functions to make and cancel
+ *     announcements.
+ */
+function Announcer(container) {
+  let region = document.createElement('div');
+  region.className = 'met-atlas-announcer';
+  region.setAttribute('role', 'status');
+  region.setAttribute('aria-live', 'polite');
+  region.setAttribute('aria-atomic', 'true');
+  // visually hidden, but still read by screen readers
+  Object.assign(region.style, {
+    position: 'absolute',
+    width: '1px',
+    height: '1px',
+    margin: '-1px',
+    padding: '0',
+    overflow: 'hidden',
+    clip: 'rect(0 0 0 0)',
+    whiteSpace: 'nowrap',
+    border: '0',
+  });
+  container.appendChild(region);
+
+  let timeout;
+
+  /**
+   * Announces a text. A pending announcement is replaced, so that quick
+   * changes, like moving the mouse over many nodes, only announce the last
+   * one.
+   *
+   * @param {string} text - the text to announce
+   * @param {number} delay - (optional) milliseconds to wait before the
+   *     announcement (default 0)
+   */
+  function announce(text, delay = 0) {
+    cancel();
+    // the region is cleared first, so that the same text is announced again
+    region.textContent = '';
+    timeout = setTimeout(() => {
+      timeout = undefined;
+      region.textContent = text;
+    }, Math.max(delay, 50));
+  }
+
+  /**
+   * Cancels a pending announcement.
+   */
+  function cancel() {
+    if (timeout !== undefined) {
+      clearTimeout(timeout);
+      timeout = undefined;
+    }
+  }
+
+  /**
+   * Removes the live region from the container.
+   */
+  function dispose() {
+    cancel();
+    region.remove();
+  }
+
+  return {announce, cancel, dispose};
+}
+
+export { Announcer };
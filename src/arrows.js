@@ -0,0 +1,69 @@
+/**
+ * @file This file contains functions for drawing link arrowheads in the
+ * Metabolic Atlas 3D Viewer.
+ */
+
+import {
+  Color,
+  ConeGeometry,
+  InstancedMesh,
+  Matrix4,
+  MeshBasicMaterial,
+  Quaternion,
+  Vector3,
+} from 'three';
+
+/**
+ * Creates an instanced mesh with one cone per arrowhead. The cones are placed
+ * so that the tip of each cone is at the arrowhead `tip` position, pointing
+ * along `dir`.
+ *
+ * @param {Array} arrows - arrowheads formatted as [{tip: [x, y, z],
+ *     dir: [x, y, z], color: [r, g, b]}, ...]
+ * @param {number} size - the length of the arrowheads in graph coordinates
+ * @returns {Object} A three-js InstancedMesh.
+ */
+function makeArrowMesh(arrows, size) {
+  let geometry = new ConeGeometry(size * 0.35, size, 8);
+  let material = new MeshBasicMaterial({color: 0xffffff,
+                                        transparent: true,
+                                        opacity: 0.67});
+  let mesh = new InstancedMesh(geometry, material, Math.max(1, arrows.length));
+
+  const up = new Vector3(0, 1, 0);
+  const dir = new Vector3();
+  const position = new Vector3();
+  const quaternion = new Quaternion();
+  const scale = new Vector3(1, 1, 1);
+  const matrix = new Matrix4();
+  const color = new Color();
+
+  arrows.forEach((arrow, i) => {
+    dir.set(arrow.dir[0], arrow.dir[1], arrow.dir[2]).normalize();
+    quaternion.setFromUnitVectors(up, dir);
+    // the cone geometry is centered on its midpoint
+    position.set(arrow.tip[0], arrow.tip[1], arrow.tip[2])
+            .addScaledVector(dir, -size/2);
+    matrix.compose(position, quaternion, scale);
+    mesh.setMatrixAt(i, matrix);
+    mesh.setColorAt(i, color.setRGB(arrow.color[0]/255,
+                                    arrow.color[1]/255,
+                                    arrow.color[2]/255));
+  });
+  mesh.count = arrows.length;
+  return mesh;
+}
+
+/**
+ * Sets the color of arrowhead `i` in an arrow mesh.
+ *
+ * @param {Object} mesh - arrow mesh created by `makeArrowMesh`
+ * @param {number} i - index of the arrowhead
+ * @param {Array} rgb - color formatted as [r, g, b]
+ */
+function setArrowColor(mesh, i, rgb) {
+  mesh.setColorAt(i, new Color(rgb[0]/255, rgb[1]/255, rgb[2]/255));
+  mesh.instanceColor.needsUpdate = true;
+}
+
+export { makeArrowMesh, setArrowColor };
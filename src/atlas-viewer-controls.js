@@ -33,6 +33,7 @@ var AtlasViewerControls = function( object, domElement ) {
     this.noRotate = false;
     this.noZoom = false;
     this.noPan = false;
+    this.noRoll = false;
 
     this.staticMoving = false;
     this.dynamicDampingFactor = 0.2;
@@ -42,6 +43,14 @@ var AtlasViewerControls = function( object, domElement ) {
 
     this.keys = [ 65 /*A*/, 83 /*S*/, 68 /*D*/ ];
 
+    // actions of the mouse buttons and one-finger touch, which can be
+    // 'rotate', 'zoom', 'pan' or 'none' ('zoom' is not available for touch)
+    this.mouseButtons = { LEFT: 'rotate', MIDDLE: 'zoom', RIGHT: 'pan' };
+    this.touches = { ONE: 'rotate' };
+
+    // reverses the zoom direction of the mouse wheel
+    this.invertZoom = false;
+
     // internals
 
     this.target = new Vector3();
@@ -67,6 +76,9 @@ var AtlasViewerControls = function( object, domElement ) {
         _touchZoomDistanceStart = 0,
         _touchZoomDistanceEnd = 0,
 
+        _touchAngleStart = 0,
+        _touchAngleEnd = 0,
+
         _panStart = new Vector2(),
         _panEnd = new Vector2();
 
@@ -268,6 +280,31 @@ var AtlasViewerControls = function( object, domElement ) {
 
     }() );
 
+    // rolls the camera around the viewing direction when twisting two fingers
+    this.rollCamera = ( function () {
+
+        var axis = new Vector3();
+
+        return function rollCamera() {
+
+            if ( _state !== STATE.TOUCH_ZOOM_PAN ) return;
+
+            var angle = _touchAngleEnd - _touchAngleStart;
+            // take the shortest way around
+            angle = Math.atan2( Math.sin( angle ), Math.cos( angle ) );
+            _touchAngleStart = _touchAngleEnd;
+
+            if ( angle ) {
+
+                axis.copy( _eye ).normalize();
+                _this.object.up.applyAxisAngle( axis, angle );
+
+            }
+
+        };
+
+    }() );
+
     this.checkDistances = function () {
 
         if ( ! _this.noZoom || ! _this.noPan ) {
@@ -312,6 +349,12 @@ var AtlasViewerControls = function( object, domElement ) {
 
         }
 
+        if ( ! _this.noRoll ) {
+
+            _this.rollCamera();
+
+        }
+
         _this.object.position.addVectors( _this.target, _eye );
 
         _this.checkDistances();
@@ -396,7 +439,15 @@ var AtlasViewerControls = function( object, domElement ) {
 
         if ( _state === STATE.NONE ) {
 
-            _state = event.button;
+            var action = _this.mouseButtons[ [ 'LEFT', 'MIDDLE', 'RIGHT' ][ event.button ] ];
+            _state = { rotate: STATE.ROTATE, zoom: STATE.ZOOM, pan: STATE.PAN }[ action ];
+
+            if ( _state === undefined ) {
+
+                _state = STATE.NONE;
+                return;
+
+            }
 
         }
 
@@ -494,21 +545,23 @@ var AtlasViewerControls = function( object, domElement ) {
         event.preventDefault();
         event.stopPropagation();
 
+        var zoomDirection = _this.invertZoom ? - 1 : 1;
+
         switch ( event.deltaMode ) {
 
             case 2:
                 // Zoom in pages
-                _zoomStart.y -= event.deltaY * 0.025;
+                _zoomStart.y -= zoomDirection * event.deltaY * 0.025;
                 break;
 
             case 1:
                 // Zoom in lines
-                _zoomStart.y -= event.deltaY * 0.01;
+                _zoomStart.y -= zoomDirection * event.deltaY * 0.01;
                 break;
 
             default:
                 // undefined, 0, assume pixels
-                _zoomStart.y -= event.deltaY * 0.00025;
+                _zoomStart.y -= zoomDirection * event.deltaY * 0.00025;
                 break;
 
         }
@@ -557,6 +610,29 @@ var AtlasViewerControls = function( object, domElement ) {
 
     }
 
+    // starts the one-finger touch action
+    function touchOne( touch ) {
+
+        if ( _this.touches.ONE === 'pan' ) {
+
+            _state = STATE.PAN;
+            _panStart.copy( getMouseOnScreen( touch.pageX, touch.pageY ) );
+            _panEnd.copy( _panStart );
+
+        } else if ( _this.touches.ONE === 'rotate' ) {
+
+            _state = STATE.TOUCH_ROTATE;
+            _moveCurr.copy( getMouseOnCircle( touch.pageX, touch.pageY ) );
+            _movePrev.copy( _moveCurr );
+
+        } else {
+
+            _state = STATE.NONE;
+
+        }
+
+    }
+
     function touchstart( event ) {
 
         if ( _this.enabled === false ) return;
@@ -566,9 +642,7 @@ var AtlasViewerControls = function( object, domElement ) {
         switch ( event.touches.length ) {
 
             case 1:
-                _state = STATE.TOUCH_ROTATE;
-                _moveCurr.copy( getMouseOnCircle( event.touches[ 0 ].pageX, event.touches[ 0 ].pageY ) );
-                _movePrev.copy( _moveCurr );
+                touchOne( event.touches[ 0 ] );
                 break;
 
             default: // 2 or more
@@ -576,6 +650,7 @@ var AtlasViewerControls = function( object, domElement ) {
                 var dx = event.touches[ 0 ].pageX - event.touches[ 1 ].pageX;
                 var dy = event.touches[ 0 ].pageY - event.touches[ 1 ].pageY;
                 _touchZoomDistanceEnd = _touchZoomDistanceStart = Math.sqrt( dx * dx + dy * dy );
+                _touchAngleEnd = _touchAngleStart = Math.atan2( dy, dx );
 
                 var x = ( event.touches[ 0 ].pageX + event.touches[ 1 ].pageX ) / 2;
                 var y = ( event.touches[ 0 ].pageY + event.touches[ 1 ].pageY ) / 2;
@@ -599,14 +674,23 @@ var AtlasViewerControls = function( object, domElement ) {
         switch ( event.touches.length ) {
 
             case 1:
-                _movePrev.copy( _moveCurr );
-                _moveCurr.copy( getMouseOnCircle( event.touches[ 0 ].pageX, event.touches[ 0 ].pageY ) );
+                if ( _state === STATE.PAN ) {
+
+                    _panEnd.copy( getMouseOnScreen( event.touches[ 0 ].pageX, event.touches[ 0 ].pageY ) );
+
+                } else if ( _state === STATE.TOUCH_ROTATE ) {
+
+                    _movePrev.copy( _moveCurr );
+                    _moveCurr.copy( getMouseOnCircle( event.touches[ 0 ].pageX, event.touches[ 0 ].pageY ) );
+
+                }
                 break;
 
             default: // 2 or more
                 var dx = event.touches[ 0 ].pageX - event.touches[ 1 ].pageX;
                 var dy = event.touches[ 0 ].pageY - event.touches[ 1 ].pageY;
                 _touchZoomDistanceEnd = Math.sqrt( dx * dx + dy * dy );
+                _touchAngleEnd = Math.atan2( dy, dx );
 
                 var x = ( event.touches[ 0 ].pageX + event.touches[ 1 ].pageX ) / 2;
                 var y = ( event.touches[ 0 ].pageY + event.touches[ 1 ].pageY ) / 2;
@@ -628,9 +712,19 @@ var AtlasViewerControls = function( object, domElement ) {
                 break;
 
             case 1:
-                _state = STATE.TOUCH_ROTATE;
-                _moveCurr.copy( getMouseOnCircle( event.touches[ 0 ].pageX, event.touches[ 0 ].pageY ) );
-                _movePrev.copy( _moveCurr );
+                touchOne( event.touches[ 0 ] );
+                break;
+
+            default: // 2 or more, restart the gesture with the remaining touches
+                var dx = event.touches[ 0 ].pageX - event.touches[ 1 ].pageX;
+                var dy = event.touches[ 0 ].pageY - event.touches[ 1 ].pageY;
+                _touchZoomDistanceEnd = _touchZoomDistanceStart = Math.sqrt( dx * dx + dy * dy );
+                _touchAngleEnd = _touchAngleStart = Math.atan2( dy, dx );
+
+                var x = ( event.touches[ 0 ].pageX + event.touches[ 1 ].pageX ) / 2;
+                var y = ( event.touches[ 0 ].pageY + event.touches[ 1 ].pageY ) / 2;
+                _panStart.copy( getMouseOnScreen( x, y ) );
+                _panEnd.copy( _panStart );
                 break;
 
         }
@@ -0,0 +1,75 @@
+/**
+ * @file This file contains the storage of the bookmarks of the Metabolic
+ * Atlas 3D Viewer. Bookmarks are kept in localStorage, so that they survive
+ * reloads of the page, and can be exported to and imported from JSON files
+ * to move them between browsers. A bookmark is formatted as:
+ *
+ *   {id, label, created, node, camera, selection, state}
+ *
+ * where node is the ID of a bookmarked node, camera and selection the view
+ * when the bookmark was made, and state (optional) the full view state.
+ */
+
+/**
+ * Creates a unique bookmark ID.
+ *
+ * @returns {string} The ID.
+ */
+function bookmarkId() {
+  return Date.now().toString(36) + Math.random().toString(36).slice(2, 8);
+}
+
+/**
+ * Checks and cleans imported bookmarks. Bookmarks without a label, or without
+ * a node or camera to go to, are dropped.
+ *
+ * @param {Array} list - the bookmarks
+ * @returns {Array} The valid bookmarks.
+ */
+function validBookmarks(list) {
+  if (!Array.isArray(list)) return [];
+  return list.filter(b => b && typeof b.label == 'string' &&
+                          (b.node !== undefined || (b.camera && b.camera.position)))
+    .map(b => Object.assign({}, b, {
+      id: b.id !== undefined ? String(b.id) : bookmarkId(),
+      created: b.created || new Date().toISOString(),
+      selection: Array.isArray(b.selection) ? b.selection : []
+    }));
+}
+
+/**
+ * Reads the bookmarks saved under a key.
+ *
+ * @param {string} key - the localStorage key
+ * @param {Array} fallback - (optional) the bookmarks to return if
+ *     localStorage isn't available (default none)
+ * @returns {Array} The bookmarks, or an empty list if there are none.
+ */
+function loadBookmarks(key, fallback = []) {
+  try {
+    let saved = window.localStorage.getItem(key);
+    return saved ? validBookmarks(JSON.parse(saved)) : [];
+  } catch (error) {
+    console.warn('could not load bookmarks: ' + error.message);
+    return fallback;
+  }
+}
+
+/**
+ * Saves bookmarks under a key.
+ *
+ * @param {string} key - the localStorage key
+ * @param {Array} bookmarks - the bookmarks
+ * @returns {boolean} False if localStorage isn't available or full.
+ */
+function saveBookmarks(key, bookmarks) {
+  try {
+    window.localStorage.setItem(key, JSON.stringify(bookmarks));
+    return true;
+  } catch (error) {
+    console.warn('could not save bookmarks: ' + error.message);
+    return false;
+  }
+}
+
+export { bookmarkId, loadBookmarks, saveBookmarks, validBookmarks };
@@ -0,0 +1,77 @@
+/**
+ * @file This file contains the breadcrumb of the Metabolic Atlas 3D Viewer,
+ * a bar over the top left corner of the canvas which lists the isolated
+ * views, see `isolate` of the viewer. Clicking a step restores it, and the
+ * last step is the current view. The breadcrumb is hidden when there is
+ * only one step.
+ */
+
+/**
+ * Creates the breadcrumb.
+ *
+ * @param {Object} container - the element of the viewer
+ * @param {Function} onClick - called with the index of the clicked step
+ * @returns {Object} An object with functions to update and remove the
+ *     breadcrumb.
+ */
+function Breadcrumb(container, onClick) {
+  let bar = document.createElement('nav');
+  bar.className = 'met-atlas-breadcrumb';
+  bar.setAttribute('aria-label', 'Isolated views');
+  Object.assign(bar.style, {
+    position: 'absolute',
+    left: '10px',
+    top: '10px',
+    display: 'none',
+    padding: '4px 8px',
+    borderRadius: '4px',
+    backgroundColor: 'rgba(255,255,255,0.9)',
+    color: '#000000',
+    font: '12px sans-serif',
+  });
+  container.appendChild(bar);
+
+  /**
+   * Shows the steps.
+   *
+   * @param {Array} steps - the step labels, first to current
+   */
+  function update(steps) {
+    bar.replaceChildren();
+    bar.style.display = steps.length > 1 ? 'block' : 'none';
+    steps.forEach((label, k) => {
+      if (k > 0) {
+        let separator = document.createElement('span');
+        separator.textContent = ' › ';
+        separator.setAttribute('aria-hidden', 'true');
+        bar.appendChild(separator);
+      }
+      let current = k == steps.length - 1;
+      let step = document.createElement(current ? 'span' : 'a');
+      step.textContent = label;
+      if (current) {
+        step.setAttribute('aria-current', 'page');
+        step.style.fontWeight = 'bold';
+      } else {
+        step.href = '#';
+        step.style.color = 'inherit';
+        step.addEventListener('click', event => {
+          event.preventDefault();
+          onClick(k);
+        });
+      }
+      bar.appendChild(step);
+    });
+  }
+
+  /**
+   * Removes the breadcrumb.
+   */
+  function dispose() {
+    bar.remove();
+  }
+
+  return {dispose, update};
+}
+
+export { Breadcrumb };
@@ -0,0 +1,327 @@
+/**
+ * @file This file contains the community detection of the Metabolic Atlas 3D
+ * Viewer, which finds clusters of densely connected nodes, to help users
+ * discover the modular structure of unfamiliar models. Two methods are
+ * available: Louvain, which optimizes the modularity of the clusters and
+ * gives the best clusters, and label propagation, which is faster on very
+ * large networks. Both run in a web worker, so that the viewer stays
+ * responsive.
+ *
+ * Graphs are given as the number of nodes and a list of undirected edges,
+ * formatted as [[a, b, weight], ...], where a and b are node indices.
+ */
+
+/**
+ * Creates a seeded random number generator (mulberry32), so that clusters
+ * are the same each time for the same network.
+ *
+ * @param {number} seed - the seed
+ * @returns {Function} A function returning numbers in [0, 1).
+ */
+function seededRandom(seed) {
+  let state = seed >>> 0;
+  return () => {
+    state = (state + 0x6D2B79F5) >>> 0;
+    let t = state;
+    t = Math.imul(t ^ (t >>> 15), t | 1);
+    t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+    return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+  };
+}
+
+/**
+ * Returns the node indices in random order.
+ *
+ * @param {number} n - the number of nodes
+ * @param {Function} random - the random number generator
+ * @returns {Array} The indices.
+ */
+function shuffled(n, random) {
+  let order = Array.from({length: n}, (_, i) => i);
+  for (let i = n - 1; i > 0; i--) {
+    let j = Math.floor(random() * (i + 1));
+    [order[i], order[j]] = [order[j], order[i]];
+  }
+  return order;
+}
+
+/**
+ * Returns the weighted neighbors of each node, with parallel edges merged.
+ *
+ * @param {number} n - the number of nodes
+ * @param {Array} edges - the edges, formatted as [[a, b, weight], ...]
+ * @returns {Array} The neighbors of each node, as Maps from neighbor to
+ *     weight.
+ */
+function neighborWeights(n, edges) {
+  let neighbors = Array.from({length: n}, () => new Map());
+  edges.forEach(([a, b, weight]) => {
+    if (a == b) return;
+    neighbors[a].set(b, (neighbors[a].get(b) || 0) + weight);
+    neighbors[b].set(a, (neighbors[b].get(a) || 0) + weight);
+  });
+  return neighbors;
+}
+
+/**
+ * Numbers clusters from 0, largest first.
+ *
+ * @param {Array} labels - any cluster label of each node
+ * @returns {Array} The cluster numbers of the nodes.
+ */
+function renumber(labels) {
+  let sizes = new Map();
+  labels.forEach(label => sizes.set(label, (sizes.get(label) || 0) + 1));
+  let order = [...sizes.keys()].sort((a, b) => sizes.get(b) - sizes.get(a) || a - b);
+  let number = new Map(order.map((label, k) => [label, k]));
+  return labels.map(label => number.get(label));
+}
+
+/**
+ * Computes the modularity of clusters, the fraction of the edge weight
+ * within clusters minus the fraction expected if edges were random.
+ *
+ * @param {number} n - the number of nodes
+ * @param {Array} edges - the edges
+ * @param {Array} labels - the cluster of each node
+ * @param {number} resolution - the resolution, see `louvain`
+ * @returns {number} The modularity, between -0.5 and 1.
+ */
+function modularity(n, edges, labels, resolution = 1) {
+  let total = 0;
+  let inside = 0;
+  let degrees = new Map();
+  edges.forEach(([a, b, weight]) => {
+    if (a == b) return;
+    total += weight;
+    if (labels[a] == labels[b]) inside += weight;
+    degrees.set(labels[a], (degrees.get(labels[a]) || 0) + weight);
+    degrees.set(labels[b], (degrees.get(labels[b]) || 0) + weight);
+  });
+  if (total == 0) return 0;
+  let expected = 0;
+  degrees.forEach(degree => { expected += (degree / (2 * total)) ** 2; });
+  return inside / total - resolution * expected;
+}
+
+/**
+ * Finds clusters with the Louvain method: nodes are moved to the
+ * neighboring cluster which increases the modularity most, until no move
+ * helps, and then the clusters are merged into nodes and the process is
+ * repeated on the smaller graph.
+ *
+ * @param {number} n - the number of nodes
+ * @param {Array} edges - the edges
+ * @param {object} options - (optional) options with the keys resolution
+ *     (higher values give more and smaller clusters, default 1) and seed
+ * @returns {Array} The cluster of each node.
+ */
+function louvain(n, edges, options = {}) {
+  let resolution = options.resolution !== undefined ? options.resolution : 1;
+  let random = seededRandom(options.seed !== undefined ? options.seed : 1);
+  // the cluster of each original node, and the graph of the current level
+  let labels = Array.from({length: n}, (_, i) => i);
+  let size = n;
+  let levelEdges = edges.filter(([a, b]) => a != b);
+  let selfLoops = new Float64Array(n);
+
+  for (;;) {
+    let neighbors = neighborWeights(size, levelEdges);
+    let degrees = new Float64Array(size);
+    let total = 0;
+    for (let i = 0; i < size; i++) {
+      neighbors[i].forEach(weight => { degrees[i] += weight; });
+      degrees[i] += 2 * selfLoops[i];
+      total += degrees[i];
+    }
+    if (total == 0) break;
+
+    let community = Int32Array.from({length: size}, (_, i) => i);
+    let communityDegree = Float64Array.from(degrees);
+    let improved = false;
+    let moved = true;
+    for (let pass = 0; moved && pass < 100; pass++) {
+      moved = false;
+      shuffled(size, random).forEach(i => {
+        let own = community[i];
+        let links = new Map();
+        neighbors[i].forEach((weight, j) => {
+          links.set(community[j], (links.get(community[j]) || 0) + weight);
+        });
+        communityDegree[own] -= degrees[i];
+        const gain = c => (links.get(c) || 0) -
+          resolution * communityDegree[c] * degrees[i] / total;
+        let best = own;
+        let bestGain = gain(own);
+        links.forEach((_, c) => {
+          let g = gain(c);
+          if (g > bestGain + 1e-12) {
+            best = c;
+            bestGain = g;
+          }
+        });
+        communityDegree[best] += degrees[i];
+        if (best != own) {
+          community[i] = best;
+          moved = true;
+          improved = true;
+        }
+      });
+    }
+    if (!improved) break;
+
+    // merge the clusters into the nodes of the next level
+    let number = new Map();
+    community.forEach(c => {
+      if (!number.has(c)) number.set(c, number.size);
+    });
+    labels = labels.map(label => number.get(community[label]));
+    let nextLoops = new Float64Array(number.size);
+    let merged = new Map();
+    for (let i = 0; i < size; i++) {
+      nextLoops[number.get(community[i])] += selfLoops[i];
+    }
+    levelEdges.forEach(([a, b, weight]) => {
+      let ca = number.get(community[a]);
+      let cb = number.get(community[b]);
+      if (ca == cb) {
+        nextLoops[ca] += weight;
+        return;
+      }
+      let key = Math.min(ca, cb) + ',' + Math.max(ca, cb);
+      merged.set(key, (merged.get(key) || 0) + weight);
+    });
+    levelEdges = [...merged].map(([key, weight]) => key.split(',').map(Number).concat([weight]));
+    selfLoops = nextLoops;
+    size = number.size;
+  }
+  return renumber(labels);
+}
+
+/**
+ * Finds clusters by label propagation: every node starts in its own
+ * cluster, and repeatedly joins the cluster most of its neighbors are in,
+ * until no node changes.
+ *
+ * @param {number} n - the number of nodes
+ * @param {Array} edges - the edges
+ * @param {object} options - (optional) options with the keys iterations
+ *     (the maximum number of rounds, default 20) and seed
+ * @returns {Array} The cluster of each node.
+ */
+function labelPropagation(n, edges, options = {}) {
+  let iterations = options.iterations || 20;
+  let random = seededRandom(options.seed !== undefined ? options.seed : 1);
+  let neighbors = neighborWeights(n, edges);
+  let labels = Array.from({length: n}, (_, i) => i);
+  for (let round = 0; round < iterations; round++) {
+    let changed = false;
+    shuffled(n, random).forEach(i => {
+      let counts = new Map();
+      neighbors[i].forEach((weight, j) => {
+        counts.set(labels[j], (counts.get(labels[j]) || 0) + weight);
+      });
+      let best = labels[i];
+      let bestCount = counts.get(best) || 0;
+      counts.forEach((count, label) => {
+        if (count > bestCount || (count == bestCount && random() < 0.5)) {
+          best = label;
+          bestCount = count;
+        }
+      });
+      if (best != labels[i]) {
+        labels[i] = best;
+        changed = true;
+      }
+    });
+    if (!changed) break;
+  }
+  return renumber(labels);
+}
+
+/**
+ * Finds clusters with the chosen method.
+ *
+ * @param {number} n - the number of nodes
+ * @param {Array} edges - the edges
+ * @param {object} options - clustering options with the key method
+ *     ('louvain' or 'labelPropagation'), and the options of the method
+ * @returns {Object} The clusters, formatted as {labels, count, modularity}.
+ */
+function findClusters(n, edges, options) {
+  let labels = options.method == 'labelPropagation' ? labelPropagation(n, edges, options) :
+                                                      louvain(n, edges, options);
+  return {labels: labels,
+          count: labels.reduce((max, label) => Math.max(max, label + 1), 0),
+          modularity: modularity(n, edges, labels)};
+}
+
+/**
+ * Handles a clustering request in the worker.
+ *
+ * @param {Object} event - the message event, with the data {n, edges,
+ *     options}
+ */
+function onClusterMessage(event) {
+  try {
+    self.postMessage({clusters: findClusters(event.data.n, event.data.edges,
+                                             event.data.options)});
+  } catch (error) {
+    self.postMessage({error: error.message});
+  }
+}
+
+/**
+ * Returns the source code of the worker, see `workerSource` in
+ * graph-builder.js.
+ */
+function workerSource() {
+  return [seededRandom, shuffled, neighborWeights, renumber, modularity, louvain,
+          labelPropagation, findClusters, onClusterMessage].map(String).join('\n') +
+    '\nself.onmessage = ' + onClusterMessage.name + ';\n';
+}
+
+/**
+ * Finds clusters in a web worker. Falls back to the main thread if workers
+ * aren't available.
+ *
+ * @param {number} n - the number of nodes
+ * @param {Array} edges - the edges
+ * @param {object} options - clustering options, see `findClusters`
+ * @returns {Promise} A promise resolving to the clusters, see
+ *     `findClusters`.
+ */
+function findClustersInWorker(n, edges, options) {
+  let worker;
+  let url;
+  try {
+    url = URL.createObjectURL(new Blob([workerSource()], {type: 'text/javascript'}));
+    worker = new Worker(url);
+  } catch (error) {
+    if (url) URL.revokeObjectURL(url);
+    console.warn('could not start a worker, clustering on the main thread: ' +
+                 error.message);
+    return Promise.resolve(findClusters(n, edges, options));
+  }
+  return new Promise((resolve, reject) => {
+    const finish = () => {
+      worker.terminate();
+      URL.revokeObjectURL(url);
+    };
+    worker.onmessage = event => {
+      finish();
+      if (event.data.error) {
+        reject(new Error(event.data.error));
+      } else {
+        resolve(event.data.clusters);
+      }
+    };
+    worker.onerror = event => {
+      finish();
+      reject(new Error(event.message));
+    };
+    worker.postMessage({n: n, edges: edges, options: options});
+  });
+}
+
+export { findClusters, findClustersInWorker };
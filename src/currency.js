@@ -0,0 +1,109 @@
+/**
+ * @file This file contains the currency metabolites of the Metabolic Atlas 3D
+ * Viewer: cofactors and small molecules like ATP, water and protons, which
+ * take part in so many reactions that they dominate the node degrees, pull
+ * the layout together and hide the structure of the pathways. The list is
+ * configurable, see `setCurrencyMetabolites` of the viewer. Currency
+ * metabolites can be hidden, or split into one duplicate per reaction like
+ * in pathway maps. The duplicates are formatted like the other nodes, with
+ * the extra key duplicateOf, the ID of the split node.
+ *
+ * Names are matched to the node names and IDs regardless of case, and
+ * without a trailing compartment, so that 'ATP' matches 'ATP [c]' and
+ * 'atp[m]'.
+ */
+
+/**
+ * The default currency metabolites.
+ */
+const defaultCurrency = [
+  'ATP', 'ADP', 'AMP', 'GTP', 'GDP', 'H2O', 'H+', 'Pi', 'PPi', 'phosphate',
+  'diphosphate', 'NAD+', 'NADH', 'NADP+', 'NADPH', 'FAD', 'FADH2', 'CoA',
+  'CO2', 'O2', 'NH3', 'NH4+', 'H2O2'
+];
+
+/**
+ * Returns a name without case and trailing compartment, for matching.
+ *
+ * @param {*} name - the name
+ * @returns {string} The normalized name.
+ */
+function normalizeName(name) {
+  return String(name).trim().replace(/\s*[[(][^\])]*[\])]$/, '').toLowerCase();
+}
+
+/**
+ * Creates a function returning whether a node is a currency metabolite.
+ *
+ * @param {Array} names - the names or IDs of the currency metabolites
+ * @returns {Function} A function taking the node data.
+ */
+function currencyTest(names) {
+  let normalized = new Set(names.map(normalizeName));
+  return node => (node.n !== undefined && normalized.has(normalizeName(node.n))) ||
+    normalized.has(normalizeName(node.id));
+}
+
+/**
+ * Splits nodes into one duplicate per neighbor, so that each reaction gets
+ * its own copy of a currency metabolite. A duplicate is placed between its
+ * neighbor and the split node, at `spacing` from the neighbor, and keeps the
+ * links to the neighbor with their data, e.g. the stoichiometry. Nodes
+ * without links, and duplicates of an earlier split, are kept as they are.
+ *
+ * @param {Object} graphData - the graph data formatted as {nodes, links}
+ * @param {Function} test - a function returning whether to split a node
+ * @param {number} spacing - the distance from a duplicate to its neighbor
+ * @returns {Object} The graph data with duplicates, formatted as {nodes,
+ *     links}.
+ */
+function splitNodes(graphData, test, spacing) {
+  let split = new Map();
+  graphData.nodes.forEach(node => {
+    if (node.duplicateOf === undefined && test(node)) split.set(node.id, node);
+  });
+  if (split.size == 0) return graphData;
+  let positions = new Map(graphData.nodes.map(node => [node.id, node.pos]));
+
+  // the duplicates, by split node and neighbor
+  let duplicates = new Map();
+  const duplicate = (id, neighbor) => {
+    let key = id + '\t' + neighbor;
+    if (!duplicates.has(key)) {
+      let node = split.get(id);
+      let from = positions.get(neighbor);
+      let offset = [0, 1, 2].map(k => node.pos[k] - from[k]);
+      let length = Math.hypot(...offset);
+      let pos = length > 0 ?
+        offset.map((d, k) => from[k] + d * Math.min(1, spacing / length)) :
+        node.pos.slice();
+      duplicates.set(key, Object.assign({}, node, {
+        id: id + '@' + neighbor,
+        pos: pos,
+        duplicateOf: id
+      }));
+    }
+    return duplicates.get(key).id;
+  };
+
+  let links = [];
+  graphData.links.forEach(link => {
+    let s = split.has(link.s);
+    let t = split.has(link.t);
+    // links between two split nodes have no reaction to be copied for
+    if (s && t) return;
+    if (!s && !t) {
+      links.push(link);
+      return;
+    }
+    links.push(Object.assign({}, link, {
+      s: s ? duplicate(link.s, link.t) : link.s,
+      t: t ? duplicate(link.t, link.s) : link.t
+    }));
+  });
+  let linked = new Set([...duplicates.values()].map(node => node.duplicateOf));
+  let nodes = graphData.nodes.filter(node => !split.has(node.id) || !linked.has(node.id));
+  return {nodes: nodes.concat([...duplicates.values()]), links: links};
+}
+
+export { currencyTest, defaultCurrency, splitNodes };
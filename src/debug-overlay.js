@@ -0,0 +1,176 @@
+/**
+ * @file This file contains the debug overlay of the Metabolic Atlas 3D
+ * Viewer, a small panel over the canvas which shows the frame rate, where
+ * the time of each frame goes, and the draw calls, so that users can report
+ * performance issues with numbers. The viewer renders on demand, so the
+ * frame rate is the number of frames rendered in the last second, and is
+ * low when nothing moves.
+ */
+
+const padding = 8;
+const width = 180;
+const lineHeight = 13;
+const graphHeight = 30;
+// the number of frames in the frame time graph
+const historyLength = 90;
+
+// the frame time parts, and their colors in the graph
+const parts = [
+  ['layout', '#4fc3f7'],
+  ['picking', '#ffb74d'],
+  ['render', '#81c784'],
+];
+
+/**
+ * Creates a debug overlay in a corner of the viewer container.
+ *
+ * @param {Object} container - the viewer container element
+ * @returns {Object} An object with functions to configure and update the
+ *     overlay.
+ */
+function DebugOverlay(container) {
+  let canvas = document.createElement('canvas');
+  canvas.className = 'met-atlas-debug';
+  canvas.style.position = 'absolute';
+  canvas.style.pointerEvents = 'none';
+  canvas.hidden = true;
+  container.appendChild(canvas);
+
+  let options = {
+    corner: 'top-left',
+    background: 'rgba(0,0,0,0.6)',
+    color: '#ffffff',
+  };
+  // the start times of the frames in the last second, and the part times of
+  // the last frames
+  let frameStarts = [];
+  let history = [];
+
+  /**
+   * Moves the panel to its corner.
+   */
+  function place() {
+    let [vertical, horizontal] = options.corner.split('-');
+    canvas.style.top = vertical == 'top' ? padding + 'px' : '';
+    canvas.style.bottom = vertical == 'bottom' ? padding + 'px' : '';
+    canvas.style.left = horizontal == 'left' ? padding + 'px' : '';
+    canvas.style.right = horizontal == 'right' ? padding + 'px' : '';
+  }
+
+  /**
+   * Draws the frame time graph, with the parts of each frame stacked, and a
+   * line at 16.7 ms (60 frames per second).
+   *
+   * @param {Object} ctx - the canvas context
+   * @param {number} top - the top of the graph
+   */
+  function drawGraph(ctx, top) {
+    let barWidth = (width - padding * 2) / historyLength;
+    let scale = graphHeight / 33.3;
+    history.forEach((frame, k) => {
+      let x = padding + k * barWidth;
+      let y = top + graphHeight;
+      parts.forEach(([part, color]) => {
+        let h = Math.min(frame[part] * scale, y - top);
+        ctx.fillStyle = color;
+        ctx.fillRect(x, y - h, Math.max(1, barWidth - 0.5), h);
+        y -= h;
+      });
+    });
+    ctx.strokeStyle = 'rgba(255,255,255,0.5)';
+    ctx.beginPath();
+    ctx.moveTo(padding, top + graphHeight / 2);
+    ctx.lineTo(width - padding, top + graphHeight / 2);
+    ctx.stroke();
+  }
+
+  /**
+   * Records a frame and redraws the overlay.
+   *
+   * @param {Object} frame - the frame, with the keys start (the start time),
+   *     layout, picking and render (the milliseconds spent on each part),
+   *     drawCalls, triangles, points and lines (the primitives drawn) and
+   *     nodes and links (the graph size)
+   */
+  function update(frame) {
+    if (canvas.hidden) return;
+    frameStarts.push(frame.start);
+    while (frameStarts[0] < frame.start - 1000) {
+      frameStarts.shift();
+    }
+    history.push(frame);
+    if (history.length > historyLength) {
+      history.shift();
+    }
+
+    let total = frame.layout + frame.picking + frame.render;
+    let lines = [
+      frameStarts.length + ' fps  ' + total.toFixed(1) + ' ms',
+      'layout  ' + frame.layout.toFixed(1) + ' ms',
+      'picking ' + frame.picking.toFixed(1) + ' ms',
+      'render  ' + frame.render.toFixed(1) + ' ms',
+      'draw calls ' + frame.drawCalls,
+      'tris ' + frame.triangles + '  points ' + frame.points + '  lines ' + frame.lines,
+      'nodes ' + frame.nodes + '  links ' + frame.links,
+    ];
+    let height = padding * 3 + lines.length * lineHeight + graphHeight;
+
+    let ratio = window.devicePixelRatio || 1;
+    if (canvas.width != Math.round(width * ratio) ||
+        canvas.height != Math.round(height * ratio)) {
+      canvas.width = Math.round(width * ratio);
+      canvas.height = Math.round(height * ratio);
+      canvas.style.width = width + 'px';
+      canvas.style.height = height + 'px';
+    }
+    let ctx = canvas.getContext('2d');
+    ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+    ctx.clearRect(0, 0, width, height);
+    ctx.fillStyle = options.background;
+    ctx.fillRect(0, 0, width, height);
+    ctx.font = '11px monospace';
+    ctx.textBaseline = 'top';
+    lines.forEach((line, k) => {
+      // the part lines are colored like the graph
+      let part = parts.find(([name]) => line.startsWith(name));
+      ctx.fillStyle = part ? part[1] : options.color;
+      ctx.fillText(line, padding, padding + k * lineHeight);
+    });
+    drawGraph(ctx, padding * 2 + lines.length * lineHeight);
+  }
+
+  /**
+   * Shows or hides the overlay, and sets its options.
+   *
+   * @param {boolean} enabled - whether to show the overlay
+   * @param {object} settings - (optional) overlay options, see
+   *     `setDebugOverlay` of the viewer
+   */
+  function setOptions(enabled, settings = {}) {
+    Object.assign(options, settings);
+    canvas.hidden = !enabled;
+    if (!enabled) {
+      frameStarts = [];
+      history = [];
+    }
+    place();
+  }
+
+  /**
+   * Returns whether the overlay is shown.
+   */
+  function isEnabled() {
+    return !canvas.hidden;
+  }
+
+  /**
+   * Removes the overlay from the container.
+   */
+  function dispose() {
+    canvas.remove();
+  }
+
+  return {dispose, isEnabled, setOptions, update};
+}
+
+export { DebugOverlay };
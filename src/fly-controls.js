@@ -0,0 +1,225 @@
+/**
+ * @file This file contains first-person fly controls for the Metabolic Atlas
+ * 3D Viewer, for flying through the interior of the network. The camera is
+ * moved with the keyboard and turned by dragging the mouse:
+ *
+ *  - W / S: fly forward / backward
+ *  - A / D: strafe left / right
+ *  - space / C: fly up / down
+ *  - shift: fly faster
+ *  - mouse drag: look around
+ *  - mouse wheel: fly forward / backward
+ *
+ * Keys typed in text fields of the page don't move the camera.
+ *
+ * The controls can be used with `setCameraControls` in place of the default
+ * orbit controls.
+ */
+
+import {
+  EventDispatcher,
+  Vector3,
+} from 'three';
+
+const moveKeys = {
+  KeyW: 'forward',
+  KeyS: 'backward',
+  KeyA: 'left',
+  KeyD: 'right',
+  Space: 'up',
+  KeyC: 'down',
+};
+
+/**
+ * Returns whether an element takes text input, so that typing in it doesn't
+ * move the camera.
+ *
+ * @param {Object} element - the event target
+ */
+function isEditable(element) {
+  return !!element && (element.isContentEditable ||
+                       ['INPUT', 'TEXTAREA', 'SELECT'].includes(element.tagName));
+}
+
+/**
+ * Creates fly controls for a camera.
+ *
+ * @param {Object} object - the camera to control
+ * @param {Object} domElement - the element to listen to mouse events on
+ */
+var FlyControls = function(object, domElement) {
+  var _this = this;
+
+  this.object = object;
+  this.domElement = domElement !== undefined ? domElement : document;
+
+  this.enabled = true;
+
+  // movement speed in graph units per second, and the speed factor when
+  // shift is held
+  this.movementSpeed = 600;
+  this.boostFactor = 3;
+  // look speed in radians per pixel of mouse movement
+  this.lookSpeed = 0.004;
+
+  // the point the camera looks at, kept in front of the camera
+  this.target = new Vector3();
+
+  var moving = {};
+  var boost = false;
+  var dragging = false;
+  var lastPointer = [0, 0];
+  var lastTime = performance.now();
+  var wheelDistance = 0;
+
+  var changeEvent = {type: 'change'};
+  var startEvent = {type: 'start'};
+  var endEvent = {type: 'end'};
+
+  var forward = new Vector3();
+  var right = new Vector3();
+  var move = new Vector3();
+
+  /**
+   * Moves the camera according to the pressed keys and turns it to face the
+   * target. Should be called once per frame.
+   */
+  this.update = function() {
+    let now = performance.now();
+    // limit the time step, so that the camera doesn't jump after a pause
+    let dt = Math.min(0.1, (now - lastTime) / 1000);
+    lastTime = now;
+
+    forward.subVectors(_this.target, _this.object.position);
+    let distance = forward.length() || 1;
+    forward.normalize();
+    right.crossVectors(forward, _this.object.up).normalize();
+
+    move.set(0, 0, 0);
+    if (_this.enabled) {
+      if (moving.forward) move.add(forward);
+      if (moving.backward) move.sub(forward);
+      if (moving.right) move.add(right);
+      if (moving.left) move.sub(right);
+      if (moving.up) move.add(_this.object.up);
+      if (moving.down) move.sub(_this.object.up);
+      if (move.lengthSq() > 0) {
+        move.normalize().multiplyScalar(_this.movementSpeed * dt *
+                                        (boost ? _this.boostFactor : 1));
+      }
+      move.addScaledVector(forward, wheelDistance);
+    }
+    wheelDistance = 0;
+
+    let changed = move.lengthSq() > 0;
+    if (changed) {
+      _this.object.position.add(move);
+      _this.target.copy(_this.object.position).addScaledVector(forward, distance);
+    }
+    _this.object.lookAt(_this.target);
+    if (changed) {
+      _this.dispatchEvent(changeEvent);
+    }
+  };
+
+  /**
+   * Turns the camera by rotating the target around the camera position.
+   *
+   * @param {number} dx - horizontal mouse movement in pixels
+   * @param {number} dy - vertical mouse movement in pixels
+   */
+  function look(dx, dy) {
+    let offset = new Vector3().subVectors(_this.target, _this.object.position);
+    let up = _this.object.up.clone().normalize();
+    offset.applyAxisAngle(up, -dx * _this.lookSpeed);
+
+    // tilt around the right axis, and keep the camera from turning over the
+    // poles
+    let angle = offset.angleTo(up);
+    let pitch = Math.max(angle - Math.PI + 0.01,
+                         Math.min(angle - 0.01, -dy * _this.lookSpeed));
+    let axis = new Vector3().crossVectors(offset, up).normalize();
+    offset.applyAxisAngle(axis, pitch);
+
+    _this.target.copy(_this.object.position).add(offset);
+    _this.object.lookAt(_this.target);
+    _this.dispatchEvent(changeEvent);
+  }
+
+  function keydown(event) {
+    if (_this.enabled === false || isEditable(event.target)) return;
+    boost = event.shiftKey;
+    if (moveKeys[event.code]) {
+      moving[moveKeys[event.code]] = true;
+      event.preventDefault();
+    }
+  }
+
+  function keyup(event) {
+    boost = event.shiftKey;
+    if (moveKeys[event.code]) {
+      moving[moveKeys[event.code]] = false;
+      if (!Object.values(moving).some(m => m)) {
+        _this.dispatchEvent(endEvent);
+      }
+    }
+  }
+
+  function mousedown(event) {
+    if (_this.enabled === false || event.button !== 0) return;
+    dragging = true;
+    lastPointer = [event.clientX, event.clientY];
+    document.addEventListener('mousemove', mousemove, false);
+    document.addEventListener('mouseup', mouseup, false);
+    _this.dispatchEvent(startEvent);
+  }
+
+  function mousemove(event) {
+    if (_this.enabled === false || !dragging) return;
+    look(event.clientX - lastPointer[0], event.clientY - lastPointer[1]);
+    lastPointer = [event.clientX, event.clientY];
+  }
+
+  function mouseup() {
+    dragging = false;
+    document.removeEventListener('mousemove', mousemove, false);
+    document.removeEventListener('mouseup', mouseup, false);
+    _this.dispatchEvent(endEvent);
+  }
+
+  function wheel(event) {
+    if (_this.enabled === false) return;
+    event.preventDefault();
+    wheelDistance -= Math.sign(event.deltaY) * _this.movementSpeed * 0.1;
+    _this.dispatchEvent(startEvent);
+    _this.dispatchEvent(endEvent);
+  }
+
+  function blur() {
+    moving = {};
+  }
+
+  this.dispose = function() {
+    this.domElement.removeEventListener('mousedown', mousedown, false);
+    this.domElement.removeEventListener('wheel', wheel, false);
+    document.removeEventListener('mousemove', mousemove, false);
+    document.removeEventListener('mouseup', mouseup, false);
+    window.removeEventListener('keydown', keydown, false);
+    window.removeEventListener('keyup', keyup, false);
+    window.removeEventListener('blur', blur, false);
+  };
+
+  this.domElement.addEventListener('mousedown', mousedown, false);
+  this.domElement.addEventListener('wheel', wheel, {passive: false});
+  window.addEventListener('keydown', keydown, false);
+  window.addEventListener('keyup', keyup, false);
+  window.addEventListener('blur', blur, false);
+
+  // start by looking in the current viewing direction
+  this.object.getWorldDirection(forward);
+  this.target.copy(this.object.position).addScaledVector(forward, 100);
+};
+FlyControls.prototype = Object.create(EventDispatcher.prototype);
+FlyControls.prototype.constructor = FlyControls;
+
+export { FlyControls };
@@ -0,0 +1,186 @@
+/**
+ * @file This file contains a small animated GIF encoder for the Metabolic
+ * Atlas 3D Viewer. All frames share one 256 color palette, made from the
+ * most common colors of the frames, which is enough for the flat colors of
+ * the network views, but gives visible banding on smooth gradients.
+ */
+
+/**
+ * Returns the 15 bit color key of a pixel.
+ *
+ * @param {Array} data - RGBA pixel data
+ * @param {number} p - index of the pixel's first byte
+ */
+function colorKey(data, p) {
+  return ((data[p] >> 3) << 10) | ((data[p+1] >> 3) << 5) | (data[p+2] >> 3);
+}
+
+/**
+ * Creates a palette of the most common colors of the frames, and a lookup
+ * table from 15 bit color keys to palette indices.
+ *
+ * @param {Array} frames - the frames as ImageData
+ * @returns {Object} The palette as {colors: [[r, g, b], ...], lookup}.
+ */
+function makePalette(frames) {
+  let counts = new Uint32Array(32768);
+  frames.forEach(frame => {
+    // every fourth pixel is plenty for the color statistics
+    for (let p = 0; p < frame.data.length; p += 16) {
+      counts[colorKey(frame.data, p)]++;
+    }
+  });
+  let keys = [];
+  counts.forEach((count, key) => {
+    if (count > 0) keys.push(key);
+  });
+  keys.sort((a, b) => counts[b] - counts[a]);
+  let colors = keys.slice(0, 256).map(key => [
+    ((key >> 10) << 3) | 4, (((key >> 5) & 31) << 3) | 4, ((key & 31) << 3) | 4
+  ]);
+  if (colors.length == 0) {
+    colors.push([0, 0, 0]);
+  }
+
+  // palette indices of all 15 bit colors, filled in as they are used
+  let lookup = new Int16Array(32768).fill(-1);
+  keys.slice(0, 256).forEach((key, i) => { lookup[key] = i; });
+  return {colors: colors, lookup: lookup};
+}
+
+/**
+ * Returns the index of the palette color closest to a 15 bit color.
+ *
+ * @param {Object} palette - the palette from `makePalette`
+ * @param {number} key - the color key
+ */
+function paletteIndex(palette, key) {
+  if (palette.lookup[key] >= 0) return palette.lookup[key];
+  let r = ((key >> 10) << 3) | 4, g = (((key >> 5) & 31) << 3) | 4, b = ((key & 31) << 3) | 4;
+  let best = 0, bestDistance = Infinity;
+  palette.colors.forEach((c, i) => {
+    let d = (c[0]-r)*(c[0]-r) + (c[1]-g)*(c[1]-g) + (c[2]-b)*(c[2]-b);
+    if (d < bestDistance) {
+      bestDistance = d;
+      best = i;
+    }
+  });
+  palette.lookup[key] = best;
+  return best;
+}
+
+/**
+ * Compresses palette indices with the variable code size LZW of GIF.
+ *
+ * @param {Uint8Array} indices - the palette index of each pixel
+ * @param {number} minCodeSize - the minimum code size
+ * @returns {Array} The compressed bytes.
+ */
+function lzwEncode(indices, minCodeSize) {
+  let clearCode = 1 << minCodeSize;
+  let endCode = clearCode + 1;
+  let codeSize = minCodeSize + 1;
+  let nextCode = endCode + 1;
+  let table = new Map();
+  let bytes = [];
+  let buffer = 0;
+  let bits = 0;
+  const write = code => {
+    buffer |= code << bits;
+    bits += codeSize;
+    while (bits >= 8) {
+      bytes.push(buffer & 255);
+      buffer >>>= 8;
+      bits -= 8;
+    }
+  };
+
+  write(clearCode);
+  let prefix = indices[0];
+  for (let i = 1; i < indices.length; i++) {
+    let key = (prefix << 8) | indices[i];
+    let code = table.get(key);
+    if (code !== undefined) {
+      prefix = code;
+      continue;
+    }
+    write(prefix);
+    if (nextCode == 4096) {
+      // the table is full, start over
+      write(clearCode);
+      table.clear();
+      codeSize = minCodeSize + 1;
+      nextCode = endCode + 1;
+    } else {
+      if (nextCode >= 1 << codeSize) codeSize++;
+      table.set(key, nextCode++);
+    }
+    prefix = indices[i];
+  }
+  write(prefix);
+  write(endCode);
+  if (bits > 0) {
+    bytes.push(buffer & 255);
+  }
+  return bytes;
+}
+
+/**
+ * Encodes frames as an animated GIF, which loops forever.
+ *
+ * @param {Array} frames - the frames as ImageData, all of the same size
+ * @param {number} delay - time between the frames in milliseconds
+ * @returns {Uint8Array} The GIF file.
+ */
+function encodeGIF(frames, delay) {
+  let width = frames[0].width;
+  let height = frames[0].height;
+  let palette = makePalette(frames);
+  let out = [];
+  const word = value => out.push(value & 255, (value >> 8) & 255);
+  const text = string => string.split('').forEach(c => out.push(c.charCodeAt(0)));
+
+  text('GIF89a');
+  word(width);
+  word(height);
+  // global color table of 256 colors, 8 bits per channel
+  out.push(0xF7, 0, 0);
+  for (let i = 0; i < 256; i++) {
+    out.push.apply(out, palette.colors[i] || [0, 0, 0]);
+  }
+  // loop forever
+  out.push(0x21, 0xFF, 11);
+  text('NETSCAPE2.0');
+  out.push(3, 1, 0, 0, 0);
+
+  let indices = new Uint8Array(width * height);
+  frames.forEach(frame => {
+    // graphic control extension with the frame delay in centiseconds
+    out.push(0x21, 0xF9, 4, 0);
+    word(Math.round(delay / 10));
+    out.push(0, 0);
+    // image descriptor covering the whole image
+    out.push(0x2C);
+    word(0);
+    word(0);
+    word(width);
+    word(height);
+    out.push(0);
+
+    for (let i = 0; i < indices.length; i++) {
+      indices[i] = paletteIndex(palette, colorKey(frame.data, i * 4));
+    }
+    let data = lzwEncode(indices, 8);
+    out.push(8);
+    for (let i = 0; i < data.length; i += 255) {
+      let block = data.slice(i, i + 255);
+      out.push(block.length);
+      out.push.apply(out, block);
+    }
+    out.push(0);
+  });
+  out.push(0x3B);
+  return new Uint8Array(out);
+}
+
+export { encodeGIF };
@@ -0,0 +1,128 @@
+/**
+ * @file This file contains the glTF export of the Metabolic Atlas 3D Viewer.
+ * The network is exported as a scene where every node is a named object
+ * sharing one mesh per node shape, and the links are line segments with
+ * vertex colors, so that the file can be opened in e.g. Blender or embedded
+ * in other 3D tools and AR viewers.
+ */
+
+import {
+  BufferGeometry,
+  Color,
+  Float32BufferAttribute,
+  Group,
+  LineBasicMaterial,
+  LineSegments,
+  Mesh,
+  MeshStandardMaterial,
+  Scene,
+} from 'three';
+import { GLTFExporter } from 'three/examples/jsm/exporters/GLTFExporter.js';
+import { shapeGeometry } from './level-of-detail';
+
+/**
+ * Converts an [r, g, b] color with components between 0 and 255 to a
+ * linear three-js color, since glTF colors are linear.
+ *
+ * @param {Array} rgb - the color
+ * @returns {Object} The three-js color.
+ */
+function linearColor(rgb) {
+  return new Color(rgb[0] / 255, rgb[1] / 255, rgb[2] / 255).convertSRGBToLinear();
+}
+
+/**
+ * Builds the scene to export.
+ *
+ * @param {Array} nodes - the nodes, formatted as [{id, pos, color, scale,
+ *     shape}], where color is [r, g, b] and scale multiplies the node radius
+ * @param {Object} links - the link segments, formatted as {positions,
+ *     colors}, flat lists of [x, y, z] positions and [r, g, b] colors of the
+ *     segment end points
+ * @param {object} options - export options with the keys radius (node
+ *     radius at scale 1), detail (number of segments of curved shapes) and
+ *     shapes (the custom node shapes, see `registerShape`)
+ * @returns {Object} The three-js scene.
+ */
+function buildExportScene(nodes, links, options) {
+  let scene = new Scene();
+  scene.name = 'network';
+
+  let geometries = {};
+  let materials = {};
+  let nodeGroup = new Group();
+  nodeGroup.name = 'nodes';
+  nodes.forEach(node => {
+    let shape = node.shape || 'sphere';
+    if (!geometries[shape]) {
+      geometries[shape] = shapeGeometry(shape, options.detail, options.shapes);
+    }
+    let key = node.color.join(',');
+    if (!materials[key]) {
+      materials[key] = new MeshStandardMaterial({color: linearColor(node.color),
+                                                 roughness: 0.6,
+                                                 metalness: 0});
+      materials[key].name = 'node ' + key;
+    }
+    let mesh = new Mesh(geometries[shape], materials[key]);
+    mesh.name = String(node.id);
+    mesh.position.set(node.pos[0], node.pos[1], node.pos[2]);
+    mesh.scale.setScalar(options.radius * node.scale);
+    nodeGroup.add(mesh);
+  });
+  scene.add(nodeGroup);
+
+  if (links.positions.length > 0) {
+    let colors = [];
+    for (let i = 0; i < links.colors.length; i += 3) {
+      let color = linearColor(links.colors.slice(i, i + 3));
+      colors.push(color.r, color.g, color.b);
+    }
+    let geometry = new BufferGeometry();
+    geometry.setAttribute('position', new Float32BufferAttribute(links.positions, 3));
+    geometry.setAttribute('color', new Float32BufferAttribute(colors, 3));
+    let lines = new LineSegments(geometry, new LineBasicMaterial({vertexColors: true}));
+    lines.name = 'links';
+    scene.add(lines);
+  }
+  return scene;
+}
+
+/**
+ * Disposes the geometries and materials of an export scene.
+ *
+ * @param {Object} scene - the scene from `buildExportScene`
+ */
+function disposeExportScene(scene) {
+  let disposed = new Set();
+  scene.traverse(object => {
+    [object.geometry, object.material].forEach(resource => {
+      if (resource && !disposed.has(resource)) {
+        disposed.add(resource);
+        resource.dispose();
+      }
+    });
+  });
+}
+
+/**
+ * Exports a network as glTF.
+ *
+ * @param {Array} nodes - the nodes, see `buildExportScene`
+ * @param {Object} links - the link segments, see `buildExportScene`
+ * @param {object} options - export options with the keys radius, detail,
+ *     shapes and binary (whether to export a GLB file instead of glTF JSON)
+ * @returns {Promise} A promise resolving to the GLB file as an ArrayBuffer,
+ *     or the glTF JSON as an object.
+ */
+function exportNetworkGLTF(nodes, links, options) {
+  let scene = buildExportScene(nodes, links, options);
+  return new Promise(resolve => {
+    new GLTFExporter().parse(scene, result => {
+      disposeExportScene(scene);
+      resolve(result);
+    }, {binary: options.binary, onlyVisible: false});
+  });
+}
+
+export { exportNetworkGLTF };
@@ -0,0 +1,170 @@
+/**
+ * @file This file contains graph algorithms for the Metabolic Atlas 3D
+ * Viewer. The graph is given as an adjacency list, where `adjacency[i]` is the
+ * list of node indices connected to node `i`.
+ */
+
+/**
+ * Finds the shortest path between two nodes, counting every link as one step.
+ *
+ * @param {Array} adjacency - adjacency list of the graph
+ * @param {number} source - index of the start node
+ * @param {number} target - index of the end node
+ * @returns {Array} The node indices of the path from `source` to `target`,
+ *     or an empty list if the nodes aren't connected.
+ */
+function shortestPath(adjacency, source, target) {
+  let previous = new Map([[source, source]]);
+  let queue = [source];
+  for (let q = 0; q < queue.length && !previous.has(target); q++) {
+    adjacency[queue[q]].forEach(neighbor => {
+      if (!previous.has(neighbor)) {
+        previous.set(neighbor, queue[q]);
+        queue.push(neighbor);
+      }
+    });
+  }
+  if (!previous.has(target)) {
+    return [];
+  }
+  let path = [target];
+  while (path[0] != source) {
+    path.unshift(previous.get(path[0]));
+  }
+  return path;
+}
+
+/**
+ * Finds the path with the lowest total weight between two nodes, using
+ * Dijkstra's algorithm.
+ *
+ * @param {Array} edges - edge list of the graph, where `edges[i]` lists the
+ *     edges leaving node i, formatted as [{neighbor: <node index>,
+ *     weight: <non-negative weight>, link: <link index>}, ...]
+ * @param {number} source - index of the start node
+ * @param {number} target - index of the end node
+ * @param {Function} skip - (optional) returns true for nodes that the path
+ *     may not pass through. The source and target are never skipped.
+ * @returns {Object} The path as {nodes: [<node index>], links:
+ *     [<link index>], weight: <total weight>}, or null if there is no path.
+ */
+function lightestPath(edges, source, target, skip = () => false) {
+  let distance = new Map([[source, 0]]);
+  let previous = new Map();
+  let done = new Set();
+  let heap = new MinHeap();
+  heap.push(source, 0);
+
+  while (heap.size() > 0) {
+    let [node, d] = heap.pop();
+    if (done.has(node)) continue;
+    done.add(node);
+    if (node == target) break;
+    if (node != source && skip(node)) continue;
+
+    edges[node].forEach(edge => {
+      let next = d + edge.weight;
+      if (!done.has(edge.neighbor) &&
+          (!distance.has(edge.neighbor) || next < distance.get(edge.neighbor))) {
+        distance.set(edge.neighbor, next);
+        previous.set(edge.neighbor, {node: node, link: edge.link});
+        heap.push(edge.neighbor, next);
+      }
+    });
+  }
+
+  if (!done.has(target)) {
+    return null;
+  }
+  let path = {nodes: [target], links: [], weight: distance.get(target)};
+  while (path.nodes[0] != source) {
+    let step = previous.get(path.nodes[0]);
+    path.nodes.unshift(step.node);
+    path.links.unshift(step.link);
+  }
+  return path;
+}
+
+/**
+ * A binary min-heap of items with priorities.
+ */
+function MinHeap() {
+  let items = [];
+
+  function swap(a, b) {
+    [items[a], items[b]] = [items[b], items[a]];
+  }
+
+  /**
+   * Adds an item with a priority.
+   */
+  function push(item, priority) {
+    items.push([item, priority]);
+    let i = items.length - 1;
+    while (i > 0) {
+      let parent = (i - 1) >> 1;
+      if (items[parent][1] <= items[i][1]) break;
+      swap(i, parent);
+      i = parent;
+    }
+  }
+
+  /**
+   * Removes and returns the item with the lowest priority, as
+   * [item, priority].
+   */
+  function pop() {
+    let top = items[0];
+    let last = items.pop();
+    if (items.length > 0) {
+      items[0] = last;
+      let i = 0;
+      for (;;) {
+        let smallest = i;
+        [2*i + 1, 2*i + 2].forEach(child => {
+          if (child < items.length && items[child][1] < items[smallest][1]) {
+            smallest = child;
+          }
+        });
+        if (smallest == i) break;
+        swap(i, smallest);
+        i = smallest;
+      }
+    }
+    return top;
+  }
+
+  function size() {
+    return items.length;
+  }
+
+  return {pop, push, size};
+}
+
+/**
+ * Finds the connected components of the graph, ignoring link directions.
+ *
+ * @param {Array} adjacency - adjacency list of the graph
+ * @returns {Array} The node indices of each component, largest first.
+ */
+function connectedComponents(adjacency) {
+  let seen = new Uint8Array(adjacency.length);
+  let components = [];
+  for (let start = 0; start < adjacency.length; start++) {
+    if (seen[start]) continue;
+    seen[start] = 1;
+    let component = [start];
+    for (let q = 0; q < component.length; q++) {
+      adjacency[component[q]].forEach(neighbor => {
+        if (!seen[neighbor]) {
+          seen[neighbor] = 1;
+          component.push(neighbor);
+        }
+      });
+    }
+    components.push(component);
+  }
+  return components.sort((a, b) => b.length - a.length || a[0] - b[0]);
+}
+
+export { connectedComponents, lightestPath, shortestPath };
@@ -0,0 +1,334 @@
+/**
+ * @file This file contains the graph building of the Metabolic Atlas 3D
+ * Viewer: the node and link vertex buffers, and the link curves and
+ * arrowheads. The build doesn't touch the DOM or three-js, so that it can
+ * run in a web worker, which parses and builds large models without
+ * freezing the page, and hands the buffers back without copying them.
+ */
+
+import { bezier, cross, dashSegments, linkPoints, norm } from './helpers';
+
+/**
+ * Returns the position and direction of an arrowhead at the end of a link
+ * given by `points`, backed off by `offset` from the end node.
+ *
+ * @param {Array} points - the points of the link as [[x, y, z], ...]
+ * @param {number} offset - distance from the node center to the arrow tip
+ * @returns {Object} Arrowhead formatted as {tip, dir}
+ */
+function arrowTip(points, offset) {
+  let end = points[points.length-1];
+  let prev = points[points.length-2];
+  let dir = [end[0]-prev[0], end[1]-prev[1], end[2]-prev[2]];
+  let l = Math.sqrt(dir[0]*dir[0] + dir[1]*dir[1] + dir[2]*dir[2]) || 1;
+  dir = dir.map(v => v/l);
+  return {tip: end.map((v, k) => v - dir[k]*offset),
+          dir: dir};
+}
+
+/**
+ * Splits the nodes into loading chunks by degree, so that the high-degree
+ * backbone of the network is shown first. Each link belongs to the chunk of
+ * its later node, and the links are sorted by chunk (in place), so that the
+ * links of the first chunks come first in the vertex buffers.
+ *
+ * @param {Array} nodes - the nodes
+ * @param {Array} links - the links
+ * @param {number} chunks - the number of chunks
+ * @returns {Object} The chunk of each node, by node ID.
+ */
+function chunkGraph(nodes, links, chunks) {
+  let degree = {};
+  links.forEach(link => {
+    degree[link.s] = (degree[link.s] || 0) + 1;
+    degree[link.t] = (degree[link.t] || 0) + 1;
+  });
+  let chunkOf = {};
+  nodes.map(node => node.id)
+    .sort((a, b) => (degree[b] || 0) - (degree[a] || 0))
+    .forEach((id, rank) => {
+      chunkOf[id] = Math.floor(rank * chunks / nodes.length);
+    });
+  const linkChunk = link => Math.max(chunkOf[link.s] || 0, chunkOf[link.t] || 0);
+  // sort by chunk, keeping the link order within each chunk
+  let sorted = links.map((link, i) => [linkChunk(link), i, link])
+    .sort((a, b) => a[0] - b[0] || a[1] - b[1]);
+  sorted.forEach((entry, i) => { links[i] = entry[2]; });
+  return chunkOf;
+}
+
+/**
+ * Builds the vertex buffers of a graph. The nodes are sorted by group (in
+ * place), so that each group can have its own material.
+ *
+ * @param {object} graphData - graph data formatted like {nodes:[], links: []},
+ *     see `setData` of the viewer
+ * @param {object} options - build options with the keys nodeSize,
+ *     defaultColor (color of nodes without a color), linkStyle,
+ *     arrowStyle (see `setLinkStyle` and `setArrowStyle` of the viewer) and
+ *     (optional) chunks, the number of chunks to split the graph into for
+ *     progressive loading, see `chunkGraph`
+ * @returns {Object} The graph formatted as {nodes, links, groupCounts,
+ *     positions, colors, indexColors, linkRecords, linePositions}, where
+ *     groupCounts is the number of nodes in each group, positions and colors
+ *     the node vertex buffers, indexColors the picking colors of the nodes,
+ *     linePositions the link vertex buffer and linkRecords the valid links,
+ *     formatted as [{link, start, count, reversible, arrow, startArrow}],
+ *     where link is the index of the link in `links`, start and count the
+ *     first vertex and number of vertices of the link, and arrow and
+ *     startArrow the arrowheads at its ends, formatted as {tip, dir}. If the
+ *     graph is split into chunks, it also has the keys nodeChunks, the chunk
+ *     of each node, and linkChunkEnds, the number of link records up to the
+ *     end of each chunk.
+ */
+function buildGraph(graphData, options) {
+  let nodes = graphData.nodes;
+  let links = graphData.links;
+  let linkStyle = options.linkStyle;
+  let arrowStyle = options.arrowStyle;
+
+  nodes.sort((a,b) => a.g.localeCompare(b.g));
+  let chunks = options.chunks > 1 ? options.chunks : 1;
+  let chunkOf = chunks > 1 ? chunkGraph(nodes, links, chunks) : undefined;
+
+  let positions = new Float32Array(nodes.length * 3);
+  let colors = new Uint8Array(nodes.length * 3);
+  let indexColors = new Uint8Array(nodes.length * 3);
+  let groupCounts = {};
+  let nodeIndex = {};
+  nodes.forEach((node, i) => {
+    positions.set(node.pos, i * 3);
+    colors.set(node.color ? node.color : options.defaultColor, i * 3);
+    // a unique color for each node, used for picking nodes in the scene
+    indexColors.set([Math.floor(i/(256*256)), Math.floor(i/256) % 256, i % 256], i * 3);
+    groupCounts[node.g] = (groupCounts[node.g] || 0) + 1;
+    nodeIndex[node.id] = i;
+  });
+
+  let linePositions = [];
+  let linkRecords = [];
+  // Count parallel links so that they can be curved apart
+  let parallelLinks = {};
+  links.forEach((link, i) => {
+    // Check the the nodes are in the graph
+    if (!(link.s in nodeIndex)) {
+      console.warn("ignoring link: '" + link.s + "' to '" + link.t +
+                   ". The start node is not in the node list.");
+      return;
+    }
+    if (!(link.t in nodeIndex)) {
+      console.warn("ignoring link: '" + link.s + "' to '" + link.t +
+                   ". The end node is not in the node list.");
+      return;
+    }
+    // Links are always curved in the direction of the lowest to the highest
+    // node index, and every parallel link is curved further out, on
+    // alternating sides. Parallel links are bent even if the link style is
+    // straight, unless the link sets its own curvature.
+    let start = nodeIndex[link.s];
+    let end = nodeIndex[link.t];
+    let key = Math.min(start, end) + ':' + Math.max(start, end);
+    let parallel = parallelLinks[key] || 0;
+    parallelLinks[key] = parallel + 1;
+
+    let curvature = link.curvature !== undefined ? link.curvature : linkStyle.curvature;
+    if (parallel > 0 && !curvature && link.curvature === undefined) {
+      curvature = 0.1;
+    }
+    curvature *= (parallel % 2 == 0 ? 1 : -1) * (1 + Math.floor(parallel / 2));
+    if (start > end) {
+      curvature = -curvature;
+    }
+
+    let points = linkPoints(nodes[start].pos, nodes[end].pos, curvature,
+                            linkStyle.segments, linkStyle.cubic);
+
+    let reversible = !!link.reversible;
+    let dashed = reversible && ['dashed', 'both'].includes(linkStyle.reversible);
+    let segments = [];
+    if (dashed) {
+      segments = dashSegments(points, linkStyle.dashes);
+    } else {
+      for (let p = 0; p < points.length - 1; p++) {
+        segments.push([points[p], points[p+1]]);
+      }
+    }
+
+    let record = {link: i,
+                  start: linePositions.length / 3,
+                  count: segments.length * 2,
+                  reversible: reversible};
+    segments.forEach(segment => {
+      linePositions.push.apply(linePositions, segment[0]);
+      linePositions.push.apply(linePositions, segment[1]);
+    });
+    if (arrowStyle.show && arrowStyle.types[link.type] !== false) {
+      record.arrow = arrowTip(points, options.nodeSize/2);
+      if (reversible && ['arrows', 'both'].includes(linkStyle.reversible)) {
+        record.startArrow = arrowTip(points.slice().reverse(), options.nodeSize/2);
+      }
+    }
+    linkRecords.push(record);
+  });
+
+  let graph = {nodes: nodes,
+               links: links,
+               groupCounts: groupCounts,
+               positions: positions,
+               colors: colors,
+               indexColors: indexColors,
+               linkRecords: linkRecords,
+               linePositions: new Float32Array(linePositions)};
+  if (chunkOf) {
+    graph.nodeChunks = nodes.map(node => chunkOf[node.id]);
+    graph.linkChunkEnds = new Array(chunks).fill(0);
+    linkRecords.forEach(record => {
+      let link = links[record.link];
+      let chunk = Math.max(chunkOf[link.s], chunkOf[link.t]);
+      for (let k = chunk; k < chunks; k++) {
+        graph.linkChunkEnds[k]++;
+      }
+    });
+  }
+  return graph;
+}
+
+/**
+ * Parses graph data in the worker. The source is fetched if it's a URL, and
+ * parsed if it's JSON text or UTF-8 encoded JSON in an ArrayBuffer.
+ *
+ * @param {string|ArrayBuffer|Object} source - the graph data
+ * @param {Function} onProgress - (optional) called with the progress,
+ *     formatted as {phase, loaded, total}, where the phase is 'download'
+ *     while fetching (loaded and total in bytes, total is 0 if unknown) and
+ *     'build' after parsing
+ * @returns {Promise} A promise resolving to the graph data object.
+ */
+async function parseGraphData(source, onProgress = () => {}) {
+  if (source instanceof ArrayBuffer) {
+    source = new TextDecoder().decode(source);
+  }
+  if (typeof source != 'string') {
+    return source;
+  }
+  if (/^\s*[{[]/.test(source)) {
+    return JSON.parse(source);
+  }
+  let response = await fetch(source);
+  if (!response.ok) {
+    throw new Error('could not load ' + source + ': ' + response.status);
+  }
+  let total = Number(response.headers.get('Content-Length')) || 0;
+  if (!response.body || !response.body.getReader) {
+    let graphData = await response.json();
+    onProgress({phase: 'build', loaded: 0, total: 1});
+    return graphData;
+  }
+  // read the body in parts, to report the download progress
+  let reader = response.body.getReader();
+  let parts = [];
+  let loaded = 0;
+  for (;;) {
+    let {done, value} = await reader.read();
+    if (done) break;
+    parts.push(value);
+    loaded += value.length;
+    onProgress({phase: 'download', loaded: loaded, total: total});
+  }
+  let bytes = new Uint8Array(loaded);
+  let offset = 0;
+  parts.forEach(part => {
+    bytes.set(part, offset);
+    offset += part.length;
+  });
+  let graphData = JSON.parse(new TextDecoder().decode(bytes));
+  onProgress({phase: 'build', loaded: 0, total: 1});
+  return graphData;
+}
+
+/**
+ * Handles a build request in the worker, and posts the graph back with the
+ * vertex buffers transferred instead of copied.
+ *
+ * @param {Object} event - the message event, with the data {source, options}
+ */
+async function onBuildMessage(event) {
+  try {
+    let graphData = await parseGraphData(event.data.source,
+                                         progress => self.postMessage({progress: progress}));
+    let graph = buildGraph(graphData, event.data.options);
+    self.postMessage({graph: graph}, [graph.positions.buffer,
+                                      graph.colors.buffer,
+                                      graph.indexColors.buffer,
+                                      graph.linePositions.buffer]);
+  } catch (error) {
+    self.postMessage({error: error.message});
+  }
+}
+
+/**
+ * Returns the source code of the worker. The worker is made from the source
+ * of the functions themselves, so that it works without a separate file in
+ * the bundle, and the names are taken at runtime, as the bundle may be
+ * minified.
+ */
+function workerSource() {
+  return [arrowTip, bezier, buildGraph, chunkGraph, cross, dashSegments, linkPoints,
+          norm, parseGraphData, onBuildMessage].map(String).join('\n') +
+    '\nself.onmessage = ' + onBuildMessage.name + ';\n';
+}
+
+/**
+ * Parses and builds a graph in a web worker. Falls back to building on the
+ * main thread if workers aren't available, e.g. when a content security
+ * policy doesn't allow them.
+ *
+ * @param {string|ArrayBuffer|Object} source - the graph data, as a URL,
+ *     JSON text, UTF-8 encoded JSON or a graph data object
+ * @param {object} options - build options, see `buildGraph`
+ * @param {Function} onProgress - (optional) called with the loading
+ *     progress, see `parseGraphData`
+ * @returns {Promise} A promise resolving to the graph, see `buildGraph`.
+ */
+function buildGraphInWorker(source, options, onProgress = () => {}) {
+  // resolve relative URLs against the page, as the worker has a blob URL
+  if (typeof source == 'string' && !/^\s*[{[]/.test(source)) {
+    source = new URL(source, document.baseURI).href;
+  }
+  let worker;
+  let url;
+  try {
+    url = URL.createObjectURL(new Blob([workerSource()], {type: 'text/javascript'}));
+    worker = new Worker(url);
+  } catch (error) {
+    if (url) URL.revokeObjectURL(url);
+    console.warn('could not start a worker, building the graph on the main thread: ' +
+                 error.message);
+    return parseGraphData(source, onProgress).then(graphData => buildGraph(graphData, options));
+  }
+  return new Promise((resolve, reject) => {
+    const finish = () => {
+      worker.terminate();
+      URL.revokeObjectURL(url);
+    };
+    worker.onmessage = event => {
+      if (event.data.progress) {
+        onProgress(event.data.progress);
+        return;
+      }
+      finish();
+      if (event.data.error) {
+        reject(new Error(event.data.error));
+      } else {
+        resolve(event.data.graph);
+      }
+    };
+    worker.onerror = event => {
+      finish();
+      reject(new Error(event.message));
+    };
+    worker.postMessage({source: source, options: options});
+  });
+}
+
+export { buildGraph, buildGraphInWorker };
@@ -38,4 +38,222 @@ function makeIndexSprite(baseSprite) {
   return canvas.toDataURL();
 }
 
-export { makeIndexSprite };
+/**
+ * Returns how much of a sprite is covered by the largest opaque square
+ * around its center, as the half side of the square relative to half the
+ * sprite size. A disc covers about 0.7, and shapes with transparent corners
+ * like triangles less. Used to size the nodes hiding others in occlusion
+ * culling.
+ *
+ * @param {Object} baseSprite - the sprite texture
+ * @returns {number} The coverage, from 0 to 1.
+ */
+function spriteCoverage(baseSprite) {
+  let width = baseSprite.image.width;
+  let height = baseSprite.image.height;
+  let canvas = document.createElement("canvas");
+  canvas.width = width;
+  canvas.height = height;
+  let ctx = canvas.getContext("2d");
+  ctx.drawImage(baseSprite.image, 0, 0);
+  let data = ctx.getImageData(0, 0, width, height).data;
+  const opaque = (x, y) => data[(y * width + x) * 4 + 3] > 128;
+
+  // grow the square one ring of pixels at a time, until a ring has a
+  // transparent pixel
+  let size = Math.min(width, height) / 2;
+  let half = 1;
+  for (; half <= size; half++) {
+    let x0 = Math.max(0, Math.floor(width / 2 - half));
+    let x1 = Math.min(width - 1, Math.ceil(width / 2 + half) - 1);
+    let y0 = Math.max(0, Math.floor(height / 2 - half));
+    let y1 = Math.min(height - 1, Math.ceil(height / 2 + half) - 1);
+    let ring = true;
+    for (let x = x0; x <= x1 && ring; x++) {
+      ring = opaque(x, y0) && opaque(x, y1);
+    }
+    for (let y = y0; y <= y1 && ring; y++) {
+      ring = opaque(x0, y) && opaque(x1, y);
+    }
+    if (!ring) break;
+  }
+  return size > 0 ? (half - 1) / size : 0;
+}
+
+/**
+ * Creates a white disc sprite with a darker ring, for nodes which have no
+ * sprite of their own, such as metanodes. The sprite is tinted by the node
+ * colors like other sprites.
+ *
+ * @param {number} size - (optional) the sprite size in pixels (default 64)
+ * @returns {string} The data url to the sprite.
+ */
+function makeDiscSprite(size = 64) {
+  let canvas = document.createElement("canvas");
+  canvas.width = size;
+  canvas.height = size;
+  let ctx = canvas.getContext("2d");
+  ctx.fillStyle = '#ffffff';
+  ctx.beginPath();
+  ctx.arc(size / 2, size / 2, size / 2, 0, Math.PI * 2);
+  ctx.fill();
+  ctx.strokeStyle = '#a0a0a0';
+  ctx.lineWidth = size / 10;
+  ctx.beginPath();
+  ctx.arc(size / 2, size / 2, size * 0.35, 0, Math.PI * 2);
+  ctx.stroke();
+  return canvas.toDataURL();
+}
+
+/**
+ * Calculates the points along a link between `start` and `end`. If
+ * `curvature` is 0 the link is a straight line, otherwise the link is drawn as
+ * a quadratic (or cubic) bezier curve, bent sideways by `curvature` times the
+ * length of the link.
+ *
+ * @param {Array} start - start position as [x, y, z]
+ * @param {Array} end - end position as [x, y, z]
+ * @param {number} curvature - relative curvature of the link
+ * @param {number} segments - number of line segments to use for curves
+ * @param {boolean} cubic - use a cubic instead of a quadratic curve
+ * @returns {Array} A list of points formatted as [[x, y, z], ...]
+ */
+function linkPoints(start, end, curvature = 0, segments = 12, cubic = false) {
+  if (!curvature || segments < 2) {
+    return [start, end];
+  }
+
+  let d = [end[0]-start[0], end[1]-start[1], end[2]-start[2]];
+  let length = Math.sqrt(d[0]*d[0] + d[1]*d[1] + d[2]*d[2]);
+  if (length == 0) {
+    return [start, end];
+  }
+  let mid = [(start[0]+end[0])/2, (start[1]+end[1])/2, (start[2]+end[2])/2];
+
+  // bend the link perpendicular to both the link and the vector from the
+  // origin to the link midpoint, so that links curve around the graph rather
+  // than in towards the center. Fall back to the y-axis for radial links.
+  let normal = cross(d, mid);
+  if (norm(normal) < 1e-6 * length) {
+    normal = cross(d, [0, 1, 0]);
+    if (norm(normal) < 1e-6 * length) {
+      normal = cross(d, [1, 0, 0]);
+    }
+  }
+  let n = norm(normal);
+  let offset = normal.map(v => v / n * curvature * length);
+
+  let controls;
+  if (cubic) {
+    controls = [
+      start,
+      [0, 1, 2].map(k => start[k] + d[k]/4 + offset[k]),
+      [0, 1, 2].map(k => start[k] + d[k]*3/4 + offset[k]),
+      end
+    ];
+  } else {
+    controls = [start, [0, 1, 2].map(k => mid[k] + offset[k]), end];
+  }
+
+  let points = [];
+  for (let i = 0; i <= segments; i++) {
+    points.push(bezier(controls, i / segments));
+  }
+  return points;
+}
+
+/**
+ * Evaluates a bezier curve given by `controls` at `t` using de Casteljau's
+ * algorithm.
+ *
+ * @param {Array} controls - control points as [[x, y, z], ...]
+ * @param {number} t - curve parameter in [0, 1]
+ * @returns {Array} The point as [x, y, z]
+ */
+function bezier(controls, t) {
+  let points = controls;
+  while (points.length > 1) {
+    let next = [];
+    for (let i = 0; i < points.length - 1; i++) {
+      next.push([0, 1, 2].map(k => points[i][k] + (points[i+1][k]-points[i][k])*t));
+    }
+    points = next;
+  }
+  return points[0];
+}
+
+/**
+ * Splits a line, given by a list of points, into `dashes` dashes of equal
+ * length with equally long gaps in between.
+ *
+ * @param {Array} points - the points of the line as [[x, y, z], ...]
+ * @param {number} dashes - the number of dashes
+ * @returns {Array} A list of line segments formatted as [[start, end], ...]
+ */
+function dashSegments(points, dashes) {
+  let distances = [0];
+  for (let i = 1; i < points.length; i++) {
+    let d = points[i].map((v, k) => v - points[i-1][k]);
+    distances.push(distances[i-1] + norm(d));
+  }
+  let total = distances[distances.length-1];
+  let dashLength = total / (2*dashes - 1);
+
+  // returns the point at distance `at` along the line
+  function pointAt(at) {
+    let i = 1;
+    while (i < points.length - 1 && distances[i] < at) {
+      i++;
+    }
+    let span = distances[i] - distances[i-1];
+    let t = span > 0 ? (at - distances[i-1]) / span : 0;
+    return points[i].map((v, k) => points[i-1][k] + (v - points[i-1][k]) * t);
+  }
+
+  let segments = [];
+  for (let i = 0; i < dashes; i++) {
+    segments.push([pointAt(2*i*dashLength), pointAt((2*i+1)*dashLength)]);
+  }
+  return segments;
+}
+
+/**
+ * Easing functions, mapping the progress of an animation in [0, 1] to the
+ * eased progress.
+ */
+const easings = {
+  linear: t => t,
+  easeIn: t => t * t * t,
+  easeOut: t => 1 - Math.pow(1 - t, 3),
+  easeInOut: t => t < 0.5 ? 4 * t * t * t : 1 - Math.pow(-2 * t + 2, 3) / 2,
+};
+
+/**
+ * Applies an easing to the progress of an animation.
+ *
+ * @param {string|Function} easing - name of an easing in `easings`, or an
+ *     easing function
+ * @param {number} t - the progress, between 0 and 1
+ * @returns {number} The eased progress.
+ */
+function ease(easing, t) {
+  let f = typeof easing === 'function' ? easing : easings[easing];
+  if (!f) {
+    console.warn("unknown easing: '" + easing + "', using 'easeInOut'.");
+    f = easings.easeInOut;
+  }
+  return f(Math.min(1, Math.max(0, t)));
+}
+
+function cross(a, b) {
+  return [a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]];
+}
+
+function norm(a) {
+  return Math.sqrt(a[0]*a[0] + a[1]*a[1] + a[2]*a[2]);
+}
+
+export {
+  bezier, cross, dashSegments, ease, linkPoints, makeDiscSprite, makeIndexSprite, norm,
+  spriteCoverage
+};
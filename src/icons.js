@@ -0,0 +1,84 @@
+/**
+ * @file This file contains functions for drawing node icons from a texture
+ * atlas in the Metabolic Atlas 3D Viewer.
+ */
+
+import {
+  BufferGeometry,
+  Float32BufferAttribute,
+  Points,
+  ShaderMaterial,
+  Vector2,
+} from 'three';
+
+const iconVertexShader = `
+  attribute vec2 iconCell;
+  uniform float size;
+  uniform float scale;
+  varying vec2 vCell;
+
+  void main() {
+    vCell = iconCell;
+    vec4 mvPosition = modelViewMatrix * vec4( position, 1.0 );
+    gl_PointSize = size * ( scale / - mvPosition.z );
+    gl_Position = projectionMatrix * mvPosition;
+  }
+`;
+
+const iconFragmentShader = `
+  uniform sampler2D atlas;
+  uniform vec2 grid;
+  varying vec2 vCell;
+
+  void main() {
+    vec2 uv = vec2( gl_PointCoord.x, 1.0 - gl_PointCoord.y );
+    vec4 color = texture2D( atlas, ( vCell + uv ) / grid );
+    if ( color.a < 0.5 ) discard;
+    gl_FragColor = color;
+  }
+`;
+
+/**
+ * Creates a points mesh which draws an icon from a texture atlas at each
+ * given position. The atlas is a grid of equally sized icons, numbered from
+ * left to right and top to bottom.
+ *
+ * @param {Array} icons - icons formatted as [{pos: [x, y, z], cell: <icon
+ *     index in the atlas>}, ...]
+ * @param {Object} atlas - three-js texture with the icon atlas
+ * @param {number} columns - number of icon columns in the atlas
+ * @param {number} rows - number of icon rows in the atlas
+ * @param {number} size - icon size in graph coordinates
+ * @returns {Object} A three-js Points object.
+ */
+function makeIconMesh(icons, atlas, columns, rows, size) {
+  let positions = [];
+  let cells = [];
+  icons.forEach(icon => {
+    positions.push.apply(positions, icon.pos);
+    // texture coordinates start in the bottom left corner
+    cells.push(icon.cell % columns, rows - 1 - Math.floor(icon.cell / columns));
+  });
+
+  let geometry = new BufferGeometry();
+  geometry.setAttribute('position', new Float32BufferAttribute(positions, 3));
+  geometry.setAttribute('iconCell', new Float32BufferAttribute(cells, 2));
+  geometry.computeBoundingSphere();
+
+  let material = new ShaderMaterial({
+    uniforms: {
+      atlas: {value: atlas},
+      grid: {value: new Vector2(columns, rows)},
+      size: {value: size},
+      scale: {value: 1}
+    },
+    vertexShader: iconVertexShader,
+    fragmentShader: iconFragmentShader,
+    transparent: true,
+    depthTest: true
+  });
+
+  return new Points(geometry, material);
+}
+
+export { makeIconMesh };
@@ -0,0 +1,182 @@
+/**
+ * @file This file contains the overlays which can be burned into images
+ * exported from the Metabolic Atlas 3D Viewer, so that figures are
+ * self-contained: the annotation callouts, which are html elements on
+ * screen, and an orientation gizmo with the axes and a scale bar. The
+ * overlays are drawn on a 2D canvas context in CSS pixels, and the caller
+ * scales the context to the image resolution.
+ */
+
+import { Vector3 } from 'three';
+
+import { formatTick } from './legend';
+
+const margin = 10;
+const calloutFont = '12px sans-serif';
+const calloutLineHeight = 15;
+const calloutMaxWidth = 200;
+const axisLength = 28;
+const scaleBarLength = 80;
+
+/**
+ * Returns the position of a box in a corner of the image.
+ *
+ * @param {Object} size - the image size in CSS pixels, as {width, height}
+ * @param {Object} box - the box size, as {width, height}
+ * @param {string} corner - 'top-left', 'top-right', 'bottom-left' or
+ *     'bottom-right'
+ * @returns {Array} The top left corner of the box as [x, y].
+ */
+function cornerPosition(size, box, corner) {
+  let [vertical, horizontal] = corner.split('-');
+  return [horizontal == 'left' ? margin : size.width - box.width - margin,
+          vertical == 'top' ? margin : size.height - box.height - margin];
+}
+
+/**
+ * Splits a text into lines which fit a width, at spaces and line breaks.
+ *
+ * @param {Object} ctx - the canvas context, with the font set
+ * @param {string} text - the text
+ * @param {number} width - the maximum line width
+ * @returns {Array} The lines.
+ */
+function wrapText(ctx, text, width) {
+  let lines = [];
+  text.split('\n').forEach(paragraph => {
+    let line = '';
+    paragraph.split(' ').forEach(word => {
+      let longer = line ? line + ' ' + word : word;
+      if (line && ctx.measureText(longer).width > width) {
+        lines.push(line);
+        line = word;
+      } else {
+        line = longer;
+      }
+    });
+    lines.push(line);
+  });
+  return lines;
+}
+
+/**
+ * Draws annotation callouts like they are shown over the canvas: a dot on
+ * the node or link, a leader line, and the note centered at the callout
+ * offset.
+ *
+ * @param {Object} ctx - the canvas context
+ * @param {Array} callouts - the annotations, each with the extra key anchor,
+ *     the position of its node or link as [x, y]
+ */
+function drawCallouts(ctx, callouts) {
+  ctx.save();
+  ctx.font = calloutFont;
+  ctx.textBaseline = 'middle';
+  ctx.textAlign = 'left';
+  ctx.lineWidth = 1.5;
+  callouts.forEach(callout => {
+    let [x, y] = callout.anchor;
+    let cx = x + callout.offset[0];
+    let cy = y + callout.offset[1];
+    ctx.strokeStyle = callout.color;
+    ctx.fillStyle = callout.color;
+    ctx.beginPath();
+    ctx.moveTo(x, y);
+    ctx.lineTo(cx, cy);
+    ctx.stroke();
+    ctx.beginPath();
+    ctx.arc(x, y, 3, 0, Math.PI * 2);
+    ctx.fill();
+
+    let lines = wrapText(ctx, callout.text, calloutMaxWidth - 16);
+    let width = Math.max(...lines.map(line => ctx.measureText(line).width)) + 16;
+    let height = lines.length * calloutLineHeight + 8;
+    let left = cx - width / 2;
+    let top = cy - height / 2;
+    ctx.fillStyle = 'rgba(255,255,255,0.9)';
+    ctx.fillRect(left, top, width, height);
+    ctx.lineWidth = 1;
+    ctx.strokeRect(left + 0.5, top + 0.5, width - 1, height - 1);
+    ctx.lineWidth = 1.5;
+    ctx.fillStyle = '#000000';
+    lines.forEach((line, k) => {
+      ctx.fillText(line, left + 8, top + 4 + (k + 0.5) * calloutLineHeight);
+    });
+  });
+  ctx.restore();
+}
+
+/**
+ * Returns a round scale bar length, 1, 2 or 5 times a power of ten, at most
+ * `max` graph units.
+ *
+ * @param {number} max - the maximum length
+ * @returns {number} The length.
+ */
+function roundLength(max) {
+  let power = Math.pow(10, Math.floor(Math.log10(max)));
+  let mantissa = max / power;
+  return (mantissa >= 5 ? 5 : mantissa >= 2 ? 2 : 1) * power;
+}
+
+/**
+ * Draws the orientation gizmo: the x, y and z axes as seen from the camera,
+ * and a scale bar. With a perspective camera the scale depends on the
+ * depth, so the scale bar holds at the distance of the camera target.
+ *
+ * @param {Object} ctx - the canvas context
+ * @param {Object} camera - the camera
+ * @param {number} distance - the distance from the camera to its target
+ * @param {Object} size - the image size in CSS pixels, as {width, height}
+ * @param {object} options - gizmo options with the keys corner, unit (the
+ *     name of the graph units, default ''), color, background and font
+ */
+function drawGizmo(ctx, camera, distance, size, options) {
+  let box = {width: scaleBarLength + 20, height: axisLength * 2 + 44};
+  let [left, top] = cornerPosition(size, box, options.corner);
+  ctx.save();
+  if (options.background) {
+    ctx.fillStyle = options.background;
+    ctx.fillRect(left, top, box.width, box.height);
+  }
+  ctx.font = options.font;
+  ctx.textAlign = 'center';
+  ctx.textBaseline = 'middle';
+  ctx.lineWidth = 2;
+
+  // the axes in camera space, drawn back to front
+  let center = [left + box.width / 2, top + axisLength + 8];
+  let inverse = camera.quaternion.clone().invert();
+  let axes = [['x', [1, 0, 0], '#e53935'],
+              ['y', [0, 1, 0], '#43a047'],
+              ['z', [0, 0, 1], '#1e88e5']]
+    .map(([name, axis, color]) => [name, new Vector3(...axis).applyQuaternion(inverse), color])
+    .sort((a, b) => a[1].z - b[1].z);
+  axes.forEach(([name, v, color]) => {
+    ctx.strokeStyle = color;
+    ctx.fillStyle = color;
+    ctx.beginPath();
+    ctx.moveTo(center[0], center[1]);
+    ctx.lineTo(center[0] + v.x * axisLength, center[1] - v.y * axisLength);
+    ctx.stroke();
+    ctx.fillText(name, center[0] + v.x * (axisLength + 7), center[1] - v.y * (axisLength + 7));
+  });
+
+  let unitsPerPixel = 2 * distance * Math.tan(camera.fov * Math.PI / 360) / size.height;
+  let length = roundLength(scaleBarLength * unitsPerPixel);
+  let pixels = length / unitsPerPixel;
+  let y = top + box.height - 22;
+  ctx.strokeStyle = options.color;
+  ctx.fillStyle = options.color;
+  ctx.beginPath();
+  ctx.moveTo(center[0] - pixels / 2, y - 4);
+  ctx.lineTo(center[0] - pixels / 2, y);
+  ctx.lineTo(center[0] + pixels / 2, y);
+  ctx.lineTo(center[0] + pixels / 2, y - 4);
+  ctx.stroke();
+  ctx.fillText(formatTick(length) + (options.unit ? ' ' + options.unit : ''),
+               center[0], y + 11);
+  ctx.restore();
+}
+
+export { cornerPosition, drawCallouts, drawGizmo };
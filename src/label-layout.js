@@ -0,0 +1,68 @@
+/**
+ * @file This file contains the screen-space label layout for the Metabolic
+ * Atlas 3D Viewer, which hides or nudges overlapping labels.
+ */
+
+/**
+ * Places labels on screen in priority order. A label that overlaps an already
+ * placed label is nudged up or down by up to `maxNudge` label heights, and is
+ * hidden if no free position is found.
+ *
+ * @param {Array} labels - labels formatted as [{id: <id>, x: <center x>,
+ *     y: <center y>, width: <width>, height: <height>,
+ *     priority: <priority>}, ...], with coordinates in pixels.
+ * @param {number} maxNudge - (optional) maximum number of label heights to
+ *     nudge labels by.
+ * @returns {Object} An object mapping the id of each placed label to its
+ *     vertical nudge in pixels. Hidden labels are not included.
+ */
+function layoutLabels(labels, maxNudge = 1) {
+  // Placed boxes are kept in a coarse grid so that only nearby boxes need to
+  // be tested for overlaps.
+  const cell = 64;
+  let grid = {};
+  let placed = {};
+
+  function cells(box) {
+    let keys = [];
+    for (let x = Math.floor(box.x0 / cell); x <= Math.floor(box.x1 / cell); x++) {
+      for (let y = Math.floor(box.y0 / cell); y <= Math.floor(box.y1 / cell); y++) {
+        keys.push(x + ':' + y);
+      }
+    }
+    return keys;
+  }
+
+  function overlaps(box) {
+    return cells(box).some(key => (grid[key] || []).some(other =>
+      box.x0 < other.x1 && box.x1 > other.x0 && box.y0 < other.y1 && box.y1 > other.y0
+    ));
+  }
+
+  // try the original position first, then alternate up and down
+  let nudges = [0];
+  for (let n = 1; n <= maxNudge; n++) {
+    nudges.push(-n, n);
+  }
+
+  labels.slice().sort((a,b) => b.priority - a.priority).forEach(label => {
+    for (let n of nudges) {
+      let dy = n * label.height;
+      let box = {x0: label.x - label.width/2,
+                 x1: label.x + label.width/2,
+                 y0: label.y - label.height/2 + dy,
+                 y1: label.y + label.height/2 + dy};
+      if (!overlaps(box)) {
+        cells(box).forEach(key => {
+          (grid[key] = grid[key] || []).push(box);
+        });
+        placed[label.id] = dy;
+        return;
+      }
+    }
+  });
+
+  return placed;
+}
+
+export { layoutLabels };
@@ -0,0 +1,133 @@
+/**
+ * @file This file contains the color legends of the Metabolic Atlas 3D
+ * Viewer. Legends are drawn on canvases, which the host page can place
+ * anywhere, or draw onto its own canvases. A legend is described as either:
+ *
+ *   {type: 'continuous', title, position, output, ticks}
+ *
+ * where position maps values to [0, 1], output maps [0, 1] to [r, g, b]
+ * colors and ticks is the list of values to label, or:
+ *
+ *   {type: 'categorical', title, entries: [{label, color}, ...]}
+ *
+ * or, for encodings by color and line width like the flux overlay:
+ *
+ *   {type: 'flux', title, entries: [{label, color}, ...],
+ *    widths: [{value, width}, ...]}
+ *
+ * where widths are the line widths in pixels of a few values.
+ */
+
+const barHeight = 12;
+const tickLength = 4;
+const lineHeight = 16;
+const padding = 6;
+
+/**
+ * Formats a tick value with at most three significant digits.
+ *
+ * @param {number} value - the value
+ * @returns {string} The label.
+ */
+function formatTick(value) {
+  let magnitude = Math.abs(value);
+  if (magnitude != 0 && (magnitude >= 1e5 || magnitude < 1e-3)) {
+    return value.toExponential(1).replace('e+', 'e');
+  }
+  return String(Number(value.toPrecision(3)));
+}
+
+/**
+ * Draws a legend on a canvas, resizing the canvas to fit. The canvas is
+ * hidden if there is no legend.
+ *
+ * @param {Object} canvas - the canvas element
+ * @param {Object} legend - the legend description, or undefined
+ * @param {object} options - drawing options with the keys width (in CSS
+ *     pixels), color (text color), background (CSS color or null), font and
+ *     ratio (canvas pixels per CSS pixel, default the device pixel ratio)
+ */
+function drawLegend(canvas, legend, options) {
+  canvas.hidden = !legend;
+  if (!legend) return;
+
+  let ratio = options.ratio || window.devicePixelRatio || 1;
+  let width = options.width;
+  let titleHeight = legend.title ? lineHeight : 0;
+  let height = legend.type == 'categorical' ?
+    padding * 2 + titleHeight + legend.entries.length * lineHeight :
+    legend.type == 'flux' ?
+    padding * 2 + titleHeight + (legend.entries.length + legend.widths.length) * lineHeight :
+    padding * 2 + titleHeight + barHeight + tickLength + lineHeight;
+  canvas.width = Math.round(width * ratio);
+  canvas.height = Math.round(height * ratio);
+  canvas.style.width = width + 'px';
+  canvas.style.height = height + 'px';
+
+  let ctx = canvas.getContext('2d');
+  ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+  ctx.clearRect(0, 0, width, height);
+  if (options.background) {
+    ctx.fillStyle = options.background;
+    ctx.fillRect(0, 0, width, height);
+  }
+  ctx.font = options.font;
+  ctx.fillStyle = options.color;
+  ctx.strokeStyle = options.color;
+  ctx.textBaseline = 'middle';
+
+  let y = padding;
+  if (legend.title) {
+    ctx.textAlign = 'left';
+    ctx.fillText(legend.title, padding, y + lineHeight / 2);
+    y += lineHeight;
+  }
+
+  if (legend.type == 'categorical' || legend.type == 'flux') {
+    legend.entries.forEach(entry => {
+      ctx.fillStyle = 'rgb(' + entry.color.join(',') + ')';
+      ctx.fillRect(padding, y + (lineHeight - barHeight) / 2, barHeight, barHeight);
+      ctx.fillStyle = options.color;
+      ctx.textAlign = 'left';
+      ctx.fillText(String(entry.label), padding * 2 + barHeight, y + lineHeight / 2);
+      y += lineHeight;
+    });
+    (legend.widths || []).forEach(step => {
+      ctx.lineWidth = Math.min(step.width, lineHeight - 2);
+      ctx.beginPath();
+      ctx.moveTo(padding, y + lineHeight / 2);
+      ctx.lineTo(padding + barHeight * 2, y + lineHeight / 2);
+      ctx.stroke();
+      ctx.textAlign = 'left';
+      ctx.fillText(formatTick(step.value), padding * 2 + barHeight * 2, y + lineHeight / 2);
+      y += lineHeight;
+    });
+    ctx.lineWidth = 1;
+    return;
+  }
+
+  // leave room for the labels at the ends of the bar
+  let inset = padding + 10;
+  let barWidth = width - inset * 2;
+  for (let x = 0; x < barWidth; x++) {
+    let color = legend.output(x / Math.max(1, barWidth - 1));
+    ctx.fillStyle = 'rgb(' + color.join(',') + ')';
+    ctx.fillRect(inset + x, y, 1, barHeight);
+  }
+  y += barHeight;
+
+  ctx.fillStyle = options.color;
+  ctx.textAlign = 'center';
+  ctx.beginPath();
+  legend.ticks.forEach(value => {
+    let t = legend.position(value);
+    if (isNaN(t) || t < -1e-9 || t > 1 + 1e-9) return;
+    let x = Math.round(inset + t * barWidth) + 0.5;
+    ctx.moveTo(x, y);
+    ctx.lineTo(x, y + tickLength);
+    ctx.fillText(formatTick(value), x, y + tickLength + lineHeight / 2);
+  });
+  ctx.stroke();
+}
+
+export { drawLegend, formatTick };
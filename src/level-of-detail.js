@@ -0,0 +1,303 @@
+/**
+ * @file This file contains the level-of-detail system for the Metabolic Atlas
+ * 3D Viewer. Nodes are drawn as sprite impostors, and nodes that are large
+ * enough on screen are instead drawn as instanced geometry with a polygon
+ * count chosen from their screen-space size.
+ */
+
+import {
+  BoxGeometry,
+  Color,
+  CylinderGeometry,
+  Frustum,
+  Group,
+  InstancedMesh,
+  Matrix4,
+  MeshLambertMaterial,
+  OctahedronGeometry,
+  SphereGeometry,
+  TetrahedronGeometry,
+  TorusGeometry,
+  Vector3,
+} from 'three';
+
+/**
+ * Default detail levels. `minSize` is the smallest on-screen node size (in
+ * pixels) for which the level is used, and `detail` is the number of
+ * segments used for curved shapes. Nodes smaller than the smallest `minSize`
+ * are only drawn as sprites.
+ */
+const defaultLevels = [
+  {minSize: 48, detail: 24},
+  {minSize: 20, detail: 12},
+  {minSize: 8, detail: 6},
+];
+
+/**
+ * Geometry factories for the built-in node shapes. Each factory takes the
+ * level of detail and returns a geometry that fits approximately in a unit
+ * sphere.
+ */
+const builtinShapes = {
+  sphere: detail => new SphereGeometry(1, detail, Math.max(3, Math.round(detail*0.75))),
+  cube: () => new BoxGeometry(1.6, 1.6, 1.6),
+  octahedron: () => new OctahedronGeometry(1.2, 0),
+  tetrahedron: () => new TetrahedronGeometry(1.3, 0),
+  cylinder: detail => new CylinderGeometry(0.8, 0.8, 1.6, detail),
+  torus: detail => new TorusGeometry(0.75, 0.3, Math.max(3, Math.round(detail/2)), detail),
+};
+
+/**
+ * Registers a custom node shape in a registry, which each viewer keeps for
+ * its own shapes. The shape can be given as a geometry, as a three-js object
+ * (such as a loaded glTF scene) containing a mesh, or as a function which
+ * takes the level of detail and returns a geometry. Geometries and objects
+ * are centered and scaled to fit in a unit sphere.
+ *
+ * @param {Object} registry - the custom shapes, by name
+ * @param {string} name - name of the shape
+ * @param {Object|Function} shape - geometry, object or geometry factory
+ */
+function registerShape(registry, name, shape) {
+  if (typeof shape === 'function') {
+    registry[name] = shape;
+    return;
+  }
+
+  let geometry = shape.isBufferGeometry ? shape.clone() : undefined;
+  if (!geometry && shape.isObject3D) {
+    shape.updateMatrixWorld(true);
+    shape.traverse(child => {
+      if (!geometry && child.isMesh) {
+        geometry = child.geometry.clone().applyMatrix4(child.matrixWorld);
+      }
+    });
+  }
+  if (!geometry) {
+    console.warn("could not register node shape '" + name + "'. The shape " +
+                 "must be a geometry, a geometry function or contain a mesh.");
+    return;
+  }
+
+  geometry.computeBoundingSphere();
+  let sphere = geometry.boundingSphere;
+  geometry.translate(-sphere.center.x, -sphere.center.y, -sphere.center.z);
+  if (sphere.radius > 0) {
+    geometry.scale(1/sphere.radius, 1/sphere.radius, 1/sphere.radius);
+  }
+  if (!geometry.attributes.normal) {
+    geometry.computeVertexNormals();
+  }
+  registry[name] = () => geometry.clone();
+}
+
+/**
+ * Returns the geometry factory of a shape, custom or built-in.
+ *
+ * @param {string} name - name of the shape
+ * @param {Object} registry - the custom shapes, see `registerShape`
+ * @returns {Function} The factory, or undefined for unknown shapes.
+ */
+function findShape(name, registry) {
+  return registry[name] || builtinShapes[name];
+}
+
+/**
+ * Creates the geometry of a node shape, which fits approximately in a unit
+ * sphere. Unknown shapes are drawn as spheres.
+ *
+ * @param {string} name - name of the shape
+ * @param {number} detail - number of segments used for curved shapes
+ * @param {Object} registry - (optional) the custom shapes, see
+ *     `registerShape`
+ * @returns {Object} The geometry.
+ */
+function shapeGeometry(name, detail, registry = {}) {
+  return (findShape(name, registry) || builtinShapes.sphere)(detail);
+}
+
+/**
+ * Creates a level-of-detail handler for the nodes of a graph.
+ *
+ * @param {Array} levels - (optional) detail levels formatted as
+ *     [{minSize: <pixels>, detail: <segments>}, ...]
+ * @param {Object} registry - (optional) the custom shapes, see
+ *     `registerShape`
+ * @returns {Object} An object with functions to build and update the meshes.
+ */
+function LevelOfDetail(levels = defaultLevels, registry = {}) {
+  let group = new Group();
+  let meshes = [];
+  let positions = [];
+  let nodeShapes = [];
+  let nodeRadius = 1;
+  // the per-node attribute hiding the sprites of the nodes drawn as geometry
+  let spriteHidden;
+  // the nodes drawn as geometry in the last update
+  let meshed = [];
+
+  // sort levels so that the most detailed level is tested first
+  levels = levels.slice().sort((a,b) => b.minSize - a.minSize);
+
+  // reusable objects for the per-frame update
+  const matrix = new Matrix4();
+  const color = new Color();
+  const point = new Vector3();
+  const frustum = new Frustum();
+
+  /**
+   * Creates one instanced mesh per detail level and shape, each with room for
+   * all nodes of that shape.
+   *
+   * @param {Array} nodePositions - list of node positions as [x, y, z]
+   * @param {number} nodeSize - size of the nodes in graph coordinates
+   * @param {Array} shapeList - (optional) shape name of each node. Nodes with
+   *     the shape 'sprite' are always drawn as sprites.
+   */
+  function build(nodePositions, nodeSize, shapeList = []) {
+    dispose();
+    positions = nodePositions;
+    let unknown = new Set();
+    nodeShapes = positions.map((p, i) => {
+      let shape = shapeList[i] || 'sphere';
+      if (shape != 'sprite' && !findShape(shape, registry)) {
+        unknown.add(shape);
+        shape = 'sphere';
+      }
+      return shape;
+    });
+    unknown.forEach(shape => {
+      console.warn("unknown node shape: '" + shape + "', using 'sphere'.");
+    });
+    nodeRadius = nodeSize * 0.5;
+
+    let counts = {};
+    nodeShapes.filter(shape => shape != 'sprite').forEach(shape => {
+      counts[shape] = (counts[shape] || 0) + 1;
+    });
+
+    levels.forEach(level => {
+      let levelMeshes = {};
+      Object.keys(counts).forEach(shape => {
+        let geometry = findShape(shape, registry)(level.detail);
+        let material = new MeshLambertMaterial({color: 0xffffff});
+        let mesh = new InstancedMesh(geometry, material, counts[shape]);
+        // instance colors need to exist before the first render for three-js
+        // to compile the material with instance color support.
+        for (let i = 0; i < mesh.count; i++) {
+          mesh.setColorAt(i, color.setRGB(1, 1, 1));
+        }
+        mesh.count = 0;
+        mesh.frustumCulled = false;
+        mesh.renderOrder = 2;
+        levelMeshes[shape] = mesh;
+        group.add(mesh);
+      });
+      meshes.push(levelMeshes);
+    });
+  }
+
+  /**
+   * Distributes the nodes over the detail levels given their current size on
+   * screen. Nodes outside of the camera frustum are skipped. Nodes that are
+   * drawn as geometry have their sprites hidden by the `meshed` attribute of
+   * the node sprites, so that the sprite positions stay untouched.
+   *
+   * @param {Object} camera - the camera used for rendering
+   * @param {number} viewportHeight - height of the viewport in pixels
+   * @param {Array} colors - node color array with 3 normalized bytes per node
+   * @param {Object} sprites - meshed attribute of the node sprites, set to 1
+   *     for the nodes drawn as geometry and 0 for the others
+   * @param {Array} scales - (optional) size scale factor of each node
+   * @param {Function} isVisible - (optional) returns false for hidden nodes
+   * @param {Function} nearby - (optional) function of a distance returning
+   *     the indices of the nodes within that distance from the camera, so
+   *     that only the nodes close enough to be drawn as geometry are visited
+   */
+  function update(camera, viewportHeight, colors, sprites, scales = undefined,
+                  isVisible = () => true, nearby = undefined) {
+    if (meshes.length == 0) return;
+    spriteHidden = sprites;
+
+    camera.updateMatrixWorld();
+    frustum.setFromProjectionMatrix(
+      new Matrix4().multiplyMatrices(camera.projectionMatrix,
+                                     camera.matrixWorldInverse)
+    );
+    // pixels per graph unit at distance 1 from the camera
+    let scale = viewportHeight / (2 * Math.tan(camera.fov * Math.PI / 360));
+
+    meshes.forEach(levelMeshes => {
+      Object.values(levelMeshes).forEach(mesh => { mesh.count = 0; });
+    });
+    let candidates = positions.map((pos, i) => i);
+    if (nearby) {
+      // nodes farther away than this are smaller than the least detailed
+      // level
+      let maxScale = scales ? scales.reduce((a, b) => Math.max(a, b), 0) : 1;
+      let minSize = levels[levels.length - 1].minSize;
+      candidates = nearby(2 * nodeRadius * maxScale * scale / minSize);
+    }
+    meshed.forEach(i => { sprites.array[i] = 0; });
+    let changed = meshed.length > 0;
+    meshed = [];
+    candidates.forEach(i => {
+      let pos = positions[i];
+      point.set(pos[0], pos[1], pos[2]);
+      let radius = nodeRadius * (scales ? scales[i] : 1);
+      let l = -1;
+      if (nodeShapes[i] != 'sprite' && radius > 0 && isVisible(i) &&
+          frustum.containsPoint(point)) {
+        let size = 2 * radius * scale / point.distanceTo(camera.position);
+        l = levels.findIndex(level => size >= level.minSize);
+      }
+      if (l < 0) return;
+      sprites.array[i] = 1;
+      meshed.push(i);
+      changed = true;
+
+      let mesh = meshes[l][nodeShapes[i]];
+      matrix.makeScale(radius, radius, radius);
+      matrix.setPosition(point);
+      mesh.setMatrixAt(mesh.count, matrix);
+      mesh.setColorAt(mesh.count, color.setRGB(colors[i*3]/255,
+                                                colors[i*3+1]/255,
+                                                colors[i*3+2]/255));
+      mesh.count += 1;
+    });
+    if (changed) {
+      sprites.needsUpdate = true;
+    }
+    meshes.forEach(levelMeshes => {
+      Object.values(levelMeshes).forEach(mesh => {
+        mesh.instanceMatrix.needsUpdate = true;
+        mesh.instanceColor.needsUpdate = true;
+      });
+    });
+  }
+
+  /**
+   * Removes and disposes all meshes, and shows all sprites again.
+   */
+  function dispose() {
+    meshes.forEach(levelMeshes => {
+      Object.values(levelMeshes).forEach(mesh => {
+        group.remove(mesh);
+        mesh.geometry.dispose();
+        mesh.material.dispose();
+      });
+    });
+    meshes = [];
+    meshed = [];
+
+    if (spriteHidden && spriteHidden.count == positions.length) {
+      spriteHidden.array.fill(0);
+      spriteHidden.needsUpdate = true;
+    }
+    spriteHidden = undefined;
+  }
+
+  return {build, dispose, group, update};
+}
+
+export { LevelOfDetail, registerShape, shapeGeometry };
@@ -0,0 +1,217 @@
+/**
+ * @file This file contains linked views of the Metabolic Atlas 3D Viewer:
+ * viewers whose cameras, hovered nodes and selections follow each other, so
+ * that two models, e.g. a human and a mouse GEM or two tissue models, can be
+ * compared node by node. Node IDs can be mapped between the viewers, for
+ * models with different identifiers.
+ *
+ *   let {viewers, unlink} = createSplitView('viewer', {map: orthologs});
+ *   viewers[0].loadData(...);
+ *   viewers[1].loadData(...);
+ *
+ * The highlight bus is a lighter link for any number of viewers on a page:
+ * hovering a node in one viewer highlights the node with the same ID in the
+ * other viewers on the same channel, see `joinHighlightBus`.
+ */
+
+import { MetAtlasViewer } from './met-atlas-viewer';
+
+/**
+ * Returns a key of a camera, to tell whether it has moved.
+ *
+ * @param {Object} camera - the camera, see `getCamera` of the viewer
+ * @returns {string} The key.
+ */
+function cameraKey(camera) {
+  return ['position', 'up', 'target'].map(key =>
+    [camera[key].x, camera[key].y, camera[key].z].join(',')).join(';');
+}
+
+/**
+ * Links the cameras, hovered nodes and selections of viewers. A viewer
+ * moved by the user moves the other viewers to the same camera position.
+ * Nodes that are not in a viewer are left out of its hover and selection.
+ *
+ * @param {Array} viewers - the viewers
+ * @param {object} options - (optional) link options with the keys:
+ *     - camera, hover, selection: what to link (default all)
+ *     - map: maps node IDs between the viewers, as a function taking the ID
+ *       and the indices of the viewers it's mapped from and to, returning
+ *       the ID in the other viewer, or null if there is none. For two
+ *       viewers it can also be an object mapping the IDs of the first viewer
+ *       to the IDs of the second. IDs are the same in all viewers if not
+ *       given.
+ * @returns {Object} An object with the function unlink.
+ */
+function linkViewers(viewers, options = {}) {
+  let settings = Object.assign({camera: true, hover: true, selection: true}, options);
+  let inverse;
+  if (settings.map && typeof settings.map === 'object') {
+    inverse = {};
+    Object.entries(settings.map).forEach(([a, b]) => { inverse[b] = a; });
+  }
+  const mapId = (id, from, to) => {
+    if (typeof settings.map === 'function') return settings.map(id, from, to);
+    if (settings.map) return (from == 0 ? settings.map : inverse)[id];
+    return id;
+  };
+  // the camera the viewers were last synchronized to, and whether a
+  // selection is being copied, so that it isn't copied back
+  let syncedCamera;
+  let copying = false;
+  let handlers = [];
+
+  viewers.forEach((viewer, k) => {
+    const others = fn => viewers.forEach((other, j) => {
+      if (j != k) fn(other, j);
+    });
+
+    if (settings.camera) {
+      const onFrame = () => {
+        let camera = viewer.getCamera();
+        let key = cameraKey(camera);
+        if (key == syncedCamera) return;
+        syncedCamera = key;
+        others(other => other.setCamera(camera.position, camera.up, camera.target));
+      };
+      viewer.on('renderFrame', onFrame);
+      handlers.push([viewer, 'renderFrame', onFrame]);
+    }
+
+    if (settings.hover) {
+      const onHover = ({node}) => {
+        others((other, j) => {
+          other.setHover(node ? mapId(node.id, k, j) : null);
+        });
+      };
+      viewer.on('nodeHover', onHover);
+      handlers.push([viewer, 'nodeHover', onHover]);
+    }
+
+    if (settings.selection) {
+      const onSelection = ({items}) => {
+        if (copying) return;
+        copying = true;
+        others((other, j) => {
+          let ids = items.map(node => mapId(node.id, k, j))
+            .filter(id => id !== null && id !== undefined && other.getNode(id));
+          other.select(ids);
+        });
+        copying = false;
+      };
+      viewer.on('selectionChange', onSelection);
+      handlers.push([viewer, 'selectionChange', onSelection]);
+    }
+  });
+
+  /**
+   * Stops linking the viewers.
+   */
+  function unlink() {
+    handlers.forEach(([viewer, type, handler]) => viewer.off(type, handler));
+    handlers = [];
+  }
+
+  return {unlink};
+}
+
+/**
+ * Splits an element into two panes, side by side or one above the other,
+ * with a linked viewer in each, see `linkViewers`.
+ *
+ * @param {string|Object} targetElement - the element or its ID
+ * @param {object} options - (optional) link options, see `linkViewers`,
+ *     with the extra key vertical (whether to stack the panes, default
+ *     false)
+ * @returns {Object} An object with the viewers, and the functions unlink
+ *     and dispose, which disposes the viewers and removes the panes.
+ */
+function createSplitView(targetElement, options = {}) {
+  const container = typeof targetElement === 'string' ?
+    document.getElementById(targetElement) : targetElement;
+  let panes = [0, 1].map(k => {
+    let pane = document.createElement('div');
+    pane.className = 'met-atlas-split-pane';
+    Object.assign(pane.style, {
+      position: 'absolute',
+      left: options.vertical ? '0' : k * 50 + '%',
+      top: options.vertical ? k * 50 + '%' : '0',
+      width: options.vertical ? '100%' : '50%',
+      height: options.vertical ? '50%' : '100%',
+      overflow: 'hidden',
+      boxSizing: 'border-box',
+    });
+    if (k == 1) {
+      pane.style[options.vertical ? 'borderTop' : 'borderLeft'] = '1px solid #888888';
+    }
+    container.appendChild(pane);
+    return pane;
+  });
+  if (!container.style.position) {
+    container.style.position = 'relative';
+  }
+
+  let viewers = panes.map(pane => MetAtlasViewer(pane));
+  let link = linkViewers(viewers, options);
+
+  /**
+   * Disposes the viewers and removes the panes.
+   */
+  function dispose() {
+    link.unlink();
+    viewers.forEach(viewer => viewer.dispose());
+    panes.forEach(pane => pane.remove());
+  }
+
+  return {viewers: viewers, unlink: link.unlink, dispose: dispose};
+}
+
+// The viewers on each channel of the highlight bus, by channel name, each
+// with its membership
+const channels = new Map();
+
+/**
+ * Adds a viewer to a channel of the highlight bus. Hovering a node in a
+ * viewer on the channel highlights the node with the same ID in the other
+ * viewers on the channel, if they have it. Viewers can join and leave at
+ * any time. Joining a channel again returns the same membership.
+ *
+ * @param {Object} viewer - the viewer
+ * @param {string} channel - (optional) the channel name, default 'default'
+ * @returns {Object} An object with the function leave, which removes the
+ *     viewer from the channel. Leaving more than once has no effect.
+ */
+function joinHighlightBus(viewer, channel = 'default') {
+  if (!channels.has(channel)) {
+    channels.set(channel, new Map());
+  }
+  let members = channels.get(channel);
+  if (members.has(viewer)) {
+    return members.get(viewer);
+  }
+  const onHover = ({node}) => {
+    members.forEach((membership, other) => {
+      if (other !== viewer) other.setHover(node ? node.id : null);
+    });
+  };
+  viewer.on('nodeHover', onHover);
+
+  /**
+   * Removes the viewer from the channel.
+   */
+  function leave() {
+    if (members.get(viewer) !== membership) return;
+    viewer.off('nodeHover', onHover);
+    members.delete(viewer);
+    // the channel may have been emptied and created again since
+    if (members.size == 0 && channels.get(channel) === members) {
+      channels.delete(channel);
+    }
+  }
+
+  let membership = {leave};
+  members.set(viewer, membership);
+  return membership;
+}
+
+export { createSplitView, joinHighlightBus, linkViewers };
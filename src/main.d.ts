@@ -0,0 +1,837 @@
+/**
+ * @file Type definitions for the Metabolic Atlas 3D Map Viewer. The viewer
+ * is written in JavaScript, and these definitions describe its public API:
+ * the graph data format, the style options and the events.
+ */
+
+import {
+  BufferGeometry,
+  Object3D,
+  PerspectiveCamera,
+  Scene,
+  Vector3,
+  WebGLRenderer,
+} from 'three';
+
+/** An RGB color with integer channels between 0 and 255. */
+export type RGB = [number, number, number];
+
+/** A point or vector in graph coordinates. */
+export interface XYZ {
+  x: number;
+  y: number;
+  z: number;
+}
+
+/* Graph data */
+
+export interface GraphNode {
+  /** Unique node ID. */
+  id: string;
+  /** Node name, used for labels and the default tooltip. */
+  n?: string;
+  /** Node group, e.g. 'm' for metabolites and 'r' for reactions. */
+  g: string;
+  /** Node position in graph coordinates. */
+  pos: [number, number, number];
+  color?: RGB;
+  /** 3D shape used when node geometries are enabled, see `setLevelOfDetail`. */
+  shape?: NodeShape;
+  /** Icon name, see `setNodeIcons`. */
+  icon?: string;
+  /** ID of the split metabolite, see `duplicateCurrencyMetabolites`. */
+  duplicateOf?: string;
+  [field: string]: any;
+}
+
+export interface GraphLink {
+  /** ID of the start node. */
+  s: string;
+  /** ID of the end node. */
+  t: string;
+  type?: string;
+  reversible?: boolean;
+  /** Overrides the curvature set by `setLinkStyle`. */
+  curvature?: number;
+  /** Width in pixels, overrides the width set by `setLinkStyle`. */
+  width?: number;
+  [field: string]: any;
+}
+
+export interface GraphData {
+  nodes: GraphNode[];
+  links: GraphLink[];
+}
+
+export interface NodeTexture {
+  group: string;
+  /** Url of the sprite image. */
+  sprite: string;
+  shape?: NodeShape;
+}
+
+export type NodeShape = 'sphere' | 'cube' | 'octahedron' | 'tetrahedron' |
+  'cylinder' | 'torus' | 'sprite' | string;
+
+/** Information about a node in the viewer, as passed to callbacks and events. */
+export interface NodeInfo {
+  id: string;
+  n?: string;
+  pos: [number, number, number];
+  color: RGB;
+  group: string;
+  index: number;
+  shape?: NodeShape;
+  icon?: string;
+  /** Index of the connected component, see `getComponents`. */
+  component: number;
+  /** The node data given to `setData`. */
+  data: GraphNode;
+  [key: string]: any;
+}
+
+/* Styles */
+
+export type ContinuousScale = 'linear' | 'sqrt' | 'log' | 'symlog' | 'quantile';
+
+/** A domain bound: a value, null for the data extent, or a percentile such as '95%'. */
+export type DomainBound = number | string | null;
+
+/** Evenly spaced [r, g, b] color stops, or a function mapping [0, 1] to [r, g, b]. */
+export type Colormap = RGB[] | ((t: number) => RGB);
+
+export interface Mapper {
+  attr: string;
+  scale?: ContinuousScale | 'categorical';
+  /** Linear range around zero of symlog scales (default 1). */
+  constant?: number;
+  domain?: any[];
+  range?: any[];
+  colormap?: Colormap | string;
+  missing?: any;
+}
+
+/** A style property value: a constant, a function of the attributes or a mapper. */
+export type StyleValue<T> = T | Mapper | ((attributes: any, kind: 'node' | 'link') => T);
+
+export interface NodeStyle {
+  color?: StyleValue<RGB>;
+  size?: StyleValue<number>;
+  opacity?: StyleValue<number>;
+  shape?: StyleValue<NodeShape>;
+  icon?: StyleValue<string>;
+}
+
+export interface LinkStyle {
+  color?: StyleValue<RGB>;
+  startColor?: StyleValue<RGB>;
+  endColor?: StyleValue<RGB>;
+  width?: StyleValue<number>;
+}
+
+export interface StyleRule {
+  /** e.g. `node[g = "m"]`, `node[degree >= 10]` or `link[reversible]`. */
+  selector: string | ((attributes: any, kind: 'node' | 'link') => boolean);
+  style: NodeStyle & LinkStyle;
+}
+
+export interface LinkDrawingStyle {
+  curvature?: number;
+  segments?: number;
+  cubic?: boolean;
+  reversible?: 'dashed' | 'arrows' | 'both';
+  dashes?: number;
+  width?: number;
+}
+
+export interface ArrowStyle {
+  show?: boolean;
+  size?: number;
+  types?: { [linkType: string]: boolean };
+}
+
+export interface Colors {
+  nodeDefaultColor?: RGB;
+  connectionStartColor?: RGB;
+  connectionEndColor?: RGB;
+  nodeSelectColor?: RGB;
+  connectionSelectColor?: RGB;
+  hoverSelectColor?: RGB;
+  hoverConnectionColor?: RGB;
+  pathColor?: RGB;
+  matchColor?: RGB;
+  currentMatchColor?: RGB;
+}
+
+export interface Theme extends Colors {
+  background?: RGB;
+  fog?: RGB;
+  labelColor?: string;
+  labelBackground?: string;
+  infoColor?: string;
+  infoBackground?: string;
+}
+
+export interface FogSettings {
+  color?: any;
+  near?: number;
+  far?: number;
+  auto?: boolean;
+  desaturation?: number;
+}
+
+export interface Bookmark {
+  id: string;
+  label: string;
+  /** Creation time as an ISO 8601 string. */
+  created: string;
+  node?: string;
+  camera: { position: XYZ; up: XYZ; target: XYZ };
+  selection: string[];
+  state?: ViewState;
+}
+
+/** Nodes where `attribute` is or contains `value`, collapsed into a metanode. */
+export interface CollapsedGroup {
+  attribute: string;
+  value: string | number;
+  label?: string;
+  color?: RGB;
+}
+
+export interface ClusterOptions {
+  method?: 'louvain' | 'labelPropagation';
+  /** Higher values give more and smaller clusters (Louvain only). */
+  resolution?: number;
+  weight?: string | ((link: GraphLink) => number);
+  /** Node data attribute to store the cluster number in. */
+  attribute?: string;
+  color?: boolean;
+  /** Draw a hull around each cluster, as groups 'cluster-<number>'. */
+  groups?: boolean;
+  minSize?: number;
+}
+
+/** A selector like in `StyleRule`, or a function returning whether to show an element. */
+export type Filter = string | ((attributes: any, kind: 'node' | 'link') => boolean);
+
+export interface FilterLayer {
+  name: string;
+  filter: Filter;
+  combine: 'and' | 'or';
+}
+
+export interface DiffOptions {
+  colors?: { added?: RGB; removed?: RGB; changed?: RGB };
+  /** Opacity of unchanged nodes, default 0.3. */
+  fade?: number;
+  /** Attributes which don't count as changes, default ['pos']. */
+  ignore?: string[];
+  nodeTextures?: NodeTexture[];
+  nodeSize?: number;
+}
+
+export interface SubsystemFilterOptions {
+  /** Node attribute holding the subsystem, default 'subsystem'. */
+  attribute?: string;
+  /** Show the links leaving the subsystems, greyed out with the nodes they lead to. */
+  boundary?: boolean;
+  boundaryColor?: RGB;
+}
+
+export interface NodeGroup {
+  id: string;
+  nodes: string[];
+  label?: string;
+  color: RGB;
+  /** Opacity of the hull. */
+  opacity: number;
+  collapsed: boolean;
+}
+
+export interface NodeGroupOptions {
+  id?: string;
+  label?: string;
+  color?: RGB;
+  opacity?: number;
+  collapsed?: boolean;
+}
+
+export interface Annotation {
+  id: string;
+  text: string;
+  node?: string;
+  /** The IDs of the link source and target nodes. */
+  link?: { s: string; t: string };
+  /** Callout position relative to the node or link, in pixels. */
+  offset: [number, number];
+  color: string;
+  /** Creation time as an ISO 8601 string. */
+  created: string;
+}
+
+export interface AnnotationTarget {
+  node?: string;
+  /** The IDs of the link source and target nodes, in either order. */
+  link?: { s: string; t: string };
+  offset?: [number, number];
+  color?: string;
+}
+
+export interface MinimapSettings {
+  projection?: 'top' | 'front' | 'side';
+  size?: number;
+  corner?: 'bottom-right' | 'bottom-left' | 'top-right' | 'top-left';
+  background?: string | null;
+  frustumColor?: string;
+  selectionColor?: RGB;
+  nodeSize?: number;
+}
+
+export interface BloomSettings {
+  strength?: number;
+  radius?: number;
+  threshold?: number;
+}
+
+export interface LabelStyle {
+  font?: string;
+  size?: number;
+  color?: string;
+  outlineColor?: string;
+  opacity?: number;
+}
+
+export interface NodeIconStyle {
+  atlas?: string;
+  columns?: number;
+  rows?: number;
+  icons?: { [name: string]: number };
+  groups?: { [group: string]: string };
+  size?: number;
+}
+
+export interface NodeSizing {
+  attr?: 'degree' | 'indegree' | 'outdegree' | string;
+  min?: number;
+  max?: number;
+  scale?: ContinuousScale;
+  constant?: number;
+  domain?: [DomainBound, DomainBound];
+}
+
+export interface DetailLevel {
+  minSize: number;
+  detail: number;
+}
+
+/* Overlays */
+
+export interface ExpressionOverlayOptions {
+  colormap?: Colormap | string;
+  scale?: ContinuousScale;
+  constant?: number;
+  domain?: [DomainBound, DomainBound];
+  groups?: string[];
+  aggregate?: 'mean' | 'sum' | 'min' | 'max';
+  missing?: 'grey' | 'hatched' | 'transparent' | 'keep';
+  missingColor?: RGB;
+  missingOpacity?: number;
+}
+
+export interface ComparisonOverlayOptions extends ExpressionOverlayOptions {
+  mode?: 'foldChange' | 'split';
+  pseudocount?: number;
+}
+
+export interface OverlayCondition {
+  label: string;
+  values: { [id: string]: number } | Map<string, number>;
+}
+
+export interface FluxOverlayOptions {
+  widthRange?: [number, number];
+  scale?: ContinuousScale;
+  constant?: number;
+  domain?: [DomainBound, DomainBound];
+  threshold?: number;
+  positiveColor?: RGB;
+  negativeColor?: RGB;
+  zeroColor?: RGB;
+}
+
+export interface ExportImageOptions {
+  width?: number;
+  height?: number;
+  scale?: number;
+  transparent?: boolean;
+  type?: string;
+  quality?: number;
+  /** Draw the annotation callouts into the image. */
+  annotations?: boolean;
+  legend?: boolean | (LegendOptions & { corner?: 'bottom-right' | 'bottom-left' | 'top-right' | 'top-left' });
+  /** Draw the axes and a scale bar into the image. */
+  gizmo?: boolean | {
+    corner?: 'bottom-right' | 'bottom-left' | 'top-right' | 'top-left';
+    unit?: string;
+    color?: string;
+    background?: string | null;
+    font?: string;
+  };
+}
+
+export interface SearchOptions {
+  limit?: number;
+  fields?: string[];
+  fuzzy?: boolean;
+}
+
+/** Matching character ranges of a text, as [start, end]. */
+export type Highlights = [number, number][];
+
+export interface SearchMatch {
+  node: NodeInfo;
+  score: number;
+  field: string;
+  text: string;
+  highlights: Highlights;
+}
+
+export interface CurrentMatch {
+  node: NodeInfo;
+  index: number;
+  count: number;
+}
+
+export interface Suggestion {
+  text: string;
+  field: string;
+  highlights: Highlights;
+  nodes: NodeInfo[];
+}
+
+export interface RecordingOptions {
+  frameRate?: number;
+  bitsPerSecond?: number;
+  mimeType?: string;
+}
+
+export interface LegendOptions {
+  source?: 'auto' | 'expression' | 'flux' | 'style';
+  title?: string;
+  width?: number;
+  ticks?: number;
+  color?: string;
+  background?: string | null;
+  font?: string;
+}
+
+export interface TimelineSnapshot {
+  label?: string;
+  values: { [id: string]: number } | Map<string, number>;
+}
+
+export interface TimelineOptions {
+  overlay?: 'expression' | 'flux';
+  overlayOptions?: ExpressionOverlayOptions | FluxOverlayOptions;
+  stepTime?: number;
+  loop?: boolean;
+  interpolate?: boolean;
+}
+
+export interface Timeline {
+  play(): void;
+  pause(): void;
+  /** Moves to a snapshot index, fractional between snapshots. */
+  seek(position: number): void;
+  step(delta?: number): void;
+  getPosition(): number | undefined;
+}
+
+export interface ParticleFlowSettings {
+  count?: number;
+  speed?: number;
+  size?: number;
+}
+
+/* Interaction */
+
+export type ControlAction = 'rotate' | 'zoom' | 'pan' | 'none';
+
+export interface ControlBindings {
+  mouseButtons?: { LEFT?: ControlAction; MIDDLE?: ControlAction; RIGHT?: ControlAction };
+  touches?: { ONE?: 'rotate' | 'pan' | 'none' };
+  invertZoom?: boolean;
+  rotateSpeed?: number;
+  zoomSpeed?: number;
+  panSpeed?: number;
+}
+
+export interface FlyOptions {
+  movementSpeed?: number;
+  boostFactor?: number;
+  lookSpeed?: number;
+}
+
+export interface FramingOptions {
+  distance?: number;
+  padding?: number;
+  duration?: number;
+}
+
+export interface PathOptions {
+  weight?: string | ((link: GraphLink) => number);
+  directed?: boolean;
+  exclude?: string[] | ((node: NodeInfo) => boolean);
+  highlight?: boolean;
+  animate?: boolean;
+}
+
+export interface Path {
+  nodes: string[];
+  links: GraphLink[];
+  weight: number;
+}
+
+export interface TraversalOptions {
+  mode?: 'camera' | 'marker';
+  stepTime?: number;
+  distance?: number;
+  loop?: boolean;
+}
+
+export type Easing = 'linear' | 'easeIn' | 'easeOut' | 'easeInOut' | ((t: number) => number);
+
+export interface TourKeyframe {
+  position?: XYZ;
+  target?: XYZ;
+  up?: XYZ;
+  node?: string;
+  duration?: number;
+  easing?: Easing;
+  pause?: number;
+  select?: string[];
+  path?: [string, string] | null;
+}
+
+/* Events */
+
+export interface ViewerEvents {
+  nodeClick: { node: NodeInfo; event: PointerEvent };
+  nodeHover: { node: NodeInfo | null; event: MouseEvent };
+  edgeClick: { link: GraphLink; event: PointerEvent };
+  annotationClick: { annotation: Annotation; event: MouseEvent };
+  selectionChange: { items: NodeInfo[]; added: NodeInfo[]; removed: NodeInfo[] };
+  cameraChange: { position: Vector3; target: Vector3; up: Vector3 };
+  dataLoaded: { nodes: number; links: number; components: number };
+  vrChange: { active: boolean };
+  loadProgress: { phase: 'download' | 'build' | 'display'; loaded: number; total: number };
+  renderFrame: { time: number };
+  tick: { position: number; index: number; label?: string; playing: boolean };
+}
+
+export type ViewerEvent = keyof ViewerEvents;
+
+/* VR */
+
+export interface VRSettings {
+  /** Graph units per meter, defaults to nodes being 10 cm. */
+  scale?: number;
+  /** Flying speed in meters per second. */
+  speed?: number;
+  /** Snap turn angle in radians. */
+  turn?: number;
+  rayLength?: number;
+  rayColor?: RGB;
+  hoverColor?: RGB;
+}
+
+/* Statistics */
+
+export interface ViewerStats {
+  nodes: number;
+  links: number;
+  /** Nodes hidden by occlusion culling. */
+  culledNodes: number;
+  geometries: number;
+  buffers: number;
+  /** Estimated GPU memory of the vertex buffers, in bytes. */
+  bufferBytes: number;
+  textures: number;
+  /** Estimated GPU memory of the textures, including mipmaps, in bytes. */
+  textureBytes: number;
+  /** Draw calls and primitives of the last rendered frame. */
+  drawCalls: number;
+  triangles: number;
+  points: number;
+  lines: number;
+  programs: number;
+}
+
+/* View state */
+
+export interface ViewState {
+  camera?: { position: XYZ; up: XYZ; target: XYZ };
+  navigationMode?: 'orbit' | 'fly';
+  selection?: string[];
+  /** The highlighted path, with the node IDs and link indices in path order. */
+  path?: { nodes: string[]; links: number[] } | null;
+  hiddenNodeType?: string | null;
+  currency?: { names?: string[]; hidden?: boolean; duplicated?: boolean };
+  subsystemFilter?: (SubsystemFilterOptions & { subsystems: string[] }) | null;
+  degreeFilter?: { min?: number; max?: number | null } | null;
+  hiddenLinkTypes?: string[];
+  /** The isolated views, see `isolate`. */
+  isolation?: Array<{ ids: string[]; label: string }>;
+  /** Filter layers with selectors, see `setFilter`. */
+  filters?: Array<FilterLayer & { filter: string }>;
+  labels?: {
+    show?: boolean;
+    mode?: 'html' | 'sdf';
+    style?: LabelStyle;
+    distance?: number;
+    declutter?: boolean;
+    minScreenSize?: number;
+  };
+  highlightDepth?: number;
+  colors?: Colors;
+  background?: string | null;
+  colorVisionMode?: 'normal' | 'deuteranopia' | 'protanopia' | 'tritanopia';
+  fog?: FogSettings & { enabled: boolean };
+  ambientOcclusion?: { enabled: boolean; radius?: number; strength?: number };
+  levelOfDetail?: boolean;
+  occlusionCulling?: { enabled: boolean; resolution?: number };
+  particleFlow?: ParticleFlowSettings & { enabled: boolean };
+  fluxOverlay?: { values: { [id: string]: number }; options: FluxOverlayOptions } | null;
+  expressionOverlay?: {
+    values: { [id: string]: number };
+    reference?: { [id: string]: number };
+    options: ExpressionOverlayOptions | ComparisonOverlayOptions;
+  } | null;
+  smallMultiples?: {
+    conditions: Array<{ label: string; values: { [id: string]: number } }>;
+    options: ExpressionOverlayOptions;
+  } | null;
+  style?: StyleRule[];
+  nodeSizing?: NodeSizing | null;
+  linkStyle?: LinkDrawingStyle;
+  arrowStyle?: ArrowStyle;
+  minimap?: MinimapSettings & { enabled: boolean };
+  collapsedGroups?: CollapsedGroup[];
+  groups?: Array<Omit<NodeGroup, 'collapsed'>>;
+  annotations?: { visible: boolean; items: Annotation[] };
+}
+
+/* Plugins */
+
+export interface PluginContext {
+  scene: Scene;
+  camera: PerspectiveCamera;
+  renderer: WebGLRenderer;
+  container: HTMLElement;
+  /** The current camera controls. */
+  readonly controls: any;
+  viewer: Viewer;
+  /** Requests a new frame. */
+  render(): void;
+}
+
+export interface Plugin {
+  name?: string;
+  init?(context: PluginContext, options: any): void;
+  onDataLoad?(detail: ViewerEvents['dataLoaded']): void;
+  onFrame?(time: number): void;
+  onPick?(detail: ViewerEvents['nodeClick'] | ViewerEvents['edgeClick']): void;
+  dispose?(): void;
+}
+
+/* Viewer */
+
+export interface Viewer {
+  addAnnotation(text: string, target: AnnotationTarget): Annotation | undefined;
+  addBookmark(label: string, options?: { node?: string; state?: boolean }): Bookmark | undefined;
+  addData(data: Partial<GraphData>, nodeTextures?: NodeTexture[]): Promise<NodeInfo[]>;
+  centerNode(node: NodeInfo): void;
+  clearAnnotations(): void;
+  clearDrawing(): void;
+  clearPath(): void;
+  clearMatches(): void;
+  clearSelection(): void;
+  collapseGroup(attribute: string, value: string | number, options?: { label?: string; color?: RGB }): Promise<NodeInfo | undefined>;
+  copyImageToClipboard(options?: ExportImageOptions): Promise<void>;
+  createGroup(ids: string[], options?: NodeGroupOptions): Promise<NodeGroup | undefined>;
+  createLegend(options?: LegendOptions): HTMLCanvasElement;
+  deselect(ids: string[]): void;
+  detectClusters(options?: ClusterOptions): Promise<{ count: number; modularity: number; clusters: string[][] }>;
+  dispose(): void;
+  duplicateCurrencyMetabolites(duplicate?: boolean): Promise<boolean>;
+  enterVR(settings?: VRSettings): Promise<boolean>;
+  exitVR(): void;
+  expandGroup(id: string): Promise<NodeInfo[]>;
+  expandNode(id: string): Promise<NodeInfo[]>;
+  exportGIF(options?: { duration?: number; fps?: number; width?: number; rotate?: number }): Promise<Blob>;
+  exportGLTF(options?: { binary?: boolean; detail?: number }): Promise<Blob>;
+  exportImage(options?: ExportImageOptions): Promise<Blob>;
+  exportAnnotations(): string;
+  exportBookmarks(): string;
+  findPath(sourceId: string, targetId: string, options?: PathOptions): Path | null;
+  fitSelection(padding?: number, duration?: number): void;
+  focusNode(id: string, options?: FramingOptions): void;
+  getAnnotations(): Annotation[];
+  getBookmarks(): Bookmark[];
+  getCamera(): { position: XYZ; up: XYZ; target: XYZ };
+  getCollapsedGroups(): Array<CollapsedGroup & { id: string }>;
+  getComponents(): Array<{ index: number; size: number; nodes: string[] }>;
+  getCurrencyMetabolites(): { names: string[]; hidden: boolean; duplicated: boolean };
+  getEgoNetwork(id: string, depth?: number, options?: { open?: boolean }): Promise<GraphData | undefined>;
+  getFilters(): FilterLayer[];
+  getGroups(): NodeGroup[];
+  getHiddenLinkTypes(): string[];
+  getNavigationHistory(): { back: boolean; forward: boolean };
+  getNode(id: string): NodeInfo | undefined;
+  getSelection(): string[];
+  getState(): ViewState;
+  getStats(): ViewerStats;
+  getSummary(): string;
+  goBack(duration?: number): boolean;
+  goForward(duration?: number): boolean;
+  goToBookmark(id: string, options?: FramingOptions): Promise<boolean>;
+  highlightMatches(query: string, options?: SearchOptions): SearchMatch[];
+  importAnnotations(json: string | Annotation[], options?: { replace?: boolean }): number;
+  importBookmarks(json: string | Bookmark[], options?: { replace?: boolean }): number;
+  isolate(ids?: string[], options?: { depth?: number }): Promise<number>;
+  isVRSupported(): Promise<boolean>;
+  loadData(source: string | ArrayBuffer | GraphData, data: { nodeTextures: NodeTexture[]; nodeSize: number; chunks?: number; chunkDelay?: number }): Promise<void>;
+  moveGroup(id: string, offset: [number, number, number]): Promise<boolean>;
+  nextMatch(options?: FramingOptions): CurrentMatch | undefined;
+  off<E extends ViewerEvent>(type: E, handler?: (detail: ViewerEvents[E]) => void): void;
+  on<E extends ViewerEvent>(type: E, handler: (detail: ViewerEvents[E]) => void): void;
+  prevMatch(options?: FramingOptions): CurrentMatch | undefined;
+  removeAnnotation(id: string): boolean;
+  removeBookmark(id: string): boolean;
+  removeFilter(name?: string): Promise<void>;
+  removeGroup(id: string): Promise<boolean>;
+  removeLegend(canvas: HTMLCanvasElement): void;
+  renameBookmark(id: string, label: string): boolean;
+  removePlugin(plugin: Plugin): void;
+  restoreIsolation(step?: number): Promise<void>;
+  recordTour(keyframes: TourKeyframe[], options?: RecordingOptions): Promise<Blob | undefined>;
+  redo(): boolean;
+  registerColormap(name: string, colormap: Colormap): void;
+  registerNodeShape(name: string,
+                    shape: BufferGeometry | Object3D | ((detail: number) => BufferGeometry)): void;
+  search(query: string, options?: SearchOptions): SearchMatch[];
+  setAmbientOcclusion(enabled: boolean, settings?: { radius?: number; strength?: number }): void;
+  setAnnotationsVisible(visible: boolean): void;
+  setAnnouncements(enabled: boolean, settings?: { hover?: boolean; format?: (node: NodeInfo) => string }): void;
+  setAntialiasing(mode: 'none' | 'msaa' | 'fxaa' | 'smaa', samples?: number): void;
+  setArrowStyle(style: ArrowStyle): Promise<void>;
+  setBackgroundColor(color: any): void;
+  setBloom(enabled: boolean, settings?: BloomSettings): void;
+  setBookmarkStorage(key: string | null): void;
+  setBoxSelection(enabled: boolean,
+                  settings?: { mode?: 'box' | 'lasso'; includeOccluded?: boolean }): void;
+  select(ids: string[], add?: boolean): void;
+  selectBy(filter: { [field: string]: any }): void;
+  setCameraControls(cameraControlFunction: new (camera: any, domElement: HTMLElement) => any): any;
+  setColors(colors: Colors): void;
+  setColorVisionMode(mode: 'normal' | 'deuteranopia' | 'protanopia' | 'tritanopia'): void;
+  setComparisonOverlay(reference: { [id: string]: number } | Map<string, number>,
+                       values: { [id: string]: number } | Map<string, number>,
+                       options?: ComparisonOverlayOptions): void;
+  setControlBindings(bindings: ControlBindings): void;
+  setCurrencyMetabolites(names?: string[]): Promise<void>;
+  setData(data: { graphData: GraphData; nodeTextures: NodeTexture[]; nodeSize: number }): Promise<void>;
+  setDebugOverlay(enabled: boolean, settings?: { corner?: 'bottom-right' | 'bottom-left' | 'top-right' | 'top-left'; background?: string; color?: string }): void;
+  setDegreeFilter(range: { min?: number; max?: number } | null): Promise<void>;
+  setDrawingTool(tool: 'pen' | 'eraser' | 'none', settings?: { color?: RGB; width?: number }): void;
+  setExpressionOverlay(values: { [id: string]: number } | Map<string, number> | null,
+                       options?: ExpressionOverlayOptions): void;
+  setExpandCallback(callback?: (node: NodeInfo) => Partial<GraphData> | Promise<Partial<GraphData>>): void;
+  setFilter(filter: Filter | null, options?: { name?: string; combine?: 'and' | 'or' }): Promise<void>;
+  setFluxOverlay(values: { [id: string]: number } | Map<string, number> | null,
+                 options?: FluxOverlayOptions): void;
+  setFog(enabled: boolean, settings?: FogSettings): void;
+  setGroupCollapsed(id: string, collapse: boolean): Promise<boolean>;
+  setHighlightDepth(depth: number): void;
+  setHover(id: string | null): boolean;
+  setCamera(position: XYZ, up?: XYZ, target?: XYZ): void;
+  setNodeIcons(style: NodeIconStyle): void;
+  setNodeScreenSize(minSize: number): void;
+  setNodeSizing(sizing: NodeSizing | null): void;
+  setParticleFlow(enabled: boolean, settings?: ParticleFlowSettings): void;
+  setReducedMotion(mode: boolean | 'auto'): void;
+  setSelectionMode(mode: 'box' | 'lasso'): void;
+  setSmallMultiples(conditions: OverlayCondition[] | null, options?: ExpressionOverlayOptions): void;
+  setState(state: ViewState): Promise<void>;
+  setStereo(mode: 'none' | 'anaglyph' | 'side-by-side', settings?: { eyeSeparation?: number; swapEyes?: boolean }): void;
+  setStyle(rules: StyleRule[]): void;
+  setSubsystemFilter(subsystems?: string[] | null, options?: SubsystemFilterOptions): Promise<void>;
+  setSummary(enabled: boolean, settings?: { compartment?: string; subsystem?: string; maxItems?: number }): void;
+  setTooltip(content?: (node: NodeInfo) => string | Node | null | undefined,
+             options?: { offset?: number }): void;
+  setTheme(theme: 'light' | 'dark' | Theme): void;
+  setTimeline(snapshots: TimelineSnapshot[] | null, options?: TimelineOptions): Timeline | undefined;
+  setNodeSelectCallback(callback: (node: NodeInfo) => void): void;
+  setUpdateCameraCallback(callback: (position: Vector3) => void): void;
+  showComponent(index: number, options?: { color?: RGB | null; isolate?: boolean }): Promise<string[] | undefined>;
+  showDiff(before: GraphData, after: GraphData, options?: DiffOptions): Promise<{
+    nodes: { added: number; removed: number; changed: number };
+    links: { added: number; removed: number; changed: number };
+  }>;
+  startRecording(options?: RecordingOptions): boolean;
+  stopRecording(): Promise<Blob | undefined>;
+  stopTour(): void;
+  stopTraversal(): void;
+  setLabelDeclutter(enabled: boolean): void;
+  setLabelDistance(distance: number): void;
+  setLabelMode(mode: 'html' | 'sdf', style?: LabelStyle): void;
+  setLabelScreenSize(minSize: number): void;
+  setLevelOfDetail(enabled: boolean, levels?: DetailLevel[]): void;
+  setLinkStyle(style: LinkDrawingStyle): Promise<void>;
+  setMinimap(enabled: boolean, settings?: MinimapSettings): void;
+  setNavigationMode(mode: 'orbit' | 'fly', options?: FlyOptions): void;
+  setOcclusionCulling(enabled: boolean, settings?: { resolution?: number }): void;
+  suggest(query: string, options?: SearchOptions): Suggestion[];
+  toDataURL(type?: string): string;
+  tour(keyframes: TourKeyframe[], options?: { loop?: boolean }): Promise<void>;
+  traversePath(options?: TraversalOptions): Promise<void>;
+  toggleCurrencyMetabolites(hide?: boolean): Promise<boolean>;
+  toggleLabels(): void;
+  toggleLinkType(type: string, show?: boolean): Promise<boolean>;
+  toggleNodeType(nodeType: string): Promise<void>;
+  undo(): boolean;
+  updateAnnotation(id: string, changes: { text?: string; offset?: [number, number]; color?: string }): boolean;
+  updateGroup(id: string, style: { label?: string; color?: RGB; opacity?: number }): Promise<boolean>;
+  use(plugin: Plugin, options?: any): void;
+}
+
+/**
+ * Creates a rendering context for the Metabolic Atlas Viewer.
+ *
+ * @param targetElement - the ID of the target DOM element, or the element
+ */
+export function MetAtlasViewer(targetElement: string | HTMLElement): Viewer;
+
+export interface LinkOptions {
+  camera?: boolean;
+  hover?: boolean;
+  selection?: boolean;
+  /**
+   * Maps node IDs between the viewers, as a function returning the ID in
+   * viewer `to` (or null if there is none), or for two viewers as an object
+   * mapping the IDs of the first viewer to the IDs of the second.
+   */
+  map?: ((id: string, from: number, to: number) => string | null | undefined) |
+        { [id: string]: string };
+}
+
+export function linkViewers(viewers: Viewer[], options?: LinkOptions): { unlink(): void };
+
+export function joinHighlightBus(viewer: Viewer, channel?: string): { leave(): void };
+
+export function createSplitView(targetElement: string | HTMLElement, options?: LinkOptions & { vertical?: boolean }): {
+  viewers: [Viewer, Viewer];
+  unlink(): void;
+  dispose(): void;
+};
@@ -4,3 +4,4 @@
  */
 
 export { MetAtlasViewer } from './met-atlas-viewer.js';
+export { createSplitView, joinHighlightBus, linkViewers } from './linked-views.js';
@@ -0,0 +1,277 @@
+/**
+ * @file This file contains the data-driven style mappers of the Metabolic
+ * Atlas 3D Viewer. A mapper maps an element attribute to a visual property,
+ * and is given as an object like:
+ *
+ *   {attr: 'flux', scale: 'linear', range: [1, 8]}
+ *
+ * with the keys:
+ *  - attr: name of the attribute to map
+ *  - scale: 'linear' (default), 'sqrt', 'log', 'symlog', 'quantile' or
+ *    'categorical'. 'log' maps the logarithm of the values, and elements
+ *    with values of zero or below get the `missing` output. 'symlog' is
+ *    logarithmic for large values of either sign and linear around zero,
+ *    below `constant` (default 1). 'quantile' maps the rank of the values,
+ *    so that the outputs are evenly spread over the elements.
+ *  - domain: (optional) input domain, [min, max] for continuous scales or a
+ *    list of values for categorical scales. Defaults to the extent (or the
+ *    unique values) of the attribute over the elements matched by the
+ *    selector of the style rule. Values outside of the domain are
+ *    clamped. Continuous domain bounds can also be null, for the extent of
+ *    the attribute, or percentiles such as '2%' and '98%', which clamp
+ *    outliers.
+ *  - range: output range, [min, max] for continuous scales, where the values
+ *    can be numbers or [r, g, b] colors, or a list of outputs for categorical
+ *    scales.
+ *  - colormap: (optional) continuous color scale to use instead of a color
+ *    range: the name of a built-in ('viridis', 'cividis', 'magma', 'rdBu')
+ *    or registered (see `registerColormap` in palettes.js) scale, or the
+ *    color stops or function themselves.
+ *  - missing: (optional) output for elements without the attribute. If not
+ *    set, the property is left unset for those elements.
+ */
+
+import { categorical, colormapColor, continuous, interpolateStops } from './palettes';
+
+/**
+ * Returns true if `value` is a mapper specification.
+ *
+ * @param {*} value - a style property value
+ */
+function isMapper(value) {
+  return value !== null && typeof value === 'object' && !Array.isArray(value) &&
+         typeof value.attr === 'string';
+}
+
+/**
+ * Creates a mapping function from a mapper specification.
+ *
+ * @param {Object} spec - mapper specification
+ * @param {Array} values - the attribute values of all elements, used to set
+ *     the default domain
+ * @returns {Function} A function taking element attributes and returning the
+ *     mapped value.
+ */
+function makeMapper(spec, values) {
+  let present = values.filter(v => v !== undefined && v !== null);
+  let map;
+
+  if (spec.scale == 'categorical') {
+    let { domain, range } = categoricalScale(spec, present);
+    map = v => {
+      let i = domain.indexOf(v);
+      return i < 0 ? spec.missing : range[i % range.length];
+    };
+  } else {
+    let { position, output } = continuousScale(spec, present);
+    map = v => {
+      v = Number(v);
+      let t = isNaN(v) ? NaN : position(v);
+      return isNaN(t) ? spec.missing : output(Math.max(0, Math.min(1, t)));
+    };
+  }
+
+  return attributes => {
+    let v = attributes[spec.attr];
+    if (v === undefined || v === null) {
+      return spec.missing;
+    }
+    return map(v);
+  };
+}
+
+/**
+ * Resolves the domain and range of a categorical mapper.
+ *
+ * @param {Object} spec - mapper specification
+ * @param {Array} values - the attribute values of all elements
+ * @returns {Object} The scale, as {domain, range}.
+ */
+function categoricalScale(spec, values) {
+  return {
+    domain: spec.domain || [...new Set(values.filter(v => v !== undefined && v !== null))],
+    range: spec.range || categorical.okabeIto
+  };
+}
+
+/**
+ * Resolves a continuous mapper.
+ *
+ * @param {Object} spec - mapper specification
+ * @param {Array} values - the attribute values of all elements
+ * @returns {Object} The scale, as {domain, position, output, ticks}, where
+ *     position maps values to [0, 1] (or NaN), output maps [0, 1] to the
+ *     output range, and ticks(count) returns about `count` values to label
+ *     the scale with.
+ */
+function continuousScale(spec, values) {
+  let numbers = values.filter(v => v !== undefined && v !== null)
+    .map(Number).filter(v => !isNaN(v)).sort((a, b) => a - b);
+  let domain = resolveDomain(spec, numbers);
+  return {
+    domain: domain,
+    position: positioner(spec, domain, numbers),
+    output: interpolator(spec),
+    ticks: count => scaleTicks(spec, domain, numbers, count)
+  };
+}
+
+/**
+ * Returns evenly spaced round values in a range, such as 0, 0.5, 1.
+ *
+ * @param {number} low - start of the range
+ * @param {number} high - end of the range
+ * @param {number} count - approximate number of values
+ */
+function niceTicks(low, high, count) {
+  let span = high - low;
+  if (!(span > 0)) return isFinite(low) ? [low] : [];
+  let step = Math.pow(10, Math.floor(Math.log10(span / count)));
+  let error = span / count / step;
+  step *= error >= 7.5 ? 10 : error >= 3.5 ? 5 : error >= 1.5 ? 2 : 1;
+  let ticks = [];
+  for (let v = Math.ceil(low / step) * step; v <= high + step * 1e-9; v += step) {
+    // avoid floating point noise such as 0.30000000000000004
+    ticks.push(Number(v.toPrecision(12)));
+  }
+  return ticks;
+}
+
+/**
+ * Returns values to label a continuous scale with: round values for linear
+ * scales, powers of ten for log and symlog scales, and quartiles for
+ * quantile scales.
+ *
+ * @param {Object} spec - mapper specification
+ * @param {Array} domain - the resolved [min, max] domain
+ * @param {Array} sorted - the numeric attribute values in ascending order
+ * @param {number} count - approximate number of values
+ */
+function scaleTicks(spec, domain, sorted, count = 5) {
+  let [low, high] = domain;
+  let ticks = [];
+  if (spec.scale == 'quantile') {
+    let inside = sorted.filter(v => v >= low && v <= high);
+    for (let i = 0; i < count; i++) {
+      ticks.push(quantile(inside, i / Math.max(1, count - 1)));
+    }
+  } else if (spec.scale == 'log' || spec.scale == 'symlog') {
+    let c = spec.constant || 1;
+    let powers = [];
+    for (let e = -12; e <= 12; e++) {
+      powers.push(Math.pow(10, e));
+    }
+    if (spec.scale == 'symlog') {
+      powers = powers.filter(p => p >= c);
+      powers = powers.map(p => -p).reverse().concat([0], powers);
+    }
+    ticks = powers.filter(p => p >= low && p <= high);
+    // thin out ticks on scales that span many orders of magnitude
+    let every = Math.ceil(ticks.length / count);
+    ticks = ticks.filter((p, i) => i % every == 0);
+  }
+  if (ticks.length < 2) {
+    ticks = niceTicks(low, high, count);
+  }
+  return ticks.filter(v => !isNaN(v));
+}
+
+/**
+ * Returns the value at quantile `q` of sorted numbers.
+ *
+ * @param {Array} sorted - numbers in ascending order
+ * @param {number} q - the quantile, between 0 and 1
+ */
+function quantile(sorted, q) {
+  if (sorted.length == 0) return NaN;
+  let p = Math.max(0, Math.min(1, q)) * (sorted.length - 1);
+  let i = Math.floor(p);
+  return i + 1 < sorted.length ? sorted[i] + (sorted[i+1] - sorted[i]) * (p - i) : sorted[i];
+}
+
+/**
+ * Returns the [min, max] domain of a continuous mapper, resolving missing
+ * and percentile bounds from the attribute values. For log scales, the
+ * lower bound is raised to the smallest positive value.
+ *
+ * @param {Object} spec - mapper specification
+ * @param {Array} sorted - the numeric attribute values in ascending order
+ */
+function resolveDomain(spec, sorted) {
+  const bound = (value, q) => {
+    if (value === undefined || value === null) return quantile(sorted, q);
+    if (typeof value == 'string' && value.trim().endsWith('%')) {
+      return quantile(sorted, parseFloat(value) / 100);
+    }
+    return Number(value);
+  };
+  let domain = spec.domain || [];
+  let low = bound(domain[0], 0);
+  let high = bound(domain[1], 1);
+  if (spec.scale == 'log' && !(low > 0)) {
+    let positive = sorted.find(v => v > 0);
+    low = positive !== undefined ? Math.min(positive, high) : NaN;
+  }
+  return [low, high];
+}
+
+/**
+ * Returns a function that maps attribute values to positions on a
+ * continuous scale, where the domain maps to [0, 1]. Positions are NaN for
+ * values that can't be mapped, such as zero on a log scale.
+ *
+ * @param {Object} spec - mapper specification
+ * @param {Array} domain - the resolved [min, max] domain
+ * @param {Array} sorted - the numeric attribute values in ascending order
+ */
+function positioner(spec, domain, sorted) {
+  if (spec.scale == 'quantile') {
+    let inside = sorted.filter(v => v >= domain[0] && v <= domain[1]);
+    return v => {
+      if (inside.length < 2) return 0.5;
+      // rank of the value, by binary search
+      let lo = 0, hi = inside.length;
+      while (lo < hi) {
+        let mid = (lo + hi) >> 1;
+        if (inside[mid] < v) lo = mid + 1; else hi = mid;
+      }
+      return lo / (inside.length - 1);
+    };
+  }
+
+  let c = spec.constant || 1;
+  let f = spec.scale == 'log' ? v => v > 0 ? Math.log(v) : NaN :
+          spec.scale == 'symlog' ? v => Math.sign(v) * Math.log1p(Math.abs(v) / c) :
+          v => v;
+  let low = f(domain[0]);
+  let span = f(domain[1]) - low;
+  return v => {
+    let t = span > 0 ? (f(v) - low) / span : isNaN(f(v)) ? NaN : 0.5;
+    return spec.scale == 'sqrt' ? Math.sqrt(Math.max(0, Math.min(1, t))) : t;
+  };
+}
+
+/**
+ * Returns a function that maps [0, 1] to the output range of a continuous
+ * mapper.
+ *
+ * @param {Object} spec - mapper specification
+ */
+function interpolator(spec) {
+  if (spec.colormap) {
+    let colormap = typeof spec.colormap === 'string' ? continuous[spec.colormap] :
+                   spec.colormap;
+    if (!colormap) {
+      console.warn("unknown colormap: '" + spec.colormap + "', using 'viridis'.");
+      colormap = continuous.viridis;
+    }
+    return t => colormapColor(colormap, t);
+  }
+  let range = spec.range || [0, 1];
+  if (Array.isArray(range[0])) {
+    return t => interpolateStops(range, t);
+  }
+  return t => range[0] + (range[range.length-1] - range[0]) * t;
+}
+
+export { categoricalScale, continuousScale, isMapper, makeMapper };
@@ -5,21 +5,29 @@
  */
 
 import {
+  AmbientLight,
   BufferGeometry,
   Color,
+  DirectionalLight,
+  Fog,
   Float32BufferAttribute,
   Frustum,
   Group,
   LineBasicMaterial,
   LineSegments,
   Matrix4,
+  Mesh,
+  MeshBasicMaterial,
   NearestFilter,
   PerspectiveCamera,
   Points,
   PointsMaterial,
+  Quaternion,
   Scene,
+  SphereGeometry,
   TextureLoader,
   Uint8BufferAttribute,
+  Vector3,
   VertexColors,
   WebGLRenderer,
   WebGLRenderTarget,
@@ -31,17 +39,62 @@ import {
 } from './CSS2DRenderer';
 
 import { AtlasViewerControls } from './atlas-viewer-controls';
-import { makeIndexSprite } from './helpers';
+import { FlyControls } from './fly-controls';
+import { makeArrowMesh, setArrowColor } from './arrows';
+import { makeIconMesh } from './icons';
+import { makeWideLineMesh } from './wide-lines';
+import { makeGlyphAtlas, makeTextMesh, setTextLayout } from './sdf-text';
+import { layoutLabels } from './label-layout';
+import { BLOOM_LAYER, PostProcessing } from './post-processing';
+import { computeOcclusion } from './ambient-occlusion';
+import { extendLinkMaterial, extendNodeMaterial } from './node-material';
+import { computeStyles, isValidSelector, parseSelector } from './stylesheet';
+import { categoricalScale, continuousScale, isMapper, makeMapper } from './mappers';
+import { drawLegend } from './legend';
+import { cornerPosition, drawCallouts, drawGizmo } from './image-overlays';
+import { fluxLegend, foldChanges, linkFluxStyles, nodeOverlayValues, overlayColors } from './overlays';
+import { categorical, colorVisionMapping, registerColormap as addColormap } from './palettes';
+import { splitAlpha, themes } from './themes';
+import { ease, makeDiscSprite, makeIndexSprite, spriteCoverage } from './helpers';
+import { buildGraph, buildGraphInWorker } from './graph-builder';
+import { LevelOfDetail, registerShape } from './level-of-detail';
+import { exportNetworkGLTF } from './gltf-export';
+import { encodeGIF } from './gif-encoder';
+import { SearchIndex } from './search-index';
+import { Minimap, planeToWorld } from './minimap';
+import { DebugOverlay } from './debug-overlay';
+import { Announcer } from './announcer';
+import { NetworkSummary, summarizeNetwork } from './summary';
+import { XRMode } from './xr-mode';
+import { Stereo } from './stereo';
+import { Octree } from './octree';
+import { OcclusionCulling } from './occlusion-culling';
+import { bookmarkId, loadBookmarks, saveBookmarks, validBookmarks } from './bookmarks';
+import { AnnotationLayer, annotationId, validAnnotations } from './annotations';
+import { Sketch, strokeId } from './sketch';
+import { collapseGraph, collapsedId, inGroup, metanodeId } from './metanodes';
+import { groupId, makeHullMesh } from './node-groups';
+import { findClustersInWorker } from './clustering';
+import { currencyTest, defaultCurrency, splitNodes } from './currency';
+import { subsystemGraph } from './subsystems';
+import { Breadcrumb } from './breadcrumb';
+import { SmallMultiples } from './small-multiples';
+import { diffGraphs } from './network-diff';
+import { ParticleFlow } from './particle-flow';
+import { SelectionOverlay, pointBounds, pointInPolygon } from './selection-tools';
+import { connectedComponents, lightestPath, shortestPath } from './graph-algorithms';
+import { sceneMemory } from './stats';
 
 /**
  * Creates a rendering context for the Metabolic Atlas Viewer.
  *
- * @param {string} targetElement - The ID of the target DOM element where the
- *     viewer should be placed.
+ * @param {string|Object} targetElement - The ID of the target DOM element where
+ *     the viewer should be placed, or the element itself.
  * @returns {Object} A control object with functions for controlling the viewer.
  */
 function MetAtlasViewer(targetElement) {
-  const container = document.getElementById(targetElement)
+  const container = typeof targetElement === 'string' ?
+    document.getElementById(targetElement) : targetElement;
 
   // Camera variables
   let fieldOfView = 90;
@@ -52,6 +105,17 @@ function MetAtlasViewer(targetElement) {
   camera.position.z = 3000;
   let nodeSelectCallback, updateCameraCallback;
 
+  // Handlers registered with `on`, formatted as {<event type>: [handler]}
+  const viewerEvents = ['nodeClick', 'nodeHover', 'edgeClick', 'selectionChange',
+                        'cameraChange', 'dataLoaded', 'renderFrame', 'tick'];
+  var eventHandlers = {};
+
+  // Plugins added with `use`, formatted as [{plugin, handlers}], where
+  // handlers are the event handlers registered for the plugin hooks
+  var plugins = [];
+  // The node under the mouse pointer, as last reported with 'nodeHover'
+  var hoveredItem;
+
   var cameraDefault = {
     position: Object.assign({}, camera.position),
     up: Object.assign({}, camera.up),
@@ -68,6 +132,13 @@ function MetAtlasViewer(targetElement) {
     runTime: 750
   };
 
+  // Whether to replace animations with instant changes, see
+  // `setReducedMotion`. 'auto' follows the prefers-reduced-motion setting of
+  // the browser.
+  var reducedMotion = 'auto';
+  var reducedMotionQuery = window.matchMedia ?
+    window.matchMedia('(prefers-reduced-motion: reduce)') : undefined;
+
   // Set default colors
   var nodeDefaultColor = [255,255,255];
   var connectionStartColor = [0, 127, 255];
@@ -76,15 +147,95 @@ function MetAtlasViewer(targetElement) {
   var connectionSelectColor = [255, 255, 0];
   var hoverSelectColor = [255, 0, 255];
   var hoverConnectionColor = [255, 0, 0];
+  var pathColor = [0, 230, 230];
+  var matchColor = [255, 200, 0];
+  var currentMatchColor = [255, 120, 0];
+
+  // Color vision mode, one of 'normal', 'deuteranopia', 'protanopia' or
+  // 'tritanopia'. In the color-blind modes, node colors are remapped to a
+  // color-blind-safe palette.
+  var colorVisionMode = 'normal';
+
+  // Style rules for nodes and links, see `setStyle`
+  var styleRules = [];
+
+  // Node sizing by degree or another numeric attribute, see `setNodeSizing`
+  var nodeSizing = null;
+
+  // The expression overlay on the nodes, formatted as {values, options}, see
+  // `setExpressionOverlay`
+  var expressionOverlay;
+
+  // The small multiples, formatted as {conditions, options, panels, scale},
+  // where panels holds the overlay fields of each node in each condition,
+  // see `setSmallMultiples`
+  var smallMultiples;
+
+  // The flux overlay on the links, formatted as {values, options}, see
+  // `setFluxOverlay`
+  var fluxOverlay;
+
+  // Default missing data style of the expression overlay
+  const missingDefaults = {missing: 'grey',
+                           missingColor: [150, 150, 150],
+                           missingOpacity: 0.15};
+
+  // Time-series playback of overlay snapshots, see `setTimeline`
+  var timeline;
+
+  // Pixel ratio used while rendering an exported image, see `exportImage`
+  var exportPixelRatio;
+
+  // The active video recording, formatted as {recorder, done}, where done
+  // is a promise of the video, see `startRecording`
+  var recording;
+
+  // Full-text index of the node IDs, names and annotations, see `search`
+  var searchIndex = SearchIndex();
+  // The highlighted search matches, formatted as {query, options, nodes:
+  // [<node index>], positions: <map of node indices to their position in
+  // nodes>, current: <position of the current match>}, see
+  // `highlightMatches`
+  var searchMatches = {query: undefined, options: {}, nodes: [], positions: new Map(),
+                       current: -1};
+  // Node data fields which aren't annotations, and aren't searched
+  const unsearchedFields = ['id', 'n', 'g', 'pos', 'color', 'shape', 'icon'];
+
+  // Color legends kept in sync with the active color scale, formatted as
+  // [{canvas, options}], see `createLegend`
+  var legends = [];
+
+  // Animated particles moving along the links with a flux, see
+  // `setParticleFlow`
+  var particleFlow = ParticleFlow();
+  var particleOptions = {
+    enabled: false,
+    count: 3,
+    speed: 300,
+    size: 0.4
+  };
+
+  // Label colors, set by the theme
+  var labelColors = {
+    color: 'rgba(255,255,255,0.9)',
+    background: 'rgba(0,0,0,0.6)'
+  };
 
   // Create the scene and set background
   var scene = new Scene();
   scene.background = new Color( 0xdddddd );
+  scene.add(particleFlow.group);
 
-  // Create color picking scene and target
+  // Add lights for the node geometries. The directional light follows the
+  // camera so that the lit side of the nodes is always facing the viewer.
+  scene.add(new AmbientLight(0xffffff, 0.5));
+  var headLight = new DirectionalLight(0xffffff, 0.6);
+  camera.add(headLight);
+  scene.add(camera);
+
+  // Create the color picking scene, used for region selections
   var indexScene = new Scene();
   indexScene.background = new Color( 0xffffff );
-  var indexTarget = new WebGLRenderTarget(1,1);
 
   // Create object group for the graph
   var graph = new Group();
@@ -93,27 +244,178 @@ function MetAtlasViewer(targetElement) {
   // later
   var nodeMesh;
   var connectionMesh;
+  var wideLineMesh;
+  var arrowMesh;
+  var iconMesh;
+
+  // Node icon controls. The atlas is a grid of `columns` x `rows` icons, and
+  // `icons` maps icon names to their position in the grid. `groups` maps node
+  // groups to icon names, and `size` is the icon size relative to the nodes.
+  var iconStyle = {
+    atlas: undefined,
+    columns: 1,
+    rows: 1,
+    icons: {},
+    groups: {},
+    size: 0.6
+  };
+  var iconTexture;
+
+  // Level-of-detail geometries for the nodes, drawn on top of the node sprites
+  // when enabled.
+  // Custom node shapes of this viewer, see `registerNodeShape`
+  var customShapes = {};
+  var levelOfDetail = LevelOfDetail(undefined, customShapes);
+  var useLevelOfDetail = false;
+  var currentNodeSize;
 
   // Create color and material arrays for the nodes
-  var nodeColors = [];
-  var indexColors = [];
 
   // Create a list to keep track of selected nodes.
   var selected = [];
 
+  // Maps node IDs to their index in `nodeInfo`
+  var nodeIds = {};
+
+  // Spatial index of the node positions, for picking and proximity queries
+  var octree = Octree();
+
+  // Occlusion culling options, see `setOcclusionCulling`. The culled nodes
+  // are only updated when the camera moves, or when `cullingKey` is reset.
+  var occlusionCulling = {
+    enabled: false,
+    resolution: 64
+  };
+  var occlusionCuller = OcclusionCulling(occlusionCulling.resolution);
+  var cullingKey;
+  // how much of the sprite of each node group hides what's behind it, see
+  // `spriteCoverage`
+  var spriteCoverages = {};
+
   // Create another reference to keep track of hover-selected node
   var hoverNode;
 
+  // Number of link hops around selected and hovered nodes to highlight
+  var highlightDepth = 1;
+
+  // The path highlighted by `findPath`, formatted as {nodes: Map(<node
+  // index>: <step>), links: Map(<link index>: <step>), steps: <link count>,
+  // shown: <steps shown>, start: <time>}. The path is revealed one step at
+  // a time.
+  var highlightedPath;
+  const pathStepTime = 150;
+
+  // Animation walking along the highlighted path, see `traversePath`
+  var pathTraversal;
+
+  // The running camera tour, see `tour`
+  var cameraTour;
+
+  // The node with keyboard focus, and the node whose neighbors are cycled
+  // through with tab, see `onKeydown`
+  var focusedNode;
+  var focusAnchor;
+  // whether the tooltip was opened from the keyboard, so that it follows the
+  // focus
+  var focusTooltip = false;
+
+  // Undo and redo stacks of user interactions, formatted as [{undo, redo}],
+  // see `record`. `replaying` is set while an entry is undone or redone, so
+  // that the changes aren't recorded again.
+  var undoStack = [];
+  var redoStack = [];
+  const maxHistory = 100;
+  var replaying = false;
+  // IDs of the selected nodes, as last recorded in the undo stack
+  var recordedSelection = [];
+
+  // Back and forward history of camera jumps, see `goBack`. The entries are
+  // views formatted as {position, up, target, node}, where node is the ID of
+  // the focused node, if any, and `index` is the entry of the current view.
+  // `navigating` is set while moving through the history, so that the moves
+  // aren't recorded again.
+  var navigationHistory = {entries: [], index: -1};
+  var navigating = false;
+
+  // Bookmarked nodes and views, see `addBookmark`. They are saved in
+  // localStorage under `bookmarkKey`, or only kept in memory if it's null.
+  // Other viewers on the page can save under the same key, so the saved
+  // bookmarks are read again before they are used or changed.
+  var bookmarkKey = 'met-atlas-viewer-bookmarks';
+  var bookmarks = loadBookmarks(bookmarkKey);
+
+  // Notes pinned to nodes and links, see `addAnnotation`. They are part of
+  // the view state, and their callouts are placed in `render`.
+  var annotations = [];
+
+  // The last clicked node, used as the start of shift-click path selections
+  var lastClicked;
+
+  // Adjacency list of the nodes (by index), created when first needed
+  var adjacency;
+  // The connected components, as lists of node indices, largest first. The
+  // component of each node is also in its info.
+  var components = [];
+  // The style rule coloring a component, see `showComponent`
+  var componentRule;
+  // The style rules coloring a network diff, see `showDiff`
+  var diffRules = [];
+
+  // Callback which returns the neighbors to add when a node is expanded, see
+  // `setExpandCallback`
+  var expandCallback;
+
+  // Nodes that are growing into the graph after being added, formatted as
+  // {items: [<node index>], scales: [<final scale>], start: <time>}
+  var growNodes;
+  const growTime = 500;
+
+  // The chunks being shown by `loadData`, cleared when other data is set
+  var chunkReveal;
+
   // Create a texture loader for later
   const textureLoader = new TextureLoader();
 
   // Create renderer
-  var renderer = new WebGLRenderer();
+  // the alpha channel is needed for transparent image exports
+  var renderer = new WebGLRenderer({alpha: true});
   renderer.setSize(container.offsetWidth, container.offsetHeight);
-
-  // Add the renderer to the target element
+  // the render statistics are reset once per frame instead of once per render
+  // call, so that they include all passes, see `getStats`
+  renderer.info.autoReset = false;
+  var frameInfo = {calls: 0, triangles: 0, points: 0, lines: 0};
+
+  // Add the renderer to the target element. An inline canvas sits on the
+  // text baseline, which leaves a gap below it that grows the container, so
+  // the resize observer would keep growing the canvas.
+  renderer.domElement.style.display = 'block';
   container.appendChild(renderer.domElement);
 
+  // Create the optional post-processing pipeline, and a group for highlighted
+  // objects which are drawn with bloom when it's enabled.
+  var postProcessing = PostProcessing(renderer, scene, camera);
+  var highlight = new Group();
+  scene.add(highlight);
+
+  // Depth fog options. With `auto`, the fog starts at the near side of the
+  // graph and ends at the far side, as seen from the camera.
+  var fogOptions = {
+    enabled: false,
+    color: undefined,
+    near: 1000,
+    far: 5000,
+    auto: true,
+    desaturation: 0.8
+  };
+  var fogDesaturation = {value: 0};
+
+  // Baked ambient occlusion options, darkening nodes in dense regions.
+  var ambientOcclusion = {
+    enabled: false,
+    radius: 100,
+    strength: 0.6
+  };
+
   // Add a label-renderer for node labels
   var labelRenderer = new CSS2DRenderer();
   labelRenderer.setSize( container.offsetWidth, container.offsetHeight );
@@ -129,6 +431,31 @@ function MetAtlasViewer(targetElement) {
   var showLabels = true;
   var labelDistance = 200;
 
+  // Labels are drawn either as 'html' elements, or as 'sdf' text in the scene
+  var labelMode = 'html';
+  var labelStyle = {
+    font: 'monospace',
+    size: 6,
+    color: 0xffffff,
+    outlineColor: 0x000000
+  };
+  var glyphAtlas;
+  var textMesh;
+
+  // When decluttering is on, overlapping labels are nudged or hidden, with
+  // selected, hovered and high-degree nodes being labeled first. It's off by
+  // default, so that labels are placed as they always were.
+  var declutterLabels = false;
+
+  // Minimum on-screen node size in pixels for a node to be labeled, so that
+  // labels appear progressively as the camera gets closer.
+  var labelMinScreenSize = 0;
+
+  // Minimum on-screen node size in pixels for a node to be drawn, see
+  // `setNodeScreenSize`, and the shader uniform in device pixels
+  var nodeMinScreenSize = 0;
+  var minPointSize = {value: 0};
+
   // Create a div to use for node mouseover information
   var infoBox = document.createElement('div');
   infoBox.style.position = 'fixed';
@@ -141,22 +468,227 @@ function MetAtlasViewer(targetElement) {
   infoBox.style.border = '1px solid rgba(0,0,0,0.6)';
   container.appendChild(infoBox);
 
-  // Add window resize listener and mouse listener
-  window.addEventListener('resize', onWindowResize, false);
+  // A ring around the node with keyboard focus, placed in `render`
+  var focusRing = document.createElement('div');
+  focusRing.className = 'met-atlas-focus-ring';
+  focusRing.style.position = 'absolute';
+  focusRing.style.pointerEvents = 'none';
+  focusRing.style.borderRadius = '50%';
+  focusRing.style.border = '2px solid #ffbf00';
+  focusRing.style.boxShadow = '0 0 0 2px rgba(0,0,0,0.6)';
+  focusRing.hidden = true;
+  container.appendChild(focusRing);
+
+  // Tooltip controls. `content` is a function which takes the hovered node
+  // and returns the tooltip as an HTML string or a DOM node, and `node` is
+  // the node the tooltip is currently showing.
+  var tooltip = {
+    content: undefined,
+    offset: 5,
+    node: undefined
+  };
+
+  // Screen reader announcements of hover, focus and selection changes, see
+  // `setAnnouncements`
+  var announcer = Announcer(container);
+  var announcements = {
+    enabled: true,
+    hover: true,
+    format: undefined
+  };
+
+  // Off-screen text summary of the view for screen readers, updated a while
+  // after the view changes, see `setSummary`
+  var networkSummary = NetworkSummary(container);
+  var summaryOptions = {
+    enabled: true,
+    compartment: 'compartment',
+    subsystem: 'subsystem',
+    maxItems: 10
+  };
+  var summaryTimeout;
+
+  // Box selection controls. Shift-dragging selects all nodes inside the
+  // dragged rectangle, or inside the freehand lasso in 'lasso' mode. By
+  // default only nodes which are visible in the region are selected,
+  // `includeOccluded` also selects the nodes hidden behind other nodes.
+  var boxSelection = {
+    enabled: true,
+    mode: 'box',
+    includeOccluded: false
+  };
+  // the selection region being dragged, as a list of [x, y] page points
+  var selectionDrag;
+  var selectionOverlay = SelectionOverlay(container);
+
+  // Freehand drawing, see `setDrawingTool`. With the pen, dragging draws a
+  // stroke on a plane facing the camera, and with the eraser, dragging over
+  // strokes removes them. `drawingStroke` is the stroke being drawn, and
+  // `drawingPlane` its plane, formatted as {point, normal}.
+  var drawing = {
+    tool: 'none',
+    color: [255, 64, 64],
+    width: 4
+  };
+  var drawingStroke;
+  var drawingPlane;
+  var sketch = Sketch(scene);
+
+  // Overview panel of the whole network, see `setMinimap`
+  var minimap = Minimap(container, navigateMinimap);
+
+  var breadcrumb = Breadcrumb(container, step => restoreIsolation(step));
+
+  // Grid of panels, one per overlay condition, see `setSmallMultiples`
+  var multiples = SmallMultiples(renderer, container);
+
+  var annotationLayer = AnnotationLayer(container, (id, event) => {
+    let annotation = annotations.find(a => a.id == id);
+    emit('annotationClick', {annotation: copyAnnotation(annotation), event: event});
+  });
+
+  // Frame rate and frame time panel, see `setDebugOverlay`. Picking happens
+  // between frames, so its time is summed up until the next frame.
+  var debugOverlay = DebugOverlay(container);
+  var pickingTime = 0;
+
+  // Immersive VR mode, see `enterVR`. The camera view before the session is
+  // restored after it, and `xrRendering` is set while rendering a frame of
+  // the session, as frames can't be rendered outside of the session loop.
+  var xrMode = XRMode(renderer, scene, camera, {
+    pick: (origin, direction) => raycastNodes(origin, direction, 0),
+    hover: onXRHover,
+    select: onXRSelect,
+    drag: onXRDrag,
+    drop: onXRDrop,
+    end: onXREnd
+  });
+  var xrSavedView;
+  var xrRendering = false;
+
+  // Anaglyph or side-by-side stereo rendering, see `setStereo`
+  var stereoRenderer = Stereo(renderer);
+  var stereoOptions = {
+    mode: 'none',
+    eyeSeparation: undefined,
+    swapEyes: false
+  };
+
+  // Follow the size of the container, falling back to window resizes in
+  // browsers without ResizeObserver, and watch for device pixel ratio
+  // changes, e.g. when the window is moved to another screen
+  var resizeObserver;
+  if (typeof ResizeObserver !== 'undefined') {
+    resizeObserver = new ResizeObserver(onWindowResize);
+    resizeObserver.observe(container);
+  } else {
+    window.addEventListener('resize', onWindowResize, false);
+  }
+  var pixelRatioQuery;
+  watchPixelRatio();
+
+  // Add mouse listeners
   window.addEventListener('mousemove', onMouseMove, false);
   window.addEventListener('pointerdown', onMouseClick, false);
+  renderer.domElement.addEventListener('pointerdown', onSelectionStart, false);
+  renderer.domElement.addEventListener('pointerdown', onDrawStart, false);
+  // let the camera controls handle all touch gestures, instead of the browser
+  // zooming or scrolling the page
+  renderer.domElement.style.touchAction = 'none';
+  renderer.domElement.addEventListener('contextmenu', onContextMenu, false);
+  renderer.domElement.addEventListener('dblclick', onDoubleClick, false);
+
+  // The container takes keyboard focus when clicked, for keyboard navigation
+  if (container.tabIndex < 0) {
+    container.tabIndex = 0;
+  }
+  container.addEventListener('keydown', onKeydown, false);
+  renderer.domElement.addEventListener('pointerdown', focusContainer, false);
   window.addEventListener('keypress', onKeypress, false);
 
+  // The id of the pending animation frame, and whether the viewer has been
+  // disposed, see `dispose`
+  var animationFrame;
+  var disposed = false;
+
   // Set a camera control placeholder
   var cameraControls;
 
+  // Control bindings which are applied to the camera controls, see
+  // `setControlBindings`
+  var controlBindings = {};
+
   // holds information to connect nodes to graph id's
   var nodeInfo = [];
 
   // initial data for setData, this should only be set once
   let initialData = null;
+  // the data currently shown in the viewer
+  let currentData = null;
+
+  // holds the vertex range of each link in the connection mesh
+  var linkInfo = [];
+
+  // link style controls
+  var linkStyle = {
+    curvature: 0,
+    segments: 12,
+    cubic: false,
+    reversible: 'both',
+    dashes: 8,
+    width: 1
+  };
+
+  // arrowhead controls. `types` maps link types to whether they should be
+  // drawn with arrowheads, types that are not in the map are drawn with
+  // arrowheads.
+  var arrowStyle = {
+    show: false,
+    size: 1,
+    types: {}
+  };
 
   let showGenes = true;
+  // the node type hidden by `toggleNodeType`, if any
+  let hiddenNodeType;
+
+  // Node groups collapsed into metanodes, see `collapseGroup`. `base` is the
+  // graph data without the collapsed groups and node filters, and `data` the
+  // graph data shown with them, so that other data replaces the collapsed
+  // groups.
+  var collapsed = {groups: [], base: undefined, data: undefined};
+  // Filters hiding nodes and links, by name, see `filterGraph`. The filters
+  // stay on when other data is set.
+  var nodeFilters = {};
+  // the filter layers of `setFilter`
+  var filterLayers = [];
+  // the currency metabolites, see `toggleCurrencyMetabolites` and
+  // `duplicateCurrencyMetabolites`
+  var currency = {names: defaultCurrency.slice(), hidden: false, duplicated: false};
+  // the subsystems shown, see `setSubsystemFilter`, and the style rules
+  // greying out the boundary nodes and links
+  var subsystemFilter;
+  var boundaryRules = [];
+  // the degree range of the nodes shown, see `setDegreeFilter`
+  var degreeFilter;
+  // the link types hidden by `toggleLinkType`
+  var hiddenLinkTypes = new Set();
+  // the isolated views, see `isolate`, formatted as [{ids, label}], where
+  // ids is the set of node IDs shown
+  var isolation = [];
+  var metanodeSprite;
+
+  // User-defined node groups, see `createGroup`, and the meshes of their
+  // hulls. Collapsed groups are also in `collapsed`.
+  var nodeGroups = [];
+  var hullMeshes = [];
+
+  // The style rule coloring the nodes by cluster, and the cluster of each
+  // node ID under its attribute name, see `detectClusters`. The clusters are
+  // added to copies of the node data, so the data of the caller is left as
+  // it is.
+  var clusterRule;
+  var clusterLabels;
 
   // Set default controls
   setCameraControls(AtlasViewerControls);
@@ -167,19 +699,36 @@ function MetAtlasViewer(targetElement) {
    * The data should be formatted as:
    * nodes = [{id: <node ID>, pos: (<x-pos>, <y-pos>, <z-pos>), g: <group>,
    *           (optional) color: [<r>, <g>, <b>],
+   *           (optional) shape: <shape>,
+   *           (optional) icon: <icon name>,
    *           ...
    *          ]
-   * links = [{s: <node ID>, t: <node ID>},
+   * links = [{s: <node ID>, t: <node ID>,
+   *           (optional) type: <link type>,
+   *           (optional) reversible: <true/false>,
+   *           (optional) curvature: <curvature>,
+   *           (optional) width: <width in pixels>},
    *           ...
    *          ]
    * where 's' and 't' should be the id of the start and end nodes of the link.
+   * The optional link curvature overrides the curvature set by `setLinkStyle`.
+   * Reversible links are drawn dashed and/or with arrowheads in both
+   * directions, as set by `setLinkStyle`. The optional link width overrides
+   * the width set by `setLinkStyle`, and can also be set with `setStyle`.
    *
    * @param {object} graphData - graph data formatted like {nodes:[], links: []}
    * @param {object} nodeTexture - texture images formatted as [{group:group,
-   *     sprite:<image>}]
+   *     sprite:<image>, (optional) shape:<shape>}], where shape is the 3D
+   *     shape used for the group when node geometries are enabled with
+   *     `setLevelOfDetail`. Valid shapes are 'sphere' (default), 'cube',
+   *     'octahedron', 'tetrahedron', 'cylinder', 'torus', 'sprite' (always
+   *     draw as a sprite), and shapes added with `registerNodeShape`. A shape
+   *     set on a node overrides the shape of its group.
    * @param {object} nodeSize - Size of the nodes in graph coordinates
+   * @param {object} built - (optional) the graph built by `loadData`,
+   *     built here if not given
    */
-  async function setData({ graphData, nodeTextures, nodeSize }) {
+  async function setData({ graphData, nodeTextures, nodeSize }, built) {
     if (!initialData) {
       initialData = {
         graphData,
@@ -187,6 +736,15 @@ function MetAtlasViewer(targetElement) {
         nodeSize,
       };
     }
+    if (graphData !== collapsed.data) {
+      collapsed = {groups: [], base: undefined, data: undefined};
+      if (isTransformed()) {
+        collapsed = {groups: [], base: graphData, data: transformGraph(graphData, nodeSize)};
+        graphData = collapsed.data;
+        built = undefined;
+      }
+    }
+    currentData = { graphData, nodeTextures, nodeSize };
 
     // reset graph
     scene.remove(graph);
@@ -194,45 +752,35 @@ function MetAtlasViewer(targetElement) {
     requestAnimationFrame(render);
     graph = new Group();
     nodeInfo = [];
-    nodeColors = [];
-    indexColors = [];
-
-    let nodes = graphData.nodes;
-    let links = graphData.links;
-
-    // Make an index to keep track of nodes for the connections
-    var nodeIndex = {}
+    nodeIds = {};
+    hideTooltip();
+    adjacency = undefined;
+    lastClicked = undefined;
+    focusedNode = undefined;
+    focusAnchor = undefined;
+    focusTooltip = false;
+    stopTraversal();
+    highlightedPath = undefined;
+    linkInfo = [];
+    chunkReveal = undefined;
+
+    // Build the vertex buffers and link curves, with the nodes sorted by
+    // group so that we can set the materials properly
+    if (!built) {
+      built = buildGraph(graphData, buildOptions(nodeSize));
+    }
+    let nodes = built.nodes;
+    let links = built.links;
 
     // create the node and index geometries
     var nodeGeometry = new BufferGeometry();
     var indexGeometry = new BufferGeometry();
 
-    // Sort the vertex positions by group, so that we can set the materials
-    // properly
-    nodes.sort((a,b) => a.g.localeCompare(b.g));
-
     // Sort the materials as well so that the arrays match
     nodeTextures.sort((a,b) => a.group.localeCompare(b.group));
 
-    // Set node positions and colors, and set a unique index color for each
-    // node. The index color will be used for selecting nodes in the scene.
-    var nodePositions = [];
-    var nodeGroups = {};
     nodes.forEach((node,i) => {
-      nodePositions.push.apply(nodePositions, node.pos);
-      if (nodeGroups[node.g] === undefined) {
-        nodeGroups[node.g] = 1;
-      } else {
-        nodeGroups[node.g] += 1;
-      }
-      let color = node.color ? node.color : nodeDefaultColor;
-      nodeColors.push.apply(nodeColors, color);
-      indexColors.push(Math.floor(i/(256*256)),
-                       Math.floor(i/256) % 256,
-                       i % 256
-                      );
-      // update index
-      nodeIndex[node.id] = {pos: node.pos, index: i};
+      nodeIds[node.id] = i;
 
       // create a label div for the node
       let text = document.createElement( 'div' );
@@ -240,10 +788,10 @@ function MetAtlasViewer(targetElement) {
       text.textContent = node.n;
       text.style.fontSize = '11px';
       text.style.fontFamily = 'monospace';
-      text.style.color = 'rgba(255,255,255,0.9)';
+      text.style.color = labelColors.color;
       text.style.marginTop = '-1em';
       text.style.padding = '5px';
-      text.style.background = "rgba(0,0,0,0.6)";
+      text.style.background = labelColors.background;
       var label = new CSS2DObject( text );
       label.position.copy( {x: node.pos[0], y: node.pos[1], z: node.pos[2]} );
 
@@ -252,24 +800,54 @@ function MetAtlasViewer(targetElement) {
         n: node.n,
         pos: node.pos,
         color: node.color ? node.color : nodeDefaultColor,
+        dataColor: node.color,
         connections: {to:[], from:[]},
         index: i,
         label: label,
-        group: node.g});
+        shape: node.shape,
+        icon: node.icon,
+        group: node.g,
+        data: node,
+        style: {}});
     });
     scene.add( labels );
+    buildSearchIndex();
+    octree.build(nodeInfo.map(node => node.pos));
+    cullingKey = undefined;
+    minimap.invalidate();
 
     // bind arrays to node geometry attributes
     nodeGeometry.setAttribute('position',
-                              new Float32BufferAttribute(nodePositions, 3));
+                              new Float32BufferAttribute(built.positions, 3));
     nodeGeometry.setAttribute('color',
-                              new Uint8BufferAttribute(nodeColors, 3, true));
+                              new Uint8BufferAttribute(built.colors, 3, true));
+    nodeGeometry.setAttribute('occlusion',
+                              new Float32BufferAttribute(
+                                new Float32Array(nodes.length).fill(1), 1));
+    // right half colors of split nodes, see `setComparisonOverlay`
+    nodeGeometry.setAttribute('secondColor',
+                              new Uint8BufferAttribute(
+                                new Uint8Array(nodes.length * 4), 4, true));
+    // node scale and opacity are shared with the index geometry, so that
+    // picking matches what's on screen
+    let nodeScales = new Float32BufferAttribute(
+      new Float32Array(nodes.length).fill(1), 1);
+    let nodeOpacities = new Float32BufferAttribute(
+      new Float32Array(nodes.length).fill(1), 1);
+    // nodes hidden by occlusion culling aren't picked either
+    let nodesCulled = new Float32BufferAttribute(new Float32Array(nodes.length), 1);
+    nodeGeometry.setAttribute('nodeScale', nodeScales);
+    nodeGeometry.setAttribute('nodeOpacity', nodeOpacities);
+    nodeGeometry.setAttribute('culled', nodesCulled);
+    // nodes drawn as geometry instead of sprites, see `setLevelOfDetail`
+    nodeGeometry.setAttribute('meshed',
+                              new Float32BufferAttribute(new Float32Array(nodes.length), 1));
     nodeGeometry.computeBoundingSphere();
 
     let last = 0;
     // Set material groups
     nodeTextures.forEach(function(texture, i) {
-      let current = nodeGroups[texture.group];
+      let current = built.groupCounts[texture.group] || 0;
       nodeGeometry.addGroup(last, current, i);
       indexGeometry.addGroup(last, current, i);
       last += current;
@@ -277,9 +855,12 @@ function MetAtlasViewer(targetElement) {
 
     // Set index geometry attributes
     indexGeometry.setAttribute('position',
-                               new Float32BufferAttribute(nodePositions, 3));
+                               new Float32BufferAttribute(built.positions, 3));
     indexGeometry.setAttribute('color',
-                               new Uint8BufferAttribute(indexColors, 3, true));
+                               new Uint8BufferAttribute(built.indexColors, 3, true));
+    indexGeometry.setAttribute('nodeScale', nodeScales);
+    indexGeometry.setAttribute('nodeOpacity', nodeOpacities);
+    indexGeometry.setAttribute('culled', nodesCulled);
 
     // Create the link material and geometry
     var lineMaterial = new LineBasicMaterial({vertexColors: VertexColors,
@@ -287,75 +868,95 @@ function MetAtlasViewer(targetElement) {
       depthTest: true,
       opacity: 0.67
     });
+    extendLinkMaterial(lineMaterial);
 
-    var linePositions = [];
     var lineColors = [];
 
-    for ( var i = 0; i < links.length; i ++ ) {
-      // Check the the nodes are in the graph
-      if (!(links[i].s in nodeIndex)) {
-        console.warn("ignoring link: '" + links[i].s + "' to '" + links[i].t +
-                     ". The start node is not in the node list.")
-        continue
+    // Arrowheads are placed where the links reach the edge of the node sprites
+    var arrows = [];
+
+    built.linkRecords.forEach(record => {
+      let data = links[record.link];
+      // Add the curve as line segments, with colors interpolated from the
+      // start to the end color.
+      let link = linkInfo.length;
+      linkInfo.push({s: data.s,
+                     t: data.t,
+                     data: data,
+                     style: {},
+                     reversible: record.reversible,
+                     start: record.start,
+                     count: record.count});
+      if (record.arrow) {
+        linkInfo[link].arrow = arrows.length;
+        arrows.push(Object.assign({color: connectionEndColor}, record.arrow));
       }
-      if (!(links[i].t in nodeIndex)) {
-        console.warn("ignoring link: '" + links[i].s + "' to '" + links[i].t +
-                     ". The end node is not in the node list.")
-        continue
+      if (record.startArrow) {
+        linkInfo[link].startArrow = arrows.length;
+        arrows.push(Object.assign({color: connectionStartColor}, record.startArrow));
       }
-      // Start position and color
-      linePositions.push.apply(linePositions, nodeIndex[links[i].s].pos);
-      lineColors.push.apply(lineColors, connectionStartColor );
-
-      // End position and color
-      linePositions.push.apply(linePositions, nodeIndex[links[i].t].pos);
-      lineColors.push.apply(lineColors, connectionEndColor );
+      setLinkColor(link, connectionStartColor, connectionEndColor, lineColors);
 
       // Add connections to nodeInfo
       // to:
-      nodeInfo[nodeIndex[links[i].s].index].connections.to.push({
-        index: i*2+1,
-        neighbor: links[i].t
+      nodeInfo[nodeIds[data.s]].connections.to.push({
+        link: link,
+        neighbor: data.t
         });
       // from:
-      nodeInfo[nodeIndex[links[i].t].index].connections.from.push({
-        index: i*2,
-        neighbor: links[i].s
+      nodeInfo[nodeIds[data.t]].connections.from.push({
+        link: link,
+        neighbor: data.s
         })
-    }
+    });
+
+    components = connectedComponents(getAdjacency());
+    components.forEach((component, k) => {
+      component.forEach(i => { nodeInfo[i].component = k; });
+    });
 
     // set line geometry attributes and mesh.
     var lineGeometry = new BufferGeometry();
     lineGeometry.setAttribute('position',
-                              new Float32BufferAttribute(linePositions, 3));
+                              new Float32BufferAttribute(built.linePositions, 3));
     lineGeometry.setAttribute('color',
                               new Uint8BufferAttribute(lineColors, 3, true));
+    // links to nodes hidden by occlusion culling are hidden too
+    lineGeometry.setAttribute('culled', new Float32BufferAttribute(
+      new Float32Array(built.linePositions.length / 3), 1));
 
     connectionMesh = new LineSegments(lineGeometry, lineMaterial);
     // Add the lines to the graph group and set it to render first
     graph.add(connectionMesh);
     connectionMesh.renderOrder = 0;
 
+    arrowMesh = makeArrowMesh(arrows, nodeSize * arrowStyle.size);
+    arrowMesh.renderOrder = 0;
+    graph.add(arrowMesh);
+
     let promises = [];
     var nodeMaterials = [];
     var indexMaterials = [];
     nodeTextures.forEach(tex => {
       promises.push(new Promise(function (resolve, reject) {
         var sprite = textureLoader.load(tex.sprite, function () {
-          nodeMaterials.push(new PointsMaterial({
+          spriteCoverages[tex.group] = spriteCoverage(sprite);
+          let nodeMaterial = new PointsMaterial({
             size: nodeSize,
             vertexColors: VertexColors,
             map: sprite,
             transparent: true,
             depthTest: true,
             alphaTest: 0.5
-          }));
+          });
+          extendNodeMaterial(nodeMaterial, fogDesaturation, false, minPointSize);
+          nodeMaterials.push(nodeMaterial);
 
           var indexSprite = textureLoader.load(makeIndexSprite(sprite));
           indexSprite.magFilter = NearestFilter;
           indexSprite.minFilter = NearestFilter;
 
-          indexMaterials.push(new PointsMaterial({
+          let indexMaterial = new PointsMaterial({
             size: nodeSize,
             vertexColors: VertexColors,
             map: indexSprite,
@@ -363,7 +964,9 @@ function MetAtlasViewer(targetElement) {
             depthTest: true,
             flatShading: true,
             alphaTest: 0.5
-          }));
+          });
+          extendNodeMaterial(indexMaterial, undefined, true, minPointSize);
+          indexMaterials.push(indexMaterial);
           resolve("texture loaded");
         });
       }));
@@ -379,15 +982,162 @@ function MetAtlasViewer(targetElement) {
       nodeMesh.renderOrder = 1;
       graph.add(nodeMesh);
 
+      applyStyles();
+
+      // Add the level-of-detail geometries if they are in use
+      currentNodeSize = nodeSize;
+      if (useLevelOfDetail) {
+        buildLevelOfDetail();
+      }
+      graph.add(levelOfDetail.group);
+
+      buildIcons();
+      buildTextLabels();
+      buildGroupHulls();
+      updateHighlight();
+      updateOcclusion();
+
       // Finally, add the graph to the scene, and the index geometry to the index
       // scene, and render to show the new geometry
       scene.add(graph);
       indexScene.add(indexMesh);
       requestAnimationFrame(render);
+
+      emit('dataLoaded', {
+        nodes: nodeInfo.length,
+        links: linkInfo.length,
+        components: components.length
+      });
     });
 
   }
 
+  /**
+   * Returns the options for building the graph buffers, see `buildGraph`.
+   *
+   * @param {number} nodeSize - size of the nodes in graph coordinates
+   */
+  function buildOptions(nodeSize) {
+    return {nodeSize: nodeSize,
+            defaultColor: nodeDefaultColor,
+            linkStyle: linkStyle,
+            arrowStyle: arrowStyle};
+  }
+
+  /**
+   * Loads graph data without blocking the page. The data is parsed and the
+   * vertex buffers are built in a web worker, and then shown like with
+   * `setData`. This keeps the page responsive while large models load.
+   *
+   * The network can be shown progressively, in chunks of nodes ordered by
+   * degree, so that the high-degree backbone appears first and the details
+   * grow in after it. 'loadProgress' events report the progress, formatted
+   * as {phase, loaded, total}, where phase is:
+   *     - 'download': fetching a URL, loaded and total in bytes (total is 0
+   *       if the server doesn't send the size)
+   *     - 'build': building the graph, loaded is 1 when done
+   *     - 'display': showing the chunks, loaded is the number of chunks shown
+   *
+   * @param {string|ArrayBuffer|object} source - the graph data, as a URL to
+   *     a JSON file, JSON text, UTF-8 encoded JSON, or an object formatted as
+   *     for `setData`
+   * @param {object} nodeTextures - texture images, see `setData`
+   * @param {number} nodeSize - size of the nodes in graph coordinates
+   * @param {number} chunks - (optional) number of chunks to show the network
+   *     in (default 1, all at once)
+   * @param {number} chunkDelay - (optional) milliseconds between showing
+   *     chunks (default 200)
+   * @returns {Promise} A promise resolving when the whole network is shown.
+   */
+  async function loadData(source, { nodeTextures, nodeSize, chunks = 1, chunkDelay = 200 }) {
+    const progress = detail => emit('loadProgress', detail);
+    let options = Object.assign(buildOptions(nodeSize), {chunks: chunks});
+    let built = await buildGraphInWorker(source, options, progress);
+    progress({phase: 'build', loaded: 1, total: 1});
+    let graphData = {nodes: built.nodes, links: built.links};
+    await setData({ graphData, nodeTextures, nodeSize }, built);
+    if (built.nodeChunks) {
+      await revealChunks(built, chunkDelay, progress);
+    } else {
+      progress({phase: 'display', loaded: 1, total: 1});
+    }
+  }
+
+  /**
+   * Shows the links up to a link, and hides the rest.
+   *
+   * @param {number} count - the number of links to show
+   */
+  function showLinks(count) {
+    let vertices = count > 0 ? linkInfo[count-1].start + linkInfo[count-1].count : 0;
+    connectionMesh.geometry.setDrawRange(0, vertices);
+    if (wideLineMesh) {
+      wideLineMesh.geometry.instanceCount = vertices / 2;
+    }
+    arrowMesh.count = linkInfo.slice(0, count).reduce((n, link) =>
+      n + (link.arrow !== undefined ? 1 : 0) + (link.startArrow !== undefined ? 1 : 0), 0);
+  }
+
+  /**
+   * Shows the chunks of a graph built by `loadData` one after another. The
+   * nodes of each chunk grow in like added nodes, see `addData`.
+   *
+   * @param {object} built - the built graph, see `buildGraph`
+   * @param {number} delay - milliseconds between chunks
+   * @param {function} progress - called with the progress of each chunk
+   * @returns {Promise} A promise resolving when all chunks are shown, or
+   *     when other data is set.
+   */
+  function revealChunks(built, delay, progress) {
+    let scales = nodeMesh.geometry.attributes.nodeScale;
+    let finalScales = Float32Array.from(scales.array);
+    built.nodeChunks.forEach((chunk, i) => {
+      if (chunk > 0) scales.array[i] = 0;
+    });
+    scales.needsUpdate = true;
+    let total = built.linkChunkEnds.length;
+    let reveal = {};
+    chunkReveal = reveal;
+
+    return new Promise(resolve => {
+      const show = chunk => {
+        if (chunkReveal !== reveal) {
+          resolve();
+          return;
+        }
+        // finish growing the previous chunk
+        if (growNodes) {
+          growNodes.items.forEach((item, k) => {
+            scales.array[item] = growNodes.scales[k];
+          });
+          growNodes = undefined;
+        }
+        let items = [];
+        built.nodeChunks.forEach((c, i) => {
+          if (c == chunk && chunk > 0) items.push(i);
+        });
+        showLinks(built.linkChunkEnds[chunk]);
+        progress({phase: 'display', loaded: chunk + 1, total: total});
+        if (chunk + 1 < total) {
+          setTimeout(() => show(chunk + 1), delay);
+        } else {
+          chunkReveal = undefined;
+          resolve();
+        }
+        if (items.length > 0) {
+          growNodes = {items: items,
+                       scales: items.map(i => finalScales[i]),
+                       start: performance.now()};
+          growUpdate();
+        } else {
+          cullingKey = undefined;
+          requestAnimationFrame(render);
+        }
+      };
+      show(0);
+    });
+  }
+
   /**
    * Sets the default colors
    *
@@ -401,6 +1151,9 @@ function MetAtlasViewer(targetElement) {
    * - connectionSelectColor
    * - hoverSelectColor
    * - hoverConnectionColor
+   * - pathColor
+   * - matchColor
+   * - currentMatchColor
    */
   function setColors(colors) {
     const keys = Object.keys(colors);
@@ -432,615 +1185,7148 @@ function MetAtlasViewer(targetElement) {
     if (keys.includes('hoverConnectionColor')) {
       hoverConnectionColor = colors.hoverConnectionColor;
     }
+
+    if (keys.includes('pathColor')) {
+      pathColor = colors.pathColor;
+    }
+
+    if (keys.includes('matchColor')) {
+      matchColor = colors.matchColor;
+    }
+
+    if (keys.includes('currentMatchColor')) {
+      currentMatchColor = colors.currentMatchColor;
+    }
   }
 
   /**
-   * Selects nodes in the graph based on a filter.
+   * Sets the stylesheet for nodes and links. The stylesheet is an ordered
+   * list of rules, and each rule has a selector and a style. For each element
+   * the styles of all matching rules are combined, with later rules
+   * overriding earlier ones. Styles are re-evaluated whenever the data
+   * changes.
    *
-   * @param {*} filter - filter object, whose keys-value pairs will be compared
-   *     to the nodes. If a node has the same key-value pair it will be
-   *     selected.
+   * Selectors are written as `<kind>[<attribute> <operator> <value>]...`,
+   * where kind is 'node', 'link' or '*', e.g. `node[g = "m"]`,
+   * `node[degree >= 10]` or `link[reversible]`. Node attributes are the node
+   * data fields, and 'degree', 'indegree' and 'outdegree'. Link attributes are
+   * the link data fields. Selectors can also be functions taking the
+   * attributes and the element kind.
+   *
+   * Node style properties:
+   *  - color: [r, g, b]
+   *  - size: size relative to the node size
+   *  - opacity: 0 to 1
+   *  - shape: node shape, see `setData`
+   *  - icon: node icon, see `setNodeIcons`
+   * Link style properties:
+   *  - color, startColor, endColor: [r, g, b]
+   *  - width: width in pixels
+   *
+   * Property values can also be functions of the attributes, or data-driven
+   * mappers like `{attr: 'flux', scale: 'linear', range: [1, 8]}`,
+   * `{attr: 'expression', colormap: 'viridis'}` or
+   * `{attr: 'compartment', scale: 'categorical'}`, see mappers.js.
+   *
+   * @param {Array} rules - style rules formatted as [{selector: <selector>,
+   *     style: {<property>: <value>}}, ...]
    */
-  function selectBy(filter) {
-    for (let key of Object.keys(filter)) {
-      if (!Array.isArray(filter[key])) {
-        filter[key] = [filter[key]];
-      }
+  function setStyle(rules) {
+    styleRules = rules || [];
+    applyStyles();
+    if (useLevelOfDetail && nodeMesh) {
+      buildLevelOfDetail();
     }
+    buildIcons();
+    requestAnimationFrame(render);
+  }
 
-    let items = nodeInfo.filter(v => {
-      for (const key of Object.keys(filter)) {
-        if (filter[key].includes(v[key])) {
-          return true;
-        }
-      }
-      return false;
-    }).map(i => {return i.index});
-    select(items);
-
-    focusOnItems(items);
-
-    // render the scene to make sure that it's updated
+  /**
+   * Sizes nodes by their degree, or by any other numeric node attribute, so
+   * that hubs stand out. The attribute is mapped from its range in the data
+   * (or `domain`) to sizes between `min` and `max`, relative to the node
+   * size. Node sizes set with `setStyle` take precedence.
+   *
+   * @param {object} sizing - sizing options, or null to give all nodes the
+   *     same size. The keys are:
+   *     - attr: attribute to size by, e.g. 'degree' (default), 'indegree',
+   *       'outdegree' or a node data field
+   *     - min: size of the node with the lowest value (default 0.5)
+   *     - max: size of the node with the highest value (default 3)
+   *     - scale: 'linear', 'sqrt' (default), 'log', 'symlog' or 'quantile'
+   *     - domain: (optional) [low, high] attribute values, outside of which
+   *       the sizes are clamped to `min` and `max`. The bounds can also be
+   *       percentiles, e.g. [null, '99%'].
+   */
+  function setNodeSizing(sizing) {
+    nodeSizing = sizing ? Object.assign({attr: 'degree', min: 0.5, max: 3,
+                                         scale: 'sqrt'}, sizing) : null;
+    applyStyles();
     requestAnimationFrame(render);
   }
 
   /**
-   * Given a lisf of nodes, `items`, this function will calculate the center
-   * point of the nodes, then set the camera to point along a vector from that
-   * point to the world center.
+   * Returns the attributes of each node that styles can use: the node data,
+   * the degree, indegree and outdegree, and the connected component, see
+   * `getComponents`.
    *
-   * The function will attempt to move the camera backwards along the vector
-   * until all items are inside the camera frustum.
+   * @returns {Array} The attributes of each node.
    */
-  function focusOnItems(items) {
+  function styleAttributes() {
+    return nodeInfo.map(node => Object.assign({}, clustered(node.data), {
+      indegree: node.connections.from.length,
+      outdegree: node.connections.to.length,
+      degree: node.connections.from.length + node.connections.to.length,
+      component: node.component
+    }));
+  }
 
-    // move camera to view items.
-    if (items.length > 0) {
-      let p = midPoint(items)
-      let l = Math.sqrt(p.x*p.x + p.y*p.y + p.z*p.z);
+  /**
+   * Evaluates the stylesheet for all nodes and links and updates the node
+   * and link visuals.
+   */
+  function applyStyles() {
+    if (!nodeMesh) return;
+
+    let nodeAttributes = styleAttributes();
+    let nodeStyles = computeStyles(nodeAttributes, 'node', styleRules);
+    let sizeOf = () => 1;
+    if (nodeSizing) {
+      let mapper = makeMapper({attr: nodeSizing.attr,
+                               scale: nodeSizing.scale,
+                               constant: nodeSizing.constant,
+                               domain: nodeSizing.domain,
+                               range: [nodeSizing.min, nodeSizing.max],
+                               missing: 1},
+                              nodeAttributes.map(a => a[nodeSizing.attr]));
+      sizeOf = i => mapper(nodeAttributes[i]);
+    }
+    let scales = nodeMesh.geometry.attributes.nodeScale;
+    nodeInfo.forEach((node, i) => {
+      node.style = nodeStyles[i];
+      scales.array[i] = node.style.size !== undefined ? node.style.size :
+                        node.data.metanode ? node.data.metanode.scale : sizeOf(i);
+    });
+    scales.needsUpdate = true;
 
-      let cameraDistance = 50; // default, for single items
+    let linkStyles = computeStyles(linkInfo.map(link => link.data), 'link', styleRules);
+    linkInfo.forEach((link, i) => {
+      link.style = linkStyles[i];
+    });
+    updateFluxOverlay();
+    updateLinkWidths();
+    buildParticleFlow();
+
+    updateExpressionOverlay();
+    updateSmallMultiples();
+    updateNodeOpacities();
+    refreshColors();
+  }
 
-      let t = {
-        x: p.x + p.x/l * cameraDistance,
-        y: p.y + p.y/l * cameraDistance,
-        z: p.z + p.z/l * cameraDistance
-      };
+  /**
+   * Returns the opacity of a node from its style and the expression overlay.
+   *
+   * @param {Object} node - the node info
+   * @returns {number} The opacity.
+   */
+  function nodeOpacity(node) {
+    let opacity = node.style.opacity !== undefined ? node.style.opacity : 1;
+    return opacity * (node.overlayOpacity !== undefined ? node.overlayOpacity : 1);
+  }
 
-      let cameraStep = 50;
-      let maxDistance = 3000 - l;
-      if (items.length > 1) {
-        // copy camera to move it around without having to mess with the scene,
-        // but make the FoV slightly narrower to make sure things are inside the
-        // visible portion of the view on the main camera.
-        let testCamera = new PerspectiveCamera(fieldOfView-10, aspect, near, far);
-        testCamera.position.copy(t);
-        testCamera.up.copy({x:0, y:1, z:0});
-        testCamera.lookAt(0,0,0);
-        testCamera.updateMatrix();
-        testCamera.updateMatrixWorld();
-        testCamera.matrixWorldInverse.getInverse( testCamera.matrixWorld );
+  /**
+   * Sets the opacity of each node from its style and the expression
+   * overlay.
+   */
+  function updateNodeOpacities() {
+    let opacities = nodeMesh.geometry.attributes.nodeOpacity;
+    nodeInfo.forEach((node, i) => {
+      opacities.array[i] = nodeOpacity(node);
+    });
+    opacities.needsUpdate = true;
+    minimap.invalidate();
+    cullingKey = undefined;
+  }
 
-        while (!isInCamera(items, testCamera) && cameraDistance < maxDistance) {
-          // move camera back until we've reached the max distance or we can see
-          // all object in the camera
-          cameraDistance += cameraStep;
-          t = {
-            x: p.x + p.x/l * cameraDistance,
-            y: p.y + p.y/l * cameraDistance,
-            z: p.z + p.z/l * cameraDistance
-          };
-          testCamera.position.copy(t);
-          testCamera.up.copy({x:0, y:1, z:0});
-          testCamera.lookAt(0,0,0);
-          testCamera.updateMatrix();
-          testCamera.updateMatrixWorld();
-          testCamera.matrixWorldInverse.getInverse( testCamera.matrixWorld );
-        }
+  /**
+   * Sets the width of each link from its style, its data or the link style.
+   * One pixel wide links are drawn as lines, and if any link is wider, all
+   * links are drawn as quads instead.
+   */
+  function updateLinkWidths() {
+    if (wideLineMesh) {
+      graph.remove(wideLineMesh);
+      wideLineMesh.geometry.dispose();
+      wideLineMesh.material.dispose();
+      wideLineMesh = undefined;
+    }
+
+    let widths = [];
+    let wide = false;
+    linkInfo.forEach(link => {
+      let width = link.flux ? link.flux.width :
+                  link.style.width !== undefined ? link.style.width :
+                  link.data.width !== undefined ? link.data.width :
+                  linkStyle.width;
+      wide = wide || width != 1;
+      for (let s = 0; s < link.count / 2; s++) {
+        widths.push(width);
       }
-      setFlyTarget(t);
+    });
+
+    connectionMesh.visible = !wide;
+    if (wide) {
+      wideLineMesh = makeWideLineMesh(connectionMesh.geometry, widths);
+      wideLineMesh.renderOrder = 0;
+      graph.add(wideLineMesh);
     }
   }
 
   /**
-   * returns the midpoints given a list of node index numbers.
+   * Sets the color vision mode. In the color-blind modes, the node colors of
+   * the data (e.g. compartment colors) are remapped to a palette which is
+   * distinguishable with the given color vision deficiency, based on the
+   * Okabe-Ito palette. Overlays use the cividis color scale in these modes,
+   * unless they are given a color scale.
    *
-   * @param {*} items Items to get midpoint for
+   * @param {string} mode - one of 'normal', 'deuteranopia', 'protanopia' or
+   *     'tritanopia'
    */
-  function midPoint(items) {
-    let s = items.map(i => nodeInfo[i]).reduce((a,b) => {
-      return {x: a.x+b.pos[0], y:a.y+b.pos[1], z: a.z+b.pos[2]};},
-      {x:0,y:0,z:0}
-    );
-    return {
-      x: s.x / items.length,
-      y: s.y / items.length,
-      z: s.z / items.length
-    };
+  function setColorVisionMode(mode) {
+    colorVisionMode = mode;
+    updateExpressionOverlay();
+    updateSmallMultiples();
+    updateLegends();
+    applyColorVisionMode();
+    requestAnimationFrame(render);
   }
 
   /**
-   * Given a number of items and a camera, this function will return true if all
-   * items are inside the camera frustum.
-   *
-   * @param {*} items - A list of node id's
-   * @param {*} cam - The camera to test with
+   * Sets the node colors from the data colors and the color vision mode.
    */
-  function isInCamera(items, cam) {
-    let retval = true;
-    let frustum = new Frustum();
-    frustum.setFromProjectionMatrix( new Matrix4().multiplyMatrices( cam.projectionMatrix, cam.matrixWorldInverse ) );
-    items.map(i => nodeInfo[i]).forEach(node => {
-      let pos = {x: node.pos[0], y: node.pos[1], z: node.pos[2]};
-      retval = retval && frustum.containsPoint(pos);
-    });
-    return retval;
+  function applyColorVisionMode() {
+    updateNodeColors();
+    if (nodeMesh) {
+      nodeInfo.forEach((node, i) => setSpriteColor(i));
+    }
   }
 
   /**
-   * Mouse move callback that does scene object picking.
-   * @param {event} event - A mouse move event
+   * Sets the color of each node info from its overlay, its style, or its
+   * data color in the color vision mode, without drawing it.
    */
-  function onMouseMove(event) {
-    var items = pickInScene(event);
-    items.forEach(id => {
-      infoBox.style.top = (event.clientY+5).toString() + "px";
-      infoBox.style.left = (event.clientX+5).toString() + "px";
-      infoBox.style.visibility = 'visible';
-      infoBox.innerHTML = nodeInfo[id].n;
+  function updateNodeColors() {
+    let dataColors = nodeInfo.map(n => n.dataColor || nodeDefaultColor);
+    let mapping = colorVisionMapping(dataColors, colorVisionMode);
+    nodeInfo.forEach((node, i) => {
+      node.color = node.overlayColor ? node.overlayColor :
+                   node.style.color ? node.style.color :
+                   mapping ? mapping[dataColors[i].join(',')] : dataColors[i];
     });
-    if (items.length == 0) {
-      infoBox.style.visibility = 'hidden';
+  }
+
+  /**
+   * Colors nodes by gene expression, or any other values measured for genes
+   * or enzymes. Nodes whose ID is in `values` are colored by their value,
+   * and reaction nodes without a value are colored by the combined values of
+   * their connected nodes, e.g. the mean expression of their enzymes. Nodes
+   * that still have no value are styled as missing data, grey by default, so
+   * that they can't be mistaken for measured nodes. The overlay colors take
+   * precedence over the data and style colors.
+   *
+   * @param {Object|Map} values - map of node IDs to values, or null to
+   *     remove the overlay
+   * @param {object} options - (optional) overlay options with the keys:
+   *     - colormap: color scale, 'viridis' (default) or 'cividis'. In the
+   *       color-blind modes (see `setColorVisionMode`), the default is
+   *       'cividis'.
+   *     - scale: how values map to colors, 'linear' (default), 'log',
+   *       'symlog' or 'quantile', see mappers.js
+   *     - domain: [low, high] values, outside of which the colors are
+   *       clamped. Defaults to the extent of the node values. The bounds can
+   *       also be percentiles, e.g. ['2%', '98%'].
+   *     - groups: node groups which get the combined values of their
+   *       neighbors (default ['r'])
+   *     - aggregate: how neighbor values are combined, 'mean' (default),
+   *       'sum', 'min' or 'max'
+   *     - missing: style of nodes without a value, 'grey' (default),
+   *       'hatched' (grey stripes), 'transparent' (faded), or 'keep' (keep
+   *       their color)
+   *     - missingColor: color of nodes without a value (default
+   *       [150, 150, 150])
+   *     - missingOpacity: opacity of transparent nodes without a value
+   *       (default 0.15)
+   */
+  function setExpressionOverlay(values, options = {}) {
+    expressionOverlay = values ? {
+      values: values,
+      options: Object.assign({groups: ['r'], aggregate: 'mean'}, missingDefaults,
+                             options)
+    } : undefined;
+    updateExpressionOverlay();
+    if (nodeMesh) {
+      updateNodeOpacities();
     }
-    select(items, false);
+    refreshColors();
     requestAnimationFrame(render);
   }
 
-  function select(items, persistent = true) {
+  /**
+   * Compares two conditions, e.g. expression in a control and a treatment,
+   * on the nodes. By default, nodes are colored by the log2 fold change from
+   * the reference condition to the compared condition, on a diverging color
+   * scale centered on zero. In 'split' mode, the left half of each node shows
+   * the reference value and the right half the compared value, on a shared
+   * color scale. The comparison replaces the expression overlay, and is
+   * removed with `setExpressionOverlay(null)`.
+   *
+   * @param {Object|Map} reference - map of node IDs to values in the
+   *     reference condition
+   * @param {Object|Map} values - map of node IDs to values in the compared
+   *     condition
+   * @param {object} options - (optional) the options of
+   *     `setExpressionOverlay`, and:
+   *     - mode: 'foldChange' (default) or 'split'
+   *     - pseudocount: added to both values before taking the fold change,
+   *       so that zero values have a finite fold change (default 1)
+   *     The default colormap is 'rdBu' for fold changes, and the domain is
+   *     symmetric around zero.
+   */
+  function setComparisonOverlay(reference, values, options = {}) {
+    expressionOverlay = {
+      values: values,
+      reference: reference,
+      options: Object.assign({groups: ['r'], aggregate: 'mean',
+                              mode: 'foldChange', pseudocount: 1}, missingDefaults,
+                             options)
+    };
+    updateExpressionOverlay();
+    if (nodeMesh) {
+      updateNodeOpacities();
+    }
+    refreshColors();
+    requestAnimationFrame(render);
+  }
 
-    if (persistent) {
-      // reset the currently persistently selected sprites
-      while (selected.length > 0) {
-        let item = selected.pop();
-        setSpriteColor(item);
-        setConnectionsColor(item);
-      }
-    } else if (hoverNode) {
-      setSpriteColor(hoverNode);
-      setConnectionsColor(hoverNode);
+  /**
+   * Sets the overlay color of every node from the expression overlay.
+   */
+  function updateExpressionOverlay() {
+    nodeInfo.forEach(node => {
+      node.overlaySecondColor = undefined;
+      node.overlayPattern = undefined;
+      node.overlayOpacity = undefined;
+    });
+    if (!expressionOverlay) {
+      nodeInfo.forEach(node => { node.overlayColor = undefined; });
+      return;
     }
-
-    // save current selected ids
-    items.forEach(id => {
-      if (persistent) {
-        selected.push(id);
+    let options = Object.assign({}, expressionOverlay.options);
+    let foldChange = expressionOverlay.reference && options.mode != 'split';
+    if (!options.colormap) {
+      options.colormap = foldChange ? 'rdBu' :
+                         colorVisionMode == 'normal' ? 'viridis' : 'cividis';
+    }
+    let values = nodeOverlayValues(nodeInfo, getAdjacency(), expressionOverlay.values,
+                                   options);
+    if (expressionOverlay.reference) {
+      let reference = nodeOverlayValues(nodeInfo, getAdjacency(),
+                                        expressionOverlay.reference, options);
+      let extent = v => v.filter(x => x !== undefined)
+        .reduce((d, x) => [Math.min(d[0], x), Math.max(d[1], x)], [Infinity, -Infinity]);
+      if (foldChange) {
+        values = foldChanges(reference, values, options.pseudocount);
+        if (!options.domain) {
+          let d = extent(values);
+          let max = Math.max(Math.abs(d[0]), Math.abs(d[1]));
+          options.domain = isFinite(max) && max > 0 ? [-max, max] : [-1, 1];
+        }
       } else {
-        hoverNode = id;
+        if (!options.domain) {
+          options.domain = extent(reference.concat(values));
+        }
+        expressionOverlay.scale = {options: options, values: reference.concat(values)};
+        let firsts = overlayColors(reference, options);
+        let seconds = overlayColors(values, options);
+        nodeInfo.forEach((node, i) => {
+          // nodes with a value in only one condition show that value whole
+          node.overlayColor = firsts[i] || seconds[i];
+          node.overlaySecondColor = firsts[i] && seconds[i];
+          node.overlayPattern = node.overlaySecondColor && 'split';
+        });
+        applyMissingStyle(options);
+        return;
       }
+    }
+    // the resolved scale, for the legend
+    expressionOverlay.scale = {options: options, values: values};
+    let colors = overlayColors(values, options);
+    nodeInfo.forEach((node, i) => { node.overlayColor = colors[i]; });
+    applyMissingStyle(options);
+  }
 
-      // update selected if with red color
-      setSpriteColor(id, persistent ? nodeSelectColor : hoverSelectColor);
+  // The node fields set by the expression overlay
+  const overlayFields = ['overlayColor', 'overlaySecondColor', 'overlayPattern',
+                         'overlayOpacity'];
 
-      // update selected connections with blue
-      setConnectionsColor(id, persistent ? connectionSelectColor : hoverConnectionColor)
+  /**
+   * Shows the network in a grid of panels, one per condition, each colored
+   * by the values of its condition like the expression overlay, and all seen
+   * from the same camera: the 3D equivalent of faceted plots. The conditions
+   * share one color scale, so that the panels can be compared. Nodes are
+   * picked and selected in any panel. The grid replaces the expression
+   * overlay while it is shown, which comes back when the grid is removed.
+   *
+   * @param {Array} conditions - the conditions as {label, values}, where
+   *     values maps node IDs to values, or null to show a single view
+   * @param {object} options - (optional) the options of
+   *     `setExpressionOverlay`. The domain defaults to the extent of the
+   *     node values in all conditions.
+   */
+  function setSmallMultiples(conditions, options = {}) {
+    smallMultiples = conditions && conditions.length > 0 ? {
+      conditions: conditions.map(c => ({label: String(c.label), values: c.values})),
+      options: Object.assign({groups: ['r'], aggregate: 'mean'}, missingDefaults,
+                             options)
+    } : undefined;
+    multiples.setPanels(smallMultiples ?
+      smallMultiples.conditions.map(c => c.label) : []);
+    updateSmallMultiples();
+    updateLegends();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Computes the node colors and opacities of each condition of the small
+   * multiples, with the expression overlay, and restores the overlay of the
+   * single view. The panels only swap in the precomputed buffers when they
+   * are rendered.
+   */
+  function updateSmallMultiples() {
+    if (!smallMultiples || !nodeMesh) return;
+    let options = Object.assign({}, smallMultiples.options);
+    if (!options.domain) {
+      let values = smallMultiples.conditions.map(c =>
+        nodeOverlayValues(nodeInfo, getAdjacency(), c.values, options));
+      options.domain = [].concat(...values).filter(x => x !== undefined)
+        .reduce((d, x) => [Math.min(d[0], x), Math.max(d[1], x)], [Infinity, -Infinity]);
+    }
+    let saved = expressionOverlay;
+    let base = nodeInfo.map(node => overlayFields.map(key => node[key]));
+    smallMultiples.panels = smallMultiples.conditions.map(c => {
+      expressionOverlay = {values: c.values, options: options};
+      updateExpressionOverlay();
+      smallMultiples.scale = expressionOverlay.scale;
+      updateNodeColors();
+      return panelBuffers();
     });
+    expressionOverlay = saved;
+    setOverlayFields(base);
+    updateNodeColors();
+  }
 
-    if (persistent) {
-      // // focus camera on midpoint
-      // let m = midPoint(items);
-      // cameraControls.target.copy(m);
+  /**
+   * Returns the contents of the node color, second color and opacity
+   * buffers for the current node colors and overlay fields, without
+   * highlights.
+   *
+   * @returns {Object} The buffers, formatted as {colors, secondColors,
+   *     opacities}.
+   */
+  function panelBuffers() {
+    let colors = new Uint8Array(nodeInfo.length * 3);
+    let secondColors = new Uint8Array(nodeInfo.length * 4);
+    let opacities = new Float32Array(nodeInfo.length);
+    nodeInfo.forEach((node, i) => {
+      colors.set(node.color, i*3);
+      secondColors.set(secondColor(node, node.color), i*4);
+      opacities[i] = nodeOpacity(node);
+    });
+    return {colors, secondColors, opacities};
+  }
 
-      // Create new selection event
-      let selectEvent = new CustomEvent(
-          "select",
-          {
-              detail: {
-                items: items.map(i => {return nodeInfo[i];})
-              },
-              bubbles: false,
-              cancelable: true
-          });
+  /**
+   * Sets the overlay fields of the nodes.
+   *
+   * @param {Array} fields - the fields of each node, in the order of
+   *     `overlayFields`
+   */
+  function setOverlayFields(fields) {
+    nodeInfo.forEach((node, i) => {
+      overlayFields.forEach((key, k) => { node[key] = fields[i][k]; });
+    });
+  }
 
-      container.dispatchEvent(selectEvent);
+  /**
+   * Colors the nodes by a condition of the small multiples, or by the single
+   * view, before rendering its panel, by copying its buffers into the node
+   * geometry. The highlighted nodes of the single view are colored on top.
+   * The opacities are set directly, as the minimap and the culling follow
+   * the single view.
+   *
+   * @param {Object} panel - the buffers of the panel, see `panelBuffers`
+   * @param {boolean} highlights - whether to color the highlighted nodes
+   */
+  function showPanel(panel, highlights = true) {
+    let attributes = nodeMesh.geometry.attributes;
+    attributes.color.array.set(panel.colors);
+    attributes.secondColor.array.set(panel.secondColors);
+    attributes.nodeOpacity.array.set(panel.opacities);
+    attributes.color.needsUpdate = true;
+    attributes.secondColor.needsUpdate = true;
+    attributes.nodeOpacity.needsUpdate = true;
+    if (!highlights) return;
+
+    let highlighted = new Set(selected.concat([...searchMatches.positions.keys()]));
+    if (highlightedPath) {
+      highlightedPath.nodes.forEach((step, i) => highlighted.add(i));
+    }
+    highlighted.forEach(i => {
+      if (!nodeInfo[i]) return;
+      let c = selected.includes(i) ? nodeSelectColor :
+              onPath('nodes', i) ? pathColor : searchMatchColor(i);
+      if (c) {
+        setSpriteColor(i, c);
+      }
+    });
+    if (hoverNode !== undefined) {
+      setSpriteColor(hoverNode, hoverSelectColor);
     }
   }
 
   /**
-   * Mouse click callback which calls pickInScene to get the current object
-   * under the mouse cursor and colors it red.
+   * Styles the nodes without an overlay value as missing data.
    *
-   * @param {event} - A mouse click event.
+   * @param {object} options - overlay options with the keys missing,
+   *     missingColor and missingOpacity, see `setExpressionOverlay`
    */
-  function onMouseClick(event) {
+  function applyMissingStyle(options) {
+    if (options.missing == 'keep') return;
+    let color = options.missingColor;
+    // the stripes of hatched nodes are a lighter shade of the missing color
+    let stripes = color.map(c => Math.round(c + (255 - c) * 0.6));
+    nodeInfo.forEach(node => {
+      if (node.overlayColor) return;
+      node.overlayColor = color;
+      if (options.missing == 'hatched') {
+        node.overlaySecondColor = stripes;
+        node.overlayPattern = 'hatched';
+      } else if (options.missing == 'transparent') {
+        node.overlayOpacity = options.missingOpacity;
+      }
+    });
+  }
 
-    var items = pickInScene(event);
+  /**
+   * Shows reaction fluxes, e.g. from flux balance analysis, on the links of
+   * the reactions. The link width encodes the magnitude of the flux, and the
+   * color its sign. The links are drawn with a gradient which is brightest
+   * where the flux goes: towards the end of the link for positive flux, and
+   * towards the start for negative flux. The flux styles take precedence over
+   * the link styles.
+   *
+   * @param {Object|Map} values - map of reaction node IDs to fluxes, or null
+   *     to remove the overlay
+   * @param {object} options - (optional) overlay options with the keys:
+   *     - widthRange: [min, max] link width in pixels (default [1, 8])
+   *     - scale: how absolute fluxes map to widths, 'sqrt' (default),
+   *       'linear', 'log', 'symlog' or 'quantile', see mappers.js
+   *     - domain: [low, high] absolute fluxes, outside of which the widths
+   *       are clamped. Defaults to the extent of the absolute fluxes. The
+   *       bounds can also be percentiles, e.g. [null, '95%'].
+   *     - threshold: absolute flux at or below which a reaction counts as
+   *       inactive (default 0)
+   *     - positiveColor, negativeColor: colors of positive and negative
+   *       flux (default red and blue)
+   *     - zeroColor: color of inactive reactions (default gray)
+   */
+  function setFluxOverlay(values, options = {}) {
+    fluxOverlay = values ? {
+      values: values,
+      options: Object.assign({widthRange: [1, 8],
+                              scale: 'sqrt',
+                              threshold: 0,
+                              positiveColor: [214, 96, 77],
+                              negativeColor: [67, 147, 195],
+                              zeroColor: [150, 150, 150]}, options)
+    } : undefined;
+    if (!nodeMesh) return;
+    updateFluxOverlay();
+    updateLinkWidths();
+    buildParticleFlow();
+    refreshColors();
+    requestAnimationFrame(render);
+  }
 
-    if (items.length > 0) {
-      select(items);
-      if (nodeSelectCallback && items.length === 1) {
-        nodeSelectCallback(nodeInfo[items[0]]);
+  /**
+   * Sets up time-series playback of overlay snapshots, e.g. expression
+   * measured at several time points. The returned timeline controller plays,
+   * pauses and seeks through the snapshots. Expression overlays are
+   * interpolated between the snapshots, so that the colors change smoothly,
+   * while flux overlays step from snapshot to snapshot. The color scale
+   * domain is fixed over all snapshots, so that colors are comparable over
+   * time. A 'tick' event (see `on`) is emitted whenever the position changes.
+   *
+   * @param {Array} snapshots - the snapshots, formatted as [{label: <label>,
+   *     values: <map of node IDs to values>}, ...], or null to remove the
+   *     timeline and its overlay
+   * @param {object} options - (optional) timeline options:
+   *     - overlay: 'expression' (default) or 'flux'
+   *     - overlayOptions: options of the overlay, see `setExpressionOverlay`
+   *       and `setFluxOverlay`
+   *     - stepTime: time in milliseconds from one snapshot to the next
+   *       (default 1000)
+   *     - loop: whether to start over after the last snapshot
+   *     - interpolate: whether to interpolate expression values between the
+   *       snapshots (default true)
+   * @returns {object} The timeline controller, with the functions play(),
+   *     pause(), seek(position), step(delta) and getPosition(), where the
+   *     position is the snapshot index, and fractional between snapshots.
+   */
+  function setTimeline(snapshots, options = {}) {
+    if (timeline) {
+      timeline.playing = false;
+      let overlay = timeline.options.overlay;
+      timeline = undefined;
+      if (overlay == 'flux') {
+        setFluxOverlay(null);
+      } else {
+        setExpressionOverlay(null);
       }
     }
+    if (!snapshots || snapshots.length == 0) return undefined;
+
+    options = Object.assign({overlay: 'expression', overlayOptions: {},
+                             stepTime: 1000, loop: false, interpolate: true},
+                            options);
+    let valueMaps = snapshots.map(s => s.values instanceof Map ? s.values :
+                                       new Map(Object.entries(s.values)));
+    let all = valueMaps.flatMap(values => [...values.values()].map(Number))
+      .filter(v => !isNaN(v))
+      .map(v => options.overlay == 'flux' ? Math.abs(v) : v);
+    // snapshots without any values leave the domain to the overlay
+    let domain = all.length == 0 ? {} :
+      {domain: [all.reduce((a, b) => Math.min(a, b), Infinity),
+                all.reduce((a, b) => Math.max(a, b), -Infinity)]};
+
+    timeline = {
+      snapshots: snapshots,
+      valueMaps: valueMaps,
+      options: options,
+      overlayOptions: Object.assign(domain, options.overlayOptions),
+      position: 0,
+      shown: undefined,
+      playing: false,
+      startTime: 0,
+      startPosition: 0
+    };
+    let controller = timeline;
+    // the controller functions only act on the timeline they were made for
+    const active = () => timeline === controller;
 
-    // render the scene to make sure that it's updated
-    requestAnimationFrame(render);
+    applyTimeline(0);
+    return {
+      play: () => {
+        if (!active()) return;
+        if (timeline.position >= snapshots.length - 1 && !options.loop) {
+          timeline.position = 0;
+        }
+        timeline.playing = true;
+        timeline.startTime = performance.now();
+        timeline.startPosition = timeline.position;
+      },
+      pause: () => {
+        if (!active()) return;
+        timeline.playing = false;
+        applyTimeline(timeline.position);
+      },
+      seek: position => {
+        if (!active()) return;
+        timeline.startTime = performance.now();
+        timeline.startPosition = position;
+        applyTimeline(position);
+      },
+      step: (delta = 1) => {
+        if (!active()) return;
+        let position = Math.round(timeline.position) + delta;
+        timeline.startTime = performance.now();
+        timeline.startPosition = position;
+        applyTimeline(position);
+      },
+      getPosition: () => active() ? timeline.position : undefined
+    };
   }
 
   /**
-   * Handles keypresses. Current controls:
-   *
-   *  - r: reset camera to start position.
-   *  - q: reset the selection
-   *
-   * @param {*} event - A keypress event
+   * Advances the playing timeline to the current time.
    */
-  function onKeypress(event) {
-    if (event.key == 'r') {
-      resetCamera();
-    } else if (event.key == 'q') {
-      resetSelection();
-    } else if (event.key == 'l') {
-      toggleLabels();
-    } else if (event.key == 'g') {
-      toggleNodeType('e');
+  function timelineUpdate() {
+    let steps = timeline.snapshots.length - 1;
+    let position = timeline.startPosition +
+      (performance.now() - timeline.startTime) / timeline.options.stepTime;
+    if (position >= steps) {
+      if (timeline.options.loop && steps > 0) {
+        // the last snapshot is shown for a whole step, and then wraps
+        // directly to the first
+        position = Math.min(steps, position % (steps + 1));
+      } else {
+        position = steps;
+        timeline.playing = false;
+      }
     }
+    // step between the snapshots instead of blending them with reduced motion
+    applyTimeline(isMotionReduced() ? Math.floor(position) : position);
   }
 
   /**
-   * Does scene object picking by rendering the pixel at the mouse pointer,
-   * converts its color to an index position and returns that id.
+   * Shows the overlay at a timeline position, interpolating the values of
+   * the surrounding snapshots, and emits a 'tick' event.
    *
-   * @param {*} event - An event containing mouse coordinates.
-   * @returns {number} ID number of the picked object.
+   * @param {number} position - snapshot index, fractional between snapshots
    */
-  function pickInScene(event) {
-    let size = renderer.domElement.getBoundingClientRect();
-    let dpr = window.devicePixelRatio || 1;
-    var posX = event.clientX-size.x;
-    var posY = event.clientY-size.y;
+  function applyTimeline(position) {
+    let steps = timeline.snapshots.length - 1;
+    position = Math.max(0, Math.min(steps, position));
+    timeline.position = position;
+    let index = Math.floor(position);
+    let f = position - index;
+    let flux = timeline.options.overlay == 'flux';
+    if (flux || !timeline.options.interpolate) {
+      f = 0;
+    }
 
-    // set the camera to only render the pixel under the cursor.
-    camera.setViewOffset(renderer.domElement.width,
-      renderer.domElement.height,
-      posX * dpr,
-      posY * dpr,
-      1,
-      1);
+    let key = flux || !timeline.options.interpolate ? index : position;
+    if (key !== timeline.shown) {
+      timeline.shown = key;
+      let from = timeline.valueMaps[index];
+      let values = from;
+      if (f > 0) {
+        let to = timeline.valueMaps[index + 1];
+        values = new Map();
+        new Set([...from.keys(), ...to.keys()]).forEach(id => {
+          let a = Number(from.get(id)), b = Number(to.get(id));
+          values.set(id, isNaN(a) ? b : isNaN(b) ? a : a + (b - a) * f);
+        });
+      }
+      if (flux) {
+        setFluxOverlay(values, timeline.overlayOptions);
+      } else {
+        setExpressionOverlay(values, timeline.overlayOptions);
+      }
+    }
 
-    // change rendering target so that the image stays on the screen
-    renderer.setRenderTarget(indexTarget);
-    renderer.render(indexScene, camera);
+    emit('tick', {
+      position: position,
+      index: index,
+      label: timeline.snapshots[index].label,
+      playing: timeline.playing
+    });
+  }
 
-    var pixelBuffer = new Uint8Array(4);
+  /**
+   * Turns the particle flow on or off. When on, small particles move along
+   * the links of the flux overlay (see `setFluxOverlay`), with a speed
+   * proportional to the magnitude of the flux, in the direction of the flux.
+   *
+   * @param {boolean} enabled - whether to animate particles
+   * @param {object} settings - (optional) settings with the keys count
+   *     (particles per link, default 3), speed (graph units per second at the
+   *     largest flux, default 300) and size (particle size relative to the
+   *     node size, default 0.4)
+   */
+  function setParticleFlow(enabled, settings = {}) {
+    particleOptions = Object.assign({}, particleOptions, settings, {enabled});
+    buildParticleFlow();
+    requestAnimationFrame(render);
+  }
 
-    renderer.readRenderTargetPixels(indexTarget, 0, 0, 1, 1, pixelBuffer);
-    // check if the color is white (background)
-    if (pixelBuffer[2] == pixelBuffer[1] == pixelBuffer[0] == 255) {
+  /**
+   * Creates the flow particles from the flux of each link, or removes them
+   * if the flow is off.
+   */
+  function buildParticleFlow() {
+    if (!particleOptions.enabled || !fluxOverlay || !connectionMesh) {
+      particleFlow.dispose();
       return;
     }
-    var id = (pixelBuffer[0] << 16) | (pixelBuffer[1] << 8) | (pixelBuffer[2]);
+    let positions = connectionMesh.geometry.attributes.position.array;
+    let largest = linkInfo.reduce((m, link) =>
+      link.flux ? Math.max(m, Math.abs(link.flux.flux)) : m, 0);
+    let links = linkInfo.filter(link => link.flux && link.flux.flux != 0).map(link => {
+      // the link polyline, from the start of the first segment through the
+      // ends of all segments
+      let path = [Array.from(positions.slice(link.start*3, link.start*3 + 3))];
+      for (let v = link.start + 1; v < link.start + link.count; v += 2) {
+        path.push(Array.from(positions.slice(v*3, v*3 + 3)));
+      }
+      let flux = link.flux.flux;
+      return {path: path,
+              flux: largest > 0 ? flux / largest : 0,
+              color: flux > 0 ? link.flux.endColor : link.flux.startColor};
+    });
+    particleFlow.build(links, {count: particleOptions.count,
+                               speed: particleOptions.speed,
+                               size: particleOptions.size * currentData.nodeSize});
+  }
 
-    // reset the camera and rendering target.
-    camera.clearViewOffset();
-    renderer.setRenderTarget(null);
+  /**
+   * Sets the flux style of every link from the flux overlay.
+   */
+  function updateFluxOverlay() {
+    let styles = fluxOverlay ? linkFluxStyles(linkInfo, fluxOverlay.values,
+                                              fluxOverlay.options) : [];
+    linkInfo.forEach((link, i) => { link.flux = styles[i]; });
+  }
 
-    // don't return background color
-    if (id == 16777215) {
-      return [];
+  /**
+   * Creates a color legend for the active color scale, which is kept in
+   * sync as overlays and styles change. The legend is a canvas element,
+   * which can be placed anywhere on the page, or drawn onto another canvas.
+   * It's hidden while there is no color scale to show.
+   *
+   * @param {object} options - (optional) legend options with the keys:
+   *     - source: the color scale to show, 'expression' (the expression or
+   *       comparison overlay), 'flux' (the flux overlay), 'style' (the
+   *       node color mapper of the stylesheet), or 'auto' (default), for the
+   *       first of these that is active
+   *     - title: title of the legend, defaults to a description of the
+   *       source
+   *     - width: width in CSS pixels (default 200)
+   *     - ticks: approximate number of tick labels (default 5)
+   *     - color, background: text and background colors, default from the
+   *       theme
+   *     - font: CSS font (default '11px sans-serif')
+   * @returns {Object} The legend canvas.
+   */
+  function createLegend(options = {}) {
+    let canvas = document.createElement('canvas');
+    canvas.className = 'met-atlas-legend';
+    let legend = {canvas: canvas, options: legendOptions(options)};
+    legends.push(legend);
+    updateLegend(legend);
+    return canvas;
+  }
+
+  /**
+   * Returns legend options with the defaults filled in, see `createLegend`.
+   *
+   * @param {object} options - the legend options
+   * @returns {object} The options.
+   */
+  function legendOptions(options) {
+    return Object.assign({source: 'auto', width: 200, ticks: 5, font: '11px sans-serif'},
+                         options);
+  }
+
+  /**
+   * Stops updating a legend, and removes it from the page.
+   *
+   * @param {Object} canvas - the legend canvas, see `createLegend`
+   */
+  function removeLegend(canvas) {
+    legends = legends.filter(legend => legend.canvas !== canvas);
+    if (canvas.parentNode) {
+      canvas.parentNode.removeChild(canvas);
     }
+  }
 
-    return [id];
+  /**
+   * Redraws all legends.
+   */
+  function updateLegends() {
+    legends.forEach(updateLegend);
   }
 
   /**
-   * Run the update camera callback with the updated camera position.
+   * Redraws a legend from the active color scale of its source.
+   *
+   * @param {object} legend - the legend, formatted as {canvas, options}
    */
-  function handleUpdateCamera() {
-    if (updateCameraCallback) {
-      updateCameraCallback(camera.position);
+  function updateLegend(legend) {
+    let options = legend.options;
+    let sources = options.source == 'auto' ? ['expression', 'flux', 'style'] :
+                  [options.source];
+    let description;
+    sources.some(source => {
+      description = legendScale(source, options.ticks);
+      return description;
+    });
+    if (description && options.title !== undefined) {
+      description.title = options.title;
     }
+    drawLegend(legend.canvas, description, {
+      width: options.width,
+      font: options.font,
+      color: options.color || labelColors.color,
+      background: options.background !== undefined ? options.background :
+                  labelColors.background,
+      ratio: options.ratio
+    });
   }
 
   /**
-   * Sets the camera control function, and adds an event listener which calls
-   * the render function whenever the controls emit a change event.
+   * Describes the active color scale of a legend source, see legend.js.
    *
-   * @param {function} cameraControlFunction
+   * @param {string} source - 'expression', 'flux' or 'style'
+   * @param {number} ticks - approximate number of ticks
+   * @returns {Object} The legend description, or undefined if the source
+   *     isn't active.
    */
-  function setCameraControls(cameraControlFunction) {
-    cameraControls = new cameraControlFunction(camera, renderer.domElement);
-    cameraControls.addEventListener( 'change', render );
-    cameraControls.addEventListener( 'end', handleUpdateCamera );
-    return cameraControls;
+  function legendScale(source, ticks) {
+    const continuous = (title, spec, values) => {
+      let scale = continuousScale(spec, values);
+      return {type: 'continuous',
+              title: title,
+              position: scale.position,
+              output: scale.output,
+              ticks: scale.ticks(ticks)};
+    };
+
+    if (source == 'expression' && smallMultiples && smallMultiples.scale) {
+      return continuous('Expression', smallMultiples.scale.options,
+                        smallMultiples.scale.values);
+    }
+    if (source == 'expression' && expressionOverlay && expressionOverlay.scale) {
+      let scale = expressionOverlay.scale;
+      let foldChange = expressionOverlay.reference && scale.options.mode != 'split';
+      return continuous(foldChange ? 'log2 fold change' : 'Expression',
+                        scale.options, scale.values);
+    }
+    if (source == 'flux' && fluxOverlay) {
+      // the sign colors and a few link widths, as the overlay encodes them
+      return fluxLegend(linkInfo, fluxOverlay.values, fluxOverlay.options,
+                        Math.min(ticks, 4));
+    }
+    if (source == 'style') {
+      let rule = styleRules.slice().reverse().find(rule =>
+        rule.style && isMapper(rule.style.color) &&
+        (typeof rule.selector !== 'string' || !/^\s*link/.test(rule.selector)));
+      if (!rule) return undefined;
+      let spec = rule.style.color;
+      // the domain of the nodes the rule styles, like in `computeStyles`
+      let match = parseSelector(rule.selector);
+      let values = styleAttributes().filter(a => match(a, 'node')).map(a => a[spec.attr]);
+      if (spec.scale == 'categorical') {
+        let scale = categoricalScale(spec, values);
+        return {type: 'categorical',
+                title: spec.attr,
+                entries: scale.domain.map((value, i) => ({
+                  label: value,
+                  color: scale.range[i % scale.range.length]
+                }))};
+      }
+      return continuous(spec.attr, spec, values);
+    }
+    return undefined;
   }
 
   /**
-   * Sets the color of 'spriteNum' in the nodeMesh to 'color'.
+   * Indexes the ID, name and annotation fields (text and lists of text in
+   * the node data) of every node for `search`.
+   */
+  function buildSearchIndex() {
+    searchIndex.build(nodeInfo.map(node => {
+      let fields = {id: node.id};
+      if (node.n !== undefined) {
+        fields.name = node.n;
+      }
+      Object.keys(node.data).forEach(key => {
+        let value = node.data[key];
+        if (unsearchedFields.includes(key)) return;
+        if (Array.isArray(value) && value.every(v => typeof v === 'string')) {
+          fields[key] = value.join(' ');
+        } else if (typeof value === 'string') {
+          fields[key] = value;
+        }
+      });
+      return fields;
+    }), {name: 3, id: 2});
+
+    // node indices change with the data, so the matches are searched again
+    if (searchMatches.query !== undefined) {
+      setSearchMatches(searchMatches.query, searchMatches.options,
+                       search(searchMatches.query, searchMatches.options));
+    }
+  }
+
+  /**
+   * Searches the node IDs, names and annotation fields. All words of the
+   * query have to match the start of a word in the node's fields, where
+   * longer words may have a typo or two. Matches are ranked by how well they
+   * match, with names ranking above IDs, and IDs above annotations.
    *
-   * @param {number} spriteNum - id of the sprite in the nodemesh
-   * @param {array} color - color to set the sprite to.
+   * @param {string} query - the search query
+   * @param {object} options - (optional) search options with the keys:
+   *     - limit: maximum number of matches (default 20)
+   *     - fields: the fields to search, e.g. ['name'], where the ID and
+   *       name fields are 'id' and 'name', and annotations use their key in
+   *       the node data. Defaults to all fields.
+   *     - fuzzy: whether to allow typos (default true)
+   * @returns {Array} The matches, best first, formatted as [{node, score,
+   *     field, text, highlights}], where field and text are the best
+   *     matching field and its text, and highlights are the matching
+   *     character ranges of the text, as [[start, end], ...].
    */
-  function setSpriteColor(spriteNum, color = undefined) {
-    if (!nodeInfo[spriteNum]) return;
+  function search(query, options = {}) {
+    return searchIndex.search(query, options).map(match => ({
+      node: nodeInfo[match.doc],
+      score: match.score,
+      field: match.field,
+      text: match.text,
+      highlights: match.highlights
+    }));
+  }
 
-    let c = color ? color : selected.includes(spriteNum) ? nodeSelectColor : nodeInfo[spriteNum].color;
-    nodeMesh.geometry.attributes.color.array[spriteNum*3+0] = c[0];
-    nodeMesh.geometry.attributes.color.array[spriteNum*3+1] = c[1];
-    nodeMesh.geometry.attributes.color.array[spriteNum*3+2] = c[2];
-    nodeMesh.geometry.attributes.color.needsUpdate = true;
+  /**
+   * Returns autocomplete suggestions for a partial query, see `search`.
+   * Nodes with the same text, such as a metabolite in several compartments,
+   * are combined into one suggestion. The highlights can be used to show
+   * which parts of the suggestion match, e.g.:
+   *
+   *   text.slice(0, start) + '<b>' + text.slice(start, end) + '</b>' + ...
+   *
+   * @param {string} query - the partial query
+   * @param {object} options - (optional) the options of `search`, where
+   *     limit is the number of suggestions (default 8)
+   * @returns {Array} The suggestions, best first, formatted as [{text,
+   *     field, highlights, nodes}], where nodes are the matching nodes.
+   */
+  function suggest(query, options = {}) {
+    let limit = options.limit !== undefined ? options.limit : 8;
+    // search deeper, since several matches can share a suggestion
+    let matches = search(query, Object.assign({}, options, {limit: limit * 10}));
+    let suggestions = [];
+    let byText = {};
+    matches.forEach(match => {
+      let key = match.field + '\t' + match.text;
+      if (byText[key]) {
+        byText[key].nodes.push(match.node);
+      } else if (suggestions.length < limit) {
+        byText[key] = {text: match.text,
+                       field: match.field,
+                       highlights: match.highlights,
+                       nodes: [match.node]};
+        suggestions.push(byText[key]);
+      }
+    });
+    return suggestions;
+  }
+
+  /**
+   * Searches the nodes (see `search`) and highlights all matches, like
+   * find-in-page in a browser. Use `nextMatch` and `prevMatch` to fly
+   * between the matches. The matches stay highlighted, also when the data
+   * changes, until `clearMatches` is called.
+   *
+   * @param {string} query - the search query
+   * @param {object} options - (optional) the options of `search`, where the
+   *     default limit is 1000
+   * @returns {Array} The matches, best first, see `search`.
+   */
+  function highlightMatches(query, options = {}) {
+    options = Object.assign({limit: 1000}, options);
+    let matches = search(query, options);
+    setSearchMatches(query, options, matches);
+    refreshColors();
+    requestAnimationFrame(render);
+    return matches;
+  }
+
+  /**
+   * Removes the search match highlights.
+   */
+  function clearMatches() {
+    setSearchMatches(undefined, {}, []);
+    refreshColors();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets the highlighted search matches, without a current match.
+   *
+   * @param {string} query - the search query, or undefined
+   * @param {object} options - the search options
+   * @param {Array} matches - the matches, see `search`
+   */
+  function setSearchMatches(query, options, matches) {
+    let nodes = matches.map(match => match.node.index);
+    searchMatches = {query: query,
+                     options: options,
+                     nodes: nodes,
+                     positions: new Map(nodes.map((node, m) => [node, m])),
+                     current: -1};
+  }
+
+  /**
+   * Returns the search match color of a node, see `highlightMatches`.
+   *
+   * @param {number} i - index of the node
+   * @returns {Array} The color, or undefined if the node isn't a match.
+   */
+  function searchMatchColor(i) {
+    let m = searchMatches.positions.get(i);
+    return m === undefined ? undefined :
+           m == searchMatches.current ? currentMatchColor : matchColor;
+  }
+
+  /**
+   * Flies the camera to the next search match, see `highlightMatches`.
+   * After the last match, it continues with the first.
+   *
+   * @param {object} options - (optional) camera options, see `focusNode`
+   * @returns {Object} The current match, formatted as {node, index, count},
+   *     or undefined if there are no matches.
+   */
+  function nextMatch(options = {}) {
+    return stepMatch(1, options);
+  }
+
+  /**
+   * Flies the camera to the previous search match, see `highlightMatches`.
+   * Before the first match, it continues with the last.
+   *
+   * @param {object} options - (optional) camera options, see `focusNode`
+   * @returns {Object} The current match, formatted as {node, index, count},
+   *     or undefined if there are no matches.
+   */
+  function prevMatch(options = {}) {
+    return stepMatch(-1, options);
+  }
+
+  /**
+   * Moves the current search match, and flies the camera to it.
+   *
+   * @param {number} step - 1 for the next match, -1 for the previous
+   * @param {object} options - camera options, see `focusNode`
+   */
+  function stepMatch(step, options) {
+    let count = searchMatches.nodes.length;
+    if (count == 0) return undefined;
+    let previous = searchMatches.current;
+    searchMatches.current = previous < 0 ?
+      (step > 0 ? 0 : count - 1) :
+      (previous + step + count) % count;
+
+    let node = nodeInfo[searchMatches.nodes[searchMatches.current]];
+    [searchMatches.nodes[previous], node.index].forEach(i => {
+      if (i !== undefined) setSpriteColor(i);
+    });
+    focusNode(node.id, options);
+    requestAnimationFrame(render);
+    return {node: node, index: searchMatches.current, count: count};
+  }
+
+  /**
+   * Selects nodes in the graph based on a filter.
+   *
+   * @param {*} filter - filter object, whose keys-value pairs will be compared
+   *     to the nodes. If a node has the same key-value pair it will be
+   *     selected.
+   */
+  function selectBy(filter) {
+    for (let key of Object.keys(filter)) {
+      if (!Array.isArray(filter[key])) {
+        filter[key] = [filter[key]];
+      }
+    }
+
+    let items = nodeInfo.filter(v => {
+      for (const key of Object.keys(filter)) {
+        if (filter[key].includes(v[key])) {
+          return true;
+        }
+      }
+      return false;
+    }).map(i => {return i.index});
+    select(items);
+
+    focusOnItems(items);
+
+    // render the scene to make sure that it's updated
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Given a lisf of nodes, `items`, this function will calculate the center
+   * point of the nodes, then set the camera to point along a vector from that
+   * point to the world center.
+   *
+   * The function will attempt to move the camera backwards along the vector
+   * until all items are inside the camera frustum.
+   */
+  function focusOnItems(items) {
+
+    // move camera to view items.
+    if (items.length > 0) {
+      let p = midPoint(items)
+      let l = Math.sqrt(p.x*p.x + p.y*p.y + p.z*p.z);
+
+      let cameraDistance = 50; // default, for single items
+
+      let t = {
+        x: p.x + p.x/l * cameraDistance,
+        y: p.y + p.y/l * cameraDistance,
+        z: p.z + p.z/l * cameraDistance
+      };
+
+      let cameraStep = 50;
+      let maxDistance = 3000 - l;
+      if (items.length > 1) {
+        // copy camera to move it around without having to mess with the scene,
+        // but make the FoV slightly narrower to make sure things are inside the
+        // visible portion of the view on the main camera.
+        let testCamera = new PerspectiveCamera(fieldOfView-10, aspect, near, far);
+        testCamera.position.copy(t);
+        testCamera.up.copy({x:0, y:1, z:0});
+        testCamera.lookAt(0,0,0);
+        testCamera.updateMatrix();
+        testCamera.updateMatrixWorld();
+        testCamera.matrixWorldInverse.getInverse( testCamera.matrixWorld );
+
+        while (!isInCamera(items, testCamera) && cameraDistance < maxDistance) {
+          // move camera back until we've reached the max distance or we can see
+          // all object in the camera
+          cameraDistance += cameraStep;
+          t = {
+            x: p.x + p.x/l * cameraDistance,
+            y: p.y + p.y/l * cameraDistance,
+            z: p.z + p.z/l * cameraDistance
+          };
+          testCamera.position.copy(t);
+          testCamera.up.copy({x:0, y:1, z:0});
+          testCamera.lookAt(0,0,0);
+          testCamera.updateMatrix();
+          testCamera.updateMatrixWorld();
+          testCamera.matrixWorldInverse.getInverse( testCamera.matrixWorld );
+        }
+      }
+      setFlyTarget(t);
+    }
+  }
+
+  /**
+   * returns the midpoints given a list of node index numbers.
+   *
+   * @param {*} items Items to get midpoint for
+   */
+  function midPoint(items) {
+    let s = items.map(i => nodeInfo[i]).reduce((a,b) => {
+      return {x: a.x+b.pos[0], y:a.y+b.pos[1], z: a.z+b.pos[2]};},
+      {x:0,y:0,z:0}
+    );
+    return {
+      x: s.x / items.length,
+      y: s.y / items.length,
+      z: s.z / items.length
+    };
+  }
+
+  /**
+   * Given a number of items and a camera, this function will return true if all
+   * items are inside the camera frustum.
+   *
+   * @param {*} items - A list of node id's
+   * @param {*} cam - The camera to test with
+   */
+  function isInCamera(items, cam) {
+    let retval = true;
+    let frustum = new Frustum();
+    frustum.setFromProjectionMatrix( new Matrix4().multiplyMatrices( cam.projectionMatrix, cam.matrixWorldInverse ) );
+    items.map(i => nodeInfo[i]).forEach(node => {
+      let pos = {x: node.pos[0], y: node.pos[1], z: node.pos[2]};
+      retval = retval && frustum.containsPoint(pos);
+    });
+    return retval;
+  }
+
+  /**
+   * Mouse move callback that does scene object picking.
+   * @param {event} event - A mouse move event
+   */
+  function onMouseMove(event) {
+    var items = pickInScene(event);
+    if (items.length > 0) {
+      showTooltip(items[0], event);
+    } else {
+      hideTooltip();
+    }
+    if (items[0] !== hoveredItem) {
+      hoveredItem = items[0];
+      if (announcements.enabled && announcements.hover) {
+        if (hoveredItem !== undefined) {
+          // wait for the pointer to settle on a node
+          announcer.announce(describeNode(hoveredItem), 500);
+        } else {
+          announcer.cancel();
+        }
+      }
+      emit('nodeHover', {
+        node: hoveredItem !== undefined ? nodeInfo[hoveredItem] : null,
+        event: event
+      });
+    }
+    select(items, false);
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Shows the tooltip for a node next to the mouse pointer. The tooltip
+   * content is only created when the hovered node changes, and the tooltip is
+   * kept inside the window.
+   *
+   * @param {number} id - index of the hovered node
+   * @param {event} event - the mouse event to place the tooltip by
+   */
+  function showTooltip(id, event) {
+    if (tooltip.node !== id) {
+      tooltip.node = id;
+      let content = tooltip.content ? tooltip.content(nodeInfo[id]) : nodeInfo[id].n;
+      infoBox.innerHTML = '';
+      if (content === undefined || content === null || content === '') {
+        infoBox.style.visibility = 'hidden';
+        return;
+      }
+      if (content instanceof Node) {
+        infoBox.appendChild(content);
+      } else {
+        infoBox.innerHTML = content;
+      }
+    }
+    if (!infoBox.firstChild) return;
+
+    let x = event.clientX + tooltip.offset;
+    let y = event.clientY + tooltip.offset;
+    if (x + infoBox.offsetWidth > window.innerWidth) {
+      x = event.clientX - tooltip.offset - infoBox.offsetWidth;
+    }
+    if (y + infoBox.offsetHeight > window.innerHeight) {
+      y = event.clientY - tooltip.offset - infoBox.offsetHeight;
+    }
+    infoBox.style.left = Math.max(0, x) + 'px';
+    infoBox.style.top = Math.max(0, y) + 'px';
+    infoBox.style.visibility = 'visible';
+  }
+
+  /**
+   * Hides the tooltip.
+   */
+  function hideTooltip() {
+    tooltip.node = undefined;
+    infoBox.style.visibility = 'hidden';
+  }
+
+  /**
+   * Sets the content of the hover tooltip. The viewer shows, places and
+   * hides the tooltip, and calls `content` whenever a new node is hovered.
+   *
+   * @param {function} content - function taking the hovered node info
+   *     ({id, n, data, ...}) and returning an HTML string or a DOM node, or
+   *     nothing to show no tooltip. If omitted, the node name is shown.
+   * @param {object} options - (optional) tooltip options with the key
+   *     offset, the distance in pixels from the mouse pointer
+   */
+  function setTooltip(content, options = {}) {
+    tooltip.content = content;
+    if (options.offset !== undefined) {
+      tooltip.offset = options.offset;
+    }
+    hideTooltip();
+  }
+
+  function select(items, persistent = true) {
+
+    let previous = selected.slice();
+    if (persistent) {
+      // reset the currently persistently selected sprites
+      while (selected.length > 0) {
+        let item = selected.pop();
+        setSpriteColor(item);
+        setConnectionsColor(item);
+      }
+    } else if (hoverNode) {
+      setSpriteColor(hoverNode);
+      setConnectionsColor(hoverNode);
+    }
+
+    // save current selected ids
+    items.forEach(id => {
+      if (persistent) {
+        selected.push(id);
+      } else {
+        hoverNode = id;
+      }
+
+      // update selected if with red color
+      setSpriteColor(id, persistent ? nodeSelectColor : hoverSelectColor);
+
+      // update selected connections with blue
+      setConnectionsColor(id, persistent ? connectionSelectColor : hoverConnectionColor)
+    });
+
+    if (persistent) {
+      // // focus camera on midpoint
+      // let m = midPoint(items);
+      // cameraControls.target.copy(m);
+
+      // Create new selection event
+      let selectEvent = new CustomEvent(
+          "select",
+          {
+              detail: {
+                items: items.map(i => {return nodeInfo[i];})
+              },
+              bubbles: false,
+              cancelable: true
+          });
+
+      container.dispatchEvent(selectEvent);
+
+      // Create a deselection event for the nodes that are no longer selected
+      let removed = previous.filter(i => !items.includes(i));
+      if (removed.length > 0) {
+        container.dispatchEvent(new CustomEvent(
+          "deselect",
+          {
+            detail: {
+              items: removed.map(i => nodeInfo[i])
+            },
+            bubbles: false,
+            cancelable: true
+          }));
+      }
+      updateHighlight();
+
+      let ids = items.map(i => nodeInfo[i].id);
+      if (ids.length != recordedSelection.length ||
+          ids.some(id => !recordedSelection.includes(id))) {
+        let before = recordedSelection;
+        record({undo: () => selectNodes(before), redo: () => selectNodes(ids)});
+        recordedSelection = ids;
+      }
+
+      let added = items.filter(i => !previous.includes(i));
+      if (announcements.enabled && (added.length > 0 || removed.length > 0)) {
+        announcer.announce(items.length == 0 ? 'Selection cleared' :
+                           items.length == 1 ? 'Selected: ' + describeNode(items[0]) :
+                           'Selected ' + items.length + ' nodes');
+      }
+
+      emit('selectionChange', {
+        items: items.map(i => nodeInfo[i]),
+        added: added.map(i => nodeInfo[i]),
+        removed: removed.map(i => nodeInfo[i])
+      });
+    }
+  }
+
+  /**
+   * Describes a node in words for screen reader announcements, as its
+   * name, its compartment if the node data has one, and its number of
+   * connections, e.g. 'pyruvate, cytosol, 14 connections'.
+   *
+   * @param {number} i - index of the node
+   * @returns {string} The description.
+   */
+  function describeNode(i) {
+    let node = nodeInfo[i];
+    if (announcements.format) {
+      return announcements.format(node);
+    }
+    let connections = node.connections.to.length + node.connections.from.length;
+    return [node.n || node.id,
+            node.data.compartment,
+            connections + (connections == 1 ? ' connection' : ' connections')]
+      .filter(part => part !== undefined && part !== null && part !== '')
+      .join(', ');
+  }
+
+  /**
+   * Returns a summary of the network and the current view in words: the
+   * network size, its compartments, the nodes and subsystems in view and the
+   * selection. This is the text of the off-screen summary, see `setSummary`.
+   *
+   * @returns {string} The summary.
+   */
+  function getSummary() {
+    return summarySentences().join(' ');
+  }
+
+  /**
+   * Returns the sentences of the summary of the current view.
+   */
+  function summarySentences() {
+    return summarizeNetwork({nodes: nodeInfo,
+                             links: linkInfo.length,
+                             visible: getNodesWithin(Infinity),
+                             selected: selected},
+                            summaryOptions);
+  }
+
+  /**
+   * Updates the off-screen summary a second after the view changes, so that
+   * it isn't rebuilt in every frame of a camera move.
+   */
+  function scheduleSummary() {
+    if (!summaryOptions.enabled || summaryTimeout !== undefined) return;
+    summaryTimeout = setTimeout(() => {
+      summaryTimeout = undefined;
+      if (disposed || !summaryOptions.enabled) return;
+      networkSummary.update(summarySentences());
+    }, 1000);
+  }
+
+  /**
+   * Sets the off-screen summary of the view, which describes the network,
+   * its compartments, the subsystems in view and the selection in words, so
+   * that screen reader users can follow along. The summary is the
+   * description of the viewer container (aria-describedby), and is updated
+   * as the view changes.
+   *
+   * @param {boolean} enabled - whether to keep the summary (default true)
+   * @param {object} settings - (optional) summary options, with the keys:
+   *     - compartment: node data attribute of the compartment (default
+   *       'compartment')
+   *     - subsystem: node data attribute of the subsystems, a value or a
+   *       list (default 'subsystem')
+   *     - maxItems: number of compartments, subsystems and selected nodes
+   *       to list (default 10)
+   */
+  function setSummary(enabled, settings = {}) {
+    Object.assign(summaryOptions, settings, {enabled: enabled});
+    if (enabled) {
+      scheduleSummary();
+    } else {
+      networkSummary.update([]);
+    }
+  }
+
+  /**
+   * Sets how changes are announced to screen readers. Selection changes,
+   * the node with keyboard focus and (optionally) the hovered node are
+   * described in a visually hidden ARIA live region, e.g. 'Selected:
+   * pyruvate, cytosol, 14 connections'.
+   *
+   * @param {boolean} enabled - whether to make announcements (default true)
+   * @param {object} settings - (optional) announcement options, with the
+   *     keys:
+   *     - hover: whether to announce the hovered node (default true), after
+   *       the pointer has rested on it for half a second
+   *     - format: function taking the node info and returning its
+   *       description, replacing the default description
+   */
+  function setAnnouncements(enabled, settings = {}) {
+    Object.assign(announcements, settings, {enabled: enabled});
+    if (!enabled) {
+      announcer.cancel();
+    }
+  }
+
+  /**
+   * Returns the node indices of a list of node IDs, skipping unknown IDs.
+   *
+   * @param {Array} ids - list of node IDs
+   * @returns {Array} The indices of the nodes in `nodeInfo`.
+   */
+  function nodeIndices(ids) {
+    return ids.filter(id => {
+      if (nodeIds[id] === undefined) {
+        console.warn("unknown node id: '" + id + "'.");
+        return false;
+      }
+      return true;
+    }).map(id => nodeIds[id]);
+  }
+
+  /**
+   * Returns the info of a node.
+   *
+   * @param {string} id - the node ID
+   * @returns {object} The node info, or undefined if the node isn't in the
+   *     graph.
+   */
+  function getNode(id) {
+    return nodeInfo[nodeIds[id]];
+  }
+
+  /**
+   * Highlights a node like when the mouse pointer is on it, e.g. to mirror
+   * the hovered node of another viewer. No 'nodeHover' event is emitted.
+   *
+   * @param {string} id - the node ID, or null to remove the highlight
+   * @returns {boolean} Whether the node is in the graph.
+   */
+  function setHover(id) {
+    let found = id !== null && id !== undefined && nodeIds[id] !== undefined;
+    select(found ? [nodeIds[id]] : [], false);
+    requestAnimationFrame(render);
+    return found;
+  }
+
+  /**
+   * Selects nodes by their IDs. A 'select' event with the new selection is
+   * dispatched on the viewer container, and a 'deselect' event with any nodes
+   * that were removed from the selection.
+   *
+   * @param {Array} ids - IDs of the nodes to select
+   * @param {boolean} add - (optional) add the nodes to the current selection
+   *     instead of replacing it
+   */
+  function selectNodes(ids, add = false) {
+    let items = nodeIndices(ids);
+    if (add) {
+      items = selected.concat(items.filter(i => !selected.includes(i)));
+    }
+    select(items);
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Removes nodes from the current selection by their IDs.
+   *
+   * @param {Array} ids - IDs of the nodes to deselect
+   */
+  function deselectNodes(ids) {
+    let items = nodeIndices(ids);
+    select(selected.filter(i => !items.includes(i)));
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns the IDs of the currently selected nodes.
+   *
+   * @returns {Array} List of node IDs.
+   */
+  function getSelection() {
+    return selected.map(i => nodeInfo[i].id);
+  }
+
+  /**
+   * Clears the selection, without moving the camera.
+   */
+  function clearSelection() {
+    select([]);
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Rebuilds the highlight objects, which are copies of the selected nodes and
+   * their connections drawn on the bloom layer.
+   */
+  function updateHighlight() {
+    while (highlight.children.length > 0) {
+      let object = highlight.children[0];
+      highlight.remove(object);
+      object.geometry.dispose();
+      object.material.dispose();
+    }
+    if (!postProcessing.isActive() || !nodeMesh || selected.length == 0) return;
+
+    // the highlighted nodes of each material, so that each node keeps the
+    // sprite of its group
+    let byMaterial = new Map();
+    let groups = nodeMesh.geometry.groups;
+    let linePositions = [];
+    let lineColors = [];
+    let connectionPositions = connectionMesh.geometry.attributes.position.array;
+    let connectionColors = connectionMesh.geometry.attributes.color.array;
+    selected.forEach(i => {
+      let node = nodeInfo[i];
+      if (!node) return;
+      let group = groups.find(g => i >= g.start && i < g.start + g.count);
+      let material = group ? group.materialIndex : 0;
+      if (!byMaterial.has(material)) {
+        byMaterial.set(material, {positions: [], colors: []});
+      }
+      let points = byMaterial.get(material);
+      points.positions.push.apply(points.positions, node.pos);
+      points.colors.push.apply(points.colors, nodeSelectColor);
+      neighborhoodLinks(i).forEach(link => {
+        let info = linkInfo[link];
+        for (let v = info.start*3; v < (info.start + info.count)*3; v++) {
+          linePositions.push(connectionPositions[v]);
+          lineColors.push(connectionColors[v]);
+        }
+      });
+    });
+
+    let nodes = [...byMaterial].map(([material, {positions, colors}]) => {
+      let nodeGeometry = new BufferGeometry();
+      nodeGeometry.setAttribute('position', new Float32BufferAttribute(positions, 3));
+      nodeGeometry.setAttribute('color', new Uint8BufferAttribute(colors, 3, true));
+      return new Points(nodeGeometry, new PointsMaterial({
+        size: currentNodeSize,
+        vertexColors: VertexColors,
+        map: nodeMesh.material[material].map,
+        transparent: true,
+        alphaTest: 0.5
+      }));
+    });
+
+    let lineGeometry = new BufferGeometry();
+    lineGeometry.setAttribute('position', new Float32BufferAttribute(linePositions, 3));
+    lineGeometry.setAttribute('color', new Uint8BufferAttribute(lineColors, 3, true));
+    let lines = new LineSegments(lineGeometry, new LineBasicMaterial({
+      vertexColors: VertexColors
+    }));
+
+    nodes.concat([lines]).forEach(object => {
+      object.layers.set(BLOOM_LAYER);
+      highlight.add(object);
+    });
+  }
+
+  /**
+   * Sets the ambient occlusion options. When enabled, nodes are darkened
+   * according to the number of other nodes within `radius`, which gives a
+   * sense of depth in dense clusters.
+   *
+   * @param {boolean} enabled - whether to darken nodes in dense regions
+   * @param {object} settings - (optional) settings with the keys radius
+   *     (neighborhood radius in graph coordinates) and strength (maximum
+   *     darkening between 0 and 1).
+   */
+  function setAmbientOcclusion(enabled, settings = {}) {
+    ambientOcclusion = Object.assign({}, ambientOcclusion, settings, {enabled});
+    updateOcclusion();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets the depth fog options. Fog fades nodes and links towards the fog
+   * color (and desaturates nodes) with the distance from the camera, which
+   * makes it easier to tell near from far nodes.
+   *
+   * @param {boolean} enabled - whether to show fog
+   * @param {object} settings - (optional) settings with the keys:
+   *     - color: fog color, defaults to the background color
+   *     - near: distance where the fog starts
+   *     - far: distance where the fog is complete
+   *     - auto: if true (default), near and far are set from the extent of
+   *       the graph as seen from the camera, instead of the given values
+   *     - desaturation: how much to desaturate distant nodes, 0 to 1
+   */
+  function setFog(enabled, settings = {}) {
+    fogOptions = Object.assign({}, fogOptions, settings, {enabled});
+    if (fogOptions.enabled) {
+      let color = fogOptions.color !== undefined ? fogOptions.color : scene.background;
+      scene.fog = new Fog(new Color(color), fogOptions.near, fogOptions.far);
+      fogDesaturation.value = fogOptions.desaturation;
+    } else {
+      scene.fog = null;
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets the fog near and far distances from the graph extent, when automatic
+   * fog is enabled.
+   */
+  function updateFog() {
+    if (!scene.fog || !fogOptions.auto || !nodeMesh) return;
+    let sphere = nodeMesh.geometry.boundingSphere;
+    let distance = camera.position.distanceTo(sphere.center);
+    scene.fog.near = Math.max(near, distance - sphere.radius);
+    scene.fog.far = distance + sphere.radius;
+  }
+
+  /**
+   * Updates the node occlusion attribute from the ambient occlusion options.
+   */
+  function updateOcclusion() {
+    if (!nodeMesh) return;
+    let attribute = nodeMesh.geometry.attributes.occlusion;
+    if (ambientOcclusion.enabled) {
+      let occlusion = computeOcclusion(nodeInfo.map(n => n.pos),
+                                       ambientOcclusion.radius,
+                                       ambientOcclusion.strength);
+      attribute.array.set(occlusion);
+    } else {
+      attribute.array.fill(1);
+    }
+    attribute.needsUpdate = true;
+  }
+
+  /**
+   * Sets the occlusion culling options. When enabled, nodes hidden behind
+   * the nodes in the foreground are not drawn, which saves fill rate when
+   * looking into dense networks. Nodes that are large on screen are drawn
+   * into a coarse depth buffer, and only the nodes whose whole octree cell
+   * is behind it are culled, so that no visible node is skipped. Only the
+   * opaque middle of the node sprites hides what's behind them, so nodes
+   * behind the corners of e.g. triangles stay visible. The links of culled
+   * nodes are hidden too.
+   *
+   * @param {boolean} enabled - whether to cull hidden nodes
+   * @param {object} settings - (optional) settings with the key resolution
+   *     (number of depth buffer columns, default 64)
+   */
+  function setOcclusionCulling(enabled, settings = {}) {
+    let resolution = occlusionCulling.resolution;
+    occlusionCulling = Object.assign({}, occlusionCulling, settings, {enabled});
+    if (occlusionCulling.resolution != resolution) {
+      occlusionCuller = OcclusionCulling(occlusionCulling.resolution);
+    }
+    cullingKey = undefined;
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Updates the culled nodes if the camera has moved since the last update.
+   */
+  function updateCulling() {
+    let culled = nodeMesh.geometry.attributes.culled;
+    let linksCulled = connectionMesh.geometry.attributes.culled;
+    if (!occlusionCulling.enabled) {
+      if (cullingKey !== null) {
+        culled.array.fill(0);
+        culled.needsUpdate = true;
+        linksCulled.array.fill(0);
+        linksCulled.needsUpdate = true;
+        cullingKey = null;
+      }
+      return;
+    }
+    camera.updateMatrixWorld();
+    let key = camera.matrixWorld.elements.concat(camera.projectionMatrix.elements,
+      [container.offsetWidth, container.offsetHeight]).join(',');
+    if (key === cullingKey) return;
+    cullingKey = key;
+
+    let scales = nodeMesh.geometry.attributes.nodeScale.array;
+    let opacities = nodeMesh.geometry.attributes.nodeOpacity.array;
+    let radius = (currentNodeSize || 1) / 2;
+    let maxRadius = radius * scales.reduce((a, b) => Math.max(a, b), 0);
+    // only nodes close enough to cover a depth buffer cell hide anything,
+    // and transparent nodes don't
+    let rows = occlusionCulling.resolution * container.offsetHeight /
+               Math.max(1, container.offsetWidth);
+    let distance = maxRadius * rows / (2 * Math.tan(camera.fov * Math.PI / 360));
+    // sprites with transparent corners only hide what's behind their opaque
+    // middle
+    let occluders = octree.within(camera.position.toArray(), distance,
+                                  i => opacities[i] >= 0.99)
+      .map(i => ({pos: nodeInfo[i].pos, radius: radius * scales[i],
+                  cover: spriteCoverages[nodeInfo[i].group]}));
+    occlusionCuller.update(camera, container.offsetWidth, container.offsetHeight,
+                           octree, occluders, maxRadius, culled.array);
+    culled.needsUpdate = true;
+
+    linkInfo.forEach(link => {
+      let hidden = culled.array[nodeIds[link.s]] || culled.array[nodeIds[link.t]];
+      linksCulled.array.fill(hidden ? 1 : 0, link.start, link.start + link.count);
+    });
+    linksCulled.needsUpdate = true;
+  }
+
+  /**
+   * Shows or hides the minimap, a small overview of the whole network seen
+   * from a fixed direction in a corner of the viewer, with the camera's
+   * field of view and the selected nodes marked. Clicking the minimap moves
+   * the camera target to the clicked point.
+   *
+   * @param {boolean} enabled - whether to show the minimap
+   * @param {object} settings - (optional) settings with the keys:
+   *     - projection: 'top' (default, looking down the y axis), 'front'
+   *       (looking down the z axis) or 'side' (looking down the x axis)
+   *     - size: width and height in CSS pixels (default 160)
+   *     - corner: 'bottom-right' (default), 'bottom-left', 'top-right' or
+   *       'top-left'
+   *     - background: CSS background color, or null for none
+   *     - frustumColor: CSS color of the camera outline
+   *     - selectionColor: color of the selected nodes as [r, g, b]
+   *     - nodeSize: size of the nodes in CSS pixels (default 1.5)
+   */
+  function setMinimap(enabled, settings = {}) {
+    minimap.setOptions(enabled, settings);
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Shows or hides the debug overlay, which shows the frame rate, the time
+   * spent on layout (level of detail, culling and label placement), picking
+   * and rendering in each frame, and the draw calls. The viewer only renders
+   * when something changes, so the frame rate is that of the frames actually
+   * rendered.
+   *
+   * @param {boolean} enabled - whether to show the overlay
+   * @param {object} settings - (optional) overlay options, with the keys:
+   *     - corner: 'top-left' (default), 'top-right', 'bottom-left' or
+   *       'bottom-right'
+   *     - background: CSS background color
+   *     - color: CSS text color
+   */
+  function setDebugOverlay(enabled, settings = {}) {
+    debugOverlay.setOptions(enabled, settings);
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Flies the camera target to a point clicked on the minimap, keeping the
+   * direction and distance of the camera.
+   *
+   * @param {Array} uv - the clicked point in the minimap plane
+   * @param {string} projection - the minimap projection
+   */
+  function navigateMinimap(uv, projection) {
+    let target = planeToWorld(uv, projection, cameraControls.target.clone());
+    let offset = target.clone().sub(cameraControls.target);
+    setFlyTarget(camera.position.clone().add(offset), camera.up.clone(), target);
+  }
+
+  /**
+   * Sets the antialiasing mode of the viewer. The antialiasing is done in a
+   * post-processing pass, so it can be changed at any time.
+   *
+   * @param {string} mode - one of 'none' (default), 'msaa' (multisampling,
+   *     requires WebGL 2), 'fxaa' or 'smaa'.
+   * @param {number} samples - (optional) number of MSAA samples, default 4.
+   */
+  function setAntialiasing(mode, samples = undefined) {
+    postProcessing.setAntialiasing(mode, samples);
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Turns glowing highlights on or off. When on, the selected nodes and their
+   * connections are rendered with a bloom effect.
+   *
+   * @param {boolean} enabled - whether to render bloom
+   * @param {object} settings - (optional) bloom settings with the keys
+   *     strength (default 1.5), radius (default 0.4) and threshold
+   *     (default 0).
+   */
+  function setBloom(enabled, settings = {}) {
+    postProcessing.setBloom(enabled, settings);
+    updateHighlight();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns the adjacency list of the graph, where entry i lists the indices
+   * of the nodes linked to node i in either direction.
+   *
+   * @returns {Array} The adjacency list.
+   */
+  function getAdjacency() {
+    if (!adjacency) {
+      adjacency = nodeInfo.map(node => [...new Set(
+        node.connections.to.concat(node.connections.from)
+          .map(conn => nodeIds[conn.neighbor]))]);
+    }
+    return adjacency;
+  }
+
+  /**
+   * Mouse click callback which calls pickInScene to get the current object
+   * under the mouse cursor and colors it red.
+   *
+   * A plain click replaces the selection, ctrl/cmd-click adds the node to, or
+   * removes it from, the selection, and shift-click adds the shortest path
+   * from the last clicked node to the clicked node.
+   *
+   * @param {event} - A mouse click event.
+   */
+  function onMouseClick(event) {
+    // only the first finger of a touch gesture selects, and nothing is
+    // selected while drawing
+    if (selectionDrag || drawing.tool != 'none' || event.isPrimary === false) {
+      return;
+    }
+
+    var items = pickInScene(event);
+
+    if (items.length > 0) {
+      let clicked = items[0];
+      // a plain click on a metanode expands its group
+      if (nodeInfo[clicked].data.metanode &&
+          !event.ctrlKey && !event.metaKey && !event.shiftKey) {
+        expandGroup(nodeInfo[clicked].id);
+        return;
+      }
+      if (event.ctrlKey || event.metaKey) {
+        items = selected.includes(clicked) ? selected.filter(i => i != clicked) :
+                                             selected.concat([clicked]);
+      } else if (event.shiftKey && lastClicked !== undefined) {
+        let path = shortestPath(getAdjacency(), lastClicked, clicked);
+        if (path.length == 0) {
+          path = [clicked];
+        }
+        items = selected.concat(path.filter(i => !selected.includes(i)));
+      }
+      lastClicked = clicked;
+      select(items);
+      if (nodeSelectCallback && items.length === 1) {
+        nodeSelectCallback(nodeInfo[items[0]]);
+      }
+      emit('nodeClick', {node: nodeInfo[clicked], event: event});
+    } else if (eventHandlers.edgeClick && eventHandlers.edgeClick.length > 0) {
+      let link = pickLink(event);
+      if (link !== undefined) {
+        emit('edgeClick', {link: linkInfo[link].data, event: event});
+      }
+    }
+
+    // render the scene to make sure that it's updated
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Double click callback which expands the neighborhood of the node under
+   * the mouse pointer.
+   *
+   * @param {event} event - A double click event.
+   */
+  function onDoubleClick(event) {
+    let items = nodeMesh ? pickInScene(event) : [];
+    if (items.length > 0) {
+      expandNode(nodeInfo[items[0]].id);
+    }
+  }
+
+  /**
+   * Expands the neighborhood of a node by adding its hidden neighbors to the
+   * graph, and dispatches an 'expand' event with the node and the added
+   * nodes. The neighbors are taken from the expand callback if one is set
+   * (see `setExpandCallback`), and otherwise from the initial data, which
+   * reveals the neighbors that have been hidden, e.g. with `toggleNodeType`.
+   *
+   * @param {string} id - ID of the node to expand
+   * @returns {Promise} A promise which resolves with the added nodes.
+   */
+  async function expandNode(id) {
+    let node = nodeInfo[nodeIds[id]];
+    if (!node) {
+      console.warn("unknown node id: '" + id + "'.");
+      return [];
+    }
+    if (node.data.metanode) {
+      return await expandGroup(id);
+    }
+    let data = expandCallback ? await expandCallback(node) : hiddenNeighbors(id);
+    let added = data ? await addData(data) : [];
+
+    container.dispatchEvent(new CustomEvent(
+      "expand",
+      {
+        detail: {
+          item: nodeInfo[nodeIds[id]],
+          added: added
+        },
+        bubbles: false,
+        cancelable: false
+      }));
+    return added;
+  }
+
+  /**
+   * Returns the neighbors of a node in the initial data which are not in the
+   * graph, with their links to the node and to the other nodes in the graph.
+   *
+   * @param {string} id - ID of the node
+   * @returns {object} Graph data formatted as {nodes: [], links: []}
+   */
+  function hiddenNeighbors(id) {
+    let shown = s => nodeIds[s] !== undefined;
+    let neighbors = new Set();
+    initialData.graphData.links.forEach(l => {
+      if (l.s == id && !shown(l.t)) neighbors.add(l.t);
+      if (l.t == id && !shown(l.s)) neighbors.add(l.s);
+    });
+    return {
+      nodes: initialData.graphData.nodes.filter(n => neighbors.has(n.id)),
+      links: initialData.graphData.links.filter(l =>
+        (neighbors.has(l.s) || neighbors.has(l.t)) &&
+        (neighbors.has(l.s) || shown(l.s)) && (neighbors.has(l.t) || shown(l.t)))
+    };
+  }
+
+  /**
+   * Adds nodes and links to the graph. Nodes that are already in the graph
+   * are skipped, and the new nodes grow into the graph from nothing. New
+   * nodes hidden by a filter, e.g. currency metabolites, stay hidden. The
+   * selection is kept.
+   *
+   * @param {object} graphData - graph data formatted like {nodes:[], links:[]},
+   *     see `setData`
+   * @param {Array} nodeTextures - (optional) textures for node groups which
+   *     aren't in the graph yet, see `setData`. Missing groups are taken from
+   *     the initial data.
+   * @returns {Promise} A promise which resolves with the info of the added
+   *     nodes.
+   */
+  async function addData({ nodes = [], links = [] }, nodeTextures = []) {
+    // nodes in collapsed groups and hidden nodes are in the base data
+    let base = collapsed.base || currentData.graphData;
+    let present = new Set(base.nodes.map(n => n.id));
+    let newNodes = nodes.filter(n => !present.has(n.id));
+    let known = new Set(base.links.map(l => l.s + '\t' + l.t));
+    let newLinks = links.filter(l => !known.has(l.s + '\t' + l.t));
+    if (newNodes.length == 0 && newLinks.length == 0) {
+      return [];
+    }
+
+    let textures = currentData.nodeTextures.slice();
+    let groups = new Set(textures.map(t => t.group));
+    nodeTextures.concat(initialData.nodeTextures).forEach(t => {
+      if (!groups.has(t.group) && newNodes.some(n => n.g == t.group)) {
+        groups.add(t.group);
+        textures.push(t);
+      }
+    });
+
+    let selection = getSelection();
+    await setData({
+      graphData: {
+        nodes: base.nodes.concat(newNodes),
+        links: base.links.concat(newLinks)
+      },
+      nodeTextures: textures,
+      nodeSize: currentData.nodeSize
+    });
+    selected = [];
+    select(nodeIndices(selection));
+
+    let items = newNodes.map(n => nodeIds[n.id]).filter(i => i !== undefined);
+    let scales = nodeMesh.geometry.attributes.nodeScale.array;
+    growNodes = {items: items,
+                 scales: items.map(i => scales[i]),
+                 start: performance.now()};
+    growUpdate();
+    return items.map(i => nodeInfo[i]);
+  }
+
+  /**
+   * Updates the size of the nodes that are growing into the graph.
+   */
+  function growUpdate() {
+    let t = isMotionReduced() ? 1 :
+            Math.min(1, (performance.now() - growNodes.start) / growTime);
+    let scales = nodeMesh.geometry.attributes.nodeScale;
+    growNodes.items.forEach((item, i) => {
+      scales.array[item] = growNodes.scales[i] * t * (2 - t);
+    });
+    scales.needsUpdate = true;
+    cullingKey = undefined;
+    if (t >= 1) {
+      growNodes = undefined;
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns graph data without the nodes and links hidden by the node
+   * filters, and without the links of hidden nodes. The filters are applied
+   * in turn, each to the graph left by the ones before.
+   *
+   * @param {object} graphData - the graph data, formatted as {nodes, links}
+   * @returns {object} The filtered graph data.
+   */
+  function filterGraph(graphData) {
+    return Object.values(nodeFilters).reduce((data, filter) => {
+      let hidden = filter(data);
+      let nodes = data.nodes.filter(node => !hidden(node, 'node'));
+      let ids = new Set(nodes.map(node => node.id));
+      let links = data.links.filter(l => ids.has(l.s) && ids.has(l.t) && !hidden(l, 'link'));
+      if (nodes.length == data.nodes.length && links.length == data.links.length) return data;
+      return {nodes: nodes, links: links};
+    }, graphData);
+  }
+
+  /**
+   * Returns graph data without the nodes outside the degree range of
+   * `setDegreeFilter`, and without their links.
+   *
+   * @param {object} graphData - the graph data, formatted as {nodes, links}
+   * @returns {object} The filtered graph data.
+   */
+  function filterDegrees(graphData) {
+    if (!degreeFilter) return graphData;
+    let degrees = new Map();
+    graphData.links.forEach(l => {
+      degrees.set(l.s, (degrees.get(l.s) || 0) + 1);
+      degrees.set(l.t, (degrees.get(l.t) || 0) + 1);
+    });
+    let nodes = graphData.nodes.filter(node => {
+      let degree = degrees.get(node.id) || 0;
+      return degree >= degreeFilter.min && degree <= degreeFilter.max;
+    });
+    let ids = new Set(nodes.map(node => node.id));
+    return {nodes: nodes, links: graphData.links.filter(l => ids.has(l.s) && ids.has(l.t))};
+  }
+
+  /**
+   * Returns graph data filtered to the subsystems of `setSubsystemFilter`,
+   * by the node filters and by degree, and with the currency metabolites
+   * split if they are duplicated, see `duplicateCurrencyMetabolites`.
+   *
+   * @param {object} graphData - the graph data, formatted as {nodes, links}
+   * @param {number} nodeSize - the node size, for the spacing of duplicates
+   * @returns {object} The transformed graph data.
+   */
+  function transformGraph(graphData, nodeSize) {
+    graphData = withClusters(graphData);
+    let filtered = filterDegrees(filterGraph(subsystemFilter ?
+      subsystemGraph(graphData, subsystemFilter.subsystems, subsystemFilter) : graphData));
+    return currency.duplicated ?
+      splitNodes(filtered, currencyTest(currency.names), 3 * (nodeSize || 1)) : filtered;
+  }
+
+  /**
+   * Returns the node data with the cluster found by `detectClusters` under
+   * its attribute, as a copy, or the node data itself if it has no cluster.
+   *
+   * @param {object} node - the node data
+   * @returns {object} The node data.
+   */
+  function clustered(node) {
+    let label = clusterLabels ? clusterLabels.labels.get(node.id) : undefined;
+    return label === undefined || node[clusterLabels.attribute] === label ? node :
+      Object.assign({}, node, {[clusterLabels.attribute]: label});
+  }
+
+  /**
+   * Returns graph data with the clusters added to the node data, see
+   * `clustered`.
+   *
+   * @param {object} graphData - the graph data, formatted as {nodes, links}
+   * @returns {object} The graph data.
+   */
+  function withClusters(graphData) {
+    if (!clusterLabels) return graphData;
+    return {nodes: graphData.nodes.map(clustered), links: graphData.links};
+  }
+
+  /**
+   * Returns whether the shown graph data is transformed, see
+   * `transformGraph`.
+   */
+  function isTransformed() {
+    return Object.keys(nodeFilters).length > 0 || currency.duplicated || !!subsystemFilter ||
+           !!degreeFilter;
+  }
+
+  /**
+   * Sets or removes a node filter, and shows the filtered graph.
+   *
+   * @param {string} name - the filter name
+   * @param {Function} filter - a function taking the graph data, and
+   *     returning a function which takes the node or link data and the kind
+   *     ('node' or 'link'), and returns whether the element is hidden, or
+   *     undefined to remove the filter
+   */
+  async function setNodeFilter(name, filter) {
+    if (filter) {
+      nodeFilters[name] = filter;
+    } else {
+      delete nodeFilters[name];
+    }
+    if (currentData) {
+      await showCollapsedGroups(collapsed.groups);
+    }
+  }
+
+  /**
+   * Shows the graph with a list of groups collapsed into metanodes, and
+   * without the nodes hidden by the node filters. The selection is kept, and
+   * the nodes that appear grow into the graph.
+   *
+   * @param {Array} groups - the collapsed groups, see `collapseGroup`
+   * @param {object} base - (optional) new graph data without collapsed
+   *     groups and node filters, e.g. with moved nodes
+   */
+  async function showCollapsedGroups(groups, base = collapsed.base || currentData.graphData) {
+    let graphData = collapseGraph(transformGraph(base, currentData.nodeSize), groups);
+    let textures = currentData.nodeTextures.filter(t => t.group != 'metanode');
+    if (groups.length > 0) {
+      metanodeSprite = metanodeSprite || makeDiscSprite();
+      textures.push({group: 'metanode', sprite: metanodeSprite});
+    }
+    collapsed = groups.length > 0 || isTransformed() ?
+      {groups: groups, base: base, data: graphData} :
+      {groups: [], base: undefined, data: undefined};
+
+    let selection = getSelection();
+    let shown = new Set(Object.keys(nodeIds));
+    await setData({graphData: graphData, nodeTextures: textures, nodeSize: currentData.nodeSize});
+    selected = [];
+    select(nodeIndices(selection.filter(id => nodeIds[id] !== undefined)));
+
+    let items = nodeInfo.filter(node => !shown.has(node.id)).map(node => node.index);
+    let scales = nodeMesh.geometry.attributes.nodeScale.array;
+    growNodes = {items: items,
+                 scales: items.map(i => scales[i]),
+                 start: performance.now()};
+    growUpdate();
+  }
+
+  /**
+   * Collapses a group of nodes, e.g. a compartment or subsystem, into one
+   * large metanode at their center, to reduce the visual complexity of large
+   * models. The links between the group and other nodes are merged into one
+   * link per neighbor and direction, drawn wider for more merged links, and
+   * the links within the group are left out. Clicking the metanode expands
+   * the group again. Nodes already in a collapsed group stay in it.
+   *
+   * @param {string} attribute - the node attribute, e.g. 'compartment' or
+   *     'subsystem'. Nodes where the attribute is a list are in the group of
+   *     every value in the list.
+   * @param {*} value - the attribute value of the nodes to collapse
+   * @param {object} options - (optional) metanode options with the keys
+   *     label (default the value and the number of nodes) and color ([r, g,
+   *     b], default the average color of the nodes)
+   * @returns {Promise} A promise which resolves with the info of the
+   *     metanode, or undefined if there are no nodes to collapse.
+   */
+  async function collapseGroup(attribute, value, options = {}) {
+    if (!currentData) return undefined;
+    let id = metanodeId(attribute, value);
+    if (collapsed.groups.some(g => collapsedId(g) == id)) {
+      return nodeInfo[nodeIds[id]];
+    }
+    let base = collapsed.base || currentData.graphData;
+    let group = {attribute: attribute, value: value};
+    if (!base.nodes.some(node => inGroup(clustered(node), group) &&
+                                 nodeIds[node.id] !== undefined)) {
+      console.warn('no nodes to collapse with ' + attribute + " '" + value + "'.");
+      return undefined;
+    }
+    if (options.label !== undefined) {
+      group.label = String(options.label);
+    }
+    if (options.color) {
+      group.color = options.color;
+    }
+    await collapseEntry(group);
+    return nodeInfo[nodeIds[id]];
+  }
+
+  /**
+   * Adds a group to the collapsed groups, so that it can be undone.
+   *
+   * @param {object} group - the group, see `collapseGroup` and `createGroup`
+   */
+  async function collapseEntry(group) {
+    let before = collapsed.groups;
+    let after = before.concat([group]);
+    await showCollapsedGroups(after);
+    record({undo: () => showCollapsedGroups(before),
+            redo: () => showCollapsedGroups(after)});
+  }
+
+  /**
+   * Expands a collapsed group, replacing its metanode with the nodes and
+   * links of the group.
+   *
+   * @param {string} id - ID of the metanode
+   * @returns {Promise} A promise which resolves with the info of the nodes
+   *     of the group.
+   */
+  async function expandGroup(id) {
+    let before = collapsed.groups;
+    let group = before.find(g => collapsedId(g) == id);
+    if (!group) {
+      console.warn("not a collapsed group: '" + id + "'.");
+      return [];
+    }
+    let after = before.filter(g => g !== group);
+    let shown = new Set(Object.keys(nodeIds));
+    await showCollapsedGroups(after);
+    record({undo: () => showCollapsedGroups(before),
+            redo: () => showCollapsedGroups(after)});
+    return nodeInfo.filter(node => !shown.has(node.id));
+  }
+
+  /**
+   * Returns the collapsed groups, see `collapseGroup`.
+   *
+   * @returns {Array} The groups, formatted as {id, attribute, value, label,
+   *     color}, where id is the ID of the metanode.
+   */
+  function getCollapsedGroups() {
+    return collapsed.groups.filter(g => !g.nodes).map(g =>
+      Object.assign({id: collapsedId(g)}, g));
+  }
+
+  /**
+   * Returns whether a user-defined group is collapsed into a metanode.
+   *
+   * @param {string} id - the group ID
+   */
+  function isGroupCollapsed(id) {
+    return collapsed.groups.some(g => g.nodes && g.id == id);
+  }
+
+  /**
+   * Draws the hulls around the nodes of the user-defined groups which are
+   * not collapsed.
+   */
+  function buildGroupHulls() {
+    hullMeshes.forEach(mesh => {
+      graph.remove(mesh);
+      mesh.geometry.dispose();
+      mesh.material.dispose();
+    });
+    hullMeshes = [];
+    nodeGroups.forEach(group => {
+      let points = group.nodes.filter(id => nodeIds[id] !== undefined)
+        .map(id => nodeInfo[nodeIds[id]].pos);
+      if (points.length == 0 || isGroupCollapsed(group.id)) return;
+      let mesh = makeHullMesh(points, currentNodeSize || 1, group);
+      mesh.renderOrder = 5;
+      graph.add(mesh);
+      hullMeshes.push(mesh);
+    });
+  }
+
+  /**
+   * Returns a copy of a user-defined group, with the extra key collapsed.
+   *
+   * @param {object} group - the group
+   * @returns {object} The copy.
+   */
+  function copyGroup(group) {
+    return Object.assign({}, group, {nodes: group.nodes.slice(),
+                                     color: group.color.slice(),
+                                     collapsed: isGroupCollapsed(group.id)});
+  }
+
+  /**
+   * Groups nodes into a module, e.g. a pathway of interest, drawn as a
+   * translucent hull around the nodes. Like compartments, the group can be
+   * collapsed into a metanode (see `setGroupCollapsed`), and it can be
+   * styled (see `updateGroup`), moved (see `moveGroup`) and dissolved again
+   * (see `removeGroup`).
+   *
+   * @param {Array} ids - IDs of the nodes of the group
+   * @param {object} options - (optional) group options with the keys id
+   *     (default a new unique ID), label (the metanode label), color ([r, g,
+   *     b], default [100, 149, 237]), opacity (of the hull, default 0.15) and
+   *     collapsed (whether to collapse the group right away)
+   * @returns {Promise} A promise which resolves with the group, formatted as
+   *     {id, nodes, label, color, opacity, collapsed}, or undefined if none
+   *     of the nodes exist.
+   */
+  async function createGroup(ids, options = {}) {
+    let nodes = ids.filter(id => nodeIds[id] !== undefined);
+    if (nodes.length == 0) {
+      console.warn('no nodes to group.');
+      return undefined;
+    }
+    let id = options.id !== undefined ? String(options.id) : groupId();
+    if (nodeGroups.some(g => g.id == id)) {
+      console.warn("group id already in use: '" + id + "'.");
+      return undefined;
+    }
+    let group = {id: id,
+                 nodes: nodes,
+                 label: options.label !== undefined ? String(options.label) : undefined,
+                 color: options.color || [100, 149, 237],
+                 opacity: options.opacity !== undefined ? options.opacity : 0.15};
+    nodeGroups.push(group);
+    if (options.collapsed) {
+      await setGroupCollapsed(id, true);
+    } else {
+      buildGroupHulls();
+      requestAnimationFrame(render);
+    }
+    return copyGroup(group);
+  }
+
+  /**
+   * Returns the user-defined groups, see `createGroup`.
+   *
+   * @returns {Array} The groups, formatted as {id, nodes, label, color,
+   *     opacity, collapsed}.
+   */
+  function getGroups() {
+    return nodeGroups.map(copyGroup);
+  }
+
+  /**
+   * Changes the label, color or hull opacity of a user-defined group.
+   *
+   * @param {string} id - the group ID
+   * @param {object} style - the keys to change: label, color or opacity, see
+   *     `createGroup`
+   * @returns {Promise} A promise which resolves with false if there is no
+   *     group with the ID.
+   */
+  async function updateGroup(id, style) {
+    let group = nodeGroups.find(g => g.id == id);
+    if (!group) return false;
+    ['label', 'color', 'opacity'].forEach(key => {
+      if (style[key] !== undefined) {
+        group[key] = style[key];
+      }
+    });
+    if (isGroupCollapsed(id)) {
+      await showCollapsedGroups(collapsed.groups.map(g => g.nodes && g.id == id ?
+        {id: id, nodes: g.nodes, label: group.label, color: group.color} : g));
+    } else {
+      buildGroupHulls();
+      requestAnimationFrame(render);
+    }
+    return true;
+  }
+
+  /**
+   * Collapses a user-defined group into a metanode, or expands it again.
+   * Clicking the metanode also expands the group.
+   *
+   * @param {string} id - the group ID
+   * @param {boolean} collapse - whether to collapse the group
+   * @returns {Promise} A promise which resolves with false if there is no
+   *     group with the ID.
+   */
+  async function setGroupCollapsed(id, collapse) {
+    let group = nodeGroups.find(g => g.id == id);
+    if (!group) return false;
+    if (collapse && !isGroupCollapsed(id)) {
+      await collapseEntry({id: id, nodes: group.nodes, label: group.label, color: group.color});
+    } else if (!collapse && isGroupCollapsed(id)) {
+      await expandGroup(collapsedId(group));
+    }
+    return true;
+  }
+
+  /**
+   * Moves the nodes of a set of groups and redraws the graph.
+   *
+   * @param {Set} ids - IDs of the nodes to move
+   * @param {Array} offset - the offset as [x, y, z]
+   */
+  async function moveNodes(ids, offset) {
+    let base = collapsed.base || currentData.graphData;
+    await showCollapsedGroups(collapsed.groups, {
+      nodes: base.nodes.map(node => !ids.has(node.id) ? node :
+        Object.assign({}, node, {pos: node.pos.map((v, k) => v + offset[k])})),
+      links: base.links
+    });
+  }
+
+  /**
+   * Moves the nodes of a user-defined group, e.g. to pull a module out of a
+   * dense region. The move can be undone.
+   *
+   * @param {string} id - the group ID
+   * @param {Array} offset - the offset in graph units as [x, y, z]
+   * @returns {Promise} A promise which resolves with false if there is no
+   *     group with the ID.
+   */
+  async function moveGroup(id, offset) {
+    let group = nodeGroups.find(g => g.id == id);
+    if (!group || !currentData) return false;
+    let ids = new Set(group.nodes);
+    await moveNodes(ids, offset);
+    record({undo: () => moveNodes(ids, offset.map(v => -v)),
+            redo: () => moveNodes(ids, offset)});
+    return true;
+  }
+
+  /**
+   * Dissolves a user-defined group, expanding it first if it's collapsed.
+   * The nodes stay where they are.
+   *
+   * @param {string} id - the group ID
+   * @returns {Promise} A promise which resolves with false if there is no
+   *     group with the ID.
+   */
+  async function removeGroup(id) {
+    let group = nodeGroups.find(g => g.id == id);
+    if (!group) return false;
+    await setGroupCollapsed(id, false);
+    nodeGroups = nodeGroups.filter(g => g !== group);
+    buildGroupHulls();
+    requestAnimationFrame(render);
+    return true;
+  }
+
+  /**
+   * Finds clusters of densely connected nodes (communities), to help
+   * discover the modular structure of unfamiliar models. The clustering
+   * runs in a web worker and ignores the link directions. The cluster number
+   * of each node, from 0 for the largest cluster, is added to the node
+   * attributes under `attribute`, so that clusters can also be used in
+   * styles (see `setStyle`), filters (see `setFilter`) and collapsed (see
+   * `collapseGroup`). The node data given to the viewer isn't changed.
+   *
+   * @param {object} options - (optional) clustering options with the keys:
+   *     - method: 'louvain' (default), which gives the best clusters, or
+   *       'labelPropagation', which is faster on very large networks
+   *     - resolution: for 'louvain', higher values give more and smaller
+   *       clusters (default 1)
+   *     - weight: link data attribute, or function of the link data, giving
+   *       the link weights (default 1 for all links)
+   *     - attribute: node data attribute to store the cluster in (default
+   *       'cluster')
+   *     - color: whether to color the nodes by cluster (default true)
+   *     - groups: whether to draw a hull around each cluster, as groups with
+   *       the IDs 'cluster-<number>' (default false), see `createGroup`
+   *     - minSize: the smallest cluster to draw a hull around (default 3)
+   * @returns {Promise} A promise which resolves with the clusters,
+   *     formatted as {count, modularity, clusters}, where clusters is the
+   *     list of node IDs of each cluster, largest first.
+   */
+  async function detectClusters(options = {}) {
+    if (!nodeMesh) return {count: 0, modularity: 0, clusters: []};
+    let attribute = options.attribute || 'cluster';
+    let weightOf = typeof options.weight === 'function' ? options.weight :
+                   options.weight ? data => Number(data[options.weight]) : () => 1;
+    let edges = linkInfo.map(link => [nodeIds[link.s], nodeIds[link.t],
+                                      Math.max(0, weightOf(link.data) || 0)]);
+    let found = await findClustersInWorker(nodeInfo.length, edges, {
+      method: options.method || 'louvain',
+      resolution: options.resolution
+    });
+
+    let clusters = Array.from({length: found.count}, () => []);
+    clusterLabels = {attribute: attribute, labels: new Map()};
+    nodeInfo.forEach((node, i) => {
+      clusterLabels.labels.set(node.id, found.labels[i]);
+      clusters[found.labels[i]].push(node.id);
+    });
+    let colors = categorical.okabeIto;
+    let rules = styleRules.filter(rule => rule !== clusterRule);
+    clusterRule = undefined;
+    if (options.color !== false) {
+      clusterRule = {selector: 'node',
+                     style: {color: {attr: attribute,
+                                     scale: 'categorical',
+                                     domain: clusters.map((_, k) => k),
+                                     range: colors}}};
+      rules.push(clusterRule);
+    }
+    setStyle(rules);
+
+    nodeGroups = nodeGroups.filter(g => !/^cluster-\d+$/.test(g.id));
+    if (options.groups) {
+      let minSize = options.minSize !== undefined ? options.minSize : 3;
+      clusters.forEach((ids, k) => {
+        if (ids.length < minSize) return;
+        nodeGroups.push({id: 'cluster-' + k,
+                         nodes: ids,
+                         label: 'Cluster ' + (k + 1),
+                         color: colors[k % colors.length],
+                         opacity: 0.15});
+      });
+    }
+    buildGroupHulls();
+    requestAnimationFrame(render);
+    return {count: found.count, modularity: found.modularity, clusters: clusters};
+  }
+
+  /**
+   * Sets a callback which returns the neighbors to add when a node is
+   * expanded by double clicking it, e.g. by fetching them from a server.
+   *
+   * @param {function} callback - function taking the node info and returning
+   *     graph data (or a promise of graph data) formatted like
+   *     {nodes: [], links: []}. If omitted, expanding reveals hidden
+   *     neighbors from the initial data.
+   */
+  function setExpandCallback(callback) {
+    expandCallback = callback;
+  }
+
+  /**
+   * Context menu callback which dispatches a 'contextmenu' event on the
+   * viewer container, with the node under the mouse pointer (or null) and the
+   * pointer position in page and canvas coordinates. If the host calls
+   * `preventDefault()` on the event, the browser context menu is suppressed.
+   *
+   * @param {event} event - A native context menu event.
+   */
+  function onContextMenu(event) {
+    // the native event is replaced by the viewer event
+    event.stopPropagation();
+
+    let items = nodeMesh ? pickInScene(event) : [];
+    let size = renderer.domElement.getBoundingClientRect();
+    let menuEvent = new CustomEvent(
+      "contextmenu",
+      {
+        detail: {
+          item: items.length > 0 ? nodeInfo[items[0]] : null,
+          x: event.clientX,
+          y: event.clientY,
+          canvasX: event.clientX - size.x,
+          canvasY: event.clientY - size.y
+        },
+        bubbles: false,
+        cancelable: true
+      });
+    if (!container.dispatchEvent(menuEvent)) {
+      event.preventDefault();
+    }
+  }
+
+  /**
+   * Pointer down callback which starts a box or lasso selection when
+   * shift-dragging.
+   * The camera controls are disabled while dragging.
+   *
+   * @param {event} event - A pointer down event.
+   */
+  function onSelectionStart(event) {
+    if (!boxSelection.enabled || !event.shiftKey || event.button != 0 ||
+        drawing.tool != 'none') {
+      return;
+    }
+    selectionDrag = [[event.clientX, event.clientY]];
+    cameraControls.enabled = false;
+    window.addEventListener('pointermove', onSelectionMove, false);
+    window.addEventListener('pointerup', onSelectionEnd, false);
+  }
+
+  /**
+   * Gives the container keyboard focus, without scrolling the page.
+   */
+  function focusContainer() {
+    container.focus({preventScroll: true});
+  }
+
+  /**
+   * Pointer move callback which updates the selection rectangle or lasso.
+   *
+   * @param {event} event - A pointer move event.
+   */
+  function onSelectionMove(event) {
+    if (boxSelection.mode == 'lasso') {
+      selectionDrag.push([event.clientX, event.clientY]);
+      selectionOverlay.showLasso(selectionDrag);
+    } else {
+      selectionDrag[1] = [event.clientX, event.clientY];
+      selectionOverlay.showBox(selectionDrag[0], selectionDrag[1]);
+    }
+  }
+
+  /**
+   * Pointer up callback which selects the nodes in the selection rectangle
+   * or lasso. Drags shorter than a few pixels are handled as clicks.
+   *
+   * @param {event} event - A pointer up event.
+   */
+  function onSelectionEnd(event) {
+    window.removeEventListener('pointermove', onSelectionMove, false);
+    window.removeEventListener('pointerup', onSelectionEnd, false);
+    selectionOverlay.hide();
+    cameraControls.enabled = true;
+
+    let points = selectionDrag;
+    let lasso = boxSelection.mode == 'lasso';
+    if (lasso) {
+      points.push([event.clientX, event.clientY]);
+    } else {
+      points[1] = [event.clientX, event.clientY];
+    }
+    selectionDrag = undefined;
+
+    let bounds = pointBounds(points);
+    if (bounds.width < 4 && bounds.height < 4) {
+      onMouseClick(event);
+      return;
+    }
+    select(lasso ? nodesInRegion(bounds, (x, y) => pointInPolygon(x, y, points)) :
+                   nodesInRegion(bounds));
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns the nodes inside a region of the page. Unless occluded nodes are
+   * included, the nodes are read from the picking buffer, so that only nodes
+   * which are visible in the region are returned.
+   *
+   * @param {Object} bounds - bounding rectangle of the region in page
+   *     coordinates, as {left, top, width, height}
+   * @param {Function} contains - (optional) function taking page coordinates
+   *     (x, y), which returns false for points outside of the region
+   * @returns {Array} The indices of the nodes in the region.
+   */
+  function nodesInRegion(bounds, contains = () => true) {
+    if (!nodeMesh) return [];
+    let size = renderer.domElement.getBoundingClientRect();
+
+    if (boxSelection.includeOccluded) {
+      let opacities = nodeMesh.geometry.attributes.nodeOpacity.array;
+      let point = new Vector3();
+      camera.updateMatrixWorld();
+      return nodeInfo.filter((node, i) => {
+        if (opacities[i] < 0.01) return false;
+        point.set(node.pos[0], node.pos[1], node.pos[2]).project(camera);
+        if (point.z < -1 || point.z > 1) return false;
+        let x = size.x + (point.x + 1) / 2 * size.width;
+        let y = size.y + (1 - point.y) / 2 * size.height;
+        return x >= bounds.left && x <= bounds.left + bounds.width &&
+               y >= bounds.top && y <= bounds.top + bounds.height &&
+               contains(x, y);
+      }).map(node => node.index);
+    }
+
+    // render the region of the index scene and collect the node ids
+    let dpr = window.devicePixelRatio || 1;
+    let width = Math.max(1, Math.round(bounds.width * dpr));
+    let height = Math.max(1, Math.round(bounds.height * dpr));
+    let target = new WebGLRenderTarget(width, height);
+    camera.setViewOffset(renderer.domElement.width,
+      renderer.domElement.height,
+      (bounds.left - size.x) * dpr,
+      (bounds.top - size.y) * dpr,
+      width,
+      height);
+    renderer.setRenderTarget(target);
+    renderer.render(indexScene, camera);
+
+    let pixelBuffer = new Uint8Array(width * height * 4);
+    renderer.readRenderTargetPixels(target, 0, 0, width, height, pixelBuffer);
+    camera.clearViewOffset();
+    renderer.setRenderTarget(null);
+    target.dispose();
+
+    let ids = new Set();
+    for (let py = 0; py < height; py++) {
+      for (let px = 0; px < width; px++) {
+        let p = (py * width + px) * 4;
+        let id = (pixelBuffer[p] << 16) | (pixelBuffer[p+1] << 8) | pixelBuffer[p+2];
+        // skip the background, and pixels outside of the region (the pixel
+        // rows are read bottom-up)
+        if (id == 16777215 || ids.has(id) || !nodeInfo[id]) continue;
+        if (contains(bounds.left + (px + 0.5) / dpr,
+                     bounds.top + (height - py - 0.5) / dpr)) {
+          ids.add(id);
+        }
+      }
+    }
+    return [...ids];
+  }
+
+  /**
+   * Sets the box selection options.
+   *
+   * @param {boolean} enabled - whether shift-dragging selects the nodes in
+   *     the dragged rectangle
+   * @param {object} settings - (optional) settings with the keys mode
+   *     ('box' or 'lasso', see `setSelectionMode`) and includeOccluded, to
+   *     also select nodes hidden behind other nodes
+   */
+  function setBoxSelection(enabled, settings = {}) {
+    boxSelection = Object.assign({}, boxSelection, settings, {enabled: enabled});
+  }
+
+  /**
+   * Sets the shape of the region drawn when shift-dragging. The lasso mode
+   * allows freehand selection of irregular regions, like curved pathways.
+   *
+   * @param {string} mode - 'box' (default) or 'lasso'
+   */
+  function setSelectionMode(mode) {
+    boxSelection.mode = mode;
+  }
+
+  /**
+   * Returns where a pointer event hits a plane.
+   *
+   * @param {event} event - A pointer event.
+   * @param {object} plane - the plane, formatted as {point, normal}
+   * @returns {Array} The point as [x, y, z], or undefined if the pointer
+   *     doesn't point at the plane.
+   */
+  function screenToPlane(event, plane) {
+    let rect = renderer.domElement.getBoundingClientRect();
+    let direction = new Vector3((event.clientX - rect.left) / rect.width * 2 - 1,
+                                1 - (event.clientY - rect.top) / rect.height * 2, 0.5)
+      .unproject(camera).sub(camera.position).normalize();
+    let facing = direction.dot(plane.normal);
+    if (facing <= 0) return undefined;
+    let distance = plane.point.clone().sub(camera.position).dot(plane.normal) / facing;
+    return camera.position.clone().addScaledVector(direction, distance).toArray();
+  }
+
+  /**
+   * Removes the newest stroke under the pointer, if any.
+   *
+   * @param {event} event - A pointer event.
+   */
+  function eraseStrokeAt(event) {
+    let rect = renderer.domElement.getBoundingClientRect();
+    let stroke = sketch.strokeAt(event.clientX - rect.left, event.clientY - rect.top,
+                                 camera, rect, 4);
+    if (!stroke) return;
+    sketch.erase(stroke.id);
+    record({undo: () => { sketch.draw(stroke); requestAnimationFrame(render); },
+            redo: () => { sketch.erase(stroke.id); requestAnimationFrame(render); }});
+  }
+
+  /**
+   * Pointer down callback which starts a stroke with the pen, or starts
+   * erasing with the eraser. The stroke is drawn on the plane facing the
+   * camera through the node under the pointer, or through the camera target
+   * when there is no node. The camera controls are disabled while drawing.
+   *
+   * @param {event} event - A pointer down event.
+   */
+  function onDrawStart(event) {
+    if (drawing.tool == 'none' || event.button != 0) {
+      return;
+    }
+    cameraControls.enabled = false;
+    if (drawing.tool == 'pen') {
+      let items = nodeMesh ? pickInScene(event) : [];
+      drawingPlane = {
+        point: items.length > 0 ? new Vector3().fromArray(nodeInfo[items[0]].pos) :
+                                  cameraControls.target.clone(),
+        normal: camera.getWorldDirection(new Vector3())
+      };
+      drawingStroke = {id: strokeId(),
+                       points: [],
+                       color: drawing.color.slice(),
+                       width: drawing.width};
+    }
+    window.addEventListener('pointermove', onDrawMove, false);
+    window.addEventListener('pointerup', onDrawEnd, false);
+    onDrawMove(event);
+  }
+
+  /**
+   * Pointer move callback which extends the stroke, or erases the strokes
+   * under the pointer. Points closer than two pixels to the last point are
+   * skipped.
+   *
+   * @param {event} event - A pointer move event.
+   */
+  function onDrawMove(event) {
+    if (drawing.tool == 'eraser') {
+      eraseStrokeAt(event);
+    } else if (drawingStroke) {
+      let point = screenToPlane(event, drawingPlane);
+      let points = drawingStroke.points;
+      if (!point) return;
+      if (points.length > 0) {
+        let rect = renderer.domElement.getBoundingClientRect();
+        let last = toScreen(points[points.length - 1]);
+        if (Math.hypot(last[0] - (event.clientX - rect.left),
+                       last[1] - (event.clientY - rect.top)) < 2) {
+          return;
+        }
+      }
+      points.push(point);
+      sketch.draw(drawingStroke);
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Pointer up callback which finishes the stroke, so that it can be undone.
+   */
+  function onDrawEnd() {
+    window.removeEventListener('pointermove', onDrawMove, false);
+    window.removeEventListener('pointerup', onDrawEnd, false);
+    cameraControls.enabled = true;
+    let stroke = drawingStroke;
+    drawingStroke = undefined;
+    if (stroke && stroke.points.length > 0) {
+      record({undo: () => { sketch.erase(stroke.id); requestAnimationFrame(render); },
+              redo: () => { sketch.draw(stroke); requestAnimationFrame(render); }});
+    }
+  }
+
+  /**
+   * Sets the freehand drawing tool, for circling regions or drawing arrows
+   * in the network. While a tool is set, dragging draws or erases instead of
+   * moving the camera, and clicking doesn't select nodes. Strokes stay in
+   * place in the network when the camera moves, and can be undone.
+   *
+   * @param {string} tool - 'pen' to draw strokes, 'eraser' to remove the
+   *     strokes dragged over, or 'none' (default) to navigate again
+   * @param {object} settings - (optional) pen settings with the keys color
+   *     ([r, g, b], default [255, 64, 64]) and width (in pixels, default 4)
+   */
+  function setDrawingTool(tool, settings = {}) {
+    Object.assign(drawing, settings, {tool: tool || 'none'});
+    renderer.domElement.style.cursor = drawing.tool == 'none' ? '' : 'crosshair';
+  }
+
+  /**
+   * Removes all freehand strokes.
+   */
+  function clearDrawing() {
+    let strokes = sketch.getStrokes();
+    if (strokes.length == 0) return;
+    sketch.clear();
+    record({undo: () => { strokes.forEach(sketch.draw); requestAnimationFrame(render); },
+            redo: () => { sketch.clear(); requestAnimationFrame(render); }});
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Handles keypresses. Current controls:
+   *
+   *  - r: reset camera to start position.
+   *  - q: reset the selection
+   *
+   * @param {*} event - A keypress event
+   */
+  function onKeypress(event) {
+    if (event.key == 'r') {
+      resetCamera();
+    } else if (event.key == 'q') {
+      resetSelection();
+    } else if (event.key == 'l') {
+      toggleLabels();
+    } else if (event.key == 'g') {
+      toggleNodeType('e');
+    }
+  }
+
+  /**
+   * Handles keyboard navigation when the viewer has focus:
+   *
+   *  - arrow keys: move the focus to the connected node in that direction on
+   *    screen
+   *  - tab / shift+tab: move the focus to the next / previous connected node,
+   *    and out of the viewer after the last / before the first one
+   *  - enter: select the focused node, ctrl/cmd+enter: add it to or remove
+   *    it from the selection, shift+enter: add the shortest path from the
+   *    last selected node, like clicking with the same keys
+   *  - i: show or hide the tooltip of the focused node
+   *  - f: fly the camera to the focused node
+   *  - e: expand the neighborhood of the focused node, like double clicking
+   *  - shift+arrow keys: rotate the camera around its target
+   *  - + / -: move the camera closer to / away from its target
+   *  - escape: remove the focus
+   *
+   * The first arrow key press focuses the selected node, or the node closest
+   * to the camera target. The focused node is marked with a ring. A 'nodefocus'
+   * event with the node info is dispatched on the viewer container whenever
+   * the focus moves.
+   *
+   * @param {*} event - A keydown event
+   */
+  function onKeydown(event) {
+    if ((event.ctrlKey || event.metaKey) && ['z', 'Z', 'y'].includes(event.key)) {
+      event.preventDefault();
+      if (event.key == 'y' || event.shiftKey) {
+        redo();
+      } else {
+        undo();
+      }
+      return;
+    }
+    if (event.altKey && ['ArrowLeft', 'ArrowRight'].includes(event.key)) {
+      event.preventDefault();
+      if (event.key == 'ArrowLeft') {
+        goBack();
+      } else {
+        goForward();
+      }
+      return;
+    }
+    const directions = {
+      ArrowLeft: [-1, 0],
+      ArrowRight: [1, 0],
+      ArrowUp: [0, -1],
+      ArrowDown: [0, 1]
+    };
+    if (event.shiftKey && directions[event.key]) {
+      event.preventDefault();
+      let step = Math.PI / 18;
+      orbitCamera(-directions[event.key][0] * step, -directions[event.key][1] * step);
+      return;
+    }
+    if (['+', '=', '-'].includes(event.key) && !event.ctrlKey && !event.metaKey) {
+      event.preventDefault();
+      zoomCamera(event.key == '-' ? 1.25 : 0.8);
+      return;
+    }
+    if (!nodeMesh || nodeInfo.length == 0) return;
+
+    if (event.key == 'Escape') {
+      if (focusedNode !== undefined) {
+        focusedNode = undefined;
+        focusAnchor = undefined;
+        focusTooltip = false;
+        hideTooltip();
+        select([], false);
+        requestAnimationFrame(render);
+      }
+      return;
+    }
+    if (event.key == 'Enter') {
+      if (focusedNode !== undefined) {
+        let items = [focusedNode];
+        if (event.ctrlKey || event.metaKey) {
+          items = selected.includes(focusedNode) ? selected.filter(i => i != focusedNode) :
+                                                   selected.concat([focusedNode]);
+        } else if (event.shiftKey && lastClicked !== undefined) {
+          let path = shortestPath(getAdjacency(), lastClicked, focusedNode);
+          if (path.length == 0) {
+            path = [focusedNode];
+          }
+          items = selected.concat(path.filter(i => !selected.includes(i)));
+        }
+        lastClicked = focusedNode;
+        select(items);
+        if (nodeSelectCallback && items.length === 1) {
+          nodeSelectCallback(nodeInfo[items[0]]);
+        }
+        requestAnimationFrame(render);
+      }
+      return;
+    }
+    if (focusedNode !== undefined && !event.ctrlKey && !event.metaKey && !event.altKey) {
+      if (event.key == 'i') {
+        focusTooltip = !focusTooltip;
+        if (focusTooltip) {
+          showFocusTooltip();
+        } else {
+          hideTooltip();
+        }
+        return;
+      }
+      if (event.key == 'f') {
+        focusNode(nodeInfo[focusedNode].id);
+        return;
+      }
+      if (event.key == 'e') {
+        expandNode(nodeInfo[focusedNode].id);
+        return;
+      }
+    }
+    if (event.key == 'Tab') {
+      // cycle through the neighbors of the anchor node in a stable order.
+      // Tab is let through to the page when no node is focused, the anchor
+      // has no neighbors, or the cycle is over, so that the viewer isn't a
+      // keyboard trap.
+      if (focusedNode === undefined) return;
+      let order = getAdjacency()[focusAnchor].slice().sort((a, b) => a - b);
+      let current = order.indexOf(focusedNode);
+      let next = current < 0 ? (event.shiftKey ? order.length - 1 : 0) :
+                 current + (event.shiftKey ? -1 : 1);
+      if (next < 0 || next >= order.length) return;
+      event.preventDefault();
+      setFocus(order[next], false);
+      return;
+    }
+    if (!directions[event.key]) return;
+    event.preventDefault();
+
+    if (focusedNode === undefined) {
+      setFocus(selected.length > 0 ? selected[0] : closestToTarget());
+      return;
+    }
+
+    // choose the neighbor whose on-screen direction is closest to the key
+    let dir = directions[event.key];
+    let origin = toScreen(nodeInfo[focusedNode].pos);
+    let best = -Infinity;
+    let next;
+    getAdjacency()[focusedNode].forEach(i => {
+      let p = toScreen(nodeInfo[i].pos);
+      let dx = p[0] - origin[0], dy = p[1] - origin[1];
+      let length = Math.sqrt(dx*dx + dy*dy);
+      let score = length > 0 ? (dx*dir[0] + dy*dir[1]) / length : -1;
+      if (score > best) {
+        best = score;
+        next = i;
+      }
+    });
+    if (best > 0.3) {
+      setFocus(next);
+    }
+  }
+
+  /**
+   * Moves the keyboard focus to a node, highlights it as hovered and
+   * dispatches a 'nodefocus' event.
+   *
+   * @param {number} i - index of the node
+   * @param {boolean} moveAnchor - (optional) whether tab should cycle through
+   *     the neighbors of the new node (default), or keep cycling through the
+   *     neighbors of the current anchor node
+   */
+  function setFocus(i, moveAnchor = true) {
+    if (i === undefined) return;
+    focusedNode = i;
+    if (moveAnchor) {
+      focusAnchor = i;
+    }
+    select([i], false);
+    if (focusTooltip) {
+      showFocusTooltip();
+    }
+    if (announcements.enabled) {
+      announcer.announce(describeNode(i));
+    }
+    requestAnimationFrame(render);
+    container.dispatchEvent(new CustomEvent(
+      "nodefocus",
+      {
+        detail: {
+          item: nodeInfo[i]
+        },
+        bubbles: false,
+        cancelable: false
+      }));
+  }
+
+  /**
+   * Shows the tooltip of the node with keyboard focus, next to the node.
+   */
+  function showFocusTooltip() {
+    let rect = container.getBoundingClientRect();
+    let p = toScreen(nodeInfo[focusedNode].pos);
+    showTooltip(focusedNode, {clientX: rect.left + p[0], clientY: rect.top + p[1]});
+  }
+
+  /**
+   * Places the ring around the node with keyboard focus, or hides it if no
+   * node has focus. The ring is a bit larger than the node on screen.
+   */
+  function updateFocusRing() {
+    let node = focusedNode !== undefined ? nodeInfo[focusedNode] : undefined;
+    let depth = node ? new Vector3().fromArray(node.pos)
+      .applyMatrix4(camera.matrixWorldInverse).z : 0;
+    if (!node || depth >= -camera.near) {
+      focusRing.hidden = true;
+      return;
+    }
+    let scale = nodeMesh.geometry.attributes.nodeScale.array[focusedNode];
+    let size = (currentNodeSize || 1) * scale * container.offsetHeight /
+               (2 * Math.tan(camera.fov * Math.PI / 360) * -depth);
+    let radius = Math.max(8, size / 2 + 4);
+    let p = toScreen(node.pos);
+    focusRing.style.left = (p[0] - radius) + 'px';
+    focusRing.style.top = (p[1] - radius) + 'px';
+    focusRing.style.width = (radius * 2) + 'px';
+    focusRing.style.height = (radius * 2) + 'px';
+    focusRing.hidden = false;
+  }
+
+  /**
+   * Rotates the camera around its target, for keyboard navigation.
+   *
+   * @param {number} yaw - rotation around the camera up vector in radians
+   * @param {number} pitch - rotation around the camera right vector in
+   *     radians
+   */
+  function orbitCamera(yaw, pitch) {
+    let offset = camera.position.clone().sub(cameraControls.target);
+    let up = camera.up.clone().normalize();
+    let right = new Vector3().crossVectors(up, offset).normalize();
+    let rotation = new Quaternion().setFromAxisAngle(up, yaw)
+      .multiply(new Quaternion().setFromAxisAngle(right, pitch));
+    offset.applyQuaternion(rotation);
+    camera.up.applyQuaternion(rotation);
+    camera.position.copy(cameraControls.target).add(offset);
+    camera.lookAt(cameraControls.target);
+    cameraControls.update();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Moves the camera towards or away from its target, for keyboard
+   * navigation.
+   *
+   * @param {number} factor - the factor to scale the distance to the target
+   *     by
+   */
+  function zoomCamera(factor) {
+    let offset = camera.position.clone().sub(cameraControls.target);
+    camera.position.copy(cameraControls.target).addScaledVector(offset, factor);
+    cameraControls.update();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns the index of the node closest to the camera target.
+   */
+  function closestToTarget() {
+    return octree.nearest(cameraControls.target.toArray());
+  }
+
+  /**
+   * Returns the index of the link between two nodes, in either direction.
+   * A link from `s` to `t` is preferred over a link from `t` to `s`.
+   *
+   * @param {string} s - ID of the source node
+   * @param {string} t - ID of the target node
+   * @returns {number} The index of the link in `linkInfo`, or undefined.
+   */
+  function findLink(s, t) {
+    let node = nodeInfo[nodeIds[s]];
+    if (!node) return undefined;
+    let conn = node.connections.to.find(c => c.neighbor == t) ||
+               node.connections.from.find(c => c.neighbor == t);
+    return conn ? conn.link : undefined;
+  }
+
+  /**
+   * Returns where an annotation is pinned: the position of its node, or the
+   * middle of its link curve.
+   *
+   * @param {object} annotation - the annotation
+   * @returns {Array} The position as [x, y, z], or undefined if the node or
+   *     link isn't in the graph.
+   */
+  function annotationAnchor(annotation) {
+    if (annotation.node !== undefined) {
+      let i = nodeIds[annotation.node];
+      return i !== undefined ? nodeInfo[i].pos : undefined;
+    }
+    let link = findLink(annotation.link.s, annotation.link.t);
+    if (link === undefined || !connectionMesh) return undefined;
+    // the curve is stored as segments, so the middle is between the middle
+    // two vertices
+    let positions = connectionMesh.geometry.attributes.position.array;
+    let middle = linkInfo[link].start + linkInfo[link].count / 2;
+    return [0, 1, 2].map(k => (positions[(middle-1)*3 + k] + positions[middle*3 + k]) / 2);
+  }
+
+  /**
+   * Returns the annotations to show, with the screen positions of their
+   * nodes and links. Annotations of hidden nodes and links, and of nodes and
+   * links behind the camera, are left out.
+   *
+   * @param {object} size - the view size in CSS pixels, as {width, height}
+   * @returns {Array} The annotations, each with the extra key anchor, the
+   *     position of its node or link as [x, y].
+   */
+  function annotationCallouts(size) {
+    let opacities = nodeMesh.geometry.attributes.nodeOpacity.array;
+    const shown = id => opacities[nodeIds[id]] >= 0.01;
+    let callouts = [];
+    annotations.forEach(annotation => {
+      let ends = annotation.node !== undefined ? [annotation.node] :
+                                                 [annotation.link.s, annotation.link.t];
+      let pos = annotationAnchor(annotation);
+      if (!pos || !ends.every(shown)) return;
+      let p = new Vector3().fromArray(pos);
+      if (p.clone().applyMatrix4(camera.matrixWorldInverse).z >= -camera.near) return;
+      p.project(camera);
+      let anchor = [(p.x + 1) / 2 * size.width, (1 - p.y) / 2 * size.height];
+      callouts.push(Object.assign({anchor: anchor}, annotation));
+    });
+    return callouts;
+  }
+
+  /**
+   * Places the annotation callouts over the canvas.
+   */
+  function updateAnnotations() {
+    if (!annotationLayer.isVisible()) return;
+    // callouts point at the single view, which isn't shown in the grid
+    annotationLayer.update(smallMultiples ? [] :
+                           annotationCallouts({width: container.offsetWidth,
+                                               height: container.offsetHeight}));
+  }
+
+  /**
+   * Projects a position in graph coordinates to canvas pixel coordinates.
+   *
+   * @param {Array} pos - position as [x, y, z]
+   * @returns {Array} The canvas position as [x, y].
+   */
+  function toScreen(pos) {
+    let p = new Vector3().fromArray(pos).project(camera);
+    return [(p.x + 1) / 2 * container.offsetWidth,
+            (1 - p.y) / 2 * container.offsetHeight];
+  }
+
+  /**
+   * Picks the node under the mouse pointer, by casting a ray from the camera
+   * through the octree of the node positions. Nodes are hit within half
+   * their size from their center, and hidden nodes can't be hit.
+   *
+   * @param {*} event - An event containing mouse coordinates.
+   * @returns {Array} The index of the picked node in a list, or an empty
+   *     list.
+   */
+  function pickInScene(event) {
+    if (!nodeMesh) return [];
+    let start = performance.now();
+    let size = renderer.domElement.getBoundingClientRect();
+    let x = (event.clientX - size.x) / size.width * 2 - 1;
+    let y = 1 - (event.clientY - size.y) / size.height * 2;
+    camera.updateMatrixWorld();
+    let view = camera;
+    if (smallMultiples) {
+      // pick in the panel under the pointer, through its own camera
+      let panel = multiples.locate((event.clientX - size.x) / size.width,
+                                   (event.clientY - size.y) / size.height, camera);
+      x = panel.x;
+      y = panel.y;
+      view = panel.camera;
+      view.updateMatrixWorld();
+    }
+    let direction = new Vector3(x, y, 0.5).unproject(view)
+      .sub(camera.position).normalize();
+
+    let hit = raycastNodes(camera.position, direction, camera.near);
+    pickingTime += performance.now() - start;
+    return hit ? [hit.index] : [];
+  }
+
+  /**
+   * Finds the first node hit by a ray through the octree of the node
+   * positions. Nodes are hit within half their size from their center, and
+   * nodes that aren't drawn can't be hit: hidden nodes, nodes hidden by
+   * occlusion culling, nodes smaller on screen than the minimum node size
+   * (see `setNodeScreenSize`) and nodes not shown yet.
+   *
+   * @param {Object} origin - the ray origin as a Vector3
+   * @param {Object} direction - the normalized ray direction as a Vector3
+   * @param {number} near - ignore hits closer than this
+   * @returns {Object} The hit formatted as {index, distance}, or undefined.
+   */
+  function raycastNodes(origin, direction, near) {
+    if (!nodeMesh) return undefined;
+    let scales = nodeMesh.geometry.attributes.nodeScale.array;
+    let opacities = nodeMesh.geometry.attributes.nodeOpacity.array;
+    let culled = nodeMesh.geometry.attributes.culled.array;
+    let radius = (currentNodeSize || 1) / 2;
+    let maxScale = scales.reduce((a, b) => Math.max(a, b), 0);
+    // the sprite size in pixels, as in the node material, so that nodes too
+    // small to be drawn can't be hit
+    let point = new Vector3();
+    const largeEnough = i => nodeMinScreenSize <= 0 ||
+      2 * radius * scales[i] * container.offsetHeight / 2 /
+        origin.distanceTo(point.fromArray(nodeInfo[i].pos)) >= nodeMinScreenSize;
+    return octree.raycast(origin.toArray(), direction.toArray(), {
+      radius: i => radius * scales[i],
+      maxRadius: radius * maxScale,
+      near: near,
+      filter: i => opacities[i] >= 0.01 && culled[i] < 0.5 && scales[i] > 0 && largeEnough(i)
+    });
+  }
+
+  /**
+   * Returns the link closest to the mouse pointer on screen, if it is within
+   * `tolerance` pixels. Links are not in the index scene, so they are picked
+   * by their projected line segments.
+   *
+   * @param {*} event - An event containing mouse coordinates.
+   * @param {number} tolerance - (optional) maximum distance in pixels
+   * @returns {number} The index of the link in `linkInfo`, or undefined.
+   */
+  function pickLink(event, tolerance = 4) {
+    if (!connectionMesh) return undefined;
+    let start = performance.now();
+    let rect = renderer.domElement.getBoundingClientRect();
+    let x = event.clientX - rect.left;
+    let y = event.clientY - rect.top;
+    let positions = connectionMesh.geometry.attributes.position.array;
+    let best, bestDistance = tolerance;
+    let a = new Vector3();
+    let b = new Vector3();
+    linkInfo.forEach((info, link) => {
+      for (let v = info.start; v < info.start + info.count; v += 2) {
+        a.fromArray(positions, v*3).project(camera);
+        b.fromArray(positions, (v+1)*3).project(camera);
+        // skip segments that are behind the camera
+        if (Math.abs(a.z) > 1 || Math.abs(b.z) > 1) continue;
+        let ax = (a.x + 1) / 2 * rect.width, ay = (1 - a.y) / 2 * rect.height;
+        let bx = (b.x + 1) / 2 * rect.width, by = (1 - b.y) / 2 * rect.height;
+        let dx = bx - ax, dy = by - ay;
+        let lengthSq = dx*dx + dy*dy;
+        let t = lengthSq > 0 ? ((x - ax)*dx + (y - ay)*dy) / lengthSq : 0;
+        t = Math.max(0, Math.min(1, t));
+        let d = Math.hypot(ax + t*dx - x, ay + t*dy - y);
+        if (d < bestDistance) {
+          bestDistance = d;
+          best = link;
+        }
+      }
+    });
+    pickingTime += performance.now() - start;
+    return best;
+  }
+
+  /**
+   * Run the update camera callback with the updated camera position.
+   */
+  function handleUpdateCamera() {
+    if (updateCameraCallback) {
+      updateCameraCallback(camera.position);
+    }
+    emit('cameraChange', {
+      position: camera.position.clone(),
+      target: cameraControls.target.clone(),
+      up: camera.up.clone()
+    });
+  }
+
+  /**
+   * Sets the navigation mode. 'orbit' (default) rotates the camera around
+   * the camera target, while 'fly' moves the camera like in a first-person
+   * game, with WASD to move and mouse drag to look around, for flying through
+   * the interior of the network.
+   *
+   * @param {string} mode - 'orbit' or 'fly'
+   * @param {object} options - (optional) fly options with the keys
+   *     movementSpeed (graph units per second), boostFactor (speed factor
+   *     when holding shift) and lookSpeed (radians per pixel)
+   */
+  function setNavigationMode(mode, options = {}) {
+    let position = camera.position.clone();
+    let target = cameraControls.target.clone();
+    if (cameraControls.dispose) {
+      cameraControls.dispose();
+    }
+    if (mode == 'fly') {
+      setCameraControls(FlyControls);
+      Object.assign(cameraControls, options);
+    } else {
+      setCameraControls(AtlasViewerControls);
+    }
+    setCamera(position, undefined, target);
+  }
+
+  /**
+   * Sets how mouse buttons, the mouse wheel and touch gestures control the
+   * camera, e.g. to pan on left-drag and rotate on right-drag. The bindings
+   * are kept when the camera controls are replaced.
+   *
+   * @param {object} bindings - bindings with the optional keys:
+   *     - mouseButtons: actions of the mouse buttons, formatted as
+   *       {LEFT: <action>, MIDDLE: <action>, RIGHT: <action>}, where the
+   *       actions are 'rotate', 'zoom', 'pan' or 'none'. Default
+   *       {LEFT: 'rotate', MIDDLE: 'zoom', RIGHT: 'pan'}.
+   *     - touches: action of one-finger touch, formatted as {ONE: <action>},
+   *       where the action is 'rotate' (default), 'pan' or 'none'. Two
+   *       fingers always zoom, pan and roll.
+   *     - invertZoom: reverse the zoom direction of the mouse wheel
+   *     - rotateSpeed, zoomSpeed, panSpeed: speed factors
+   */
+  function setControlBindings(bindings) {
+    controlBindings = Object.assign({}, controlBindings, bindings);
+    Object.assign(cameraControls, controlBindings);
+  }
+
+  /**
+   * Sets the camera control function, and adds an event listener which calls
+   * the render function whenever the controls emit a change event.
+   *
+   * @param {function} cameraControlFunction
+   */
+  function setCameraControls(cameraControlFunction) {
+    cameraControls = new cameraControlFunction(camera, renderer.domElement);
+    Object.assign(cameraControls, controlBindings);
+    cameraControls.addEventListener( 'change', render );
+    cameraControls.addEventListener( 'end', handleUpdateCamera );
+    return cameraControls;
+  }
+
+  /**
+   * Sets the color of 'spriteNum' in the nodeMesh to 'color'.
+   *
+   * @param {number} spriteNum - id of the sprite in the nodemesh
+   * @param {array} color - color to set the sprite to.
+   */
+  function setSpriteColor(spriteNum, color = undefined) {
+    if (!nodeInfo[spriteNum]) return;
+
+    let c = color ? color : selected.includes(spriteNum) ? nodeSelectColor :
+            onPath('nodes', spriteNum) ? pathColor :
+            searchMatchColor(spriteNum) || nodeInfo[spriteNum].color;
+    nodeMesh.geometry.attributes.color.array[spriteNum*3+0] = c[0];
+    nodeMesh.geometry.attributes.color.array[spriteNum*3+1] = c[1];
+    nodeMesh.geometry.attributes.color.array[spriteNum*3+2] = c[2];
+    nodeMesh.geometry.attributes.color.needsUpdate = true;
+
+    let secondColors = nodeMesh.geometry.attributes.secondColor;
+    secondColors.array.set(secondColor(nodeInfo[spriteNum], c), spriteNum*4);
+    secondColors.needsUpdate = true;
+  }
+
+  /**
+   * Returns the second color of a node sprite, with the pattern in the alpha
+   * channel, see `extendNodeMaterial`. Split and hatched nodes only show
+   * their second color in their own overlay color.
+   *
+   * @param {Object} node - the node info
+   * @param {Array} c - the color the node is drawn in
+   * @returns {Array} The second color as [r, g, b, pattern].
+   */
+  function secondColor(node, c) {
+    let second = node.overlaySecondColor;
+    let pattern = !second || c !== node.overlayColor ? 0 :
+                  node.overlayPattern == 'hatched' ? 128 : 255;
+    return pattern ? second.concat([pattern]) : [0, 0, 0, 0];
+  }
+
+  /**
+   * Colors all connections of the sprite selected by `spriteNum`, and the
+   * connections of its neighbors up to the highlight depth.
+   *
+   * @param {*} spriteNum - id of the sprite to have it's connections colored
+   * @param {*} color - (optional) color to set the connections to. If omitted,
+   *     the default connection colors will be used, except for the links
+   *     which are also highlighted for a selected node.
+   */
+  function setConnectionsColor(spriteNum, color = undefined) {
+    let node = nodeInfo[spriteNum];
+    if (!node) return;
+
+    let keep = new Set();
+    if (!color && !selected.includes(spriteNum)) {
+      selected.forEach(i => neighborhoodLinks(i).forEach(link => keep.add(link)));
+    }
+    neighborhoodLinks(spriteNum).forEach(link => {
+      if (keep.has(link)) return;
+      let base = linkBaseColors(link);
+      let startColor = color ? color : selected.includes(spriteNum) ? connectionSelectColor : base[0];
+      let endColor = color ? color : selected.includes(spriteNum) ? connectionSelectColor : base[1];
+      setLinkColor(link, startColor, endColor);
+    });
+    connectionMesh.geometry.attributes.color.needsUpdate = true;
+  }
+
+  /**
+   * Returns the links within `highlightDepth` hops of a node, i.e. the links
+   * of the node itself and of every node less than `highlightDepth` hops
+   * away.
+   *
+   * @param {number} spriteNum - index of the node
+   * @returns {Array} The indices of the links in `linkInfo`.
+   */
+  function neighborhoodLinks(spriteNum) {
+    let links = new Set();
+    let visited = new Set([spriteNum]);
+    let frontier = [spriteNum];
+    for (let hop = 0; hop < highlightDepth && frontier.length > 0; hop++) {
+      let next = [];
+      frontier.forEach(i => {
+        let node = nodeInfo[i];
+        node.connections.from.concat(node.connections.to).forEach(conn => {
+          links.add(conn.link);
+          let neighbor = nodeIds[conn.neighbor];
+          if (!visited.has(neighbor)) {
+            visited.add(neighbor);
+            next.push(neighbor);
+          }
+        });
+      });
+      frontier = next;
+    }
+    return [...links];
+  }
+
+  /**
+   * Sets how many link hops around the selected and hovered nodes are
+   * highlighted. With a depth of 1 (default) only the links of the node
+   * itself are highlighted, while higher depths light up the surrounding
+   * pathway.
+   *
+   * @param {number} depth - number of hops, 1 or more
+   */
+  function setHighlightDepth(depth) {
+    highlightDepth = Math.max(1, Math.round(depth));
+    refreshColors();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns true if a node or link is on the shown part of the highlighted
+   * path.
+   *
+   * @param {string} kind - 'nodes' or 'links'
+   * @param {number} i - index of the node or link
+   */
+  function onPath(kind, i) {
+    if (!highlightedPath || !highlightedPath[kind].has(i)) return false;
+    return highlightedPath[kind].get(i) <= highlightedPath.shown;
+  }
+
+  /**
+   * Finds the shortest path between two nodes and highlights it. The path is
+   * revealed step by step from the source node.
+   *
+   * @param {string} sourceId - ID of the start node
+   * @param {string} targetId - ID of the end node
+   * @param {object} options - (optional) path options:
+   *     - weight: link data field or function taking the link data and
+   *       returning the (non-negative) link weight. Default 1 per link.
+   *     - directed: only follow links from start to end (and reversible
+   *       links in both directions). Default false.
+   *     - exclude: node IDs, or a function taking the node info and returning
+   *       true, for nodes that the path may not pass through, such as
+   *       cofactors and currency metabolites
+   *     - highlight: whether to highlight the path (default true)
+   *     - animate: whether to reveal the path step by step (default true)
+   * @returns {object} The path as {nodes: [<node ID>], links: [<link data>],
+   *     weight: <total weight>}, or null if there is no path.
+   */
+  function findPath(sourceId, targetId, options = {}) {
+    options = Object.assign({weight: undefined, directed: false, exclude: [],
+                             highlight: true, animate: true}, options);
+    let source = nodeIds[sourceId];
+    let target = nodeIds[targetId];
+    if (source === undefined || target === undefined) {
+      console.warn("unknown node id: '" +
+                   (source === undefined ? sourceId : targetId) + "'.");
+      return null;
+    }
+
+    let weightOf = typeof options.weight === 'function' ? options.weight :
+                   options.weight ? data => Number(data[options.weight]) : () => 1;
+    let edge = conn => ({neighbor: nodeIds[conn.neighbor],
+                         weight: Math.max(0, weightOf(linkInfo[conn.link].data) || 0),
+                         link: conn.link});
+    let edges = nodeInfo.map(node => node.connections.to.concat(
+      node.connections.from.filter(conn => !options.directed ||
+                                           linkInfo[conn.link].reversible)
+    ).map(edge));
+
+    let excluded = options.exclude;
+    let skip = typeof excluded === 'function' ? i => excluded(nodeInfo[i]) :
+               (ids => i => ids.has(nodeInfo[i].id))(new Set(excluded));
+
+    let path = lightestPath(edges, source, target, skip);
+    if (!path) {
+      return null;
+    }
+
+    if (options.highlight) {
+      highlightedPath = {
+        nodes: new Map(path.nodes.map((node, step) => [node, step])),
+        links: new Map(path.links.map((link, step) => [link, step + 1])),
+        steps: path.links.length,
+        shown: options.animate && !isMotionReduced() ? 0 : path.links.length,
+        start: performance.now()
+      };
+      refreshColors();
+      requestAnimationFrame(render);
+    }
+
+    return {nodes: path.nodes.map(i => nodeInfo[i].id),
+            links: path.links.map(l => linkInfo[l].data),
+            weight: path.weight};
+  }
+
+  /**
+   * Reveals the next steps of the highlighted path.
+   */
+  function pathUpdate() {
+    let shown = Math.min(highlightedPath.steps,
+      Math.floor((performance.now() - highlightedPath.start) / pathStepTime));
+    if (shown != highlightedPath.shown) {
+      highlightedPath.shown = shown;
+      refreshColors();
+      requestAnimationFrame(render);
+    }
+  }
+
+  /**
+   * Walks the camera, or a marker, along the highlighted path node by node,
+   * pausing briefly at every node. A 'traverse' event with the node info is
+   * dispatched on the viewer container whenever a node is reached.
+   *
+   * @param {object} options - (optional) traversal options:
+   *     - mode: 'camera' (default) to move the camera along the path, keeping
+   *       the current viewing direction, or 'marker' to move a marker
+   *     - stepTime: time in milliseconds per node (default 1500)
+   *     - distance: camera distance to the nodes in camera mode. Defaults to
+   *       the current distance to the camera target.
+   *     - loop: whether to start over at the end of the path
+   * @returns {Promise} A promise which resolves when the traversal ends.
+   */
+  function traversePath(options = {}) {
+    stopTraversal();
+    if (!highlightedPath) {
+      console.warn("no path to traverse, use findPath first.");
+      return Promise.resolve();
+    }
+    options = Object.assign({mode: 'camera', stepTime: 1500, loop: false}, options);
+
+    let nodes = [...highlightedPath.nodes.keys()]
+      .sort((a, b) => highlightedPath.nodes.get(a) - highlightedPath.nodes.get(b));
+    let offset = new Vector3().subVectors(camera.position, cameraControls.target);
+    if (options.distance !== undefined) {
+      offset.setLength(options.distance);
+    }
+
+    let marker;
+    if (options.mode == 'marker') {
+      marker = new Mesh(new SphereGeometry(currentNodeSize * 0.4, 16, 12),
+                        new MeshBasicMaterial({color: new Color(
+                          pathColor[0]/255, pathColor[1]/255, pathColor[2]/255)}));
+      marker.renderOrder = 3;
+      scene.add(marker);
+    }
+
+    return new Promise(resolve => {
+      pathTraversal = {
+        nodes: nodes.map(i => nodeInfo[i]),
+        offset: offset,
+        marker: marker,
+        options: options,
+        step: -1,
+        start: performance.now(),
+        resolve: resolve
+      };
+      traversalUpdate();
+    });
+  }
+
+  /**
+   * Moves the camera or marker along the path. Each step starts with a pause
+   * at the node, followed by an eased move to the next node.
+   */
+  function traversalUpdate() {
+    let traversal = pathTraversal;
+    let steps = traversal.nodes.length - 1;
+    let t = (performance.now() - traversal.start) / traversal.options.stepTime;
+    if (traversal.options.loop) {
+      t = t % (steps + 1);
+    }
+    let step = Math.min(steps, Math.floor(t));
+    let move = Math.max(0, (t - step - 0.3) / 0.7);
+    // with reduced motion, the camera or marker jumps from node to node
+    move = step < steps && !isMotionReduced() ? move * move * (3 - 2 * move) : 0;
+
+    let from = traversal.nodes[step].pos;
+    let to = traversal.nodes[Math.min(steps, step + 1)].pos;
+    let point = new Vector3().fromArray(from).lerp(new Vector3().fromArray(to), move);
+    if (traversal.marker) {
+      traversal.marker.position.copy(point);
+      requestAnimationFrame(render);
+    } else {
+      setCamera(point.clone().add(traversal.offset), undefined, point);
+    }
+
+    if (step != traversal.step) {
+      traversal.step = step;
+      container.dispatchEvent(new CustomEvent(
+        "traverse",
+        {
+          detail: {
+            item: traversal.nodes[step],
+            step: step
+          },
+          bubbles: false,
+          cancelable: false
+        }));
+    }
+    if (t >= steps + 1) {
+      stopTraversal();
+    }
+  }
+
+  /**
+   * Stops the path traversal, and removes the marker.
+   */
+  function stopTraversal() {
+    if (!pathTraversal) return;
+    let traversal = pathTraversal;
+    pathTraversal = undefined;
+    if (traversal.marker) {
+      scene.remove(traversal.marker);
+      traversal.marker.geometry.dispose();
+      traversal.marker.material.dispose();
+      requestAnimationFrame(render);
+    }
+    traversal.resolve();
+  }
+
+  /**
+   * Removes the path highlight.
+   */
+  function clearPath() {
+    stopTraversal();
+    highlightedPath = undefined;
+    refreshColors();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns the unhighlighted start and end colors of a link, from its style
+   * or the default connection colors.
+   *
+   * @param {number} link - index of the link in `linkInfo`
+   * @returns {Array} The colors as [startColor, endColor]
+   */
+  function linkBaseColors(link) {
+    if (onPath('links', link)) {
+      return [pathColor, pathColor];
+    }
+    if (linkInfo[link].flux) {
+      return [linkInfo[link].flux.startColor, linkInfo[link].flux.endColor];
+    }
+    let style = linkInfo[link].style;
+    return [style.startColor || style.color || connectionStartColor,
+            style.endColor || style.color || connectionEndColor];
+  }
+
+  /**
+   * Colors a link with a gradient from `startColor` to `endColor`.
+   *
+   * @param {number} link - index of the link in `linkInfo`
+   * @param {array} startColor - color of the start of the link
+   * @param {array} endColor - color of the end of the link
+   * @param {array} colors - (optional) color array to write to. Defaults to
+   *     the color attribute of the connection mesh.
+   */
+  function setLinkColor(link, startColor, endColor, colors = undefined) {
+    let info = linkInfo[link];
+    if (!info) return;
+
+    if (info.arrow !== undefined && !colors) {
+      setArrowColor(arrowMesh, info.arrow, endColor);
+    }
+    if (info.startArrow !== undefined && !colors) {
+      setArrowColor(arrowMesh, info.startArrow, startColor);
+    }
+
+    colors = colors ? colors : connectionMesh.geometry.attributes.color.array;
+    let segments = info.count / 2;
+    for (let v = 0; v < info.count; v++) {
+      // vertex v is the start (even) or end (odd) of segment floor(v/2)
+      let t = (Math.floor(v / 2) + v % 2) / segments;
+      for (let k = 0; k < 3; k++) {
+        colors[(info.start + v)*3 + k] = Math.round(startColor[k] + (endColor[k] - startColor[k]) * t);
+      }
+    }
+  }
+
+  /**
+   * Updates the camera projection matrix, and renderer size to the current
+   * container size. Called automatically when the container is resized.
+   */
+  function onWindowResize() {
+    // skip hidden containers, which would give an invalid aspect ratio
+    if (container.offsetWidth == 0 || container.offsetHeight == 0) return;
+    camera.aspect = container.offsetWidth / container.offsetHeight;
+    camera.updateProjectionMatrix();
+    renderer.setSize( container.offsetWidth, container.offsetHeight );
+    postProcessing.setSize( container.offsetWidth, container.offsetHeight );
+    if (cameraControls && cameraControls.handleResize) {
+      cameraControls.handleResize();
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Re-renders when the device pixel ratio changes, which doesn't resize the
+   * container. The media query only matches the current ratio, so it is
+   * replaced on every change.
+   */
+  function watchPixelRatio() {
+    if (pixelRatioQuery) {
+      pixelRatioQuery.removeEventListener('change', onPixelRatioChange);
+    }
+    if (!window.matchMedia) return;
+    pixelRatioQuery = window.matchMedia('(resolution: ' + window.devicePixelRatio + 'dppx)');
+    pixelRatioQuery.addEventListener('change', onPixelRatioChange);
+  }
+
+  /**
+   * Updates the renderer for a new device pixel ratio.
+   */
+  function onPixelRatioChange() {
+    if (disposed) return;
+    watchPixelRatio();
+    onWindowResize();
+  }
+
+  /**
+   * Returns the camera position, up vector and target, see `setCamera`.
+   *
+   * @returns {object} The camera, formatted as {position, up, target}, each
+   *     as {x, y, z}.
+   */
+  function getCamera() {
+    return {position: {x: camera.position.x, y: camera.position.y, z: camera.position.z},
+            up: {x: camera.up.x, y: camera.up.y, z: camera.up.z},
+            target: {x: cameraControls.target.x, y: cameraControls.target.y,
+                     z: cameraControls.target.z}};
+  }
+
+  /**
+   * Sets the camera to the absolute position given by `position`, using the
+   * up-vector `up`, and pointing at `target`.
+   *
+   * @param {*} position - new camera position
+   * @param {*} up - new camera up vector
+   * @param {*} target - new camera target
+   */
+  function setCamera(position, up, target) {
+    camera.position.copy(position);
+    if (up) {
+      camera.up.copy(up);
+    }
+
+    if (target) {
+      cameraControls.target.copy(target)
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets the camera to fly towards being in the position given by `position`,
+   * the up-vector `up`, and pointing towards `target`. The duration for the
+   * transition is given by `runTime`.
+   *
+   * @param {*} position - target camera position
+   * @param {*} up - target camera up vector
+   * @param {*} target - target camera target
+   * @param {number} runTime - (optional) duration in milliseconds
+   */
+  function setFlyTarget(position, up = {x:0, y:1, z:0}, target = {x:0, y:0, z:0},
+                        runTime = 750) {
+    if (!navigating) {
+      recordJump({position: Object.assign({}, position),
+                  up: Object.assign({}, up),
+                  target: Object.assign({}, target)});
+    }
+    flyTarget.active = true;
+    flyTarget.runTime = isMotionReduced() ? 0 : runTime;
+    flyTarget.start = Object.assign({}, camera.position);
+    flyTarget.startUp = Object.assign({}, camera.up);
+    flyTarget.startTarget = Object.assign({}, cameraControls.target);
+    flyTarget.end = position;
+    flyTarget.target = target;
+    flyTarget.targetUp = up;
+    flyTarget.startTime = new Date().getTime();
+  }
+
+  /**
+   * Updates the camera with a new position given the time that's transpired
+   * between `flyTarget.startTime` and now. If the current time is greater than
+   * `flyTarget.startTime` + `flyTarget.runTime`, then the camera will be set to
+   * the `flyTarget.end` position, and `flyTarget.active` will be set to
+   * `false`.
+   */
+  function flyUpdate() {
+    let t = new Date().getTime();
+    if (t >= flyTarget.startTime + flyTarget.runTime) {
+      flyTarget.active = false;
+      setCamera(flyTarget.end, flyTarget.targetUp, flyTarget.target);
+    } else {
+      let p = (t - flyTarget.startTime)/flyTarget.runTime;
+      let p_t = {
+        x: flyTarget.start.x + (flyTarget.end.x - flyTarget.start.x)*p,
+        y: flyTarget.start.y + (flyTarget.end.y - flyTarget.start.y)*p,
+        z: flyTarget.start.z + (flyTarget.end.z - flyTarget.start.z)*p
+      };
+      let p_u = {
+        x: flyTarget.startUp.x + (flyTarget.targetUp.x - flyTarget.startUp.x)*p,
+        y: flyTarget.startUp.y + (flyTarget.targetUp.y - flyTarget.startUp.y)*p,
+        z: flyTarget.startUp.z + (flyTarget.targetUp.z - flyTarget.startUp.z)*p
+      };
+      let p_c = {
+        x: flyTarget.startTarget.x + (flyTarget.target.x - flyTarget.startTarget.x)*p,
+        y: flyTarget.startTarget.y + (flyTarget.target.y - flyTarget.startTarget.y)*p,
+        z: flyTarget.startTarget.z + (flyTarget.target.z - flyTarget.startTarget.z)*p
+      };
+      setCamera(p_t, p_u, p_c);
+    }
+  }
+
+  /**
+   * Sets whether to reduce motion. With reduced motion, camera flights and
+   * tours jump to their destination, path highlights and added nodes appear
+   * at once, path traversals jump from node to node, timelines step between
+   * snapshots, and flow particles stand still. Tours, traversals and
+   * timelines keep their timing.
+   *
+   * @param {boolean|string} mode - true or false, or 'auto' (default) to
+   *     follow the prefers-reduced-motion setting of the browser
+   */
+  function setReducedMotion(mode) {
+    reducedMotion = mode;
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns whether motion is reduced, see `setReducedMotion`.
+   */
+  function isMotionReduced() {
+    if (reducedMotion === 'auto') {
+      return !!(reducedMotionQuery && reducedMotionQuery.matches);
+    }
+    return !!reducedMotion;
+  }
+
+  /**
+   * Returns the camera position which frames a sphere, keeping the current
+   * viewing direction.
+   *
+   * @param {Object} center - center of the sphere as a Vector3
+   * @param {number} radius - radius of the sphere
+   * @param {object} options - (optional) options with the keys distance
+   *     (camera distance to the center, overrides the framing) and padding
+   *     (extra space around the sphere, relative to the radius)
+   * @returns {Object} The camera position as a Vector3.
+   */
+  function framingPosition(center, radius, options = {}) {
+    let padding = options.padding !== undefined ? options.padding : 0.2;
+    let distance = options.distance;
+    if (distance === undefined) {
+      // fit the sphere in the smaller of the vertical and horizontal field of
+      // view
+      let fov = camera.fov * Math.PI / 180;
+      let hfov = 2 * Math.atan(Math.tan(fov / 2) * camera.aspect);
+      let r = Math.max(radius, currentNodeSize || 1) * (1 + padding);
+      distance = r / Math.sin(Math.min(fov, hfov) / 2);
+    }
+    let dir = new Vector3().subVectors(camera.position, cameraControls.target);
+    if (dir.lengthSq() == 0) {
+      dir.set(0, 0, 1);
+    }
+    dir.setLength(distance);
+    return center.clone().add(dir);
+  }
+
+  /**
+   * Flies the camera to frame a sphere, keeping the current viewing
+   * direction.
+   *
+   * @param {Object} center - center of the sphere as a Vector3
+   * @param {number} radius - radius of the sphere
+   * @param {object} options - (optional) options with the keys distance,
+   *     padding (see `framingPosition`) and duration (in milliseconds)
+   */
+  function frameSphere(center, radius, options = {}) {
+    setFlyTarget(framingPosition(center, radius, options),
+                 Object.assign({}, camera.up), center.clone(),
+                 options.duration !== undefined ? options.duration : 750);
+  }
+
+  /**
+   * Returns the distance from a node to its farthest direct neighbor.
+   *
+   * @param {number} i - index of the node
+   * @returns {number} The radius of the neighborhood.
+   */
+  function neighborhoodRadius(i) {
+    let center = new Vector3().fromArray(nodeInfo[i].pos);
+    return getAdjacency()[i].reduce((r, n) => Math.max(r,
+      center.distanceTo(new Vector3().fromArray(nodeInfo[n].pos))), 0);
+  }
+
+  /**
+   * Flies the camera to a node, framing the node and its direct neighbors.
+   *
+   * @param {string} id - ID of the node
+   * @param {object} options - (optional) options with the keys distance
+   *     (camera distance to the node, instead of framing the neighbors) and
+   *     duration (in milliseconds, default 750)
+   */
+  function focusNode(id, options = {}) {
+    let i = nodeIds[id];
+    if (i === undefined) {
+      console.warn("unknown node id: '" + id + "'.");
+      return;
+    }
+    // frame the neighborhood, centered on the node itself
+    let center = new Vector3().fromArray(nodeInfo[i].pos);
+    frameSphere(center, neighborhoodRadius(i), options);
+    navigationHistory.entries[navigationHistory.index].node = id;
+  }
+
+  /**
+   * Flies the camera to frame all selected nodes, using the bounding sphere
+   * of the selection.
+   *
+   * @param {number} padding - (optional) extra space around the selection,
+   *     relative to its radius (default 0.2)
+   * @param {number} duration - (optional) duration in milliseconds
+   */
+  function fitSelection(padding = 0.2, duration = 750) {
+    if (selected.length == 0) return;
+    let m = midPoint(selected);
+    let center = new Vector3(m.x, m.y, m.z);
+    let radius = selected.reduce((r, i) => Math.max(r,
+      center.distanceTo(new Vector3().fromArray(nodeInfo[i].pos))), 0);
+    // include the size of the nodes at the edge of the selection
+    radius += (currentNodeSize || 0) / 2;
+    frameSphere(center, radius, {padding: padding, duration: duration});
+  }
+
+  /**
+   * Plays a camera tour, which moves the camera through a list of keyframes.
+   * Each keyframe is a camera move followed by an optional pause, and can
+   * change the selection and path highlight when it is reached. A 'tour'
+   * event with the keyframe and its index is dispatched on the viewer
+   * container when a keyframe starts. Starting a new tour stops the current
+   * one.
+   *
+   * @param {Array} keyframes - list of keyframes, with the keys:
+   *     - position: camera position as {x, y, z}. Defaults to the current
+   *       position, or to a framing of `node`.
+   *     - target: point the camera looks at as {x, y, z}
+   *     - up: camera up vector as {x, y, z}
+   *     - node: ID of a node to look at, with its neighborhood framed if no
+   *       position is given
+   *     - duration: time of the move in milliseconds (default 2000)
+   *     - easing: 'linear', 'easeIn', 'easeOut', 'easeInOut' (default) or a
+   *       function mapping the progress in [0, 1] to the eased progress
+   *     - pause: time in milliseconds to stay at the keyframe (default 0)
+   *     - select: list of node IDs to select when the move starts
+   *     - path: path to highlight when the move starts, formatted as
+   *       [<source ID>, <target ID>], or null to clear the path
+   * @param {object} options - (optional) tour options with the key loop,
+   *     which starts the tour over after the last keyframe (e.g. for kiosk
+   *     mode)
+   * @returns {Promise} A promise which resolves when the tour ends or is
+   *     stopped.
+   */
+  function tour(keyframes, options = {}) {
+    stopTour();
+    if (!keyframes || keyframes.length == 0) {
+      return Promise.resolve();
+    }
+    return new Promise(resolve => {
+      cameraTour = {
+        keyframes: keyframes,
+        loop: !!options.loop,
+        index: -1,
+        resolve: resolve
+      };
+      startKeyframe(0);
+    });
+  }
+
+  /**
+   * Starts the move towards a keyframe of the camera tour, from the current
+   * camera state.
+   *
+   * @param {number} index - index of the keyframe
+   */
+  function startKeyframe(index) {
+    let keyframe = cameraTour.keyframes[index];
+    let target = keyframe.target;
+    let position = keyframe.position;
+    if (keyframe.node !== undefined && nodeIds[keyframe.node] !== undefined) {
+      let i = nodeIds[keyframe.node];
+      let center = new Vector3().fromArray(nodeInfo[i].pos);
+      target = target || center;
+      if (!position) {
+        position = framingPosition(center, neighborhoodRadius(i));
+      }
+    }
+
+    cameraTour.index = index;
+    cameraTour.start = performance.now();
+    cameraTour.from = {
+      position: camera.position.clone(),
+      target: cameraControls.target.clone(),
+      up: camera.up.clone()
+    };
+    cameraTour.to = {
+      position: new Vector3().copy(position || camera.position),
+      target: new Vector3().copy(target || cameraControls.target),
+      up: new Vector3().copy(keyframe.up || camera.up)
+    };
+
+    if (keyframe.select) {
+      selectNodes(keyframe.select);
+    }
+    if (keyframe.path === null) {
+      clearPath();
+    } else if (keyframe.path) {
+      findPath(keyframe.path[0], keyframe.path[1]);
+    }
+
+    container.dispatchEvent(new CustomEvent(
+      "tour",
+      {
+        detail: {
+          keyframe: keyframe,
+          index: index
+        },
+        bubbles: false,
+        cancelable: false
+      }));
+  }
+
+  /**
+   * Moves the camera along the current keyframe of the camera tour, and
+   * continues with the next keyframe after the move and pause are done.
+   */
+  function tourUpdate() {
+    let keyframe = cameraTour.keyframes[cameraTour.index];
+    let duration = keyframe.duration !== undefined ? keyframe.duration : 2000;
+    let elapsed = performance.now() - cameraTour.start;
+    let p = duration > 0 && !isMotionReduced() ?
+            ease(keyframe.easing || 'easeInOut', elapsed / duration) : 1;
+
+    let from = cameraTour.from;
+    let to = cameraTour.to;
+    setCamera(from.position.clone().lerp(to.position, p),
+              from.up.clone().lerp(to.up, p),
+              from.target.clone().lerp(to.target, p));
+
+    if (elapsed >= duration + (keyframe.pause || 0)) {
+      let next = cameraTour.index + 1;
+      if (next < cameraTour.keyframes.length) {
+        startKeyframe(next);
+      } else if (cameraTour.loop) {
+        startKeyframe(0);
+      } else {
+        stopTour();
+      }
+    }
+  }
+
+  /**
+   * Stops the camera tour, leaving the camera where it is.
+   */
+  function stopTour() {
+    if (!cameraTour) return;
+    let resolve = cameraTour.resolve;
+    cameraTour = undefined;
+    resolve();
+  }
+
+  /**
+   * Starts recording the viewer canvas as a WebM video, e.g. to capture a
+   * camera tour or a flux animation. Html labels are not part of the video,
+   * use the 'sdf' label mode (see `setLabelMode`) for labels in the video.
+   *
+   * @param {object} options - (optional) recording options with the keys:
+   *     - frameRate: maximum frames per second (default 30)
+   *     - bitsPerSecond: video bit rate (default 8000000)
+   *     - mimeType: video type, by default the first supported of VP9 and
+   *       VP8 WebM
+   * @returns {boolean} True if the recording started, false if recording
+   *     isn't supported by the browser or a recording is already running.
+   */
+  function startRecording(options = {}) {
+    if (recording) {
+      console.warn('a recording is already running.');
+      return false;
+    }
+    if (!window.MediaRecorder || !renderer.domElement.captureStream) {
+      console.warn('video recording is not supported by this browser.');
+      return false;
+    }
+    let mimeType = options.mimeType ||
+      ['video/webm;codecs=vp9', 'video/webm;codecs=vp8', 'video/webm']
+        .find(type => MediaRecorder.isTypeSupported(type));
+    let stream = renderer.domElement.captureStream(options.frameRate || 30);
+    let recorder = new MediaRecorder(stream, {
+      mimeType: mimeType,
+      videoBitsPerSecond: options.bitsPerSecond || 8000000
+    });
+    let chunks = [];
+    recorder.ondataavailable = event => {
+      if (event.data.size > 0) chunks.push(event.data);
+    };
+    let done = new Promise(resolve => {
+      recorder.onstop = () => {
+        stream.getTracks().forEach(track => track.stop());
+        resolve(new Blob(chunks, {type: recorder.mimeType || mimeType || 'video/webm'}));
+      };
+    });
+    recording = {recorder: recorder, done: done};
+    recorder.start(1000);
+    requestAnimationFrame(render);
+    return true;
+  }
+
+  /**
+   * Stops the video recording.
+   *
+   * @returns {Promise} A promise resolving to the video as a Blob, or to
+   *     undefined if nothing was recorded.
+   */
+  function stopRecording() {
+    if (!recording) return Promise.resolve(undefined);
+    let done = recording.done;
+    recording.recorder.stop();
+    recording = undefined;
+    return done;
+  }
+
+  /**
+   * Records the viewer as an animated GIF, for quick sharing of e.g.
+   * rotations and flux animations where videos are awkward to embed. The
+   * frames are captured in real time, so animations and camera tours that
+   * are running are recorded as they play. The GIF has a 256 color palette,
+   * so smooth gradients show banding, and html labels are not included.
+   *
+   * @param {object} options - (optional) export options with the keys:
+   *     - duration: length of the animation in milliseconds (default 3000)
+   *     - fps: frames per second (default 10)
+   *     - width: width of the image in pixels (default: the viewer width, at
+   *       most 480). The height follows the aspect ratio of the viewer.
+   *     - rotate: degrees to orbit the camera around the camera target
+   *       during the animation, e.g. 360 for a full turn (default 0)
+   * @returns {Promise} A promise resolving to the GIF as a Blob.
+   */
+  async function exportGIF(options = {}) {
+    options = Object.assign({duration: 3000, fps: 10, rotate: 0}, options);
+    let width = Math.round(options.width || Math.min(container.offsetWidth, 480));
+    let height = Math.round(width * container.offsetHeight / container.offsetWidth);
+    let frameCanvas = document.createElement('canvas');
+    frameCanvas.width = width;
+    frameCanvas.height = height;
+    let ctx = frameCanvas.getContext('2d');
+
+    let count = Math.max(1, Math.round(options.duration / 1000 * options.fps));
+    let delay = 1000 / options.fps;
+    let offset = camera.position.clone().sub(cameraControls.target);
+    let axis = camera.up.clone().normalize();
+    let frames = [];
+    for (let f = 0; f < count; f++) {
+      if (disposed) {
+        throw new Error('the viewer was disposed during the export');
+      }
+      if (options.rotate) {
+        let angle = options.rotate * Math.PI / 180 * f / count;
+        camera.position.copy(cameraControls.target)
+          .add(offset.clone().applyAxisAngle(axis, angle));
+        camera.lookAt(cameraControls.target);
+      }
+      cameraControls.update();
+      render();
+      // copy the frame before the drawing buffer is cleared
+      ctx.drawImage(renderer.domElement, 0, 0, width, height);
+      frames.push(ctx.getImageData(0, 0, width, height));
+      await new Promise(resolve => setTimeout(resolve, delay));
+    }
+    if (options.rotate) {
+      camera.position.copy(cameraControls.target).add(offset);
+      camera.lookAt(cameraControls.target);
+      cameraControls.update();
+      requestAnimationFrame(render);
+    }
+    return new Blob([encodeGIF(frames, delay)], {type: 'image/gif'});
+  }
+
+  /**
+   * Records a camera tour as a WebM video, see `tour` and `startRecording`.
+   *
+   * @param {Array} keyframes - the keyframes of the tour
+   * @param {object} options - (optional) recording options, see
+   *     `startRecording`
+   * @returns {Promise} A promise resolving to the video as a Blob when the
+   *     tour ends or is stopped.
+   */
+  async function recordTour(keyframes, options = {}) {
+    if (!startRecording(options)) {
+      throw new Error('could not start the recording');
+    }
+    try {
+      await tour(keyframes);
+    } catch (error) {
+      await stopRecording();
+      throw error;
+    }
+    return stopRecording();
+  }
+
+  /**
+   * Uses the SetFlyTarget function to reset the camera to the start-position.
+   */
+  function resetCamera() {
+    setFlyTarget(cameraDefault.position, cameraDefault.up, cameraDefault.target);
+  }
+
+  /**
+   * Resets the list of selected nodes, and re-points the camera to the world
+   * center.
+   */
+  function resetSelection() {
+    select([]);
+    cameraControls.target.copy({x:0, y:0, z:0});
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Toggles showing node labels;
+   */
+  function toggleLabels() {
+    if (showLabels) {
+      clearLabels();
+    }
+    showLabels = !showLabels;
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets how node labels are drawn. 'html' labels are drawn as DOM elements
+   * on top of the canvas, while 'sdf' labels are drawn as signed distance
+   * field text inside the scene, which stays crisp at any zoom level and
+   * scales with the distance to the camera.
+   *
+   * @param {string} mode - 'html' or 'sdf'
+   * @param {object} style - (optional) sdf label style, with the keys:
+   *     - font: CSS font family
+   *     - size: text height in graph coordinates
+   *     - color: text color
+   *     - outlineColor: text outline color
+   *     - opacity: text opacity
+   */
+  function setLabelMode(mode, style = {}) {
+    if (style.font && style.font !== labelStyle.font && glyphAtlas) {
+      glyphAtlas.texture.dispose();
+      glyphAtlas = undefined;
+    }
+    labelStyle = Object.assign({}, labelStyle, style);
+    labelMode = mode;
+    clearLabels();
+    buildTextLabels();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Turns label decluttering on or off (default off). When on, labels that
+   * would overlap on screen are nudged or hidden, prioritizing selected,
+   * hovered and high-degree nodes.
+   *
+   * @param {boolean} enabled - whether to declutter labels
+   */
+  function setLabelDeclutter(enabled) {
+    declutterLabels = enabled;
+    if (!enabled && textMesh) {
+      setTextLayout(textMesh);
+    }
+    nodeInfo.forEach(node => {
+      node.label.element.style.marginTop = '-1em';
+    });
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets the minimum on-screen size of a node, in pixels, for it to be
+   * labeled. Labels then appear progressively as the camera moves closer.
+   * Set to 0 to label all nodes within the label distance.
+   *
+   * @param {number} minSize - minimum node size in pixels
+   */
+  function setLabelScreenSize(minSize) {
+    labelMinScreenSize = minSize;
+    if (!minSize && !declutterLabels && textMesh) {
+      setTextLayout(textMesh);
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets the minimum on-screen size of a node, in pixels, for it to be drawn
+   * and labeled. Skipping the nodes that are too small to see speeds up
+   * rendering of large networks seen from afar. Set to 0 (default) to draw
+   * all nodes.
+   *
+   * @param {number} minSize - minimum node size in pixels
+   */
+  function setNodeScreenSize(minSize) {
+    nodeMinScreenSize = minSize;
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Returns the nodes that should be considered for labeling, i.e. the nodes
+   * within the label distance that are large enough on screen.
+   */
+  function getLabelCandidates() {
+    let nodes = getNodesWithin(labelDistance);
+    let minSize = Math.max(labelMinScreenSize, nodeMinScreenSize);
+    if (minSize > 0) {
+      let scale = container.offsetHeight / (2 * Math.tan(camera.fov * Math.PI / 360));
+      let point = new Vector3();
+      nodes = nodes.filter(i => {
+        let pos = nodeInfo[i].pos;
+        point.set(pos[0], pos[1], pos[2]);
+        return currentNodeSize * scale / point.distanceTo(camera.position) >= minSize;
+      });
+    }
+    return nodes;
+  }
+
+  /**
+   * Runs the label decluttering pass for the given nodes.
+   *
+   * @param {Array} nodes - indices of the nodes to label
+   * @returns {Object} An object mapping the index of each node which should
+   *     be labeled to its vertical nudge in pixels.
+   */
+  function layoutNodeLabels(nodes) {
+    let width = container.offsetWidth;
+    let height = container.offsetHeight;
+    let scale = height / (2 * Math.tan(camera.fov * Math.PI / 360));
+    let point = new Vector3();
+
+    let candidates = [];
+    nodes.forEach(i => {
+      let node = nodeInfo[i];
+      point.set(node.pos[0], node.pos[1], node.pos[2]);
+      let depth = point.distanceTo(camera.position);
+      point.project(camera);
+      let candidate = {id: i,
+                       x: (point.x + 1) / 2 * width,
+                       y: (1 - point.y) / 2 * height,
+                       priority: node.connections.to.length + node.connections.from.length};
+      if (selected.includes(i)) {
+        candidate.priority += 2e9;
+      } else if (hoverNode === i) {
+        candidate.priority += 1e9;
+      }
+      if (labelMode == 'sdf') {
+        let em = labelStyle.size * scale / depth;
+        candidate.width = textMesh.userData.ranges[i].width * em;
+        candidate.height = em * 1.2;
+        candidate.em = em;
+      } else {
+        // approximate size of the html labels
+        candidate.width = String(node.n).length * 6.6 + 10;
+        candidate.height = 21;
+      }
+      candidates.push(candidate);
+    });
+    return {candidates: candidates, placed: layoutLabels(candidates)};
+  }
+
+  /**
+   * Creates the sdf text label mesh for the current graph, if sdf labels are
+   * in use.
+   */
+  function buildTextLabels() {
+    if (textMesh) {
+      graph.remove(textMesh);
+      textMesh.geometry.dispose();
+      textMesh.material.dispose();
+      textMesh = undefined;
+    }
+    if (labelMode != 'sdf' || !nodeMesh) return;
+
+    if (!glyphAtlas) {
+      glyphAtlas = makeGlyphAtlas(labelStyle.font);
+    }
+    textMesh = makeTextMesh(nodeInfo.map(node => ({text: node.n, pos: node.pos})),
+                            glyphAtlas, labelStyle);
+    textMesh.renderOrder = 4;
+    graph.add(textMesh);
+  }
+
+  /**
+   * Toggles showing nodes and links for a node type;
+   */
+  async function toggleNodeType(nodeType) {
+    record({undo: () => toggleNodeType(nodeType), redo: () => toggleNodeType(nodeType)});
+    showGenes = !showGenes;
+    hiddenNodeType = showGenes ? undefined : nodeType;
+
+    if (showGenes) {
+      return await setData(initialData);
+    } else {
+      const nodes = initialData.graphData.nodes.filter(n => n.g !== nodeType);
+      const nodeIds = nodes.map(n => n.id);
+      const links = initialData.graphData.links.filter(l =>
+        nodeIds.includes(l.s) && nodeIds.includes(l.t)
+      );
+      const nodeTextures = initialData.nodeTextures.filter(t => t.group !== nodeType);
+
+      const filteredData = {
+        ...initialData,
+        graphData: {
+          nodes,
+          links,
+        },
+        nodeTextures,
+      };
+      return await setData(filteredData);
+    }
+  }
+
+  /**
+   * Toggles hiding the currency metabolites, like ATP, water and protons,
+   * and their links. Currency metabolites take part in so many reactions
+   * that they dominate the node degrees and clutter the network. The
+   * metabolites stay hidden when other data is set. The selection is kept.
+   *
+   * @param {boolean} hide - (optional) whether to hide the metabolites,
+   *     toggled if not given
+   * @returns {Promise} A promise which resolves with whether the metabolites
+   *     are hidden.
+   */
+  async function toggleCurrencyMetabolites(hide = !currency.hidden) {
+    await restoreCurrency({names: currency.names, hidden: !!hide,
+                           duplicated: currency.duplicated && !hide});
+    return currency.hidden;
+  }
+
+  /**
+   * Toggles splitting the currency metabolites into one duplicate per
+   * reaction, like in pathway maps, instead of showing one node linked to
+   * hundreds of reactions. Each duplicate is placed next to its reaction and
+   * keeps its links with their data, e.g. the stoichiometry, so that the
+   * layout is untangled without leaving out any reactants. Duplicates have
+   * the ID '<metabolite ID>@<reaction ID>', and the extra key duplicateOf,
+   * the metabolite ID. Duplicating the metabolites shows them if they were
+   * hidden, see `toggleCurrencyMetabolites`. The selection is kept.
+   *
+   * @param {boolean} duplicate - (optional) whether to duplicate the
+   *     metabolites, toggled if not given
+   * @returns {Promise} A promise which resolves with whether the metabolites
+   *     are duplicated.
+   */
+  async function duplicateCurrencyMetabolites(duplicate = !currency.duplicated) {
+    await restoreCurrency({names: currency.names, hidden: currency.hidden && !duplicate,
+                           duplicated: !!duplicate});
+    return currency.duplicated;
+  }
+
+  /**
+   * Sets the currency metabolites and whether they are hidden or
+   * duplicated, and shows the graph. The change can be undone.
+   *
+   * @param {object} settings - the settings, formatted as {names, hidden,
+   *     duplicated}
+   */
+  async function restoreCurrency(settings) {
+    let before = getCurrencyMetabolites();
+    record({undo: () => restoreCurrency(before), redo: () => restoreCurrency(settings)});
+    currency.names = settings.names.slice();
+    currency.hidden = settings.hidden;
+    currency.duplicated = settings.duplicated;
+    if (before.hidden || before.duplicated || currency.hidden || currency.duplicated) {
+      await showCurrency();
+    }
+  }
+
+  /**
+   * Shows the graph with the currency metabolites hidden, duplicated or as
+   * they are.
+   */
+  async function showCurrency() {
+    let test = currencyTest(currency.names);
+    await setNodeFilter('currency', currency.hidden ?
+      () => (element, kind) => kind == 'node' && test(element) : undefined);
+  }
+
+  /**
+   * Sets the currency metabolites, see `toggleCurrencyMetabolites`. Names
+   * are matched to the node names and IDs regardless of case and trailing
+   * compartment, so that 'ATP' matches 'ATP [c]'.
+   *
+   * @param {Array} names - the names or IDs of the metabolites, or undefined
+   *     for the defaults (ATP, ADP, AMP, GTP, GDP, H2O, H+, Pi, PPi, NAD(P)+,
+   *     NAD(P)H, FAD(H2), CoA, CO2, O2, NH3, NH4+ and H2O2)
+   * @returns {Promise} A promise which resolves when the graph is updated.
+   */
+  async function setCurrencyMetabolites(names = defaultCurrency) {
+    await restoreCurrency({names: names.map(String), hidden: currency.hidden,
+                           duplicated: currency.duplicated});
+  }
+
+  /**
+   * Returns the currency metabolites, and whether they are hidden or
+   * duplicated.
+   *
+   * @returns {object} The metabolites, formatted as {names, hidden,
+   *     duplicated}.
+   */
+  function getCurrencyMetabolites() {
+    return {names: currency.names.slice(), hidden: currency.hidden,
+            duplicated: currency.duplicated};
+  }
+
+  /**
+   * Shows only the nodes of some subsystems, e.g. 'TCA cycle' and
+   * 'Oxidative phosphorylation', and the nodes without subsystem linked to
+   * them, like their metabolites. Nodes where the subsystem attribute is a
+   * list are in every subsystem of the list. The links leaving the
+   * subsystems can be kept, greyed out with the nodes they lead to. Boundary
+   * nodes and links have the extra key boundary, for styling with
+   * `setStyle`. The subsystems stay filtered when other data is set. The
+   * selection is kept.
+   *
+   * @param {Array} subsystems - the subsystems to show, or undefined or an
+   *     empty list to show all nodes
+   * @param {object} options - (optional) filter options with the keys:
+   *     - attribute: the node attribute holding the subsystem (default
+   *       'subsystem')
+   *     - boundary: whether to show the links leaving the subsystems and
+   *       the nodes they lead to (default false)
+   *     - boundaryColor: the color of the boundary nodes and links (default
+   *       [190, 190, 190])
+   * @returns {Promise} A promise which resolves when the graph is updated.
+   */
+  async function setSubsystemFilter(subsystems, options = {}) {
+    let before = subsystemFilter;
+    record({undo: () => setSubsystemFilter(before ? before.subsystems : undefined, before || {}),
+            redo: () => setSubsystemFilter(subsystems, options)});
+    subsystemFilter = subsystems && subsystems.length > 0 ? {
+      subsystems: subsystems.map(String),
+      attribute: options.attribute || 'subsystem',
+      boundary: !!options.boundary,
+      boundaryColor: options.boundaryColor || [190, 190, 190]
+    } : undefined;
+
+    let rules = styleRules.filter(rule => !boundaryRules.includes(rule));
+    boundaryRules = [];
+    if (subsystemFilter && subsystemFilter.boundary) {
+      let color = subsystemFilter.boundaryColor;
+      boundaryRules = [{selector: 'node[boundary]', style: {color: color, opacity: 0.5}},
+                       {selector: 'link[boundary]', style: {color: color}}];
+      rules = rules.concat(boundaryRules);
+    }
+    if (currentData) {
+      let base = collapsed.base || currentData.graphData;
+      if (subsystemFilter &&
+          subsystemGraph(base, subsystemFilter.subsystems, subsystemFilter).nodes.length == 0) {
+        console.warn("no nodes in the subsystems '" +
+                     subsystemFilter.subsystems.join("', '") + "'.");
+      }
+      await showCollapsedGroups(collapsed.groups);
+    }
+    setStyle(rules);
+  }
+
+  /**
+   * Hides the nodes with a degree outside a range, e.g. leaves with one link
+   * or hubs with more than 50 links, and their links. The degrees are
+   * counted after the other filters, so they are recomputed when the other
+   * filters change, but nodes hidden by this filter still count for the
+   * degree of their neighbors. The range stays set when other data is set.
+   * The selection is kept.
+   *
+   * @param {object} range - the degree range, formatted as {min, max}, where
+   *     both keys are optional, or null to show all nodes
+   * @returns {Promise} A promise which resolves when the graph is updated.
+   */
+  async function setDegreeFilter(range) {
+    let before = degreeFilter;
+    record({undo: () => setDegreeFilter(before), redo: () => setDegreeFilter(range)});
+    degreeFilter = degreeRange(range);
+    if (currentData) {
+      await showCollapsedGroups(collapsed.groups);
+    }
+  }
+
+  /**
+   * Toggles showing the links of a type, e.g. 'transport', 'exchange',
+   * 'enzymatic' or 'regulatory', so that each type can be shown or hidden
+   * independently, e.g. to see only the transport reactions between
+   * compartments. The types are the link attribute type, see `setData`. The
+   * nodes stay shown, and `setDegreeFilter` with a minimum of 1 hides the
+   * nodes left without links. The types stay hidden when other data is set.
+   *
+   * @param {string} type - the link type
+   * @param {boolean} show - (optional) whether to show the links, toggled if
+   *     not given
+   * @returns {Promise} A promise which resolves with whether the links are
+   *     shown.
+   */
+  async function toggleLinkType(type, show = hiddenLinkTypes.has(String(type))) {
+    let shown = !hiddenLinkTypes.has(String(type));
+    record({undo: () => toggleLinkType(type, shown), redo: () => toggleLinkType(type, show)});
+    if (show) {
+      hiddenLinkTypes.delete(String(type));
+    } else {
+      hiddenLinkTypes.add(String(type));
+    }
+    await showLinkTypes();
+    return !!show;
+  }
+
+  /**
+   * Returns the link types hidden by `toggleLinkType`.
+   *
+   * @returns {Array} The types.
+   */
+  function getHiddenLinkTypes() {
+    return [...hiddenLinkTypes];
+  }
+
+  /**
+   * Shows the graph without the link types hidden by `toggleLinkType`.
+   */
+  async function showLinkTypes() {
+    let hidden = new Set(hiddenLinkTypes);
+    await setNodeFilter('linkTypes', hidden.size == 0 ? undefined :
+      () => (element, kind) => kind == 'link' && element.type !== undefined &&
+                               hidden.has(String(element.type)));
+  }
+
+  /**
+   * Returns the nodes within a number of hops from some nodes, in either
+   * direction.
+   *
+   * @param {Array} items - the node indices
+   * @param {number} depth - the number of hops
+   * @returns {Set} The indices of the nodes and their neighbors.
+   */
+  function neighborhood(items, depth) {
+    let kept = new Set(items);
+    let frontier = items;
+    for (let hop = 0; hop < depth && frontier.length > 0; hop++) {
+      let next = [];
+      frontier.forEach(i => {
+        let connections = nodeInfo[i].connections;
+        connections.to.concat(connections.from).forEach(({neighbor}) => {
+          let j = nodeIds[neighbor];
+          if (!kept.has(j)) {
+            kept.add(j);
+            next.push(j);
+          }
+        });
+      });
+      frontier = next;
+    }
+    return kept;
+  }
+
+  /**
+   * Shows the differences between two versions of a model in one merged
+   * graph, for curation reviews: added, removed and changed nodes and links
+   * are colored, and unchanged nodes are faded. Removed elements are shown
+   * where they were in the old version. The merged elements have the extra
+   * keys diff ('added', 'removed', 'changed' or 'unchanged') and changes
+   * (the changed attributes), e.g. for tooltips, filters and styles. Links
+   * are matched by their start and end nodes, so changed reactants show as
+   * added and removed links.
+   *
+   * @param {object} before - the old graph data, formatted as {nodes, links}
+   * @param {object} after - the new graph data, formatted as {nodes, links}
+   * @param {object} options - (optional) diff options with the keys:
+   *     - colors: colors as {added, removed, changed}, default green,
+   *       vermillion and orange
+   *     - fade: the opacity of unchanged nodes (default 0.3)
+   *     - ignore: attributes which don't count as changes (default ['pos'])
+   *     - nodeTextures, nodeSize: see `setData`, default those of the
+   *       current data
+   * @returns {Promise} A promise which resolves with the differences,
+   *     formatted as {nodes, links}, each as {added, removed, changed}
+   *     counts.
+   */
+  async function showDiff(before, after, options = {}) {
+    let graphData = diffGraphs(before, after, options);
+    let colors = Object.assign({added: [0, 158, 115], removed: [213, 94, 0],
+                                changed: [230, 159, 0]}, options.colors);
+    let rules = styleRules.filter(rule => !diffRules.includes(rule));
+    diffRules = [{selector: 'node[diff = "unchanged"]',
+                  style: {opacity: options.fade !== undefined ? options.fade : 0.3}}];
+    ['added', 'removed', 'changed'].forEach(diff => {
+      diffRules.push({selector: '*[diff = "' + diff + '"]', style: {color: colors[diff]}});
+    });
+    await setData({graphData: graphData,
+                   nodeTextures: options.nodeTextures || currentData.nodeTextures,
+                   nodeSize: options.nodeSize || currentData.nodeSize});
+    setStyle(rules.concat(diffRules));
+
+    const count = (elements, diff) => elements.filter(e => e.diff == diff).length;
+    let counts = {};
+    ['nodes', 'links'].forEach(kind => {
+      counts[kind] = {added: count(graphData[kind], 'added'),
+                      removed: count(graphData[kind], 'removed'),
+                      changed: count(graphData[kind], 'changed')};
+    });
+    return counts;
+  }
+
+  /**
+   * Returns the connected components of the graph, largest first, ignoring
+   * link directions. Small components are often orphan fragments in draft
+   * models. The component number of each node is also available to styles
+   * as the attribute component, e.g. 'node[component > 0]'.
+   *
+   * @returns {Array} The components, formatted as [{index, size, nodes}],
+   *     where nodes is the list of node IDs.
+   */
+  function getComponents() {
+    return components.map((component, k) => ({
+      index: k,
+      size: component.length,
+      nodes: component.map(i => nodeInfo[i].id)
+    }));
+  }
+
+  /**
+   * Shows a connected component, see `getComponents`: selects its nodes and
+   * frames them, and optionally colors them or hides the other components.
+   *
+   * @param {number} index - the component index, 0 for the largest
+   * @param {object} options - (optional) options with the keys color ([r,
+   *     g, b] to color the component, replacing the color of the component
+   *     shown before) and isolate (whether to hide the other components,
+   *     see `isolate`)
+   * @returns {Promise} A promise which resolves with the node IDs of the
+   *     component, or undefined if there is no such component.
+   */
+  async function showComponent(index, options = {}) {
+    let component = components[index];
+    if (!component) {
+      console.warn('no component ' + index + '.');
+      return undefined;
+    }
+    let ids = component.map(i => nodeInfo[i].id);
+    if (options.color !== undefined) {
+      let rules = styleRules.filter(rule => rule !== componentRule);
+      componentRule = undefined;
+      if (options.color) {
+        let members = new Set(ids);
+        componentRule = {selector: attributes => members.has(attributes.id),
+                         style: {color: options.color}};
+        rules.push(componentRule);
+      }
+      setStyle(rules);
+    }
+    if (options.isolate) {
+      await showIsolation(isolation.concat([{ids: isolatedIds(component),
+                                             label: 'Component ' + index}]));
+    }
+    select(nodeIndices(ids));
+    fitSelection();
+    return ids;
+  }
+
+  /**
+   * Returns the ego network of a node: the node, its neighbors within a
+   * number of hops, and all links between them, as shown in the viewer. The
+   * data is copied, so that it can be handed to other tools or loaded in
+   * another viewer. It can also be opened in this viewer as a fresh view,
+   * with the camera framing it and the node selected.
+   *
+   * @param {string} id - the node ID
+   * @param {number} depth - (optional) the number of hops, default 1
+   * @param {object} options - (optional) options with the key open (whether
+   *     to show the ego network in the viewer, default false)
+   * @returns {Promise} A promise which resolves with the graph data,
+   *     formatted as {nodes, links} like in `setData`, or undefined if the
+   *     node isn't in the graph.
+   */
+  async function getEgoNetwork(id, depth = 1, options = {}) {
+    let items = nodeIndices([id]);
+    if (items.length == 0) return undefined;
+    let kept = neighborhood(items, depth);
+    let ids = new Set([...kept].map(i => nodeInfo[i].id));
+    let graphData = {
+      nodes: [...kept].sort((a, b) => a - b).map(i =>
+        Object.assign({}, nodeInfo[i].data, {pos: nodeInfo[i].pos.slice()})),
+      links: linkInfo.filter(link => ids.has(link.s) && ids.has(link.t))
+        .map(link => Object.assign({}, link.data))
+    };
+    if (options.open) {
+      // the ego network is already filtered, so it's shown as it is rather
+      // than filtered again, which would e.g. split duplicates again
+      collapsed = {groups: [], base: undefined, data: graphData};
+      await setData({graphData: graphData,
+                     nodeTextures: currentData.nodeTextures,
+                     nodeSize: currentData.nodeSize});
+      if (nodeIds[id] === undefined) return graphData;
+      let center = new Vector3().fromArray(nodeInfo[nodeIds[id]].pos);
+      let radius = nodeInfo.reduce((r, node) =>
+        Math.max(r, center.distanceTo(new Vector3().fromArray(node.pos))), 0);
+      frameSphere(center, radius + (currentNodeSize || 0) / 2, {padding: 0.2});
+      select(nodeIndices([id]));
+    }
+    return graphData;
+  }
+
+  /**
+   * Hides everything except some nodes and their neighborhood, to focus on
+   * a part of the network. Isolating again within an isolated view narrows
+   * it down further. A breadcrumb over the canvas lists the isolated views,
+   * and clicking a step restores it, see `restoreIsolation`. Metanodes
+   * isolate the nodes collapsed into them. The selection is kept.
+   *
+   * @param {Array} ids - (optional) the node IDs, default the selection
+   * @param {object} options - (optional) options with the key depth, the
+   *     number of hops of neighbors to keep (default 1)
+   * @returns {Promise} A promise which resolves with the number of nodes
+   *     shown, or 0 if there are no nodes to isolate.
+   */
+  async function isolate(ids = getSelection(), options = {}) {
+    let depth = options.depth !== undefined ? options.depth : 1;
+    let items = nodeIndices(ids);
+    if (items.length == 0) {
+      console.warn('no nodes to isolate.');
+      return 0;
+    }
+
+    let kept = neighborhood(items, depth);
+
+    let label = (items.length == 1 ? nodeInfo[items[0]].n || nodeInfo[items[0]].id :
+                                      items.length + ' nodes') +
+                (depth > 0 ? ' + ' + depth + (depth == 1 ? ' hop' : ' hops') : '');
+    await showIsolation(isolation.concat([{ids: isolatedIds(kept), label: label}]));
+    return nodeInfo.length;
+  }
+
+  /**
+   * Returns the node IDs to keep when isolating nodes, in the data before
+   * collapsing groups and duplicating nodes.
+   *
+   * @param {Iterable} items - the indices of the nodes to keep
+   * @returns {Set} The node IDs.
+   */
+  function isolatedIds(items) {
+    let base = collapsed.base || currentData.graphData;
+    let shown = new Set();
+    items.forEach(i => {
+      let node = nodeInfo[i];
+      shown.add(node.id);
+      if (node.data.duplicateOf !== undefined) {
+        shown.add(node.data.duplicateOf);
+      }
+      let group = node.data.metanode && collapsed.groups.find(g => collapsedId(g) == node.id);
+      if (group) {
+        base.nodes.filter(n => group.nodes ? group.nodes.includes(n.id) :
+                                             inGroup(clustered(n), group))
+          .forEach(n => shown.add(n.id));
+      }
+    });
+    return shown;
+  }
+
+  /**
+   * Restores a view before `isolate`.
+   *
+   * @param {number} step - (optional) the number of isolated views to keep,
+   *     0 for the whole network, default the view before the current one
+   * @returns {Promise} A promise which resolves when the graph is updated.
+   */
+  async function restoreIsolation(step = isolation.length - 1) {
+    if (step < 0 || step >= isolation.length) return;
+    await showIsolation(isolation.slice(0, step));
+  }
+
+  /**
+   * Shows the graph isolated to the last of a list of isolated views, and
+   * updates the breadcrumb.
+   *
+   * @param {Array} views - the isolated views
+   */
+  async function showIsolation(views) {
+    isolation = views;
+    breadcrumb.update(['All nodes'].concat(views.map(view => view.label)));
+    let last = views[views.length - 1];
+    await setNodeFilter('isolation', last ?
+      () => (element, kind) => kind == 'node' && !last.ids.has(element.id) : undefined);
+  }
+
+  /**
+   * Returns a degree range with defaults for missing bounds, see
+   * `setDegreeFilter`.
+   *
+   * @param {object} range - the range, formatted as {min, max}, or null
+   * @returns {object} The range, or undefined if there are no bounds.
+   */
+  function degreeRange(range) {
+    const given = value => value !== undefined && value !== null;
+    if (!range || (!given(range.min) && !given(range.max))) return undefined;
+    return {min: given(range.min) ? Number(range.min) : 0,
+            max: given(range.max) ? Number(range.max) : Infinity};
+  }
+
+  /**
+   * Makes the test of a filter layer, see `setFilter`. A selector without a
+   * kind, like '[flux != 0]', filters all elements.
+   *
+   * @param {Function|string} filter - the filter
+   * @returns {Function} A function taking the element attributes and kind,
+   *     which returns whether the element passes, or undefined if the
+   *     selector is invalid.
+   */
+  function filterTest(filter) {
+    if (typeof filter === 'function') {
+      return (attributes, kind) => !!filter(attributes, kind);
+    }
+    let selector = /^\s*(node|link|\*)/.test(filter) ? filter : '*' + filter;
+    if (!isValidSelector(selector)) {
+      console.warn("invalid filter: '" + filter + "'.");
+      return undefined;
+    }
+    let match = parseSelector(selector);
+    let kind = /^\s*(node|link|\*)/.exec(selector)[1];
+    return (attributes, elementKind) =>
+      (kind != '*' && kind != elementKind) || match(attributes, elementKind);
+  }
+
+  /**
+   * Hides the nodes and links which fail a filter, e.g. to show only the
+   * reactions with flux. Filters are named layers: setting a filter with the
+   * name of another replaces it. Elements are shown if they pass all 'and'
+   * layers and, if there are any 'or' layers, at least one of them. Links of
+   * hidden nodes are hidden too. Hidden elements are left out of the graph,
+   * so they can't be picked and don't count for fitting the camera. The
+   * filters stay on when other data is set. The selection is kept.
+   *
+   * @param {Function|string} filter - a function taking the node or link
+   *     attributes and the kind ('node' or 'link'), which returns whether to
+   *     show the element, or a selector like in `setStyle`, e.g.
+   *     'node[flux != 0]'. Selectors only filter elements of their kind,
+   *     and selectors without a kind filter all elements. Null removes the
+   *     layer, and an invalid selector leaves the filters unchanged.
+   * @param {object} options - (optional) layer options with the keys name
+   *     (default 'filter') and combine ('and' (default) or 'or')
+   * @returns {Promise} A promise which resolves when the graph is updated.
+   */
+  async function setFilter(filter, options = {}) {
+    let name = options.name !== undefined ? String(options.name) : 'filter';
+    let combine = options.combine == 'or' ? 'or' : 'and';
+    let layers = filterLayers.filter(layer => layer.name != name);
+    if (filter) {
+      let test = filterTest(filter);
+      if (!test) return;
+      layers.push({name: name, filter: filter, combine: combine, test: test});
+    }
+    await changeFilterLayers(layers);
+  }
+
+  /**
+   * Removes a filter layer, see `setFilter`.
+   *
+   * @param {string} name - (optional) the layer name, all layers are removed
+   *     if not given
+   * @returns {Promise} A promise which resolves when the graph is updated.
+   */
+  async function removeFilter(name) {
+    await changeFilterLayers(name === undefined ? [] :
+                             filterLayers.filter(layer => layer.name != String(name)));
+  }
+
+  /**
+   * Shows the graph filtered by a list of filter layers, as a change which
+   * can be undone.
+   *
+   * @param {Array} layers - the layers, see `setFilter`
+   */
+  async function changeFilterLayers(layers) {
+    let before = filterLayers;
+    record({undo: () => showFilterLayers(before), redo: () => showFilterLayers(layers)});
+    await showFilterLayers(layers);
+  }
+
+  /**
+   * Returns the filter layers, see `setFilter`.
+   *
+   * @returns {Array} The layers, formatted as [{name, filter, combine}].
+   */
+  function getFilters() {
+    return filterLayers.map(layer => ({name: layer.name, filter: layer.filter,
+                                       combine: layer.combine}));
+  }
+
+  /**
+   * Shows the graph filtered by a list of filter layers.
+   *
+   * @param {Array} layers - the layers, see `setFilter`
+   */
+  async function showFilterLayers(layers) {
+    filterLayers = layers;
+    let all = layers.filter(layer => layer.combine == 'and');
+    let any = layers.filter(layer => layer.combine == 'or');
+    await setNodeFilter('layers', layers.length == 0 ? undefined :
+      () => (element, kind) => !all.every(layer => layer.test(element, kind)) ||
+                               (any.length > 0 && !any.some(layer => layer.test(element, kind))));
+  }
+
+  /**
+   * Sets the distance to show node labels.
+   *
+   * @param {number} newDistance The new label rendering distance
+   */
+  function setLabelDistance(newDistance) {
+    labelDistance = newDistance
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Sets how link arrowheads are drawn, and redraws the graph. The
+   * selection is kept.
+   *
+   * @param {object} style - arrow style, with the optional keys:
+   *     - show: whether to draw arrowheads
+   *     - size: length of the arrowheads relative to the node size
+   *     - types: object mapping link types to true/false, to toggle the
+   *       arrowheads for specific link types
+   */
+  async function setArrowStyle(style) {
+    arrowStyle = Object.assign({}, arrowStyle, style);
+    await redrawGraph();
+  }
+
+  /**
+   * Sets how links are drawn, and redraws the graph. The selection is
+   * kept.
+   *
+   * @param {object} style - link style, with the optional keys:
+   *     - curvature: relative sideways bend of links, 0 for straight links
+   *     - segments: number of line segments to use per curved link
+   *     - cubic: use cubic instead of quadratic bezier curves
+   *     - reversible: how to draw reversible links, one of 'dashed' (dashed
+   *       lines), 'arrows' (arrowheads in both directions) or 'both'
+   *     - dashes: number of dashes per dashed link
+   *     - width: default link width in pixels
+   */
+  async function setLinkStyle(style) {
+    linkStyle = Object.assign({}, linkStyle, style);
+    await redrawGraph();
+  }
+
+  /**
+   * Rebuilds the current graph, e.g. after the link style changed, and
+   * selects the selected nodes again.
+   */
+  async function redrawGraph() {
+    if (!currentData) return;
+    let selection = getSelection();
+    await setData(currentData);
+    selected = [];
+    select(nodeIndices(selection.filter(id => nodeIds[id] !== undefined)));
+  }
+
+  /**
+   * Sets the level-of-detail options. When enabled, nodes that are large
+   * enough on screen are drawn as 3D geometry (in the shape set for their
+   * group), with fewer polygons the smaller they are, while small (far away)
+   * nodes are only drawn as sprites.
+   *
+   * @param {boolean} enabled - whether to draw node geometries
+   * @param {Array} levels - (optional) detail levels formatted as
+   *     [{minSize: <pixels>, detail: <sphere segments>}, ...]
+   */
+  function setLevelOfDetail(enabled, levels = undefined) {
+    levelOfDetail.dispose();
+    if (levels) {
+      graph.remove(levelOfDetail.group);
+      levelOfDetail = LevelOfDetail(levels, customShapes);
+      graph.add(levelOfDetail.group);
+    }
+    useLevelOfDetail = enabled;
+    if (useLevelOfDetail && nodeMesh) {
+      buildLevelOfDetail();
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Builds the level-of-detail geometries for the current graph, using the
+   * shapes set for each node group in the node textures.
+   */
+  function buildLevelOfDetail() {
+    let groupShapes = {};
+    currentData.nodeTextures.forEach(tex => {
+      groupShapes[tex.group] = tex.shape;
+    });
+    levelOfDetail.build(nodeInfo.map(n => n.pos), currentNodeSize,
+                        nodeInfo.map(n => n.style.shape || n.shape || groupShapes[n.group]));
+  }
+
+  /**
+   * Registers a named color scale, which can then be used as colormap in
+   * style mappers (see `setStyle`) and overlays. Color scales are shared by
+   * all viewers. The built-in scales are 'viridis', 'cividis', 'magma' and
+   * 'rdBu'.
+   *
+   * @param {string} name - name of the color scale
+   * @param {Array|Function} colormap - evenly spaced color stops as
+   *     [[r, g, b], ...], or a function mapping [0, 1] to [r, g, b]
+   */
+  function registerColormap(name, colormap) {
+    if (addColormap(name, colormap) && nodeMesh) {
+      applyStyles();
+      requestAnimationFrame(render);
+    }
+  }
+
+  /**
+   * Registers a custom node shape which can then be used as shape for node
+   * groups or single nodes of this viewer. The shape is used when node
+   * geometries are enabled with `setLevelOfDetail`.
+   *
+   * @param {string} name - name of the new shape
+   * @param {Object|Function} shape - a BufferGeometry, a three-js object
+   *     containing a mesh (such as the scene of a loaded glTF file), or a
+   *     function taking the level of detail (number of segments) and returning
+   *     a BufferGeometry.
+   */
+  function registerNodeShape(name, shape) {
+    registerShape(customShapes, name, shape);
+    if (useLevelOfDetail && nodeMesh) {
+      buildLevelOfDetail();
+      requestAnimationFrame(render);
+    }
+  }
+
+  /**
+   * Sets the node icon options, and redraws the icons. Icons are drawn on top
+   * of the node sprites, using the icon set on each node, or the icon set for
+   * its group.
+   *
+   * @param {object} style - icon style, with the optional keys:
+   *     - atlas: url of the icon atlas image, a grid of equally sized icons
+   *     - columns: number of icon columns in the atlas
+   *     - rows: number of icon rows in the atlas
+   *     - icons: object mapping icon names to their index in the atlas,
+   *       counted left to right, top to bottom
+   *     - groups: object mapping node groups to icon names
+   *     - size: icon size relative to the node size
+   */
+  function setNodeIcons(style) {
+    let atlasChanged = style.atlas !== undefined && style.atlas !== iconStyle.atlas;
+    iconStyle = Object.assign({}, iconStyle, style);
+    if (atlasChanged) {
+      if (iconTexture) {
+        iconTexture.dispose();
+      }
+      iconTexture = textureLoader.load(iconStyle.atlas, function () {
+        requestAnimationFrame(render);
+      });
+    }
+    buildIcons();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Creates the icon mesh for the current graph.
+   */
+  function buildIcons() {
+    if (iconMesh) {
+      graph.remove(iconMesh);
+      iconMesh.geometry.dispose();
+      iconMesh.material.dispose();
+      iconMesh = undefined;
+    }
+    if (!iconTexture || !nodeMesh) return;
+
+    let icons = [];
+    nodeInfo.forEach(node => {
+      let name = node.style.icon !== undefined ? node.style.icon :
+                 node.icon !== undefined ? node.icon : iconStyle.groups[node.group];
+      let cell = typeof name === 'number' ? name : iconStyle.icons[name];
+      if (cell !== undefined) {
+        icons.push({pos: node.pos, cell: cell});
+      }
+    });
+    iconMesh = makeIconMesh(icons, iconTexture, iconStyle.columns,
+                            iconStyle.rows, currentNodeSize * iconStyle.size);
+    iconMesh.renderOrder = 3;
+    graph.add(iconMesh);
+  }
+
+  /**
+   * Returns a list of the shown nodes in view within the given `distance`
+   * from the camera, in index order. Only the nodes near the camera are
+   * visited, through the octree.
+   */
+  function getNodesWithin(distance) {
+    if (!nodeMesh) return [];
+    camera.updateMatrixWorld();
+    let frustum = new Frustum();
+    frustum.setFromProjectionMatrix(
+      new Matrix4().multiplyMatrices(
+        camera.projectionMatrix,
+        camera.matrixWorldInverse
+      )
+    );
+    let opacities = nodeMesh.geometry.attributes.nodeOpacity.array;
+    let culled = nodeMesh.geometry.attributes.culled.array;
+    let point = new Vector3();
+    let nodes = octree.within(camera.position.toArray(), distance, i => {
+      point.fromArray(nodeInfo[i].pos);
+      return opacities[i] >= 0.01 && culled[i] < 0.5 && frustum.containsPoint(point);
+    });
+    return nodes.sort((a, b) => a - b);
+  }
+
+  /**
+   * Removes all labels from the scene
+   */
+  function clearLabels() {
+    while(labels.children.length > 0) {
+      labels.remove(labels.children[0]);
+    }
+  }
+
+  /**
+   * Adds a node label back into the scene.
+   *
+   * @param {number} node node index of the node to label
+   */
+  function labelNode(node) {
+    labels.add( nodeInfo[node].label );
+  }
+
+  /**
+   * Rendering function.
+   */
+  function render() {
+    if (disposed) return;
+    // the session renders its frames itself
+    if (xrMode.isPresenting() && !xrRendering) return;
+    renderer.info.reset();
+    let frameStart = performance.now();
+    let pixelRatio = exportPixelRatio || window.devicePixelRatio;
+    renderer.setPixelRatio(pixelRatio);
+    minPointSize.value = nodeMinScreenSize * pixelRatio;
+    updateFog();
+    if (iconMesh) {
+      iconMesh.material.uniforms.scale.value =
+        container.offsetHeight * renderer.getPixelRatio() / 2;
+    }
+    if (useLevelOfDetail && nodeMesh) {
+      let opacities = nodeMesh.geometry.attributes.nodeOpacity.array;
+      levelOfDetail.update(camera, container.offsetHeight,
+                           nodeMesh.geometry.attributes.color.array,
+                           nodeMesh.geometry.attributes.meshed,
+                           nodeMesh.geometry.attributes.nodeScale.array,
+                           i => opacities[i] >= 0.01,
+                           distance => octree.within(camera.position.toArray(), distance));
+    }
+    if (nodeMesh) {
+      updateCulling();
+      updateFocusRing();
+      updateAnnotations();
+    }
+    if (textMesh) {
+      textMesh.visible = showLabels;
+      textMesh.material.uniforms.maxDistance.value = labelDistance;
+      if (showLabels && declutterLabels) {
+        let layout = layoutNodeLabels(getLabelCandidates());
+        let placed = {};
+        layout.candidates.forEach(c => {
+          if (layout.placed[c.id] !== undefined) {
+            // screen y points down, while the label offset points up
+            placed[c.id] = -layout.placed[c.id] / c.em;
+          }
+        });
+        setTextLayout(textMesh, placed);
+      } else if (showLabels && labelMinScreenSize > 0) {
+        let placed = {};
+        getLabelCandidates().forEach(i => { placed[i] = 0; });
+        setTextLayout(textMesh, placed);
+      }
+    }
+    let renderStart = performance.now();
+    if (stereoOptions.mode != 'none' && !xrRendering) {
+      // the plane of the camera target appears at the screen, with the eyes
+      // a thirtieth of its distance apart
+      let focus = camera.position.distanceTo(cameraControls.target);
+      stereoRenderer.render(scene, camera, {
+        mode: stereoOptions.mode,
+        focus: focus,
+        eyeSeparation: stereoOptions.eyeSeparation || focus / 30,
+        swapEyes: stereoOptions.swapEyes
+      });
+    } else if (postProcessing.isActive() && !xrRendering) {
+      postProcessing.setPixelRatio(pixelRatio);
+      postProcessing.render();
+    } else if (smallMultiples && smallMultiples.panels && nodeMesh && !xrRendering) {
+      // the single view is restored as it was drawn, highlights included
+      let attributes = nodeMesh.geometry.attributes;
+      let base = {colors: attributes.color.array.slice(),
+                  secondColors: attributes.secondColor.array.slice(),
+                  opacities: attributes.nodeOpacity.array.slice()};
+      multiples.render(scene, camera, k => showPanel(smallMultiples.panels[k]));
+      showPanel(base, false);
+    } else {
+      renderer.render( scene, camera );
+    }
+    // html labels aren't part of exported images, and would only label one
+    // panel of the small multiples
+    if (showLabels && labelMode == 'html' && !exportPixelRatio && !xrRendering &&
+        !smallMultiples) {
+      let nodes = getLabelCandidates();
+      clearLabels();
+      if (declutterLabels) {
+        let placed = layoutNodeLabels(nodes).placed;
+        nodes = nodes.filter(node => placed[node] !== undefined);
+        nodes.forEach(node => {
+          nodeInfo[node].label.element.style.marginTop =
+            'calc(-1em + ' + placed[node] + 'px)';
+        });
+      }
+      nodes.forEach(node => {
+        labelNode(node);
+      });
+      labelRenderer.setSize( container.offsetWidth, container.offsetHeight );
+      labelRenderer.render( scene, camera );
+    }
+    if (nodeMesh) {
+      let opacities = nodeMesh.geometry.attributes.nodeOpacity.array;
+      minimap.draw({nodes: nodeInfo,
+                    visible: i => opacities[i] >= 0.01,
+                    selected: selected,
+                    camera: camera,
+                    target: cameraControls.target});
+    }
+    frameInfo = Object.assign({}, renderer.info.render);
+    if (debugOverlay.isEnabled()) {
+      debugOverlay.update({start: frameStart,
+                           layout: renderStart - frameStart,
+                           picking: pickingTime,
+                           render: performance.now() - renderStart,
+                           drawCalls: frameInfo.calls,
+                           triangles: frameInfo.triangles,
+                           points: frameInfo.points,
+                           lines: frameInfo.lines,
+                           nodes: nodeInfo.length,
+                           links: linkInfo.length});
+    }
+    pickingTime = 0;
+    scheduleSummary();
+    emit('renderFrame', {time: performance.now()});
+  }
+
+  /**
+   * Returns statistics about the size of the graph, its memory use and the
+   * cost of rendering it, to monitor and budget memory use.
+   *
+   * @returns {Object} The statistics formatted as {nodes, links, culledNodes,
+   *     geometries, buffers, bufferBytes, textures, textureBytes, drawCalls,
+   *     triangles, points, lines, programs}, where culledNodes is the number
+   *     of nodes hidden by occlusion culling, bufferBytes and textureBytes
+   *     estimate the GPU memory of the vertex buffers and textures, and the
+   *     draw call and primitive counts are those of the last rendered frame.
+   */
+  function getStats() {
+    let memory = sceneMemory([scene, indexScene]);
+    let culled = nodeMesh ? nodeMesh.geometry.attributes.culled.array : [];
+    return Object.assign({nodes: nodeInfo.length,
+                          links: linkInfo.length,
+                          culledNodes: culled.reduce((count, c) => count + (c > 0.5 ? 1 : 0), 0)},
+                         memory,
+                         {drawCalls: frameInfo.calls,
+                          triangles: frameInfo.triangles,
+                          points: frameInfo.points,
+                          lines: frameInfo.lines,
+                          programs: renderer.info.programs ? renderer.info.programs.length : 0});
+  }
+
+  /**
+   * Starts the animation cycle by repeatedly requesting an animation frame and
+   * calling 'render()'. During a VR session, the session runs its own
+   * animation loop instead, see `enterVR`.
+   */
+  function animate() {
+    animationFrame = requestAnimationFrame(animate);
+    if (xrMode.isPresenting()) return;
+    animationStep();
+    if (cameraControls) {
+      cameraControls.update();
+    } else {
+      render();
+    }
+  }
+
+  /**
+   * Advances the running animations by one frame.
+   */
+  function animationStep() {
+    if (flyTarget.active) {
+      flyUpdate();
+    }
+    if (growNodes) {
+      growUpdate();
+    }
+    if (highlightedPath && highlightedPath.shown < highlightedPath.steps) {
+      pathUpdate();
+    }
+    if (pathTraversal) {
+      traversalUpdate();
+    }
+    if (cameraTour) {
+      tourUpdate();
+    }
+    if (timeline && timeline.playing) {
+      timelineUpdate();
+    }
+    // the particles stand still with reduced motion
+    if (particleOptions.enabled && fluxOverlay && !isMotionReduced()) {
+      particleFlow.update(performance.now());
+      requestAnimationFrame(render);
+    }
+    if (plugins.length > 0) {
+      let time = performance.now();
+      plugins.forEach(({ plugin }) => {
+        if (plugin.onFrame) plugin.onFrame(time);
+      });
+    }
+  }
+
+  /**
+   * Renders a frame of the VR session.
+   *
+   * @param {number} time - the frame time in milliseconds
+   */
+  function xrFrame(time) {
+    xrMode.update(time);
+    animationStep();
+    xrRendering = true;
+    render();
+    xrRendering = false;
+  }
+
+  /**
+   * Returns whether the browser supports immersive VR, e.g. to only show a
+   * VR button when it does.
+   *
+   * @returns {Promise} A promise resolving to true or false.
+   */
+  function isVRSupported() {
+    return xrMode.isSupported();
+  }
+
+  /**
+   * Starts an immersive VR session (WebXR), which puts the user in the
+   * network where the camera is. In VR:
+   *     - the controller rays point at nodes, which are highlighted as
+   *       hovered
+   *     - the trigger selects the pointed at node
+   *     - the grip button grabs the pointed at node to move it, which can
+   *       be undone, or grabs the network to pull it around when no node is
+   *       pointed at. The links of a moved node follow when it's released.
+   *     - the thumbstick flies forward and back along the ray, and turns
+   *       left and right in steps
+   * The session ends with `exitVR` or from the headset, and the view is
+   * restored. Post-processing and html labels are not shown in VR, use the
+   * 'sdf' label mode (see `setLabelMode`) for labels in VR. A 'vrChange'
+   * event is emitted when the session starts and ends.
+   *
+   * Browsers only allow starting VR from a user gesture, so this should be
+   * called from e.g. a button click handler.
+   *
+   * @param {object} settings - (optional) VR options, with the keys:
+   *     - scale: graph units per meter (defaults to nodes being 10 cm)
+   *     - speed: flying speed in meters per second (default 1.5)
+   *     - turn: angle of the snap turns in radians (default 30 degrees)
+   *     - rayLength: length of the controller rays in meters (default 5)
+   *     - rayColor, hoverColor: ray colors as [r, g, b], when not pointing
+   *       and when pointing at a node
+   * @returns {Promise} A promise resolving to whether the session started.
+   */
+  async function enterVR(settings = {}) {
+    if (xrMode.isPresenting()) return true;
+    let view = {position: camera.position.clone(),
+                up: camera.up.clone(),
+                target: cameraControls.target.clone()};
+    // start where the camera is, facing the same way but upright
+    let forward = view.target.clone().sub(view.position);
+    let pose = {position: view.position,
+                quaternion: new Quaternion().setFromAxisAngle(
+                  new Vector3(0, 1, 0), Math.atan2(-forward.x, -forward.z))};
+    settings = Object.assign({scale: (currentNodeSize || 1) / 0.1}, settings);
+    if (!await xrMode.enter(pose, settings)) {
+      return false;
+    }
+    xrSavedView = view;
+    cameraControls.enabled = false;
+    hideTooltip();
+    renderer.setAnimationLoop(xrFrame);
+    emit('vrChange', {active: true});
+    return true;
+  }
+
+  /**
+   * Ends the VR session, see `enterVR`.
+   */
+  function exitVR() {
+    xrMode.exit();
+  }
+
+  /**
+   * Sets stereo rendering, for 3D projection without VR hardware. Red-cyan
+   * anaglyphs are viewed with paper glasses, and side-by-side images with
+   * passive 3D projectors and displays in side-by-side mode. Post-processing
+   * effects are skipped in stereo, and html labels are only drawn once, use
+   * the 'sdf' label mode (see `setLabelMode`) for labels in stereo.
+   *
+   * @param {string} mode - 'none' (default), 'anaglyph' or 'side-by-side'
+   * @param {object} settings - (optional) stereo options, with the keys:
+   *     - eyeSeparation: distance between the eyes in graph units. Defaults
+   *       to a thirtieth of the distance to the camera target, which puts
+   *       the target at the screen depth.
+   *     - swapEyes: whether to swap the left and right images, e.g. for
+   *       cyan-red glasses or projectors that swap them
+   */
+  function setStereo(mode, settings = {}) {
+    if (!['none', 'anaglyph', 'side-by-side'].includes(mode)) {
+      console.warn("unknown stereo mode: '" + mode + "', using 'none'.");
+      mode = 'none';
+    }
+    Object.assign(stereoOptions, settings, {mode: mode});
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Highlights the node pointed at in VR as hovered.
+   *
+   * @param {number} i - index of the node, or undefined
+   */
+  function onXRHover(i) {
+    select(i !== undefined ? [i] : [], false);
+  }
+
+  /**
+   * Selects the node chosen in VR, like clicking it.
+   *
+   * @param {number} i - index of the node
+   */
+  function onXRSelect(i) {
+    lastClicked = i;
+    select([i]);
+    if (nodeSelectCallback) {
+      nodeSelectCallback(nodeInfo[i]);
+    }
+  }
+
+  /**
+   * Moves a node grabbed in VR on screen, until it's released.
+   *
+   * @param {number} i - index of the node
+   * @param {Array} pos - the new position as [x, y, z]
+   */
+  function onXRDrag(i, pos) {
+    let positions = nodeMesh.geometry.attributes.position;
+    positions.setXYZ(i, pos[0], pos[1], pos[2]);
+    positions.needsUpdate = true;
+  }
+
+  /**
+   * Moves a node released in VR, and redraws its links. The move can be
+   * undone.
+   *
+   * @param {number} i - index of the node
+   * @param {Array} pos - the new position as [x, y, z]
+   */
+  async function onXRDrop(i, pos) {
+    let ids = new Set([nodeInfo[i].id]);
+    let offset = pos.map((v, k) => v - nodeInfo[i].pos[k]);
+    await moveNodes(ids, offset);
+    record({undo: () => moveNodes(ids, offset.map(v => -v)),
+            redo: () => moveNodes(ids, offset)});
+  }
+
+  /**
+   * Restores the view after a VR session.
+   */
+  function onXREnd() {
+    renderer.setAnimationLoop(null);
+    if (xrSavedView) {
+      setCamera(xrSavedView.position, xrSavedView.up, xrSavedView.target);
+      camera.lookAt(xrSavedView.target);
+      xrSavedView = undefined;
+    }
+    cameraControls.enabled = true;
+    onWindowResize();
+    requestAnimationFrame(render);
+    emit('vrChange', {active: false});
+  }
+
+  // Start the rendering cycle
+  animate();
+
+  /**
+   * Registers an event handler. The handler is called with the event details:
+   *     - nodeClick: {node, event}, when a node is clicked
+   *     - nodeHover: {node, event}, when the mouse pointer moves onto a node,
+   *       or off all nodes, in which case node is null
+   *     - edgeClick: {link, event}, when a link is clicked, with the link data
+   *     - selectionChange: {items, added, removed}, when the selection changes
+   *     - cameraChange: {position, target, up}, when a camera move ends
+   *     - dataLoaded: {nodes, links}, with the node and link counts, when
+   *       graph data has been set
+   *     - renderFrame: {time}, after every rendered frame
+   *     - tick: {position, index, label, playing}, when the time-series
+   *       playback moves, see `setTimeline`
+   *
+   * @param {string} type - the event type
+   * @param {function} handler - function taking the event details
+   */
+  function on(type, handler) {
+    if (!viewerEvents.includes(type)) {
+      console.warn("unknown event type: '" + type + "'.");
+      return;
+    }
+    eventHandlers[type] = (eventHandlers[type] || []).concat([handler]);
+  }
+
+  /**
+   * Removes an event handler registered with `on`.
+   *
+   * @param {string} type - the event type
+   * @param {function} handler - (optional) the handler to remove. If omitted,
+   *     all handlers of the event type are removed.
+   */
+  function off(type, handler) {
+    if (!eventHandlers[type]) return;
+    eventHandlers[type] = handler ? eventHandlers[type].filter(h => h !== handler) : [];
+  }
+
+  /**
+   * Calls the handlers of an event type.
+   *
+   * @param {string} type - the event type
+   * @param {object} detail - the event details
+   */
+  function emit(type, detail) {
+    (eventHandlers[type] || []).forEach(handler => handler(detail));
+  }
+
+  /**
+   * Adds a plugin to the viewer. Plugins extend the viewer from the outside,
+   * e.g. with minimaps or custom overlays, through lifecycle hooks:
+   *     - init(context, options): called when the plugin is added, with the
+   *       plugin context {scene, camera, renderer, container, controls,
+   *       viewer, render}, where viewer is the viewer controller and render
+   *       requests a new frame
+   *     - onDataLoad({nodes, links}): called when graph data has been set,
+   *       and directly on init if data is already loaded
+   *     - onFrame(time): called every animation frame
+   *     - onPick({node, event} or {link, event}): called when a node or a
+   *       link is clicked
+   *     - dispose(): called when the plugin is removed
+   * All hooks are optional.
+   *
+   * @param {object} plugin - the plugin, an object with the hook functions
+   * @param {object} options - (optional) options passed to `init`
+   */
+  function use(plugin, options = {}) {
+    if (plugins.some(p => p.plugin === plugin)) {
+      console.warn("plugin '" + (plugin.name || 'unnamed') + "' is already in use.");
+      return;
+    }
+    let handlers = {};
+    if (plugin.onDataLoad) {
+      handlers.dataLoaded = detail => plugin.onDataLoad(detail);
+    }
+    if (plugin.onPick) {
+      handlers.nodeClick = detail => plugin.onPick(detail);
+      handlers.edgeClick = detail => plugin.onPick(detail);
+    }
+    Object.keys(handlers).forEach(type => on(type, handlers[type]));
+    plugins.push({plugin: plugin, handlers: handlers});
+
+    if (plugin.init) {
+      plugin.init({
+        scene: scene,
+        camera: camera,
+        renderer: renderer,
+        container: container,
+        get controls() { return cameraControls; },
+        viewer: controller,
+        render: () => requestAnimationFrame(render)
+      }, options);
+    }
+    if (plugin.onDataLoad && nodeMesh) {
+      plugin.onDataLoad({nodes: nodeInfo.length, links: linkInfo.length});
+    }
+  }
+
+  /**
+   * Removes a plugin added with `use`, and calls its dispose hook.
+   *
+   * @param {object} plugin - the plugin to remove
+   */
+  function removePlugin(plugin) {
+    let entry = plugins.find(p => p.plugin === plugin);
+    if (!entry) return;
+    plugins = plugins.filter(p => p !== entry);
+    Object.keys(entry.handlers).forEach(type => off(type, entry.handlers[type]));
+    if (plugin.dispose) {
+      plugin.dispose();
+    }
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Disposes a three-js object and its children, with their geometries,
+   * materials and material textures.
+   *
+   * @param {Object} object - the object to dispose
+   */
+  function disposeObject(object) {
+    object.traverse(child => {
+      if (child.geometry) {
+        child.geometry.dispose();
+      }
+      let materials = Array.isArray(child.material) ? child.material :
+                      child.material ? [child.material] : [];
+      materials.forEach(material => {
+        Object.values(material).concat(Object.values(material.uniforms || {})
+                                       .map(uniform => uniform.value))
+          .filter(value => value && value.isTexture)
+          .forEach(texture => texture.dispose());
+        material.dispose();
+      });
+    });
+  }
+
+  /**
+   * Destroys the viewer. Stops the animation, removes all event listeners
+   * and the viewer elements, disposes all geometries, materials, textures
+   * and render targets, and releases the WebGL context. The viewer can't be
+   * used after it has been disposed.
+   */
+  function dispose() {
+    if (disposed) return;
+    disposed = true;
+    cancelAnimationFrame(animationFrame);
+    renderer.setAnimationLoop(null);
+    xrMode.exit();
+    stopTour();
+    stopTraversal();
+    stopRecording();
+    plugins.slice().forEach(({ plugin }) => removePlugin(plugin));
+    eventHandlers = {};
+    legends.slice().forEach(legend => removeLegend(legend.canvas));
+
+    window.removeEventListener('resize', onWindowResize, false);
+    if (resizeObserver) {
+      resizeObserver.disconnect();
+    }
+    if (pixelRatioQuery) {
+      pixelRatioQuery.removeEventListener('change', onPixelRatioChange);
+    }
+    window.removeEventListener('mousemove', onMouseMove, false);
+    window.removeEventListener('pointerdown', onMouseClick, false);
+    window.removeEventListener('pointermove', onSelectionMove, false);
+    window.removeEventListener('pointerup', onSelectionEnd, false);
+    window.removeEventListener('pointermove', onDrawMove, false);
+    window.removeEventListener('pointerup', onDrawEnd, false);
+    window.removeEventListener('keypress', onKeypress, false);
+    renderer.domElement.removeEventListener('pointerdown', onSelectionStart, false);
+    renderer.domElement.removeEventListener('pointerdown', onDrawStart, false);
+    renderer.domElement.removeEventListener('pointerdown', focusContainer, false);
+    renderer.domElement.removeEventListener('contextmenu', onContextMenu, false);
+    renderer.domElement.removeEventListener('dblclick', onDoubleClick, false);
+    container.removeEventListener('keydown', onKeydown, false);
+    if (cameraControls && cameraControls.dispose) {
+      cameraControls.dispose();
+    }
+
+    clearLabels();
+    levelOfDetail.dispose();
+    particleFlow.dispose();
+    disposeObject(scene);
+    disposeObject(indexScene);
+    if (glyphAtlas) {
+      glyphAtlas.texture.dispose();
+    }
+    if (iconTexture) {
+      iconTexture.dispose();
+    }
+    postProcessing.dispose();
+
+    selectionOverlay.dispose();
+    sketch.dispose();
+    minimap.dispose();
+    annotationLayer.dispose();
+    breadcrumb.dispose();
+    multiples.dispose();
+    debugOverlay.dispose();
+    infoBox.remove();
+    focusRing.remove();
+    announcer.dispose();
+    clearTimeout(summaryTimeout);
+    networkSummary.dispose();
+    labelRenderer.domElement.remove();
+    renderer.domElement.remove();
+    renderer.dispose();
+    renderer.forceContextLoss();
+  }
+
+  /**
+   * Bind callback for when a single node is clicked,
+   * used in the onMouseClick function. Same as `on('nodeClick', ...)` for
+   * single-node selections, kept for compatibility.
+   */
+  function setNodeSelectCallback(callback) {
+    nodeSelectCallback = callback;
+  }
+
+  /**
+   * Bind callback for when the camera is updated. Same as
+   * `on('cameraChange', ...)`, kept for compatibility.
+   */
+  function setUpdateCameraCallback(callback) {
+    updateCameraCallback = callback;
+  }
+
+  /**
+   * Centers camera on a node
+   */
+  function centerNode(node) {
+    let m = midPoint([node.index]);
+    cameraControls.target.copy(m);
+  }
+
+
+  /**
+   * Renders the current view and returns it as a data url. The image is
+   * read back directly after rendering, so the renderer doesn't need to
+   * preserve the drawing buffer.
+   *
+   * @param {string} type - (optional) image mime type, default 'image/png'
+   * @returns {string} The data url of the rendered image.
+   */
+  function toDataURL(type = 'image/png') {
+    cameraControls.update();
+    render();
+    return renderer.domElement.toDataURL(type);
+  }
+
+  /**
+   * Renders the current view offscreen at any resolution, e.g. four times
+   * the screen resolution for publication figures, and returns it as an
+   * image. The view is rendered as it looks on screen, only with more
+   * pixels, so node sizes, line widths and labels scale with the image. If
+   * the image has a different aspect ratio than the viewer, the view is
+   * widened or narrowed around the center. Html labels are not included,
+   * use the 'sdf' label mode (see `setLabelMode`) for labels in the image.
+   *
+   * @param {object} options - (optional) export options with the keys:
+   *     - width, height: size of the image in pixels. If only one is given,
+   *       the other follows the aspect ratio of the viewer.
+   *     - scale: size of the image relative to the viewer size, used if
+   *       neither width nor height is given (default: the device pixel
+   *       ratio)
+   *     - transparent: whether to leave out the background
+   *     - type: image mime type (default 'image/png')
+   *     - quality: image quality between 0 and 1, for lossy types
+   *     - annotations: whether to draw the annotation callouts, see
+   *       `addAnnotation`, into the image
+   *     - legend: true or legend options (see `createLegend`, with the extra
+   *       key corner, default 'top-right') to draw the color legend into the
+   *       image
+   *     - gizmo: true or gizmo options to draw the axes and a scale bar into
+   *       the image, with the keys corner (default 'bottom-left'), unit (the
+   *       name of the graph units), color, background and font
+   * @returns {Promise} A promise resolving to the image as a Blob.
+   */
+  function exportImage(options = {}) {
+    let cssWidth = container.offsetWidth;
+    let cssHeight = container.offsetHeight;
+    let width = options.width;
+    let height = options.height;
+    if (!width && !height) {
+      let scale = options.scale || window.devicePixelRatio;
+      width = cssWidth * scale;
+      height = cssHeight * scale;
+    }
+    width = Math.round(width || height * cssWidth / cssHeight);
+    height = Math.round(height || width * cssHeight / cssWidth);
+    let max = renderer.capabilities.maxTextureSize;
+    if (width > max || height > max) {
+      let shrink = max / Math.max(width, height);
+      console.warn('image size ' + width + 'x' + height + ' exceeds the maximum ' +
+                   'size of ' + max + ' pixels, and is reduced.');
+      width = Math.floor(width * shrink);
+      height = Math.floor(height * shrink);
+    }
+
+    // keep the css height, so that the view is the same as on screen, and
+    // get the image size from the pixel ratio
+    let background = scene.background;
+    let clearAlpha = renderer.getClearAlpha();
+    let image = document.createElement('canvas');
+    image.width = width;
+    image.height = height;
+    try {
+      if (options.transparent) {
+        scene.background = null;
+        renderer.setClearAlpha(0);
+      }
+      exportPixelRatio = height / cssHeight;
+      camera.aspect = width / height;
+      camera.updateProjectionMatrix();
+      renderer.setSize(width / exportPixelRatio, cssHeight, false);
+      postProcessing.setSize(width / exportPixelRatio, cssHeight);
+      cameraControls.update();
+      render();
+      // copy the image before the drawing buffer is cleared
+      image.getContext('2d').drawImage(renderer.domElement, 0, 0, width, height);
+      drawImageOverlays(image.getContext('2d'), options,
+                        {width: width / exportPixelRatio, height: cssHeight},
+                        exportPixelRatio);
+    } finally {
+      exportPixelRatio = undefined;
+      scene.background = background;
+      renderer.setClearAlpha(clearAlpha);
+      onWindowResize();
+    }
+
+    return new Promise((resolve, reject) => {
+      image.toBlob(blob => {
+        if (blob) {
+          resolve(blob);
+        } else {
+          reject(new Error('could not encode the image'));
+        }
+      }, options.type || 'image/png', options.quality);
+    });
+  }
+
+  /**
+   * Draws the overlays chosen in the export options into an exported image,
+   * so that the image is self-contained. Called while the camera is set up
+   * for the image.
+   *
+   * @param {Object} ctx - the canvas context of the image
+   * @param {object} options - the export options, see `exportImage`
+   * @param {object} size - the image size in CSS pixels, as {width, height}
+   * @param {number} ratio - image pixels per CSS pixel
+   */
+  function drawImageOverlays(ctx, options, size, ratio) {
+    ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+    if (options.annotations && nodeMesh && annotationLayer.isVisible()) {
+      drawCallouts(ctx, annotationCallouts(size));
+    }
+    if (options.legend) {
+      let settings = Object.assign({corner: 'top-right'},
+                                   options.legend === true ? {} : options.legend);
+      let legend = {canvas: document.createElement('canvas'),
+                    options: Object.assign(legendOptions(settings), {ratio: ratio})};
+      updateLegend(legend);
+      if (!legend.canvas.hidden) {
+        let box = {width: legend.canvas.width / ratio, height: legend.canvas.height / ratio};
+        let [x, y] = cornerPosition(size, box, settings.corner);
+        ctx.drawImage(legend.canvas, x, y, box.width, box.height);
+      }
+    }
+    if (options.gizmo) {
+      drawGizmo(ctx, camera, camera.position.distanceTo(cameraControls.target), size,
+                Object.assign({corner: 'bottom-left',
+                               unit: '',
+                               color: labelColors.color,
+                               background: labelColors.background,
+                               font: '11px sans-serif'},
+                              options.gizmo === true ? {} : options.gizmo));
+    }
+  }
+
+  /**
+   * Copies the current view to the clipboard as a PNG image, so that it can
+   * be pasted into documents. Browsers only allow this from user actions,
+   * such as a click on a button.
+   *
+   * @param {object} options - (optional) image options, see `exportImage`
+   * @returns {Promise} A promise which resolves when the image is copied,
+   *     and rejects if the browser doesn't support copying images.
+   */
+  function copyImageToClipboard(options = {}) {
+    if (!navigator.clipboard || !navigator.clipboard.write || !window.ClipboardItem) {
+      return Promise.reject(new Error('copying images is not supported by this browser'));
+    }
+    // the image is passed as a promise, since some browsers require the
+    // clipboard item to be created right away in the user action
+    let image = exportImage(Object.assign({}, options, {type: 'image/png'}));
+    return navigator.clipboard.write([new ClipboardItem({'image/png': image})]);
+  }
+
+  /**
+   * Exports the network as a glTF file, which can be opened in e.g. Blender
+   * or embedded in other 3D tools and AR viewers. Every visible node is an
+   * object named by its ID, sharing one mesh per node shape (see
+   * `setLevelOfDetail`), with the node colors and sizes as shown. The links
+   * are exported as colored line segments.
+   *
+   * @param {object} options - (optional) export options with the keys:
+   *     - binary: whether to export a single GLB file (default true), or
+   *       glTF JSON
+   *     - detail: number of segments of curved node shapes (default 12)
+   * @returns {Promise} A promise resolving to the file as a Blob.
+   */
+  function exportGLTF(options = {}) {
+    options = Object.assign({binary: true, detail: 12}, options);
+    if (!nodeMesh) {
+      return Promise.reject(new Error('there is no network to export'));
+    }
+    let attributes = nodeMesh.geometry.attributes;
+    let groupShapes = {};
+    currentData.nodeTextures.forEach(tex => {
+      groupShapes[tex.group] = tex.shape;
+    });
+    let visible = i => attributes.nodeOpacity.array[i] >= 0.01;
+    let nodes = nodeInfo.filter((node, i) => visible(i)).map(node => {
+      let shape = node.style.shape || node.shape || groupShapes[node.group];
+      return {id: node.id,
+              pos: node.pos,
+              color: Array.from(attributes.color.array.slice(node.index*3, node.index*3 + 3)),
+              scale: attributes.nodeScale.array[node.index],
+              shape: shape == 'sprite' ? 'sphere' : shape};
+    });
+
+    let links = {positions: [], colors: []};
+    let linePositions = connectionMesh.geometry.attributes.position.array;
+    let lineColors = connectionMesh.geometry.attributes.color.array;
+    linkInfo.forEach(link => {
+      if (!visible(nodeIds[link.s]) || !visible(nodeIds[link.t])) return;
+      let start = link.start * 3;
+      let end = (link.start + link.count) * 3;
+      links.positions.push.apply(links.positions, linePositions.slice(start, end));
+      links.colors.push.apply(links.colors, lineColors.slice(start, end));
+    });
+
+    return exportNetworkGLTF(nodes, links, {radius: currentNodeSize * 0.5,
+                                            detail: options.detail,
+                                            shapes: customShapes,
+                                            binary: options.binary})
+      .then(result => options.binary ?
+        new Blob([result], {type: 'model/gltf-binary'}) :
+        new Blob([JSON.stringify(result)], {type: 'model/gltf+json'}));
+  }
+
+  /**
+   * Sets the viewer theme, which controls the background, fog, default node
+   * and connection colors, highlight colors and label colors. The theme can
+   * be changed at any time.
+   *
+   * @param {string|object} theme - 'light', 'dark', or a theme object with
+   *     any of the keys: background, fog, nodeDefaultColor,
+   *     connectionStartColor, connectionEndColor, nodeSelectColor,
+   *     connectionSelectColor, hoverSelectColor, hoverConnectionColor,
+   *     pathColor, labelColor, labelBackground, infoColor and infoBackground. Missing
+   *     keys are left as they are.
+   */
+  function setTheme(theme) {
+    if (typeof theme === 'string') {
+      if (!themes[theme]) {
+        console.warn("unknown theme: '" + theme + "'.");
+        return;
+      }
+      theme = themes[theme];
+    }
+    const has = key => theme[key] !== undefined;
+
+    if (has('background')) {
+      setBackgroundColor(theme.background);
+    }
+    if (has('fog')) {
+      if (scene.fog) {
+        scene.fog.color = new Color(theme.fog);
+      }
+      fogOptions.color = theme.fog;
+    }
+    setColors(theme);
+
+    labelColors = {color: has('labelColor') ? theme.labelColor : labelColors.color,
+                   background: has('labelBackground') ? theme.labelBackground :
+                                                        labelColors.background};
+    nodeInfo.forEach(node => {
+      node.label.element.style.color = labelColors.color;
+      node.label.element.style.background = labelColors.background;
+    });
+    if (has('infoColor')) {
+      infoBox.style.color = theme.infoColor;
+    }
+    if (has('infoBackground')) {
+      infoBox.style.backgroundColor = theme.infoBackground;
+    }
+    if (labelMode == 'sdf' && (has('labelColor') || has('background'))) {
+      // three-js colors have no alpha, so the label alpha is set apart
+      let text = splitAlpha(labelColors.color);
+      setLabelMode('sdf', {color: new Color(text.color),
+                           opacity: text.alpha,
+                           outlineColor: scene.background ?
+                             '#' + scene.background.getHexString() : labelStyle.outlineColor});
+    }
+
+    refreshColors();
+    requestAnimationFrame(render);
+  }
+
+  /**
+   * Recolors all nodes and connections from the current colors, keeping the
+   * selection and hover highlights.
+   */
+  function refreshColors() {
+    if (!nodeMesh) return;
+    minimap.invalidate();
+    updateLegends();
+    applyColorVisionMode();
+    linkInfo.forEach((link, i) => {
+      let base = linkBaseColors(i);
+      setLinkColor(i, base[0], base[1]);
+    });
+    connectionMesh.geometry.attributes.color.needsUpdate = true;
+    selected.forEach(i => {
+      setSpriteColor(i, nodeSelectColor);
+      setConnectionsColor(i, connectionSelectColor);
+    });
+    if (hoverNode !== undefined && !selected.includes(hoverNode)) {
+      setSpriteColor(hoverNode, hoverSelectColor);
+      setConnectionsColor(hoverNode, hoverConnectionColor);
+    }
+    updateHighlight();
+  }
+
+  /**
+   * Adds an interaction to the undo stack, and clears the redo stack.
+   * Nothing is recorded while undoing or redoing.
+   *
+   * @param {object} entry - the interaction, as {undo: <function>, redo:
+   *     <function>}
+   */
+  function record(entry) {
+    if (replaying) return;
+    undoStack.push(entry);
+    if (undoStack.length > maxHistory) {
+      undoStack.shift();
+    }
+    redoStack = [];
+  }
+
+  /**
+   * Undoes the last interaction. Selection changes, filter changes (node and
+   * link types, currency metabolites, subsystems, degrees and filter
+   * layers), collapsing and moving groups, and drawing are recorded. Nodes
+   * can't be pinned or dragged one by one, so there are no such changes to
+   * undo. Also bound to ctrl/cmd+Z when the viewer has keyboard focus.
+   *
+   * @returns {boolean} False if there was nothing to undo.
+   */
+  function undo() {
+    let entry = undoStack.pop();
+    if (!entry) return false;
+    replaying = true;
+    try {
+      entry.undo();
+    } finally {
+      replaying = false;
+    }
+    redoStack.push(entry);
+    return true;
+  }
+
+  /**
+   * Redoes the last undone interaction. Also bound to ctrl/cmd+shift+Z and
+   * ctrl+Y when the viewer has keyboard focus.
+   *
+   * @returns {boolean} False if there was nothing to redo.
+   */
+  function redo() {
+    let entry = redoStack.pop();
+    if (!entry) return false;
+    replaying = true;
+    try {
+      entry.redo();
+    } finally {
+      replaying = false;
+    }
+    undoStack.push(entry);
+    return true;
+  }
+
+  /**
+   * Returns the current camera view, formatted as {position, up, target}.
+   */
+  function cameraView() {
+    return {position: Object.assign({}, camera.position),
+            up: Object.assign({}, camera.up),
+            target: Object.assign({}, cameraControls.target)};
+  }
+
+  /**
+   * Updates the current history entry to where the camera is, as it may
+   * have been moved since the jump to the entry. Views in the middle of a
+   * jump aren't kept.
+   */
+  function updateHistoryEntry() {
+    let history = navigationHistory;
+    if (history.index < 0) {
+      history.entries.push(cameraView());
+      history.index = 0;
+    } else if (!flyTarget.active) {
+      history.entries[history.index] = Object.assign(cameraView(),
+        {node: history.entries[history.index].node});
+    }
+  }
+
+  /**
+   * Adds a camera jump to the navigation history, and clears the forward
+   * history.
+   *
+   * @param {object} view - the view jumped to, see `cameraView`
+   */
+  function recordJump(view) {
+    updateHistoryEntry();
+    let history = navigationHistory;
+    history.entries = history.entries.slice(0, history.index + 1);
+    history.entries.push(view);
+    if (history.entries.length > maxHistory) {
+      history.entries.shift();
+    }
+    history.index = history.entries.length - 1;
+  }
+
+  /**
+   * Flies the camera to a view of the navigation history.
+   *
+   * @param {number} step - -1 to go back, 1 to go forward
+   * @param {number} duration - duration in milliseconds
+   * @returns {boolean} False if there is no view in that direction.
+   */
+  function stepHistory(step, duration) {
+    let history = navigationHistory;
+    let index = history.index + step;
+    if (history.index < 0 || index < 0 || index >= history.entries.length) {
+      return false;
+    }
+    updateHistoryEntry();
+    history.index = index;
+    let view = history.entries[index];
+    navigating = true;
+    try {
+      setFlyTarget(Object.assign({}, view.position), Object.assign({}, view.up),
+                   Object.assign({}, view.target), duration);
+    } finally {
+      navigating = false;
+    }
+    if (view.node !== undefined && nodeIds[view.node] !== undefined) {
+      setFocus(nodeIds[view.node]);
+    }
+    return true;
+  }
+
+  /**
+   * Flies the camera back to the view before the last camera jump, such as
+   * focusing a node, framing the selection or resetting the camera, like the
+   * back button of a browser. The focused node of the view gets the keyboard
+   * focus again. Also bound to alt+left arrow when the viewer has keyboard
+   * focus.
+   *
+   * @param {number} duration - (optional) duration in milliseconds
+   *     (default 750)
+   * @returns {boolean} False if there is no view to go back to.
+   */
+  function goBack(duration = 750) {
+    return stepHistory(-1, duration);
+  }
+
+  /**
+   * Flies the camera forward to the view that was left with `goBack`. Also
+   * bound to alt+right arrow when the viewer has keyboard focus.
+   *
+   * @param {number} duration - (optional) duration in milliseconds
+   *     (default 750)
+   * @returns {boolean} False if there is no view to go forward to.
+   */
+  function goForward(duration = 750) {
+    return stepHistory(1, duration);
   }
 
   /**
-   * Colors all connections of the sprite selected by `spriteNum`.
+   * Returns whether there are views to go back and forward to, e.g. to
+   * enable history buttons.
    *
-   * @param {*} spriteNum - id of the sprite to have it's connections colored
-   * @param {*} color - (optional) color to set the connections to. If omitted,
-   *     the default connection colors will be used.
+   * @returns {object} An object with the keys back and forward.
    */
-  function setConnectionsColor(spriteNum, color = undefined) {
-    let node = nodeInfo[spriteNum];
-    if (!node) return;
-
-    node.connections.from.forEach(conn => {
-      let c = color ? color : selected.includes(spriteNum) ? connectionSelectColor : connectionStartColor;
-      connectionMesh.geometry.attributes.color.array[conn.index*3+0] = c[0];
-      connectionMesh.geometry.attributes.color.array[conn.index*3+1] = c[1];
-      connectionMesh.geometry.attributes.color.array[conn.index*3+2] = c[2];
-
-      c = color ? color : selected.includes(spriteNum) ? connectionSelectColor : connectionEndColor;
-      connectionMesh.geometry.attributes.color.array[conn.index*3+3] = c[0];
-      connectionMesh.geometry.attributes.color.array[conn.index*3+4] = c[1];
-      connectionMesh.geometry.attributes.color.array[conn.index*3+5] = c[2];
-    });
-    node.connections.to.forEach(conn => {
-      let c = color ? color : selected.includes(spriteNum) ? connectionSelectColor : connectionStartColor;
-      connectionMesh.geometry.attributes.color.array[conn.index*3-3] = c[0];
-      connectionMesh.geometry.attributes.color.array[conn.index*3-2] = c[1];
-      connectionMesh.geometry.attributes.color.array[conn.index*3-1] = c[2];
-
-      c = color ? color : selected.includes(spriteNum) ? connectionSelectColor : connectionEndColor;
-      connectionMesh.geometry.attributes.color.array[conn.index*3+0] = c[0];
-      connectionMesh.geometry.attributes.color.array[conn.index*3+1] = c[1];
-      connectionMesh.geometry.attributes.color.array[conn.index*3+2] = c[2];
-    });
-    connectionMesh.geometry.attributes.color.needsUpdate = true;
+  function getNavigationHistory() {
+    let history = navigationHistory;
+    return {back: history.index > 0,
+            forward: history.index >= 0 && history.index < history.entries.length - 1};
   }
 
   /**
-   * Updates the camera projection matrix, and renderer size to the current
-   * window size.
+   * Reads the saved bookmarks again, unless they are only kept in memory, so
+   * that the bookmarks saved by other viewers under the same key aren't
+   * lost.
    */
-  function onWindowResize() {
-    camera.aspect = container.offsetWidth / container.offsetHeight;
-    camera.updateProjectionMatrix();
-    renderer.setSize( container.offsetWidth, container.offsetHeight );
-    if (cameraControls) {
-      cameraControls.handleResize();
+  function syncBookmarks() {
+    if (bookmarkKey !== null) {
+      bookmarks = loadBookmarks(bookmarkKey, bookmarks);
     }
-    requestAnimationFrame(render);
   }
 
   /**
-   * Sets the camera to the absolute position given by `position`, using the
-   * up-vector `up`, and pointing at `target`.
+   * Changes the bookmarks and saves them, unless they are only kept in
+   * memory. The change is made to the saved bookmarks, so that changes of
+   * other viewers under the same key are kept.
    *
-   * @param {*} position - new camera position
-   * @param {*} up - new camera up vector
-   * @param {*} target - new camera target
+   * @param {Function} change - changes `bookmarks`, and returns the result
+   * @returns {*} The result of the change.
    */
-  function setCamera(position, up, target) {
-    camera.position.copy(position);
-    if (up) {
-      camera.up.copy(up);
-    }
-
-    if (target) {
-      cameraControls.target.copy(target)
+  function updateBookmarks(change) {
+    syncBookmarks();
+    let result = change();
+    if (bookmarkKey !== null) {
+      saveBookmarks(bookmarkKey, bookmarks);
     }
-    requestAnimationFrame(render);
+    return result;
   }
 
   /**
-   * Sets the camera to fly towards being in the position given by `position`,
-   * the up-vector `up`, and pointing towards `target`. The duration for the
-   * transition is given by `flyTarget.runTime`.
+   * Bookmarks a node or the current view. Bookmarks are saved in
+   * localStorage, so that they are still there when the page is opened
+   * again. All viewers share the default key, so viewers of different
+   * models should each set their own, see `setBookmarkStorage`.
    *
-   * @param {*} position - target camera position
-   * @param {*} up - target camera up vector
-   * @param {*} target - target camera target
+   * @param {string} label - the bookmark label
+   * @param {object} options - (optional) options with the keys node (ID of
+   *     a node to bookmark instead of the view) and state (whether to save
+   *     the full view state, see `getState`, instead of only the camera and
+   *     selection)
+   * @returns {object} The bookmark, formatted as {id, label, created, node,
+   *     camera, selection, state}, or undefined if the node doesn't exist.
    */
-  function setFlyTarget(position, up = {x:0, y:1, z:0}, target = {x:0, y:0, z:0}) {
-    flyTarget.active = true;
-    flyTarget.start = Object.assign({}, camera.position);
-    flyTarget.startUp = Object.assign({}, camera.up);
-    flyTarget.end = position;
-    flyTarget.target = target;
-    flyTarget.targetUp = up;
-    flyTarget.startTime = new Date().getTime();
+  function addBookmark(label, options = {}) {
+    if (options.node !== undefined && nodeIds[options.node] === undefined) {
+      console.warn("unknown node id: '" + options.node + "'.");
+      return undefined;
+    }
+    let bookmark = {id: bookmarkId(),
+                    label: String(label),
+                    created: new Date().toISOString(),
+                    camera: cameraView(),
+                    selection: getSelection()};
+    if (options.node !== undefined) {
+      bookmark.node = options.node;
+    }
+    if (options.state) {
+      bookmark.state = JSON.parse(JSON.stringify(getState()));
+    }
+    updateBookmarks(() => bookmarks.push(bookmark));
+    return Object.assign({}, bookmark);
   }
 
   /**
-   * Updates the camera with a new position given the time that's transpired
-   * between `flyTarget.startTime` and now. If the current time is greater than
-   * `flyTarget.startTime` + `flyTarget.runTime`, then the camera will be set to
-   * the `flyTarget.end` position, and `flyTarget.active` will be set to
-   * `false`.
+   * Returns the bookmarks, oldest first.
+   *
+   * @returns {Array} The bookmarks, see `addBookmark`.
    */
-  function flyUpdate() {
-    let t = new Date().getTime();
-    if (t >= flyTarget.startTime + flyTarget.runTime) {
-      flyTarget.active = false;
-      setCamera(flyTarget.end, flyTarget.targetUp, flyTarget.target);
-    } else {
-      let p = (t - flyTarget.startTime)/flyTarget.runTime;
-      let p_t = {
-        x: flyTarget.start.x + (flyTarget.end.x - flyTarget.start.x)*p,
-        y: flyTarget.start.y + (flyTarget.end.y - flyTarget.start.y)*p,
-        z: flyTarget.start.z + (flyTarget.end.z - flyTarget.start.z)*p
-      };
-      let p_u = {
-        x: flyTarget.startUp.x + (flyTarget.targetUp.x - flyTarget.startUp.x)*p,
-        y: flyTarget.startUp.y + (flyTarget.targetUp.y - flyTarget.startUp.y)*p,
-        z: flyTarget.startUp.z + (flyTarget.targetUp.z - flyTarget.startUp.z)*p
-      };
-      setCamera(p_t, p_u, flyTarget.target);
-    }
+  function getBookmarks() {
+    syncBookmarks();
+    return bookmarks.map(bookmark => Object.assign({}, bookmark));
   }
 
   /**
-   * Uses the SetFlyTarget function to reset the camera to the start-position.
+   * Changes the label of a bookmark.
+   *
+   * @param {string} id - the bookmark ID
+   * @param {string} label - the new label
+   * @returns {boolean} False if there is no such bookmark.
    */
-  function resetCamera() {
-    setFlyTarget(cameraDefault.position, cameraDefault.up, cameraDefault.target);
+  function renameBookmark(id, label) {
+    return updateBookmarks(() => {
+      let bookmark = bookmarks.find(b => b.id == id);
+      if (!bookmark) return false;
+      bookmark.label = String(label);
+      return true;
+    });
   }
 
   /**
-   * Resets the list of selected nodes, and re-points the camera to the world
-   * center.
+   * Removes a bookmark.
+   *
+   * @param {string} id - the bookmark ID
+   * @returns {boolean} False if there is no such bookmark.
    */
-  function resetSelection() {
-    select([]);
-    cameraControls.target.copy({x:0, y:0, z:0});
-    requestAnimationFrame(render);
+  function removeBookmark(id) {
+    return updateBookmarks(() => {
+      let count = bookmarks.length;
+      bookmarks = bookmarks.filter(b => b.id != id);
+      return bookmarks.length < count;
+    });
   }
 
   /**
-   * Toggles showing node labels;
+   * Goes to a bookmark. Node bookmarks fly the camera to the node and select
+   * it, view bookmarks restore the camera and selection, or the full view
+   * state if it was saved.
+   *
+   * @param {string} id - the bookmark ID
+   * @param {object} options - (optional) framing options for node
+   *     bookmarks, see `focusNode`, and duration (in milliseconds, default
+   *     750) for view bookmarks
+   * @returns {Promise} A promise resolving to false if there is no such
+   *     bookmark or its node doesn't exist, and true otherwise.
    */
-  function toggleLabels() {
-    if (showLabels) {
-      clearLabels();
+  async function goToBookmark(id, options = {}) {
+    syncBookmarks();
+    let bookmark = bookmarks.find(b => b.id == id);
+    if (!bookmark) return false;
+    if (bookmark.state) {
+      await setState(bookmark.state);
+      return true;
     }
-    showLabels = !showLabels;
-    requestAnimationFrame(render);
+    if (bookmark.node !== undefined) {
+      if (nodeIds[bookmark.node] === undefined) {
+        console.warn("unknown node id: '" + bookmark.node + "'.");
+        return false;
+      }
+      focusNode(bookmark.node, options);
+      selectNodes([bookmark.node]);
+      return true;
+    }
+    let view = bookmark.camera;
+    setFlyTarget(Object.assign({}, view.position), Object.assign({}, view.up),
+                 Object.assign({}, view.target),
+                 options.duration !== undefined ? options.duration : 750);
+    selectNodes(bookmark.selection.filter(node => nodeIds[node] !== undefined));
+    return true;
   }
 
   /**
-   * Toggles showing nodes and links for a node type;
+   * Returns the bookmarks as JSON, e.g. to save them to a file.
+   *
+   * @returns {string} The bookmarks as a JSON string.
    */
-  async function toggleNodeType(nodeType) {
-    showGenes = !showGenes;
-
-    if (showGenes) {
-      return await setData(initialData);
-    } else {
-      const nodes = initialData.graphData.nodes.filter(n => n.g !== nodeType);
-      const nodeIds = nodes.map(n => n.id);
-      const links = initialData.graphData.links.filter(l =>
-        nodeIds.includes(l.s) && nodeIds.includes(l.t)
-      );
-      const nodeTextures = initialData.nodeTextures.filter(t => t.group !== nodeType);
+  function exportBookmarks() {
+    syncBookmarks();
+    return JSON.stringify(bookmarks, null, 2);
+  }
 
-      const filteredData = {
-        ...initialData,
-        graphData: {
-          nodes,
-          links,
-        },
-        nodeTextures,
-      };
-      return await setData(filteredData);
+  /**
+   * Adds bookmarks exported with `exportBookmarks`. Bookmarks which are
+   * already there are skipped, and invalid bookmarks are dropped.
+   *
+   * @param {string|Array} json - the bookmarks as a JSON string or a list
+   * @param {object} options - (optional) options with the key replace
+   *     (whether to remove the current bookmarks first)
+   * @returns {number} The number of added bookmarks.
+   */
+  function importBookmarks(json, options = {}) {
+    let list;
+    try {
+      list = validBookmarks(typeof json == 'string' ? JSON.parse(json) : json);
+    } catch (error) {
+      console.warn('invalid bookmarks: ' + error.message);
+      return 0;
     }
+    return updateBookmarks(() => {
+      if (options.replace) {
+        bookmarks = [];
+      }
+      let ids = new Set(bookmarks.map(b => b.id));
+      let added = list.filter(b => !ids.has(b.id));
+      bookmarks = bookmarks.concat(added);
+      return added.length;
+    });
   }
 
   /**
-   * Sets the distance to show node labels.
+   * Sets the localStorage key of the bookmarks, e.g. to keep separate
+   * bookmarks for each model, and loads the bookmarks saved under the key.
    *
-   * @param {number} newDistance The new label rendering distance
+   * @param {string} key - the localStorage key (default
+   *     'met-atlas-viewer-bookmarks'), or null to keep the bookmarks only in
+   *     memory
    */
-  function setLabelDistance(newDistance) {
-    labelDistance = newDistance
-    requestAnimationFrame(render);
+  function setBookmarkStorage(key) {
+    bookmarkKey = key;
+    bookmarks = key !== null ? loadBookmarks(key) : bookmarks;
   }
 
   /**
-   * Returns a list of all nodes within the given `distance` from the camera.
+   * Returns a copy of an annotation, so that it can't be changed from
+   * outside.
+   *
+   * @param {object} annotation - the annotation
+   * @returns {object} The copy.
    */
-  function getNodesWithin(distance) {
-    let nodes = [];
-
-    let testCamera = new PerspectiveCamera(fieldOfView, aspect, near, distance);
-    testCamera.position.copy(camera.position);
-    testCamera.up.copy(camera.up);
-    testCamera.lookAt(cameraControls.target);
-    testCamera.updateMatrix();
-    testCamera.updateMatrixWorld();
-    testCamera.matrixWorldInverse.getInverse( testCamera.matrixWorld );
+  function copyAnnotation(annotation) {
+    let copy = Object.assign({}, annotation, {offset: annotation.offset.slice()});
+    if (annotation.link) {
+      copy.link = Object.assign({}, annotation.link);
+    }
+    return copy;
+  }
 
-    let frustum = new Frustum();
-    frustum.setFromProjectionMatrix(
-      new Matrix4().multiplyMatrices(
-        testCamera.projectionMatrix,
-        testCamera.matrixWorldInverse
-      )
-    );
-    nodeInfo.forEach((node,i) => {
-      let p = {x: node.pos[0], y: node.pos[1], z: node.pos[2]};
-      if (frustum.containsPoint(p)) {
-        nodes.push(i)
+  /**
+   * Pins a note to a node or link, shown as a callout next to it.
+   *
+   * @param {string} text - the note
+   * @param {object} target - the annotated node or link, and the callout,
+   *     with the keys node (ID of the node), link (the link as {s, t}, the
+   *     IDs of its source and target nodes, in either order), offset (position of the callout
+   *     relative to the node or link as [x, y] pixels, default [40, -40]) and
+   *     color (CSS color of the callout border and leader line)
+   * @returns {object} The annotation, formatted as {id, text, node, link,
+   *     offset, color, created}, or undefined if the node or link doesn't
+   *     exist.
+   */
+  function addAnnotation(text, target = {}) {
+    if (target.node !== undefined) {
+      if (nodeIds[target.node] === undefined) {
+        console.warn("unknown node id: '" + target.node + "'.");
+        return undefined;
       }
-    });
+    } else if (!target.link || findLink(target.link.s, target.link.t) === undefined) {
+      console.warn('unknown link: ' + JSON.stringify(target.link));
+      return undefined;
+    }
+    let annotation = validAnnotations([Object.assign({}, target, {
+      id: annotationId(),
+      text: String(text)
+    })])[0];
+    annotations.push(annotation);
+    requestAnimationFrame(render);
+    return copyAnnotation(annotation);
+  }
 
-    return nodes;
+  /**
+   * Returns the annotations, oldest first.
+   *
+   * @returns {Array} The annotations, see `addAnnotation`.
+   */
+  function getAnnotations() {
+    return annotations.map(copyAnnotation);
   }
 
   /**
-   * Removes all labels from the scene
+   * Changes the note or callout of an annotation.
+   *
+   * @param {string} id - the annotation ID
+   * @param {object} changes - the keys to change: text, offset or color, see
+   *     `addAnnotation`
+   * @returns {boolean} False if there is no annotation with the ID.
    */
-  function clearLabels() {
-    while(labels.children.length > 0) {
-      labels.remove(labels.children[0]);
+  function updateAnnotation(id, changes) {
+    let annotation = annotations.find(a => a.id == id);
+    if (!annotation) return false;
+    if (changes.text !== undefined) {
+      annotation.text = String(changes.text);
+    }
+    if (Array.isArray(changes.offset) && changes.offset.length == 2) {
+      annotation.offset = changes.offset.map(Number);
     }
+    if (typeof changes.color == 'string') {
+      annotation.color = changes.color;
+    }
+    requestAnimationFrame(render);
+    return true;
   }
 
   /**
-   * Adds a node label back into the scene.
+   * Removes an annotation.
    *
-   * @param {number} node node index of the node to label
+   * @param {string} id - the annotation ID
+   * @returns {boolean} False if there is no annotation with the ID.
    */
-  function labelNode(node) {
-    labels.add( nodeInfo[node].label );
+  function removeAnnotation(id) {
+    let index = annotations.findIndex(a => a.id == id);
+    if (index < 0) return false;
+    annotations.splice(index, 1);
+    requestAnimationFrame(render);
+    return true;
   }
 
   /**
-   * Rendering function.
+   * Removes all annotations.
    */
-  function render() {
-    renderer.setPixelRatio(window.devicePixelRatio);
-    renderer.render( scene, camera );
-    if (showLabels) {
-      let nodes = getNodesWithin(labelDistance);
-      clearLabels();
-      nodes.forEach(node => {
-        labelNode(node);
-      });
-      labelRenderer.setSize( container.offsetWidth, container.offsetHeight );
-      labelRenderer.render( scene, camera );
-    }
+  function clearAnnotations() {
+    annotations = [];
+    requestAnimationFrame(render);
   }
 
   /**
-   * Starts the animation cycle by repeatedly requesting an animation frame and
-   * calling 'render()'.
+   * Returns the annotations as JSON, e.g. to save them to a file.
+   *
+   * @returns {string} The annotations as a JSON string.
    */
-  function animate() {
-    requestAnimationFrame(animate);
-    if (flyTarget.active) {
-      flyUpdate();
+  function exportAnnotations() {
+    return JSON.stringify(annotations, null, 2);
+  }
+
+  /**
+   * Adds annotations exported with `exportAnnotations`. Annotations which
+   * are already there are skipped, and invalid annotations are dropped.
+   * Annotations of nodes and links which aren't in the graph are kept, and
+   * shown when the nodes and links are added.
+   *
+   * @param {string|Array} json - the annotations, as JSON or a list
+   * @param {object} options - (optional) options with the key replace
+   *     (whether to remove the current annotations first)
+   * @returns {number} The number of added annotations.
+   */
+  function importAnnotations(json, options = {}) {
+    let list;
+    try {
+      list = validAnnotations(typeof json == 'string' ? JSON.parse(json) : json);
+    } catch (error) {
+      console.warn('invalid annotations: ' + error.message);
+      return 0;
     }
-    if (cameraControls) {
-      cameraControls.update();
-    } else {
-      render();
+    if (options.replace) {
+      annotations = [];
     }
+    let ids = new Set(annotations.map(a => a.id));
+    let added = list.filter(a => !ids.has(a.id));
+    annotations = annotations.concat(added);
+    requestAnimationFrame(render);
+    return added.length;
   }
 
-  // Start the rendering cycle
-  animate();
-
   /**
-   * Bind callback for when a single node is clicked,
-   * used in the onMouseClick function.
+   * Shows or hides the annotation callouts.
+   *
+   * @param {boolean} visible - whether to show the callouts
    */
-  function setNodeSelectCallback(callback) {
-    nodeSelectCallback = callback;
+  function setAnnotationsVisible(visible) {
+    annotationLayer.setVisible(visible);
+    requestAnimationFrame(render);
   }
 
   /**
-   * Bind callback for when the camera is updated.
+   * Returns the view state: the camera, selection, path highlight, hidden
+   * node type, labels, colors, styles and rendering options. The state can be
+   * saved as JSON (except for style functions) and restored with `setState`
+   * to return to the same view of the same graph data.
+   *
+   * @returns {object} The view state.
    */
-  function setUpdateCameraCallback(callback) {
-    updateCameraCallback = callback;
+  function getState() {
+    let path = null;
+    if (highlightedPath) {
+      let order = map => [...map.keys()].sort((a, b) => map.get(a) - map.get(b));
+      path = {nodes: order(highlightedPath.nodes).map(i => nodeInfo[i].id),
+              links: order(highlightedPath.links)};
+    }
+    return {
+      camera: {
+        position: Object.assign({}, camera.position),
+        up: Object.assign({}, camera.up),
+        target: Object.assign({}, cameraControls.target)
+      },
+      navigationMode: cameraControls instanceof FlyControls ? 'fly' : 'orbit',
+      selection: getSelection(),
+      path: path,
+      hiddenNodeType: hiddenNodeType || null,
+      currency: getCurrencyMetabolites(),
+      subsystemFilter: subsystemFilter ? Object.assign({}, subsystemFilter) : null,
+      degreeFilter: degreeFilter ? {min: degreeFilter.min,
+                                    max: isFinite(degreeFilter.max) ? degreeFilter.max : null} :
+                                   null,
+      hiddenLinkTypes: getHiddenLinkTypes(),
+      isolation: isolation.map(view => ({ids: [...view.ids], label: view.label})),
+      // only selector filters can be saved
+      filters: getFilters().filter(layer => typeof layer.filter === 'string'),
+      labels: {
+        show: showLabels,
+        mode: labelMode,
+        style: Object.assign({}, labelStyle),
+        distance: labelDistance,
+        declutter: declutterLabels,
+        minScreenSize: labelMinScreenSize
+      },
+      highlightDepth: highlightDepth,
+      colors: {
+        nodeDefaultColor: nodeDefaultColor,
+        connectionStartColor: connectionStartColor,
+        connectionEndColor: connectionEndColor,
+        nodeSelectColor: nodeSelectColor,
+        connectionSelectColor: connectionSelectColor,
+        hoverSelectColor: hoverSelectColor,
+        hoverConnectionColor: hoverConnectionColor,
+        pathColor: pathColor,
+        matchColor: matchColor,
+        currentMatchColor: currentMatchColor
+      },
+      background: scene.background ? '#' + scene.background.getHexString() : null,
+      colorVisionMode: colorVisionMode,
+      fog: Object.assign({}, fogOptions),
+      ambientOcclusion: Object.assign({}, ambientOcclusion),
+      levelOfDetail: useLevelOfDetail,
+      occlusionCulling: Object.assign({}, occlusionCulling),
+      particleFlow: Object.assign({}, particleOptions),
+      fluxOverlay: fluxOverlay ? {
+        values: fluxOverlay.values instanceof Map ?
+          Object.fromEntries(fluxOverlay.values) : fluxOverlay.values,
+        options: fluxOverlay.options
+      } : null,
+      expressionOverlay: expressionOverlay ? {
+        values: expressionOverlay.values instanceof Map ?
+          Object.fromEntries(expressionOverlay.values) : expressionOverlay.values,
+        reference: expressionOverlay.reference instanceof Map ?
+          Object.fromEntries(expressionOverlay.reference) : expressionOverlay.reference,
+        options: expressionOverlay.options
+      } : null,
+      smallMultiples: smallMultiples ? {
+        conditions: smallMultiples.conditions.map(c => ({
+          label: c.label,
+          values: c.values instanceof Map ? Object.fromEntries(c.values) : c.values
+        })),
+        options: smallMultiples.options
+      } : null,
+      style: styleRules,
+      nodeSizing: nodeSizing,
+      linkStyle: Object.assign({}, linkStyle),
+      arrowStyle: Object.assign({}, arrowStyle),
+      minimap: minimap.getOptions(),
+      collapsedGroups: collapsed.groups.map(g => Object.assign({}, g)),
+      groups: nodeGroups.map(g => Object.assign({}, g)),
+      annotations: {
+        visible: annotationLayer.isVisible(),
+        items: getAnnotations()
+      }
+    };
   }
 
   /**
-   * Centers camera on a node
+   * Restores a view state returned by `getState`. Keys that are missing from
+   * the state are left as they are.
+   *
+   * @param {object} state - the view state
+   * @returns {Promise} A promise which resolves when the state is restored.
    */
-  function centerNode(node) {
-    let m = midPoint([node.index]);
-    cameraControls.target.copy(m);
-  }
+  async function setState(state) {
+    if (state.hiddenNodeType !== undefined &&
+        (state.hiddenNodeType || undefined) !== hiddenNodeType) {
+      if (hiddenNodeType) {
+        await toggleNodeType(hiddenNodeType);
+      }
+      if (state.hiddenNodeType) {
+        await toggleNodeType(state.hiddenNodeType);
+      }
+    }
+    if (state.currency) {
+      let names = state.currency.names ? state.currency.names.map(String) :
+                                         currency.names;
+      let hidden = state.currency.hidden !== undefined ? !!state.currency.hidden :
+                                                         currency.hidden;
+      let duplicated = state.currency.duplicated !== undefined ?
+        !!state.currency.duplicated && !hidden : currency.duplicated && !hidden;
+      if (hidden != currency.hidden || duplicated != currency.duplicated ||
+          String(names) != String(currency.names)) {
+        currency = {names: names, hidden: hidden, duplicated: duplicated};
+        await showCurrency();
+      }
+    }
+    if (state.subsystemFilter !== undefined &&
+        JSON.stringify(state.subsystemFilter || undefined) != JSON.stringify(subsystemFilter)) {
+      await setSubsystemFilter(state.subsystemFilter ? state.subsystemFilter.subsystems : undefined,
+                               state.subsystemFilter || {});
+    }
+    if (state.degreeFilter !== undefined &&
+        JSON.stringify(degreeRange(state.degreeFilter)) != JSON.stringify(degreeFilter)) {
+      await setDegreeFilter(state.degreeFilter);
+    }
+    if (state.hiddenLinkTypes &&
+        String(state.hiddenLinkTypes.map(String).sort()) != String(getHiddenLinkTypes().sort())) {
+      hiddenLinkTypes = new Set(state.hiddenLinkTypes.map(String));
+      await showLinkTypes();
+    }
+    if (state.filters) {
+      let layers = state.filters.filter(layer => typeof layer.filter === 'string').map(layer =>
+        ({name: String(layer.name), filter: layer.filter,
+          combine: layer.combine == 'or' ? 'or' : 'and', test: filterTest(layer.filter)}))
+        .filter(layer => layer.test);
+      if (JSON.stringify(getFilters()) != JSON.stringify(layers.map(({test, ...layer}) => layer))) {
+        await showFilterLayers(layers);
+      }
+    }
+    if (state.isolation && JSON.stringify(state.isolation) !=
+        JSON.stringify(isolation.map(view => ({ids: [...view.ids], label: view.label})))) {
+      await showIsolation(state.isolation.map(view => ({ids: new Set(view.ids),
+                                                        label: String(view.label)})));
+    }
+    if (state.groups) {
+      nodeGroups = state.groups.map(g => ({id: g.id, nodes: g.nodes, label: g.label,
+                                           color: g.color, opacity: g.opacity}));
+      buildGroupHulls();
+    }
+    if (state.collapsedGroups &&
+        JSON.stringify(state.collapsedGroups) != JSON.stringify(collapsed.groups)) {
+      await showCollapsedGroups(state.collapsedGroups);
+    }
+    if (state.linkStyle) {
+      await setLinkStyle(state.linkStyle);
+    }
+    if (state.arrowStyle) {
+      await setArrowStyle(state.arrowStyle);
+    }
+    if (state.style) {
+      setStyle(state.style);
+    }
+    if (state.nodeSizing !== undefined) {
+      setNodeSizing(state.nodeSizing);
+    }
+    if (state.colors) {
+      setColors(state.colors);
+    }
+    if (state.background) {
+      setBackgroundColor(state.background);
+    }
+    if (state.colorVisionMode) {
+      setColorVisionMode(state.colorVisionMode);
+    }
+    if (state.fog) {
+      setFog(state.fog.enabled, state.fog);
+    }
+    if (state.ambientOcclusion) {
+      setAmbientOcclusion(state.ambientOcclusion.enabled, state.ambientOcclusion);
+    }
+    if (state.levelOfDetail !== undefined) {
+      setLevelOfDetail(state.levelOfDetail);
+    }
+    if (state.occlusionCulling) {
+      setOcclusionCulling(state.occlusionCulling.enabled, state.occlusionCulling);
+    }
+    if (state.fluxOverlay !== undefined) {
+      setFluxOverlay(state.fluxOverlay && state.fluxOverlay.values,
+                     state.fluxOverlay ? state.fluxOverlay.options : {});
+    }
+    if (state.particleFlow) {
+      setParticleFlow(state.particleFlow.enabled, state.particleFlow);
+    }
+    if (state.expressionOverlay && state.expressionOverlay.reference) {
+      setComparisonOverlay(state.expressionOverlay.reference,
+                           state.expressionOverlay.values,
+                           state.expressionOverlay.options);
+    } else if (state.expressionOverlay !== undefined) {
+      setExpressionOverlay(state.expressionOverlay && state.expressionOverlay.values,
+                           state.expressionOverlay ? state.expressionOverlay.options : {});
+    }
+    if (state.smallMultiples !== undefined) {
+      setSmallMultiples(state.smallMultiples && state.smallMultiples.conditions,
+                        state.smallMultiples ? state.smallMultiples.options : {});
+    }
+    if (state.labels) {
+      let labels = state.labels;
+      if (labels.show !== undefined && labels.show !== showLabels) {
+        toggleLabels();
+      }
+      if (labels.mode) {
+        setLabelMode(labels.mode, labels.style || {});
+      }
+      if (labels.distance !== undefined) {
+        setLabelDistance(labels.distance);
+      }
+      if (labels.declutter !== undefined) {
+        setLabelDeclutter(labels.declutter);
+      }
+      if (labels.minScreenSize !== undefined) {
+        setLabelScreenSize(labels.minScreenSize);
+      }
+    }
+    if (state.highlightDepth) {
+      setHighlightDepth(state.highlightDepth);
+    }
+    if (state.minimap) {
+      setMinimap(state.minimap.enabled, state.minimap);
+    }
+    if (state.annotations) {
+      annotations = validAnnotations(state.annotations.items);
+      setAnnotationsVisible(state.annotations.visible !== false);
+    }
+
+    if (state.navigationMode &&
+        state.navigationMode != (cameraControls instanceof FlyControls ? 'fly' : 'orbit')) {
+      setNavigationMode(state.navigationMode);
+    }
+    if (state.camera) {
+      stopTour();
+      stopTraversal();
+      flyTarget.active = false;
+      setCamera(state.camera.position, state.camera.up, state.camera.target);
+    }
 
+    // the selection and path refer to the nodes of the restored graph
+    if (state.selection) {
+      selectNodes(state.selection);
+    }
+    if (state.path === null) {
+      clearPath();
+    } else if (state.path) {
+      let nodes = nodeIndices(state.path.nodes);
+      let links = state.path.links.filter(link => linkInfo[link]);
+      highlightedPath = {
+        nodes: new Map(nodes.map((node, step) => [node, step])),
+        links: new Map(links.map((link, step) => [link, step + 1])),
+        steps: links.length,
+        shown: links.length,
+        start: performance.now()
+      };
+      refreshColors();
+    }
+    requestAnimationFrame(render);
+  }
 
   /**
    * Set background color
@@ -1050,18 +8336,153 @@ function MetAtlasViewer(targetElement) {
   }
 
   // Return a "controller" that we can use to interact with the scene.
-  return {centerNode,
+  const controller = {addAnnotation,
+          addBookmark,
+          addData,
+          centerNode,
+          clearAnnotations,
+          clearDrawing,
+          clearPath,
+          clearMatches,
+          clearSelection,
+          collapseGroup,
+          copyImageToClipboard,
+          createGroup,
+          createLegend,
+          deselect: deselectNodes,
+          detectClusters,
+          dispose,
+          duplicateCurrencyMetabolites,
+          enterVR,
+          exitVR,
+          exportAnnotations,
+          exportBookmarks,
+          expandGroup,
+          expandNode,
+          exportGIF,
+          exportGLTF,
+          exportImage,
+          findPath,
+          fitSelection,
+          focusNode,
+          getAnnotations,
+          getBookmarks,
+          getCamera,
+          getCollapsedGroups,
+          getComponents,
+          getCurrencyMetabolites,
+          getFilters,
+          getEgoNetwork,
+          getGroups,
+          getHiddenLinkTypes,
+          getNavigationHistory,
+          getNode,
+          getSelection,
+          getState,
+          getStats,
+          getSummary,
+          goBack,
+          goForward,
+          goToBookmark,
+          highlightMatches,
+          importAnnotations,
+          importBookmarks,
+          isolate,
+          isVRSupported,
+          loadData,
+          moveGroup,
+          nextMatch,
+          off,
+          on,
+          prevMatch,
+          recordTour,
+          redo,
+          registerColormap,
+          registerNodeShape,
+          removeAnnotation,
+          removeBookmark,
+          removeFilter,
+          removeGroup,
+          removeLegend,
+          removePlugin,
+          renameBookmark,
+          restoreIsolation,
+          search,
+          setAmbientOcclusion,
+          setAnnotationsVisible,
+          setAnnouncements,
+          setAntialiasing,
+          setArrowStyle,
           setBackgroundColor,
+          setBloom,
+          setBookmarkStorage,
+          setBoxSelection,
+          select: selectNodes,
           selectBy,
           setCameraControls,
           setColors,
+          setColorVisionMode,
+          setComparisonOverlay,
+          setControlBindings,
+          setCurrencyMetabolites,
           setData,
+          setDebugOverlay,
+          setDegreeFilter,
+          setDrawingTool,
+          setExpressionOverlay,
+          setExpandCallback,
+          setFilter,
+          setFluxOverlay,
+          setFog,
+          setGroupCollapsed,
+          setHighlightDepth,
+          setHover,
           setCamera,
+          setNodeIcons,
+          setNodeScreenSize,
+          setNodeSizing,
+          setParticleFlow,
+          setReducedMotion,
+          setSelectionMode,
+          setSmallMultiples,
+          setState,
+          setStereo,
+          setStyle,
+          setSubsystemFilter,
+          setSummary,
+          setTooltip,
+          setTheme,
+          setTimeline,
           setNodeSelectCallback,
           setUpdateCameraCallback,
+          showComponent,
+          showDiff,
+          startRecording,
+          stopRecording,
+          stopTour,
+          stopTraversal,
+          setLabelDeclutter,
           setLabelDistance,
+          setLabelMode,
+          setLabelScreenSize,
+          setLevelOfDetail,
+          setLinkStyle,
+          setMinimap,
+          setNavigationMode,
+          setOcclusionCulling,
+          suggest,
+          toDataURL,
+          tour,
+          traversePath,
+          toggleCurrencyMetabolites,
           toggleLabels,
-          toggleNodeType};
+          toggleLinkType,
+          toggleNodeType,
+          undo,
+          updateAnnotation,
+          updateGroup,
+          use};
+  return controller;
 }
 
 export { MetAtlasViewer };
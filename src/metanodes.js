@@ -0,0 +1,143 @@
+/**
+ * @file This file contains the collapsing of node groups into metanodes in
+ * the Metabolic Atlas 3D Viewer, to make whole-cell models manageable. All
+ * nodes of a group, e.g. of a compartment or subsystem, are replaced by one
+ * large metanode at their center. Links between the group and other nodes
+ * are merged into one link per neighbor and direction, with the number of
+ * merged links as `count`, and links within the group are left out.
+ *
+ * A collapsed group is formatted as {attribute, value, label, color}, where
+ * the nodes whose `attribute` is or contains `value` are in the group, or as
+ * {id, nodes, label, color} for groups of given nodes, see `createGroup` of
+ * the viewer. The metanode data has the extra key metanode, formatted as
+ * {attribute, value, count, scale} or {group, count, scale}, where group is
+ * the group ID, count is the number of collapsed nodes and scale the node
+ * size.
+ */
+
+/**
+ * Returns the ID of the metanode of a group.
+ *
+ * @param {string} attribute - the node attribute of the group
+ * @param {*} value - the attribute value of the group
+ * @returns {string} The metanode ID.
+ */
+function metanodeId(attribute, value) {
+  return 'metanode:' + attribute + ':' + value;
+}
+
+/**
+ * Returns the ID of the metanode of a collapsed group.
+ *
+ * @param {Object} group - the group
+ * @returns {string} The metanode ID.
+ */
+function collapsedId(group) {
+  return group.nodes ? 'metanode:' + group.id : metanodeId(group.attribute, group.value);
+}
+
+/**
+ * Returns whether a node is in a group. Attributes holding lists, like the
+ * subsystems of a reaction, put the node in the group of every value.
+ *
+ * @param {Object} node - the node data
+ * @param {Object} group - the group
+ */
+function inGroup(node, group) {
+  let value = node[group.attribute];
+  if (value === undefined || value === null) return false;
+  return [].concat(value).some(v => String(v) == String(group.value));
+}
+
+/**
+ * Creates the metanode of a group, at the center of its nodes and colored
+ * with their average color.
+ *
+ * @param {Object} group - the group
+ * @param {Array} members - the node data of the group
+ * @returns {Object} The metanode data.
+ */
+function makeMetanode(group, members) {
+  let pos = [0, 1, 2].map(k =>
+    members.reduce((sum, node) => sum + node.pos[k], 0) / members.length);
+  let colored = members.filter(node => node.color);
+  let color = group.color || (colored.length > 0 ? [0, 1, 2].map(k => Math.round(
+    colored.reduce((sum, node) => sum + node.color[k], 0) / colored.length)) : undefined);
+  let metanode = {
+    id: collapsedId(group),
+    n: group.label || String(group.nodes ? group.id : group.value) + ' (' + members.length + ')',
+    g: 'metanode',
+    pos: pos,
+    metanode: {count: members.length,
+               scale: Math.max(2, Math.min(8, Math.sqrt(members.length)))}
+  };
+  if (group.nodes) {
+    metanode.metanode.group = group.id;
+  } else {
+    Object.assign(metanode.metanode, {attribute: group.attribute, value: group.value});
+    metanode[group.attribute] = group.value;
+  }
+  if (color) {
+    metanode.color = color;
+  }
+  return metanode;
+}
+
+/**
+ * Collapses groups of a graph into metanodes. A node in several groups is
+ * collapsed into the first of them.
+ *
+ * @param {Object} graphData - the graph data formatted as {nodes, links}
+ * @param {Array} groups - the groups to collapse
+ * @returns {Object} The graph data with metanodes, formatted as {nodes,
+ *     links}.
+ */
+function collapseGraph(graphData, groups) {
+  if (groups.length == 0) return graphData;
+
+  // the metanode of each collapsed node
+  let owner = new Map();
+  let members = groups.map(() => []);
+  let given = groups.map(group => group.nodes ? new Set(group.nodes) : undefined);
+  graphData.nodes.forEach(node => {
+    let k = groups.findIndex((group, j) =>
+      given[j] ? given[j].has(node.id) : inGroup(node, group));
+    if (k < 0) return;
+    owner.set(node.id, collapsedId(groups[k]));
+    members[k].push(node);
+  });
+  let nodes = graphData.nodes.filter(node => !owner.has(node.id));
+  groups.forEach((group, k) => {
+    if (members[k].length > 0) {
+      nodes.push(makeMetanode(group, members[k]));
+    }
+  });
+
+  let links = [];
+  let merged = new Map();
+  graphData.links.forEach(link => {
+    let s = owner.get(link.s) || link.s;
+    let t = owner.get(link.t) || link.t;
+    if (s == link.s && t == link.t) {
+      links.push(link);
+      return;
+    }
+    if (s == t) return;
+    let key = s + '\t' + t;
+    if (!merged.has(key)) {
+      let aggregate = {s: s, t: t, type: link.type, count: 0, reversible: false};
+      merged.set(key, aggregate);
+      links.push(aggregate);
+    }
+    let aggregate = merged.get(key);
+    aggregate.count += 1;
+    aggregate.reversible = aggregate.reversible || !!link.reversible;
+  });
+  // links merging many links are drawn wider
+  merged.forEach(link => {
+    link.width = 1 + Math.log2(link.count);
+  });
+  return {nodes: nodes, links: links};
+}
+
+export { collapseGraph, collapsedId, inGroup, metanodeId };
@@ -0,0 +1,304 @@
+/**
+ * @file This file contains the minimap of the Metabolic Atlas 3D Viewer, a
+ * small overview panel which shows the whole network from a fixed direction,
+ * with the camera and its field of view and the selected nodes marked, to
+ * keep users oriented in large models.
+ */
+
+import { Vector3 } from 'three';
+
+// The plane axes of each projection, as [axis, sign], so that the first axis
+// points right and the second down on the minimap
+const projections = {
+  top: [[0, 1], [2, 1]],
+  front: [[0, 1], [1, -1]],
+  side: [[2, -1], [1, -1]],
+};
+
+const padding = 8;
+
+/**
+ * Creates a minimap panel in a corner of the viewer container.
+ *
+ * @param {Object} container - the viewer container element
+ * @param {Function} onNavigate - called with the clicked point as [u, v]
+ *     plane coordinates and the projection, see `planeToWorld`
+ * @returns {Object} An object with functions to configure and draw the
+ *     minimap.
+ */
+function Minimap(container, onNavigate) {
+  let canvas = document.createElement('canvas');
+  canvas.className = 'met-atlas-minimap';
+  canvas.style.position = 'absolute';
+  canvas.style.cursor = 'crosshair';
+  canvas.hidden = true;
+  container.appendChild(canvas);
+
+  let options = {
+    projection: 'top',
+    size: 160,
+    corner: 'bottom-right',
+    background: 'rgba(0,0,0,0.5)',
+    frustumColor: 'rgba(255,255,255,0.9)',
+    selectionColor: [255, 0, 0],
+    nodeSize: 1.5,
+  };
+  // the network drawn without the camera and selection, redrawn only when
+  // the nodes change
+  let layer = document.createElement('canvas');
+  let layerValid = false;
+  // the world bounds in plane coordinates, and the scale to minimap pixels
+  let bounds;
+
+  canvas.addEventListener('pointerdown', onPointerDown, false);
+
+  /**
+   * Projects a world position onto the minimap plane.
+   *
+   * @param {Array} pos - the position as [x, y, z]
+   * @returns {Array} The plane coordinates as [u, v].
+   */
+  function project(pos) {
+    let axes = projections[options.projection];
+    return [pos[axes[0][0]] * axes[0][1], pos[axes[1][0]] * axes[1][1]];
+  }
+
+  /**
+   * Converts plane coordinates to minimap pixels.
+   *
+   * @param {Array} uv - the plane coordinates
+   */
+  function toPixels(uv) {
+    return [padding + (uv[0] - bounds.u) * bounds.scale + bounds.offsetU,
+            padding + (uv[1] - bounds.v) * bounds.scale + bounds.offsetV];
+  }
+
+  /**
+   * Fits the projected node positions into the minimap, keeping the aspect
+   * ratio.
+   *
+   * @param {Array} positions - the node positions
+   */
+  function fitBounds(positions) {
+    let min = [Infinity, Infinity];
+    let max = [-Infinity, -Infinity];
+    positions.forEach(pos => {
+      let uv = project(pos);
+      for (let k = 0; k < 2; k++) {
+        min[k] = Math.min(min[k], uv[k]);
+        max[k] = Math.max(max[k], uv[k]);
+      }
+    });
+    if (positions.length == 0) {
+      min = [-1, -1];
+      max = [1, 1];
+    }
+    let inner = options.size - padding * 2;
+    let extent = Math.max(max[0] - min[0], max[1] - min[1], 1e-6);
+    let scale = inner / extent;
+    bounds = {u: min[0],
+              v: min[1],
+              scale: scale,
+              offsetU: (inner - (max[0] - min[0]) * scale) / 2,
+              offsetV: (inner - (max[1] - min[1]) * scale) / 2};
+  }
+
+  /**
+   * Draws the nodes on the cached layer.
+   *
+   * @param {Object} view - see `draw`
+   */
+  function drawLayer(view) {
+    let ratio = window.devicePixelRatio || 1;
+    layer.width = Math.round(options.size * ratio);
+    layer.height = Math.round(options.size * ratio);
+    let ctx = layer.getContext('2d');
+    ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+    if (options.background) {
+      ctx.fillStyle = options.background;
+      ctx.fillRect(0, 0, options.size, options.size);
+    }
+    fitBounds(view.nodes.map(node => node.pos));
+    let size = options.nodeSize;
+    view.nodes.forEach((node, i) => {
+      if (!view.visible(i)) return;
+      let p = toPixels(project(node.pos));
+      ctx.fillStyle = 'rgb(' + node.color.join(',') + ')';
+      ctx.fillRect(p[0] - size / 2, p[1] - size / 2, size, size);
+    });
+    layerValid = true;
+  }
+
+  /**
+   * Draws the outline of the camera's field of view, from the camera
+   * position out to the depth of the camera target.
+   *
+   * @param {Object} ctx - the canvas context
+   * @param {Object} camera - the three-js camera
+   * @param {Object} target - the camera target
+   */
+  function drawFrustum(ctx, camera, target) {
+    let depth = camera.position.distanceTo(target);
+    let eye = toPixels(project(camera.position.toArray()));
+    let corners = [[-1, -1], [1, -1], [1, 1], [-1, 1]].map(([x, y]) => {
+      let ray = new Vector3(x, y, 1).unproject(camera).sub(camera.position).normalize();
+      // scale the ray so that the corners lie in the plane of the target
+      let forward = camera.getWorldDirection(new Vector3());
+      let t = depth / Math.max(ray.dot(forward), 1e-6);
+      return toPixels(project(camera.position.clone().addScaledVector(ray, t).toArray()));
+    });
+
+    ctx.strokeStyle = options.frustumColor;
+    ctx.fillStyle = options.frustumColor;
+    ctx.lineWidth = 1;
+    ctx.beginPath();
+    corners.forEach(corner => {
+      ctx.moveTo(eye[0], eye[1]);
+      ctx.lineTo(corner[0], corner[1]);
+    });
+    ctx.moveTo(corners[3][0], corners[3][1]);
+    corners.forEach(corner => ctx.lineTo(corner[0], corner[1]));
+    ctx.stroke();
+
+    let center = toPixels(project(target.toArray()));
+    ctx.beginPath();
+    ctx.arc(eye[0], eye[1], 3, 0, Math.PI * 2);
+    ctx.fill();
+    ctx.beginPath();
+    ctx.moveTo(center[0] - 3, center[1]);
+    ctx.lineTo(center[0] + 3, center[1]);
+    ctx.moveTo(center[0], center[1] - 3);
+    ctx.lineTo(center[0], center[1] + 3);
+    ctx.stroke();
+  }
+
+  /**
+   * Draws the minimap.
+   *
+   * @param {Object} view - what to draw, with the keys nodes (the nodes,
+   *     with the keys pos as [x, y, z] and color as [r, g, b]), visible
+   *     (function of a node index returning whether the node is shown),
+   *     selected (the selected node indices), camera and target
+   *     (the camera target as a three-js vector)
+   */
+  function draw(view) {
+    if (canvas.hidden) return;
+    if (!layerValid) {
+      drawLayer(view);
+    }
+    let ratio = window.devicePixelRatio || 1;
+    if (canvas.width != layer.width || canvas.height != layer.height) {
+      canvas.width = layer.width;
+      canvas.height = layer.height;
+    }
+    let ctx = canvas.getContext('2d');
+    ctx.setTransform(1, 0, 0, 1, 0, 0);
+    ctx.clearRect(0, 0, canvas.width, canvas.height);
+    ctx.drawImage(layer, 0, 0);
+    ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+
+    ctx.fillStyle = 'rgb(' + options.selectionColor.join(',') + ')';
+    let size = options.nodeSize + 2;
+    view.selected.forEach(i => {
+      let p = toPixels(project(view.nodes[i].pos));
+      ctx.fillRect(p[0] - size / 2, p[1] - size / 2, size, size);
+    });
+
+    ctx.save();
+    ctx.beginPath();
+    ctx.rect(0, 0, options.size, options.size);
+    ctx.clip();
+    drawFrustum(ctx, view.camera, view.target);
+    ctx.restore();
+  }
+
+  /**
+   * Moves the panel to its corner, and sizes it.
+   */
+  function place() {
+    canvas.style.width = options.size + 'px';
+    canvas.style.height = options.size + 'px';
+    let [vertical, horizontal] = options.corner.split('-');
+    canvas.style.top = vertical == 'top' ? padding + 'px' : '';
+    canvas.style.bottom = vertical == 'bottom' ? padding + 'px' : '';
+    canvas.style.left = horizontal == 'left' ? padding + 'px' : '';
+    canvas.style.right = horizontal == 'right' ? padding + 'px' : '';
+  }
+
+  /**
+   * Shows or hides the minimap, and sets its options.
+   *
+   * @param {boolean} enabled - whether to show the minimap
+   * @param {object} settings - (optional) minimap options, see
+   *     `setMinimap` of the viewer
+   */
+  function setOptions(enabled, settings = {}) {
+    if (settings.projection && !projections[settings.projection]) {
+      console.warn("unknown minimap projection: '" + settings.projection + "'.");
+      settings = Object.assign({}, settings, {projection: options.projection});
+    }
+    Object.assign(options, settings);
+    delete options.enabled;
+    canvas.hidden = !enabled;
+    place();
+    layerValid = false;
+  }
+
+  /**
+   * Returns the minimap options, and whether it's shown.
+   */
+  function getOptions() {
+    return Object.assign({}, options, {enabled: !canvas.hidden});
+  }
+
+  /**
+   * Marks the nodes as changed, so that they are redrawn.
+   */
+  function invalidate() {
+    layerValid = false;
+  }
+
+  /**
+   * Calls the navigate callback with the clicked plane coordinates.
+   *
+   * @param {Object} event - the pointer event
+   */
+  function onPointerDown(event) {
+    if (!bounds || event.button !== 0) return;
+    event.preventDefault();
+    event.stopPropagation();
+    let rect = canvas.getBoundingClientRect();
+    let x = event.clientX - rect.left - padding - bounds.offsetU;
+    let y = event.clientY - rect.top - padding - bounds.offsetV;
+    onNavigate([bounds.u + x / bounds.scale, bounds.v + y / bounds.scale],
+               options.projection);
+  }
+
+  /**
+   * Removes the minimap from the container.
+   */
+  function dispose() {
+    canvas.removeEventListener('pointerdown', onPointerDown, false);
+    canvas.remove();
+  }
+
+  return {dispose, draw, getOptions, invalidate, setOptions};
+}
+
+/**
+ * Moves a world position to the given plane coordinates of a projection,
+ * keeping its depth along the projection direction.
+ *
+ * @param {Array} uv - the plane coordinates as [u, v]
+ * @param {string} projection - the projection, 'top', 'front' or 'side'
+ * @param {Object} pos - the three-js vector to move
+ * @returns {Object} The moved vector.
+ */
+function planeToWorld(uv, projection, pos) {
+  let axes = projections[projection];
+  pos.setComponent(axes[0][0], uv[0] * axes[0][1]);
+  pos.setComponent(axes[1][0], uv[1] * axes[1][1]);
+  return pos;
+}
+
+export { Minimap, planeToWorld };
@@ -0,0 +1,66 @@
+/**
+ * @file This file contains the network diff of the Metabolic Atlas 3D
+ * Viewer, which merges two versions of a model into one graph for curation
+ * reviews, see `showDiff` of the viewer. Every node and link of the merged
+ * graph is a copy with the extra keys diff ('added', 'removed', 'changed'
+ * or 'unchanged') and, for changed elements, changes, the list of changed
+ * attributes. Links are matched by their start and end nodes, so changed
+ * reactants of a reaction show as added and removed links.
+ */
+
+/**
+ * Returns whether two attribute values are equal, comparing lists and
+ * objects by value.
+ *
+ * @param {*} a - the first value
+ * @param {*} b - the second value
+ */
+function sameValue(a, b) {
+  return a === b || JSON.stringify(a) === JSON.stringify(b);
+}
+
+/**
+ * Returns the attributes which differ between two versions of an element.
+ *
+ * @param {Object} before - the old version
+ * @param {Object} after - the new version
+ * @param {Set} ignored - the attributes to leave out
+ * @returns {Array} The names of the changed attributes.
+ */
+function changedAttributes(before, after, ignored) {
+  let keys = new Set(Object.keys(before).concat(Object.keys(after)));
+  return [...keys].filter(key => !ignored.has(key) && !sameValue(before[key], after[key]));
+}
+
+/**
+ * Merges two versions of a graph and marks the differences. The merged
+ * graph has the new versions of the elements, and the removed elements
+ * where they were in the old graph.
+ *
+ * @param {Object} before - the old graph data, formatted as {nodes, links}
+ * @param {Object} after - the new graph data, formatted as {nodes, links}
+ * @param {object} options - (optional) diff options with the key ignore,
+ *     the attributes which don't count as changes (default ['pos'])
+ * @returns {Object} The merged graph data, formatted as {nodes, links}.
+ */
+function diffGraphs(before, after, options = {}) {
+  let ignored = new Set(options.ignore || ['pos']);
+  const mark = (element, diff, changes) => Object.assign({}, element, diff == 'changed' ?
+    {diff: diff, changes: changes} : {diff: diff});
+  const merge = (oldElements, newElements, key) => {
+    let old = new Map(oldElements.map(element => [key(element), element]));
+    let merged = newElements.map(element => {
+      let previous = old.get(key(element));
+      if (!previous) return mark(element, 'added');
+      let changes = changedAttributes(previous, element, ignored);
+      return mark(element, changes.length > 0 ? 'changed' : 'unchanged', changes);
+    });
+    let current = new Set(newElements.map(key));
+    return merged.concat(oldElements.filter(element => !current.has(key(element)))
+      .map(element => mark(element, 'removed')));
+  };
+  return {nodes: merge(before.nodes, after.nodes, node => node.id),
+          links: merge(before.links, after.links, link => link.s + '\t' + link.t)};
+}
+
+export { diffGraphs };
@@ -0,0 +1,63 @@
+/**
+ * @file This file contains the hulls of user-defined node groups in the
+ * Metabolic Atlas 3D Viewer, see `createGroup` of the viewer. A group is
+ * drawn as a translucent convex hull around its nodes, padded so that the
+ * nodes are inside it, and groups of one to three nodes still get a solid
+ * hull. A group is formatted as:
+ *
+ *   {id, nodes, label, color, opacity}
+ *
+ * where nodes is the list of node IDs, color is [r, g, b] and opacity the
+ * opacity of the hull.
+ */
+
+import { DoubleSide, Mesh, MeshBasicMaterial, Vector3 } from 'three';
+import { ConvexGeometry } from 'three/examples/jsm/geometries/ConvexGeometry.js';
+
+// the directions the node positions are padded in, along the axes and
+// diagonals
+const directions = [];
+[-1, 0, 1].forEach(x => [-1, 0, 1].forEach(y => [-1, 0, 1].forEach(z => {
+  if ((x != 0 && y != 0 && z != 0) || Math.abs(x) + Math.abs(y) + Math.abs(z) == 1) {
+    directions.push(new Vector3(x, y, z).normalize());
+  }
+})));
+
+/**
+ * Creates a unique group ID.
+ *
+ * @returns {string} The ID.
+ */
+function groupId() {
+  return 'group-' + Date.now().toString(36) + Math.random().toString(36).slice(2, 6);
+}
+
+/**
+ * Creates the hull mesh of a group.
+ *
+ * @param {Array} points - the node positions as [x, y, z]
+ * @param {number} padding - the distance from the nodes to the hull
+ * @param {Object} group - the group, for its color and opacity
+ * @returns {Object} A three-js Mesh.
+ */
+function makeHullMesh(points, padding, group) {
+  let padded = [];
+  points.forEach(point => {
+    let center = new Vector3().fromArray(point);
+    directions.forEach(direction => {
+      padded.push(center.clone().addScaledVector(direction, padding));
+    });
+  });
+  let material = new MeshBasicMaterial({
+    color: (group.color[0] << 16) + (group.color[1] << 8) + group.color[2],
+    transparent: true,
+    opacity: group.opacity,
+    depthWrite: false,
+    side: DoubleSide
+  });
+  let mesh = new Mesh(new ConvexGeometry(padded), material);
+  mesh.userData.group = group.id;
+  return mesh;
+}
+
+export { groupId, makeHullMesh };
@@ -0,0 +1,132 @@
+/**
+ * @file This file contains the shader modifications for the node sprite
+ * materials of the Metabolic Atlas 3D Viewer. The modified materials read a
+ * few extra per-node attributes:
+ *
+ *  - nodeScale: multiplies the point size, points smaller than the
+ *    `minPointSize` uniform (in device pixels) are not drawn
+ *  - nodeOpacity: multiplies the alpha (nodes below 0.01 are not drawn)
+ *  - culled: nodes above 0.5 are not drawn (occlusion culling)
+ *  - meshed: nodes above 0.5 are not drawn as sprites, as they are drawn as
+ *    geometry (level of detail). Picking ignores it.
+ *  - occlusion: multiplies the color (baked ambient occlusion)
+ *  - secondColor: second color of the sprite, used depending on its alpha:
+ *    above 0.75 the right half of the sprite has the second color, for
+ *    nodes that show two values side by side, and between 0.25 and 0.75 the
+ *    sprite is hatched with the second color
+ *
+ * If the scene has fog, the nodes are also desaturated with the fog depth by
+ * the amount given in the `desaturation` uniform.
+ *
+ * The link line material reads the culled attribute too, which is set for
+ * the vertices of links to culled nodes.
+ */
+
+/**
+ * Modifies a points material to use the per-node attributes.
+ *
+ * @param {Object} material - a three-js PointsMaterial
+ * @param {Object} desaturation - (optional) uniform formatted as
+ *     {value: <amount between 0 and 1>}, which can be shared between
+ *     materials.
+ * @param {boolean} picking - (optional) if true, only size and visibility are
+ *     modified, so that the index colors used for picking stay exact.
+ * @param {Object} minPointSize - (optional) uniform formatted as
+ *     {value: <pixels>}, which can be shared between materials.
+ */
+function extendNodeMaterial(material, desaturation = {value: 0}, picking = false,
+                            minPointSize = {value: 0}) {
+  material.onBeforeCompile = function (shader) {
+    shader.uniforms.desaturation = desaturation;
+    shader.uniforms.minPointSize = minPointSize;
+    shader.vertexShader = shader.vertexShader
+      .replace('#include <common>', [
+        '#include <common>',
+        'uniform float minPointSize;',
+        'attribute float occlusion;',
+        'attribute float nodeScale;',
+        'attribute float nodeOpacity;',
+        'attribute float culled;',
+        picking ? '' : 'attribute float meshed;',
+        picking ? '' : 'attribute vec4 secondColor;',
+        picking ? '' : 'varying vec4 vSecondColor;',
+        'varying float vOcclusion;',
+        'varying float vNodeOpacity;'
+      ].join('\n'))
+      .replace('#include <color_vertex>', [
+        '#include <color_vertex>',
+        picking ? '' : 'vSecondColor = secondColor;',
+        'vOcclusion = occlusion;',
+        'vNodeOpacity = nodeOpacity;'
+      ].join('\n'))
+      .replace('#include <logdepthbuf_vertex>', [
+        'gl_PointSize *= nodeScale;',
+        // move culled points outside of the clip volume
+        'if ( culled > 0.5 || gl_PointSize < minPointSize' +
+          (picking ? '' : ' || meshed > 0.5') + ' ) gl_Position = vec4( 2.0, 2.0, 2.0, 1.0 );',
+        '#include <logdepthbuf_vertex>'
+      ].join('\n'));
+
+    let fragment = [
+      'if ( vNodeOpacity < 0.01 ) discard;'
+    ];
+    if (!picking) {
+      fragment = fragment.concat([
+        'gl_FragColor.rgb *= vOcclusion;',
+        'gl_FragColor.a *= vNodeOpacity;',
+        '#ifdef USE_FOG',
+        '  float grey = dot( gl_FragColor.rgb, vec3( 0.299, 0.587, 0.114 ) );',
+        '  float fade = desaturation * smoothstep( fogNear, fogFar, fogDepth );',
+        '  gl_FragColor.rgb = mix( gl_FragColor.rgb, vec3( grey ), fade );',
+        '#endif'
+      ]);
+    }
+    shader.fragmentShader = shader.fragmentShader
+      .replace('#include <common>', [
+        '#include <common>',
+        picking ? '' : 'varying vec4 vSecondColor;',
+        'varying float vOcclusion;',
+        'varying float vNodeOpacity;',
+        'uniform float desaturation;'
+      ].join('\n'))
+      .replace('#include <fog_fragment>',
+               fragment.join('\n') + '\n#include <fog_fragment>');
+    if (!picking) {
+      shader.fragmentShader = shader.fragmentShader
+        .replace('#include <color_fragment>', [
+          '#ifdef USE_COLOR',
+          '  bool split = vSecondColor.a > 0.75 && gl_PointCoord.x > 0.5;',
+          '  bool hatch = vSecondColor.a > 0.25 && vSecondColor.a <= 0.75 &&',
+          '               fract( ( gl_PointCoord.x + gl_PointCoord.y ) * 3.0 ) < 0.5;',
+          '  diffuseColor.rgb *= split || hatch ? vSecondColor.rgb : vColor;',
+          '#endif'
+        ].join('\n'));
+    }
+  };
+  // make sure that picking and display materials get different programs
+  material.customProgramCacheKey = () => picking ? 'node-picking' : 'node';
+}
+
+/**
+ * Modifies a line material to hide the vertices whose culled attribute is
+ * above 0.5.
+ *
+ * @param {Object} material - a three-js LineBasicMaterial
+ */
+function extendLinkMaterial(material) {
+  material.onBeforeCompile = function (shader) {
+    shader.vertexShader = shader.vertexShader
+      .replace('#include <common>', [
+        '#include <common>',
+        'attribute float culled;'
+      ].join('\n'))
+      .replace('#include <logdepthbuf_vertex>', [
+        // move culled vertices outside of the clip volume
+        'if ( culled > 0.5 ) gl_Position = vec4( 2.0, 2.0, 2.0, 1.0 );',
+        '#include <logdepthbuf_vertex>'
+      ].join('\n'));
+  };
+  material.customProgramCacheKey = () => 'link';
+}
+
+export { extendLinkMaterial, extendNodeMaterial };
@@ -0,0 +1,180 @@
+/**
+ * @file This file contains the occlusion culling of the Metabolic Atlas 3D
+ * Viewer. Nodes that are large on screen are drawn into a coarse depth
+ * buffer on the CPU, and the cells of the octree are tested against it, so
+ * that the nodes of dense interior regions hidden behind the foreground are
+ * skipped instead of using fill rate. The test is conservative: only nodes
+ * whose whole cell is behind the foreground are culled. Links to culled
+ * nodes are hidden by the viewer.
+ */
+
+import { Matrix4, Vector3 } from 'three';
+
+/**
+ * Creates an occlusion culler.
+ *
+ * @param {number} resolution - (optional) number of depth buffer columns
+ *     (default 64), the rows follow the aspect ratio of the viewport
+ * @returns {Object} An object with a function to update the culled nodes.
+ */
+function OcclusionCulling(resolution = 64) {
+  let depths = new Float32Array(0);
+  let columns = 0;
+  let rows = 0;
+
+  // reusable objects for the per-frame update
+  const viewProjection = new Matrix4();
+  const point = new Vector3();
+  const view = new Vector3();
+
+  /**
+   * Returns the depth of a position in front of the camera.
+   *
+   * @param {Object} camera - the camera
+   * @param {Array} pos - the position as [x, y, z]
+   */
+  function viewDepth(camera, pos) {
+    return -view.set(pos[0], pos[1], pos[2]).applyMatrix4(camera.matrixWorldInverse).z;
+  }
+
+  /**
+   * Converts a position to depth buffer coordinates.
+   *
+   * @param {Array} pos - the position as [x, y, z]
+   * @returns {Array} The coordinates as [column, row].
+   */
+  function toCells(pos) {
+    point.set(pos[0], pos[1], pos[2]).applyMatrix4(viewProjection);
+    return [(point.x + 1) / 2 * columns, (1 - point.y) / 2 * rows];
+  }
+
+  /**
+   * Draws the occluders into the depth buffer. Each occluder covers the
+   * cells that lie completely inside the opaque square at the center of its
+   * sprite, at most a square of half its size, which fits inside round
+   * sprites with a margin.
+   *
+   * @param {Object} camera - the camera
+   * @param {number} cellScale - depth buffer cells per graph unit at
+   *     distance 1 from the camera
+   * @param {Array} occluders - the occluders, formatted as [{pos, radius,
+   *     cover}], see `update`
+   */
+  function drawOccluders(camera, cellScale, occluders) {
+    depths.fill(Infinity);
+    occluders.forEach(({pos, radius, cover = 0.5}) => {
+      let depth = viewDepth(camera, pos);
+      if (depth <= camera.near) return;
+      let [x, y] = toCells(pos);
+      let half = Math.min(0.5, cover) * radius * cellScale / depth;
+      let x0 = Math.max(0, Math.ceil(x - half));
+      let x1 = Math.min(columns, Math.floor(x + half));
+      let y0 = Math.max(0, Math.ceil(y - half));
+      let y1 = Math.min(rows, Math.floor(y + half));
+      // the back of the node, in case it's drawn as geometry
+      let far = depth + radius;
+      for (let row = y0; row < y1; row++) {
+        for (let column = x0; column < x1; column++) {
+          let k = row * columns + column;
+          if (far < depths[k]) {
+            depths[k] = far;
+          }
+        }
+      }
+    });
+  }
+
+  /**
+   * Tests whether a box is behind the depth buffer everywhere it's on
+   * screen.
+   *
+   * @param {Object} camera - the camera
+   * @param {Array} center - the box center as [x, y, z]
+   * @param {number} half - half of the box side
+   */
+  function isOccluded(camera, center, half) {
+    let nearest = Infinity;
+    let min = [Infinity, Infinity];
+    let max = [-Infinity, -Infinity];
+    for (let k = 0; k < 8; k++) {
+      let corner = [center[0] + (k & 1 ? half : -half),
+                    center[1] + (k & 2 ? half : -half),
+                    center[2] + (k & 4 ? half : -half)];
+      let depth = viewDepth(camera, corner);
+      // boxes reaching behind the camera are never culled
+      if (depth <= camera.near) return false;
+      nearest = Math.min(nearest, depth);
+      let cell = toCells(corner);
+      min = [Math.min(min[0], cell[0]), Math.min(min[1], cell[1])];
+      max = [Math.max(max[0], cell[0]), Math.max(max[1], cell[1])];
+    }
+    let x0 = Math.max(0, Math.floor(min[0]));
+    let x1 = Math.min(columns, Math.ceil(max[0]));
+    let y0 = Math.max(0, Math.floor(min[1]));
+    let y1 = Math.min(rows, Math.ceil(max[1]));
+    // boxes outside of the view are clipped anyway
+    if (x0 >= x1 || y0 >= y1) return false;
+    for (let row = y0; row < y1; row++) {
+      for (let column = x0; column < x1; column++) {
+        if (depths[row * columns + column] >= nearest) return false;
+      }
+    }
+    return true;
+  }
+
+  /**
+   * Marks the nodes of an octree cell and its descendants as culled.
+   *
+   * @param {Object} cell - the cell
+   * @param {Array} culled - the culled flag of each node
+   */
+  function cullCell(cell, culled) {
+    if (cell.children) {
+      cell.children.forEach(child => cullCell(child, culled));
+    } else {
+      cell.items.forEach(i => { culled[i] = 1; });
+    }
+  }
+
+  /**
+   * Finds the nodes hidden behind the foreground.
+   *
+   * @param {Object} camera - the camera used for rendering
+   * @param {number} width - width of the viewport in pixels
+   * @param {number} height - height of the viewport in pixels
+   * @param {Object} octree - the octree of the node positions
+   * @param {Array} occluders - the nodes which hide what's behind them,
+   *     formatted as [{pos, radius, cover}], where cover is the half side of
+   *     the opaque square at the center of the sprite relative to the
+   *     radius (default 0.5)
+   * @param {number} maxRadius - the largest radius of any node
+   * @param {Array} culled - the culled flag of each node, set to 1 for the
+   *     hidden nodes and 0 for the others
+   * @returns {number} The number of culled nodes.
+   */
+  function update(camera, width, height, octree, occluders, maxRadius, culled) {
+    columns = resolution;
+    rows = Math.max(1, Math.round(resolution * height / Math.max(1, width)));
+    if (depths.length != columns * rows) {
+      depths = new Float32Array(columns * rows);
+    }
+    camera.updateMatrixWorld();
+    viewProjection.multiplyMatrices(camera.projectionMatrix, camera.matrixWorldInverse);
+    let cellScale = rows / (2 * Math.tan(camera.fov * Math.PI / 360));
+
+    culled.fill(0);
+    drawOccluders(camera, cellScale, occluders);
+    octree.traverse(cell => {
+      if (isOccluded(camera, cell.center, cell.half + maxRadius)) {
+        cullCell(cell, culled);
+        return false;
+      }
+      return true;
+    });
+    return culled.reduce((count, c) => count + c, 0);
+  }
+
+  return {update};
+}
+
+export { OcclusionCulling };
@@ -0,0 +1,270 @@
+/**
+ * @file This file contains the octree spatial index of the Metabolic Atlas 3D
+ * Viewer. The octree holds the node positions, so that picking and proximity
+ * queries only visit the nodes near the ray or point instead of all nodes,
+ * which keeps them fast for networks with hundreds of thousands of nodes.
+ */
+
+/**
+ * Creates an empty octree.
+ *
+ * @param {number} maxItems - (optional) number of items a cell holds before
+ *     it's split (default 16)
+ * @param {number} maxDepth - (optional) maximum depth of the tree (default
+ *     16)
+ * @returns {Object} An object with functions to build and query the octree.
+ */
+function Octree(maxItems = 16, maxDepth = 16) {
+  // the item positions, formatted as [[x, y, z], ...]
+  let positions = [];
+  let root;
+
+  /**
+   * Creates a cell.
+   *
+   * @param {Array} center - the center of the cell as [x, y, z]
+   * @param {number} half - half of the cell side
+   * @param {number} depth - the depth of the cell
+   */
+  function makeCell(center, half, depth) {
+    return {center: center, half: half, depth: depth, items: [], children: null};
+  }
+
+  /**
+   * Returns the index of the child cell containing a position.
+   *
+   * @param {Object} cell - the cell
+   * @param {Array} pos - the position
+   */
+  function octant(cell, pos) {
+    return (pos[0] >= cell.center[0] ? 1 : 0) |
+           (pos[1] >= cell.center[1] ? 2 : 0) |
+           (pos[2] >= cell.center[2] ? 4 : 0);
+  }
+
+  /**
+   * Splits a cell into eight children, and moves its items to them.
+   *
+   * @param {Object} cell - the cell
+   */
+  function split(cell) {
+    let h = cell.half / 2;
+    cell.children = [];
+    for (let k = 0; k < 8; k++) {
+      cell.children.push(makeCell([cell.center[0] + (k & 1 ? h : -h),
+                                   cell.center[1] + (k & 2 ? h : -h),
+                                   cell.center[2] + (k & 4 ? h : -h)],
+                                  h, cell.depth + 1));
+    }
+    let items = cell.items;
+    cell.items = [];
+    items.forEach(i => insertInto(cell, i));
+  }
+
+  /**
+   * Inserts an item into a cell or its descendants.
+   *
+   * @param {Object} cell - the cell
+   * @param {number} i - the item index
+   */
+  function insertInto(cell, i) {
+    while (cell.children) {
+      cell = cell.children[octant(cell, positions[i])];
+    }
+    cell.items.push(i);
+    if (cell.items.length > maxItems && cell.depth < maxDepth) {
+      split(cell);
+    }
+  }
+
+  /**
+   * Indexes positions, replacing the previous items. The positions are kept
+   * by reference, so the octree is rebuilt whenever they change.
+   *
+   * @param {Array} items - the positions, formatted as [[x, y, z], ...]
+   */
+  function build(items) {
+    positions = items;
+    let min = [Infinity, Infinity, Infinity];
+    let max = [-Infinity, -Infinity, -Infinity];
+    items.forEach(pos => {
+      for (let k = 0; k < 3; k++) {
+        min[k] = Math.min(min[k], pos[k]);
+        max[k] = Math.max(max[k], pos[k]);
+      }
+    });
+    if (items.length == 0) {
+      min = [0, 0, 0];
+      max = [0, 0, 0];
+    }
+    let half = Math.max(max[0] - min[0], max[1] - min[1], max[2] - min[2], 1) / 2;
+    root = makeCell(min.map((v, k) => (v + max[k]) / 2), half, 0);
+    items.forEach((pos, i) => insertInto(root, i));
+  }
+
+  /**
+   * Computes where a ray enters and leaves a cell grown by a margin.
+   *
+   * @param {Object} cell - the cell
+   * @param {Array} origin - the ray origin
+   * @param {Array} inverse - the inverse of the ray direction components
+   * @param {number} margin - the margin
+   * @returns {Array} The ray distances as [near, far], or undefined if the
+   *     ray misses the cell.
+   */
+  function rayCell(cell, origin, inverse, margin) {
+    let near = -Infinity, far = Infinity;
+    for (let k = 0; k < 3; k++) {
+      let half = cell.half + margin;
+      let t1 = (cell.center[k] - half - origin[k]) * inverse[k];
+      let t2 = (cell.center[k] + half - origin[k]) * inverse[k];
+      if (isNaN(t1) || isNaN(t2)) {
+        // the ray is parallel to the slab, and starts on its boundary
+        continue;
+      }
+      near = Math.max(near, Math.min(t1, t2));
+      far = Math.min(far, Math.max(t1, t2));
+    }
+    return near <= far && far >= 0 ? [near, far] : undefined;
+  }
+
+  /**
+   * Finds the first item hit by a ray, treating the items as spheres.
+   *
+   * @param {Array} origin - the ray origin as [x, y, z]
+   * @param {Array} direction - the normalized ray direction as [x, y, z]
+   * @param {object} options - options with the keys radius (function of an
+   *     item index returning its radius), maxRadius (the largest radius of
+   *     any item), near (ignore hits closer than this, default 0) and
+   *     filter (function of an item index returning whether it can be hit)
+   * @returns {Object} The hit as {index, distance}, or undefined.
+   */
+  function raycast(origin, direction, options) {
+    if (!root) return undefined;
+    let near = options.near || 0;
+    let filter = options.filter || (() => true);
+    let inverse = direction.map(d => 1 / d);
+    let best;
+    let queue = [];
+    let entry = rayCell(root, origin, inverse, options.maxRadius);
+    if (entry) queue.push({cell: root, near: entry[0]});
+    while (queue.length > 0) {
+      // visit the nearest cell first, and stop when no cell can beat the
+      // best hit
+      queue.sort((a, b) => b.near - a.near);
+      let {cell, near: cellNear} = queue.pop();
+      if (best && cellNear > best.distance) break;
+      if (cell.children) {
+        cell.children.forEach(child => {
+          let t = rayCell(child, origin, inverse, options.maxRadius);
+          if (t) queue.push({cell: child, near: t[0]});
+        });
+        continue;
+      }
+      cell.items.forEach(i => {
+        let p = positions[i];
+        let dx = p[0] - origin[0], dy = p[1] - origin[1], dz = p[2] - origin[2];
+        let along = dx * direction[0] + dy * direction[1] + dz * direction[2];
+        let r = options.radius(i);
+        let offset2 = dx*dx + dy*dy + dz*dz - along * along;
+        if (offset2 > r * r) return;
+        let distance = along - Math.sqrt(r * r - offset2);
+        if (distance < near || (best && distance >= best.distance) || !filter(i)) return;
+        best = {index: i, distance: distance};
+      });
+    }
+    return best;
+  }
+
+  /**
+   * Visits the cells of the tree, parents before children. A cell is
+   * formatted as {center, half, depth, items, children}, where half is half
+   * of the cell side, and children is null for leaf cells, which hold the
+   * item indices in items.
+   *
+   * @param {Function} visit - function of a cell returning whether to visit
+   *     its children
+   */
+  function traverse(visit) {
+    const descend = cell => {
+      if (visit(cell) && cell.children) {
+        cell.children.forEach(descend);
+      }
+    };
+    if (root) descend(root);
+  }
+
+  /**
+   * Finds the items within a distance of a point.
+   *
+   * @param {Array} point - the point as [x, y, z]
+   * @param {number} radius - the distance
+   * @param {Function} filter - (optional) function of an item index
+   *     returning whether to include it
+   * @returns {Array} The item indices.
+   */
+  function within(point, radius, filter = () => true) {
+    let found = [];
+    let r2 = radius * radius;
+    const visit = cell => {
+      if ([0, 1, 2].some(k => Math.abs(point[k] - cell.center[k]) > cell.half + radius)) {
+        return;
+      }
+      if (cell.children) {
+        cell.children.forEach(visit);
+        return;
+      }
+      cell.items.forEach(i => {
+        let p = positions[i];
+        let dx = p[0] - point[0], dy = p[1] - point[1], dz = p[2] - point[2];
+        if (dx*dx + dy*dy + dz*dz <= r2 && filter(i)) {
+          found.push(i);
+        }
+      });
+    };
+    if (root) visit(root);
+    return found;
+  }
+
+  /**
+   * Finds the item closest to a point.
+   *
+   * @param {Array} point - the point as [x, y, z]
+   * @param {Function} filter - (optional) function of an item index
+   *     returning whether to include it
+   * @returns {number} The item index, or undefined if there are no items.
+   */
+  function nearest(point, filter = () => true) {
+    let best;
+    let bestDistance = Infinity;
+    // squared distance from the point to a cell
+    const cellDistance = cell => [0, 1, 2].reduce((sum, k) => {
+      let d = Math.max(0, Math.abs(point[k] - cell.center[k]) - cell.half);
+      return sum + d * d;
+    }, 0);
+    const visit = cell => {
+      if (cellDistance(cell) >= bestDistance) return;
+      if (cell.children) {
+        cell.children.slice()
+          .sort((a, b) => cellDistance(a) - cellDistance(b))
+          .forEach(visit);
+        return;
+      }
+      cell.items.forEach(i => {
+        let p = positions[i];
+        let dx = p[0] - point[0], dy = p[1] - point[1], dz = p[2] - point[2];
+        let d = dx*dx + dy*dy + dz*dz;
+        if (d < bestDistance && filter(i)) {
+          bestDistance = d;
+          best = i;
+        }
+      });
+    };
+    if (root) visit(root);
+    return best;
+  }
+
+  return {build, nearest, raycast, traverse, within};
+}
+
+export { Octree };
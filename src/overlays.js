@@ -0,0 +1,189 @@
+/**
+ * @file This file contains the data overlays of the Metabolic Atlas 3D
+ * Viewer, which project experimental values, such as gene expression, onto
+ * the nodes of the network.
+ */
+
+import { continuousScale, makeMapper } from './mappers';
+
+/**
+ * Functions which combine the values of the neighbors of a node.
+ */
+const aggregates = {
+  mean: values => values.reduce((a, b) => a + b, 0) / values.length,
+  sum: values => values.reduce((a, b) => a + b, 0),
+  min: values => values.reduce((a, b) => Math.min(a, b), Infinity),
+  max: values => values.reduce((a, b) => Math.max(a, b), -Infinity),
+};
+
+/**
+ * Computes the overlay value of each node. Nodes whose ID is in `values` get
+ * their own value, and nodes in the aggregated groups without a value of
+ * their own get the aggregate of the values of their direct neighbors, so
+ * that e.g. reactions are colored by the expression of their enzymes.
+ *
+ * @param {Array} nodes - node info of each node, with the keys id and group
+ * @param {Array} adjacency - neighbor indices of each node
+ * @param {Object|Map} values - map of node IDs to values
+ * @param {object} options - overlay options with the keys groups (node
+ *     groups which get aggregated values) and aggregate ('mean', 'sum',
+ *     'min' or 'max')
+ * @returns {Array} The value of each node, or undefined for nodes without a
+ *     value.
+ */
+function nodeOverlayValues(nodes, adjacency, values, options) {
+  let valueOf = values instanceof Map ? id => values.get(id) : id => values[id];
+  let own = nodes.map(node => {
+    let v = Number(valueOf(node.id));
+    return valueOf(node.id) === null || isNaN(v) ? undefined : v;
+  });
+
+  let aggregate = aggregates[options.aggregate];
+  if (!aggregate) {
+    console.warn("unknown aggregate: '" + options.aggregate + "', using 'mean'.");
+    aggregate = aggregates.mean;
+  }
+  return nodes.map((node, i) => {
+    if (own[i] !== undefined || !options.groups.includes(node.group)) {
+      return own[i];
+    }
+    let neighbors = adjacency[i].map(n => own[n]).filter(v => v !== undefined);
+    return neighbors.length > 0 ? aggregate(neighbors) : undefined;
+  });
+}
+
+/**
+ * Computes the log2 fold changes between two conditions. Nodes without a
+ * value in both conditions get no fold change.
+ *
+ * @param {Array} reference - the value of each node in the reference
+ *     condition, or undefined
+ * @param {Array} values - the value of each node in the compared condition,
+ *     or undefined
+ * @param {number} pseudocount - added to both values before taking the
+ *     ratio, so that zero values get a finite fold change
+ * @returns {Array} The fold change of each node, or undefined.
+ */
+function foldChanges(reference, values, pseudocount) {
+  return values.map((value, i) => {
+    if (value === undefined || reference[i] === undefined) return undefined;
+    let ratio = (value + pseudocount) / (reference[i] + pseudocount);
+    return ratio > 0 && isFinite(ratio) ? Math.log2(ratio) : undefined;
+  });
+}
+
+/**
+ * Maps overlay values to colors.
+ *
+ * @param {Array} nodeValues - the value of each node, or undefined
+ * @param {object} options - overlay options with the keys colormap, scale,
+ *     constant and domain (see mappers.js)
+ * @returns {Array} The color of each node as [r, g, b], or undefined for
+ *     nodes without a value.
+ */
+function overlayColors(nodeValues, options) {
+  let mapper = makeMapper({attr: 'value',
+                           colormap: options.colormap,
+                           scale: options.scale,
+                           constant: options.constant,
+                           domain: options.domain},
+                          nodeValues);
+  return nodeValues.map(value => mapper({value: value}));
+}
+
+/**
+ * Computes the flux styles of the links of the network. A link gets the flux
+ * of the reaction node at either of its ends. The link width encodes the
+ * magnitude of the flux, and the color its sign, with a gradient which fades
+ * towards the upstream end, so that the brighter end shows where the flux
+ * goes. Positive flux goes from the start to the end of the link, negative
+ * flux the other way.
+ *
+ * @param {Array} links - link info of each link, with the keys s and t
+ * @param {Object|Map} values - map of reaction node IDs to fluxes
+ * @param {object} options - flux options with the keys widthRange, scale,
+ *     domain, threshold, positiveColor, negativeColor and zeroColor, see
+ *     `setFluxOverlay`
+ * @returns {Array} The style of each link as {flux, width, startColor,
+ *     endColor}, or undefined for links without a flux.
+ */
+function linkFluxStyles(links, values, options) {
+  let fluxes = linkFluxes(links, values);
+  let width = fluxWidth(fluxes, options);
+  const mix = (a, b, f) => [0, 1, 2].map(k => Math.round(a[k] + (b[k] - a[k]) * f));
+  return fluxes.map(flux => {
+    if (flux === undefined) return undefined;
+    if (Math.abs(flux) <= options.threshold) {
+      return {flux: 0,
+              width: options.widthRange[0],
+              startColor: options.zeroColor,
+              endColor: options.zeroColor};
+    }
+    let color = flux > 0 ? options.positiveColor : options.negativeColor;
+    let faded = mix(color, options.zeroColor, 0.7);
+    return {flux: flux,
+            width: width({value: Math.abs(flux)}),
+            startColor: flux > 0 ? faded : color,
+            endColor: flux > 0 ? color : faded};
+  });
+}
+
+/**
+ * Returns the flux of each link: the flux of the reaction node at either of
+ * its ends.
+ *
+ * @param {Array} links - link info of each link, with the keys s and t
+ * @param {Object|Map} values - map of reaction node IDs to fluxes
+ * @returns {Array} The flux of each link, or undefined for links without a
+ *     flux.
+ */
+function linkFluxes(links, values) {
+  let valueOf = values instanceof Map ? id => values.get(id) : id => values[id];
+  return links.map(link => {
+    let flux = valueOf(link.s) !== undefined ? valueOf(link.s) : valueOf(link.t);
+    return flux === undefined || flux === null || isNaN(Number(flux)) ?
+      undefined : Number(flux);
+  });
+}
+
+/**
+ * Creates the mapper from absolute fluxes to link widths.
+ *
+ * @param {Array} fluxes - the flux of each link, see `linkFluxes`
+ * @param {object} options - flux options, see `linkFluxStyles`
+ * @returns {Function} A function of {value}, the absolute flux, returning
+ *     the width.
+ */
+function fluxWidth(fluxes, options) {
+  return makeMapper({attr: 'value',
+                     scale: options.scale,
+                     domain: options.domain,
+                     range: options.widthRange},
+                    fluxes.map(flux => flux === undefined ? flux : Math.abs(flux)));
+}
+
+/**
+ * Describes the flux encoding for a legend: the colors of positive,
+ * negative and inactive flux, and the link widths of a few absolute fluxes.
+ *
+ * @param {Array} links - link info of each link, with the keys s and t
+ * @param {Object|Map} values - map of reaction node IDs to fluxes
+ * @param {object} options - flux options, see `linkFluxStyles`
+ * @param {number} count - approximate number of widths
+ * @returns {Object} The legend description, see legend.js.
+ */
+function fluxLegend(links, values, options, count) {
+  let fluxes = linkFluxes(links, values);
+  let width = fluxWidth(fluxes, options);
+  let magnitudes = fluxes.filter(flux => flux !== undefined).map(Math.abs);
+  let steps = continuousScale({scale: options.scale, domain: options.domain}, magnitudes)
+    .ticks(count).filter(value => value > options.threshold);
+  return {type: 'flux',
+          title: 'Flux',
+          entries: [{label: 'Positive', color: options.positiveColor},
+                    {label: 'Negative', color: options.negativeColor},
+                    {label: 'Inactive', color: options.zeroColor}],
+          widths: steps.map(value => ({value: value, width: width({value: value})}))};
+}
+
+export { foldChanges, fluxLegend, linkFluxStyles, nodeOverlayValues, overlayColors };
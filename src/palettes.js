@@ -0,0 +1,134 @@
+/**
+ * @file This file contains the built-in color palettes of the Metabolic Atlas
+ * 3D Viewer, including color-blind-safe categorical palettes and perceptually
+ * uniform color scales.
+ */
+
+/**
+ * Categorical palettes, as lists of [r, g, b] colors.
+ */
+const categorical = {
+  // Okabe & Ito, "Color Universal Design", without black
+  okabeIto: [[230, 159, 0], [86, 180, 233], [0, 158, 115], [240, 228, 66],
+             [0, 114, 178], [213, 94, 0], [204, 121, 167], [127, 127, 127]],
+  // Okabe-Ito colors ordered to avoid the blue-yellow confusion of tritanopia
+  tritan: [[213, 94, 0], [0, 158, 115], [204, 121, 167], [127, 127, 127],
+           [0, 114, 178], [230, 159, 0], [240, 228, 66], [86, 180, 233]]
+};
+
+/**
+ * Continuous color scales, as lists of evenly spaced [r, g, b] stops, or
+ * functions mapping [0, 1] to [r, g, b]. rdBu is a diverging scale, from blue
+ * for low values to red for high values. More scales can be added with
+ * `registerColormap`.
+ */
+const continuous = {
+  viridis: [[68, 1, 84], [72, 40, 120], [62, 74, 137], [49, 104, 142],
+            [38, 130, 142], [31, 158, 137], [53, 183, 121], [109, 205, 89],
+            [180, 222, 44], [253, 231, 37]],
+  cividis: [[0, 32, 77], [0, 48, 111], [52, 66, 108], [84, 84, 108],
+            [109, 102, 112], [133, 121, 120], [160, 141, 121], [189, 162, 115],
+            [221, 184, 101], [255, 234, 70]],
+  magma: [[0, 0, 4], [20, 14, 54], [59, 15, 112], [100, 26, 128],
+          [140, 41, 129], [183, 55, 121], [222, 73, 104], [246, 110, 92],
+          [254, 159, 109], [254, 207, 146], [252, 253, 191]],
+  // ColorBrewer RdBu, reversed
+  rdBu: [[33, 102, 172], [67, 147, 195], [146, 197, 222], [209, 229, 240],
+         [247, 247, 247], [253, 219, 199], [244, 165, 130], [214, 96, 77],
+         [178, 24, 43]]
+};
+
+/**
+ * The categorical palette to use for each color vision mode.
+ */
+const colorVisionPalettes = {
+  deuteranopia: 'okabeIto',
+  protanopia: 'okabeIto',
+  tritanopia: 'tritan'
+};
+
+/**
+ * Returns the color at `t` of a continuous color scale given as evenly spaced
+ * stops, interpolating linearly between the stops.
+ *
+ * @param {Array} stops - color stops as [[r, g, b], ...]
+ * @param {number} t - position on the scale, between 0 and 1
+ * @returns {Array} The color as [r, g, b]
+ */
+function interpolateStops(stops, t) {
+  t = Math.max(0, Math.min(1, t));
+  let p = t * (stops.length - 1);
+  let i = Math.min(Math.floor(p), stops.length - 2);
+  let f = p - i;
+  return [0, 1, 2].map(k => Math.round(stops[i][k] + (stops[i+1][k] - stops[i][k]) * f));
+}
+
+/**
+ * Returns the color at `t` of a continuous color scale.
+ *
+ * @param {Array|Function} colormap - color stops as [[r, g, b], ...], or a
+ *     function mapping [0, 1] to [r, g, b]
+ * @param {number} t - position on the scale, between 0 and 1
+ * @returns {Array} The color as [r, g, b]
+ */
+function colormapColor(colormap, t) {
+  if (typeof colormap === 'function') {
+    return colormap(Math.max(0, Math.min(1, t))).map(Math.round);
+  }
+  return interpolateStops(colormap, t);
+}
+
+/**
+ * Adds a named continuous color scale, which can then be used as colormap
+ * in style mappers and overlays. Registering a name again replaces the
+ * scale, including the built-in ones.
+ *
+ * @param {string} name - name of the color scale
+ * @param {Array|Function} colormap - evenly spaced color stops as
+ *     [[r, g, b], ...], at least two, or a function mapping [0, 1] to
+ *     [r, g, b]
+ * @returns {boolean} True if the color scale was registered.
+ */
+function registerColormap(name, colormap) {
+  let valid = typeof colormap === 'function' ||
+    (Array.isArray(colormap) && colormap.length >= 2 &&
+     colormap.every(stop => Array.isArray(stop) && stop.length >= 3));
+  if (!valid) {
+    console.warn("could not register colormap '" + name + "'. The colormap " +
+                 "must be a list of at least two [r, g, b] stops, or a function.");
+    return false;
+  }
+  continuous[name] = colormap;
+  return true;
+}
+
+/**
+ * Creates a mapping from the given colors to a color-blind-safe palette for
+ * the given color vision mode. The most common colors are mapped to the most
+ * distinguishable palette colors.
+ *
+ * @param {Array} colors - list of [r, g, b] colors, which may contain
+ *     duplicates
+ * @param {string} mode - 'deuteranopia', 'protanopia' or 'tritanopia'
+ * @returns {Object} An object mapping 'r,g,b' color keys to palette colors,
+ *     or undefined if the mode has no palette.
+ */
+function colorVisionMapping(colors, mode) {
+  let palette = categorical[colorVisionPalettes[mode]];
+  if (!palette) return undefined;
+
+  let counts = {};
+  colors.forEach(color => {
+    let key = color.join(',');
+    counts[key] = (counts[key] || 0) + 1;
+  });
+
+  let mapping = {};
+  Object.keys(counts).sort((a,b) => counts[b] - counts[a]).forEach((key, i) => {
+    mapping[key] = palette[i % palette.length];
+  });
+  return mapping;
+}
+
+export { categorical, colorVisionMapping, colormapColor, continuous, interpolateStops,
+         registerColormap };
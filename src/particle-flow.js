@@ -0,0 +1,142 @@
+/**
+ * @file This file contains the animated particle flow of the Metabolic Atlas
+ * 3D Viewer. Small particles move along the links with a speed proportional
+ * to the magnitude of the flux, in the direction given by its sign.
+ */
+
+import {
+  BufferGeometry,
+  CanvasTexture,
+  Float32BufferAttribute,
+  Group,
+  Points,
+  PointsMaterial,
+  Uint8BufferAttribute,
+  VertexColors,
+} from 'three';
+
+/**
+ * Creates a round, soft-edged particle texture.
+ *
+ * @returns {Object} A three-js texture.
+ */
+function makeParticleTexture() {
+  let canvas = document.createElement('canvas');
+  canvas.width = 32;
+  canvas.height = 32;
+  let ctx = canvas.getContext('2d');
+  let gradient = ctx.createRadialGradient(16, 16, 0, 16, 16, 16);
+  gradient.addColorStop(0, 'rgba(255,255,255,1)');
+  gradient.addColorStop(0.6, 'rgba(255,255,255,0.8)');
+  gradient.addColorStop(1, 'rgba(255,255,255,0)');
+  ctx.fillStyle = gradient;
+  ctx.fillRect(0, 0, 32, 32);
+  return new CanvasTexture(canvas);
+}
+
+/**
+ * Creates a particle flow handler for the links of a graph.
+ *
+ * @returns {Object} An object with functions to build and update the
+ *     particles.
+ */
+function ParticleFlow() {
+  let group = new Group();
+  let points;
+  let texture;
+  // the particles, formatted as [{path, lengths, phase, speed}], where path
+  // is the polyline of the link, lengths the cumulative segment lengths, and
+  // speed the signed speed in graph units per second
+  let particles = [];
+
+  /**
+   * Creates the particles of the links with a flux.
+   *
+   * @param {Array} links - the links formatted as [{path: [[x, y, z], ...],
+   *     flux: <relative flux between -1 and 1>, color: [r, g, b]}]
+   * @param {object} options - flow options with the keys count (particles
+   *     per link), speed (graph units per second at the largest flux) and
+   *     size (particle size in graph units)
+   */
+  function build(links, options) {
+    dispose();
+    particles = [];
+    let colors = [];
+    links.forEach(link => {
+      if (!link.flux || link.path.length < 2) return;
+      let lengths = [0];
+      for (let p = 1; p < link.path.length; p++) {
+        let a = link.path[p-1], b = link.path[p];
+        lengths.push(lengths[p-1] + Math.hypot(b[0]-a[0], b[1]-a[1], b[2]-a[2]));
+      }
+      let total = lengths[lengths.length - 1];
+      if (total == 0) return;
+      for (let c = 0; c < options.count; c++) {
+        particles.push({path: link.path,
+                        lengths: lengths,
+                        phase: (c + Math.random() * 0.5) / options.count * total,
+                        speed: link.flux * options.speed});
+        colors.push.apply(colors, link.color);
+      }
+    });
+    if (particles.length == 0) return;
+
+    let geometry = new BufferGeometry();
+    geometry.setAttribute('position', new Float32BufferAttribute(
+      new Float32Array(particles.length * 3), 3));
+    geometry.setAttribute('color', new Uint8BufferAttribute(colors, 3, true));
+    texture = makeParticleTexture();
+    points = new Points(geometry, new PointsMaterial({
+      size: options.size,
+      vertexColors: VertexColors,
+      map: texture,
+      transparent: true,
+      depthWrite: false,
+    }));
+    points.renderOrder = 3;
+    points.frustumCulled = false;
+    group.add(points);
+  }
+
+  /**
+   * Moves the particles to their positions at a point in time.
+   *
+   * @param {number} time - the time in milliseconds
+   */
+  function update(time) {
+    if (!points) return;
+    let positions = points.geometry.attributes.position;
+    particles.forEach((particle, i) => {
+      let lengths = particle.lengths;
+      let total = lengths[lengths.length - 1];
+      let d = (particle.phase + particle.speed * time / 1000) % total;
+      if (d < 0) d += total;
+      let s = 1;
+      while (s < lengths.length - 1 && lengths[s] < d) s++;
+      let a = particle.path[s-1], b = particle.path[s];
+      let f = (d - lengths[s-1]) / ((lengths[s] - lengths[s-1]) || 1);
+      positions.setXYZ(i, a[0] + (b[0]-a[0]) * f,
+                          a[1] + (b[1]-a[1]) * f,
+                          a[2] + (b[2]-a[2]) * f);
+    });
+    positions.needsUpdate = true;
+  }
+
+  /**
+   * Removes and disposes the particles.
+   */
+  function dispose() {
+    if (points) {
+      group.remove(points);
+      points.geometry.dispose();
+      points.material.dispose();
+      texture.dispose();
+      points = undefined;
+    }
+    particles = [];
+  }
+
+  return {build, dispose, group, update};
+}
+
+export { ParticleFlow };
@@ -0,0 +1,234 @@
+/**
+ * @file This file contains the optional post-processing pipeline for the
+ * Metabolic Atlas 3D Viewer.
+ */
+
+import {
+  Color,
+  RGBAFormat,
+  ShaderMaterial,
+  Vector2,
+  WebGLMultisampleRenderTarget,
+} from 'three';
+
+import { EffectComposer } from 'three/examples/jsm/postprocessing/EffectComposer.js';
+import { RenderPass } from 'three/examples/jsm/postprocessing/RenderPass.js';
+import { ShaderPass } from 'three/examples/jsm/postprocessing/ShaderPass.js';
+import { UnrealBloomPass } from 'three/examples/jsm/postprocessing/UnrealBloomPass.js';
+import { SMAAPass } from 'three/examples/jsm/postprocessing/SMAAPass.js';
+import { FXAAShader } from 'three/examples/jsm/shaders/FXAAShader.js';
+
+/**
+ * Objects on this layer are rendered into the bloom pass only.
+ */
+const BLOOM_LAYER = 1;
+
+const blendVertexShader = `
+  varying vec2 vUv;
+
+  void main() {
+    vUv = uv;
+    gl_Position = projectionMatrix * modelViewMatrix * vec4( position, 1.0 );
+  }
+`;
+
+const blendFragmentShader = `
+  uniform sampler2D baseTexture;
+  uniform sampler2D bloomTexture;
+  varying vec2 vUv;
+
+  void main() {
+    gl_FragColor = texture2D( baseTexture, vUv ) + vec4( 1.0 ) * texture2D( bloomTexture, vUv );
+  }
+`;
+
+/**
+ * Creates a post-processing pipeline for a renderer, scene and camera.
+ *
+ * @param {Object} renderer - three-js WebGLRenderer
+ * @param {Object} scene - the scene to render
+ * @param {Object} camera - the camera to render with
+ * @returns {Object} An object with functions to configure and run the
+ *     pipeline.
+ */
+function PostProcessing(renderer, scene, camera) {
+  let size = renderer.getSize(new Vector2());
+  let pixelRatio = renderer.getPixelRatio();
+  let black = new Color(0x000000);
+
+  // The bloom composer renders only the bloom layer, and keeps the result in
+  // a render target which is blended with the full scene by the final
+  // composer.
+  let bloomComposer = new EffectComposer(renderer);
+  bloomComposer.renderToScreen = false;
+  bloomComposer.addPass(new RenderPass(scene, camera));
+  let bloomPass = new UnrealBloomPass(size, 1.5, 0.4, 0);
+  bloomComposer.addPass(bloomPass);
+
+  let blendPass = new ShaderPass(new ShaderMaterial({
+    uniforms: {
+      baseTexture: {value: null},
+      bloomTexture: {value: bloomComposer.renderTarget2.texture}
+    },
+    vertexShader: blendVertexShader,
+    fragmentShader: blendFragmentShader
+  }), 'baseTexture');
+  blendPass.needsSwap = true;
+
+  let options = {
+    bloom: false,
+    antialias: 'none',
+    samples: 4
+  };
+
+  let finalComposer;
+  let antialiasPass;
+  buildFinalComposer();
+
+  /**
+   * (Re)creates the final composer, which renders the scene, blends in the
+   * bloom (if enabled) and runs the antialiasing pass (if enabled). With MSAA,
+   * the scene is rendered to a multisampled render target.
+   */
+  function buildFinalComposer() {
+    if (finalComposer) {
+      finalComposer.renderTarget1.dispose();
+      finalComposer.renderTarget2.dispose();
+    }
+
+    let target;
+    if (options.antialias == 'msaa') {
+      target = new WebGLMultisampleRenderTarget(size.width * pixelRatio,
+                                                size.height * pixelRatio,
+                                                {format: RGBAFormat});
+      target.samples = options.samples;
+    }
+    finalComposer = new EffectComposer(renderer, target);
+    finalComposer.setPixelRatio(pixelRatio);
+    finalComposer.setSize(size.width, size.height);
+    finalComposer.addPass(new RenderPass(scene, camera));
+    finalComposer.addPass(blendPass);
+    blendPass.enabled = options.bloom;
+
+    antialiasPass = undefined;
+    if (options.antialias == 'fxaa') {
+      antialiasPass = new ShaderPass(FXAAShader);
+    } else if (options.antialias == 'smaa') {
+      antialiasPass = new SMAAPass(size.width * pixelRatio, size.height * pixelRatio);
+    }
+    if (antialiasPass) {
+      finalComposer.addPass(antialiasPass);
+      updateAntialiasResolution();
+    }
+  }
+
+  /**
+   * Updates the resolution uniform of the FXAA pass.
+   */
+  function updateAntialiasResolution() {
+    if (antialiasPass && antialiasPass.uniforms && antialiasPass.uniforms.resolution) {
+      antialiasPass.uniforms.resolution.value.set(1 / (size.width * pixelRatio),
+                                                  1 / (size.height * pixelRatio));
+    }
+  }
+
+  /**
+   * Sets the bloom options.
+   *
+   * @param {boolean} enabled - whether to render bloom
+   * @param {object} settings - (optional) bloom settings with the keys
+   *     strength, radius and threshold.
+   */
+  function setBloom(enabled, settings = {}) {
+    options.bloom = enabled;
+    blendPass.enabled = enabled;
+    ['strength', 'radius', 'threshold'].forEach(key => {
+      if (settings[key] !== undefined) {
+        bloomPass[key] = settings[key];
+      }
+    });
+  }
+
+  /**
+   * Sets the antialiasing mode.
+   *
+   * @param {string} mode - one of 'none', 'msaa' (multisampling, requires
+   *     WebGL 2), 'fxaa' or 'smaa'.
+   * @param {number} samples - (optional) number of MSAA samples
+   */
+  function setAntialiasing(mode, samples = undefined) {
+    if (mode == 'msaa' && !renderer.capabilities.isWebGL2) {
+      console.warn("MSAA requires WebGL 2, using FXAA instead.");
+      mode = 'fxaa';
+    }
+    options.antialias = mode;
+    if (samples !== undefined) {
+      options.samples = samples;
+    }
+    buildFinalComposer();
+  }
+
+  /**
+   * Returns true if any post-processing effect is active.
+   */
+  function isActive() {
+    return options.bloom || options.antialias != 'none';
+  }
+
+  /**
+   * Renders the scene through the pipeline.
+   */
+  function render() {
+    if (options.bloom) {
+      let background = scene.background;
+      scene.background = black;
+      camera.layers.set(BLOOM_LAYER);
+      bloomComposer.render();
+      camera.layers.set(0);
+      scene.background = background;
+      blendPass.uniforms.bloomTexture.value = bloomComposer.renderTarget2.texture;
+    }
+    finalComposer.render();
+  }
+
+  /**
+   * Updates the size of the render targets.
+   *
+   * @param {number} width - new width in pixels
+   * @param {number} height - new height in pixels
+   */
+  function setSize(width, height) {
+    size.set(width, height);
+    bloomComposer.setSize(width, height);
+    finalComposer.setSize(width, height);
+    updateAntialiasResolution();
+  }
+
+  /**
+   * Sets the pixel ratio of the render targets.
+   *
+   * @param {number} ratio - device pixel ratio
+   */
+  function setPixelRatio(ratio) {
+    if (ratio == pixelRatio) return;
+    pixelRatio = ratio;
+    bloomComposer.setPixelRatio(ratio);
+    finalComposer.setPixelRatio(ratio);
+    updateAntialiasResolution();
+  }
+
+  /**
+   * Disposes the render targets.
+   */
+  function dispose() {
+    bloomComposer.renderTarget1.dispose();
+    bloomComposer.renderTarget2.dispose();
+    finalComposer.renderTarget1.dispose();
+    finalComposer.renderTarget2.dispose();
+  }
+
+  return {dispose, isActive, render, setAntialiasing, setBloom, setPixelRatio,
+          setSize};
+}
+
+export { BLOOM_LAYER, PostProcessing };
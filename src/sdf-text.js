@@ -0,0 +1,286 @@
+/**
+ * @file This file contains functions for drawing node labels as signed
+ * distance field (SDF) text in the Metabolic Atlas 3D Viewer. A glyph atlas is
+ * generated once per font, and all labels are drawn as a single mesh of
+ * camera-facing glyph quads, which stay crisp at any zoom level.
+ */
+
+import {
+  BufferGeometry,
+  CanvasTexture,
+  Color,
+  Float32BufferAttribute,
+  LinearFilter,
+  Mesh,
+  ShaderMaterial,
+} from 'three';
+
+// glyphs are drawn in cells of `cellSize` pixels, with `fontSize` pixel text
+// and a distance field `spread` of a few pixels around each glyph.
+const cellSize = 64;
+const fontSize = 40;
+const baseline = 48;
+const spread = 8;
+const firstChar = 32;
+const lastChar = 126;
+const columns = 16;
+
+const textVertexShader = `
+  attribute vec2 offset;
+  attribute float nudge;
+  attribute float visible;
+  uniform float size;
+  uniform float maxDistance;
+  varying vec2 vUv;
+
+  void main() {
+    vUv = uv;
+    vec4 mvPosition = modelViewMatrix * vec4( position, 1.0 );
+    if ( - mvPosition.z > maxDistance || visible < 0.5 ) {
+      // move hidden labels and labels that are too far away outside of the
+      // clip volume
+      gl_Position = vec4( 0.0, 0.0, 2.0, 1.0 );
+      return;
+    }
+    mvPosition.xy += ( offset + vec2( 0.0, nudge ) ) * size;
+    gl_Position = projectionMatrix * mvPosition;
+  }
+`;
+
+const textFragmentShader = `
+  uniform sampler2D atlas;
+  uniform vec3 color;
+  uniform vec3 outlineColor;
+  uniform float outline;
+  uniform float opacity;
+  varying vec2 vUv;
+
+  void main() {
+    float distance = texture2D( atlas, vUv ).a;
+    float width = fwidth( distance );
+    float alpha = smoothstep( 0.5 - outline - width, 0.5 - outline + width, distance );
+    if ( alpha < 0.01 ) discard;
+    float fill = smoothstep( 0.5 - width, 0.5 + width, distance );
+    gl_FragColor = vec4( mix( outlineColor, color, fill ), alpha * opacity );
+  }
+`;
+
+/**
+ * Generates an SDF glyph atlas for the printable ASCII characters.
+ *
+ * @param {string} fontFamily - CSS font family to use
+ * @returns {Object} The atlas as {texture, advances, rows}, where `advances`
+ *     holds the advance width in em of each character.
+ */
+function makeGlyphAtlas(fontFamily = 'monospace') {
+  let count = lastChar - firstChar + 1;
+  let rows = Math.ceil(count / columns);
+
+  let canvas = document.createElement('canvas');
+  canvas.width = columns * cellSize;
+  canvas.height = rows * cellSize;
+  let ctx = canvas.getContext('2d');
+  ctx.font = fontSize + 'px ' + fontFamily;
+  ctx.textAlign = 'center';
+  ctx.textBaseline = 'alphabetic';
+  ctx.fillStyle = 'white';
+
+  let advances = {};
+  for (let c = firstChar; c <= lastChar; c++) {
+    let i = c - firstChar;
+    let char = String.fromCharCode(c);
+    ctx.fillText(char, (i % columns + 0.5) * cellSize,
+                 Math.floor(i / columns) * cellSize + baseline);
+    advances[char] = ctx.measureText(char).width / fontSize;
+  }
+
+  let image = ctx.getImageData(0, 0, canvas.width, canvas.height);
+  let inside = new Uint8Array(canvas.width * canvas.height);
+  for (let p = 0; p < inside.length; p++) {
+    inside[p] = image.data[p*4+3] > 127 ? 1 : 0;
+  }
+  let outer = chamferDistance(inside, canvas.width, canvas.height, 1);
+  let inner = chamferDistance(inside, canvas.width, canvas.height, 0);
+  for (let p = 0; p < inside.length; p++) {
+    let signed = inner[p] - outer[p];
+    let value = 128 + signed * 127 / spread;
+    image.data[p*4] = 255;
+    image.data[p*4+1] = 255;
+    image.data[p*4+2] = 255;
+    image.data[p*4+3] = Math.max(0, Math.min(255, Math.round(value)));
+  }
+  ctx.putImageData(image, 0, 0);
+
+  let texture = new CanvasTexture(canvas);
+  texture.minFilter = LinearFilter;
+  texture.generateMipmaps = false;
+
+  return {texture, advances, rows};
+}
+
+/**
+ * Calculates the approximate distance from each pixel to the nearest pixel
+ * where `mask` equals `target`, using a two-pass chamfer distance transform.
+ *
+ * @param {Uint8Array} mask - binary image
+ * @param {number} width - image width
+ * @param {number} height - image height
+ * @param {number} target - mask value to measure the distance to
+ * @returns {Float32Array} Distance in pixels for each pixel.
+ */
+function chamferDistance(mask, width, height, target) {
+  const a = 1, b = Math.SQRT2;
+  let d = new Float32Array(width * height);
+  for (let p = 0; p < d.length; p++) {
+    d[p] = mask[p] == target ? 0 : 1e6;
+  }
+  function relax(x, y, dx, dy, cost) {
+    let nx = x + dx, ny = y + dy;
+    if (nx < 0 || ny < 0 || nx >= width || ny >= height) return;
+    let v = d[ny*width + nx] + cost;
+    if (v < d[y*width + x]) {
+      d[y*width + x] = v;
+    }
+  }
+  for (let y = 0; y < height; y++) {
+    for (let x = 0; x < width; x++) {
+      relax(x, y, -1, 0, a);
+      relax(x, y, 0, -1, a);
+      relax(x, y, -1, -1, b);
+      relax(x, y, 1, -1, b);
+    }
+  }
+  for (let y = height - 1; y >= 0; y--) {
+    for (let x = width - 1; x >= 0; x--) {
+      relax(x, y, 1, 0, a);
+      relax(x, y, 0, 1, a);
+      relax(x, y, 1, 1, b);
+      relax(x, y, -1, 1, b);
+    }
+  }
+  return d;
+}
+
+/**
+ * Creates a mesh with camera-facing SDF text labels.
+ *
+ * @param {Array} labels - labels formatted as [{text: <text>,
+ *     pos: [x, y, z]}, ...]
+ * @param {Object} atlas - glyph atlas created by `makeGlyphAtlas`
+ * @param {Object} options - label options:
+ *     - size: text height (em) in graph coordinates
+ *     - color: text color
+ *     - outlineColor: color of the text outline
+ *     - opacity: opacity of the text (default 1)
+ *     - offset: vertical offset of the text baseline in em
+ * @returns {Object} A three-js Mesh.
+ */
+function makeTextMesh(labels, atlas, options = {}) {
+  let positions = [];
+  let offsets = [];
+  let uvs = [];
+  let indices = [];
+  let cellEm = cellSize / fontSize;
+  let baselineEm = (cellSize - baseline) / fontSize;
+  let yOffset = options.offset !== undefined ? options.offset : 0.5;
+  let ranges = [];
+
+  labels.forEach(label => {
+    let text = String(label.text);
+    let width = 0;
+    for (let char of text) {
+      width += atlas.advances[char] || atlas.advances['?'];
+    }
+    ranges.push({start: positions.length / 3, width: width});
+    let cursor = -width / 2;
+    for (let char of text) {
+      let advance = atlas.advances[char] || atlas.advances['?'];
+      let code = char.charCodeAt(0);
+      if (code < firstChar || code > lastChar) {
+        code = '?'.charCodeAt(0);
+      }
+      if (char != ' ') {
+        let i = code - firstChar;
+        let u0 = (i % columns) / columns;
+        let u1 = u0 + 1 / columns;
+        let v1 = 1 - Math.floor(i / columns) / atlas.rows;
+        let v0 = v1 - 1 / atlas.rows;
+        let x0 = cursor + advance/2 - cellEm/2;
+        let y0 = yOffset - baselineEm;
+
+        let start = positions.length / 3;
+        [[x0, y0, u0, v0], [x0 + cellEm, y0, u1, v0],
+         [x0 + cellEm, y0 + cellEm, u1, v1], [x0, y0 + cellEm, u0, v1]
+        ].forEach(corner => {
+          positions.push.apply(positions, label.pos);
+          offsets.push(corner[0], corner[1]);
+          uvs.push(corner[2], corner[3]);
+        });
+        indices.push(start, start+1, start+2, start, start+2, start+3);
+      }
+      cursor += advance;
+    }
+    ranges[ranges.length-1].count = positions.length / 3 - ranges[ranges.length-1].start;
+  });
+
+  let geometry = new BufferGeometry();
+  geometry.setIndex(indices);
+  geometry.setAttribute('position', new Float32BufferAttribute(positions, 3));
+  geometry.setAttribute('offset', new Float32BufferAttribute(offsets, 2));
+  geometry.setAttribute('uv', new Float32BufferAttribute(uvs, 2));
+  geometry.setAttribute('nudge', new Float32BufferAttribute(
+    new Float32Array(positions.length / 3), 1));
+  geometry.setAttribute('visible', new Float32BufferAttribute(
+    new Float32Array(positions.length / 3).fill(1), 1));
+  geometry.computeBoundingSphere();
+
+  let material = new ShaderMaterial({
+    uniforms: {
+      atlas: {value: atlas.texture},
+      size: {value: options.size || 10},
+      maxDistance: {value: 1e9},
+      color: {value: new Color(options.color || 0xffffff)},
+      outlineColor: {value: new Color(options.outlineColor || 0x000000)},
+      outline: {value: 0.2},
+      opacity: {value: options.opacity !== undefined ? options.opacity : 1}
+    },
+    vertexShader: textVertexShader,
+    fragmentShader: textFragmentShader,
+    extensions: {derivatives: true},
+    transparent: true,
+    depthTest: true,
+    depthWrite: false
+  });
+
+  let mesh = new Mesh(geometry, material);
+  mesh.frustumCulled = false;
+  // keep the vertex range and width (in em) of each label for the layout
+  mesh.userData.ranges = ranges;
+  return mesh;
+}
+
+/**
+ * Sets which labels in a text mesh are visible, and how far they are nudged
+ * vertically.
+ *
+ * @param {Object} mesh - text mesh created by `makeTextMesh`
+ * @param {Object} placed - (optional) object mapping label indices to their
+ *     vertical nudge in em. Labels that are not included are hidden. If
+ *     omitted, all labels are shown without nudges.
+ */
+function setTextLayout(mesh, placed = undefined) {
+  let nudge = mesh.geometry.attributes.nudge;
+  let visible = mesh.geometry.attributes.visible;
+  mesh.userData.ranges.forEach((range, i) => {
+    let shown = !placed || placed[i] !== undefined;
+    let dy = placed && shown ? placed[i] : 0;
+    for (let v = range.start; v < range.start + range.count; v++) {
+      nudge.array[v] = dy;
+      visible.array[v] = shown ? 1 : 0;
+    }
+  });
+  nudge.needsUpdate = true;
+  visible.needsUpdate = true;
+}
+
+export { makeGlyphAtlas, makeTextMesh, setTextLayout };
@@ -0,0 +1,298 @@
+/**
+ * @file This file contains the full-text search index of the Metabolic Atlas
+ * 3D Viewer. Documents are indexed by the words of their fields, and queries
+ * match words by prefix, so that e.g. 'gluc phos' finds
+ * 'glucose-6-phosphate'. Query words of four letters or more also match with
+ * one typo, and of eight letters or more with two, so that e.g.
+ * 'phosphatidylethanolamin' finds 'phosphatidylethanolamine'. Matches are
+ * ranked by how well they match, and by the weight of the matching field.
+ */
+
+// Pattern of the words in a text
+const wordPattern = /[\p{L}\p{N}]+/gu;
+
+/**
+ * Splits a text into lowercase words.
+ *
+ * @param {string} text - the text
+ * @returns {Array} The words.
+ */
+function tokenize(text) {
+  return String(text).toLowerCase().match(wordPattern) || [];
+}
+
+/**
+ * Returns the number of typos allowed in a query word.
+ *
+ * @param {string} term - the query word
+ */
+function maxEdits(term) {
+  return term.length < 4 ? 0 : term.length < 8 ? 1 : 2;
+}
+
+/**
+ * Computes the edit distance (with transpositions) between a query word and
+ * the closest prefix of a word.
+ *
+ * @param {string} term - the query word
+ * @param {string} word - the word
+ * @param {number} max - the largest distance of interest
+ * @returns {Object} The match as {distance, length}, where length is the
+ *     length of the matching prefix, or undefined if the distance is larger
+ *     than `max`.
+ */
+function prefixDistance(term, word, max) {
+  let m = term.length;
+  let n = Math.min(word.length, m + max);
+  if (n < m - max) return undefined;
+  let d = [];
+  for (let i = 0; i <= m; i++) {
+    d.push(new Array(n + 1));
+    d[i][0] = i;
+    let rowMin = i;
+    for (let j = 1; j <= n; j++) {
+      if (i == 0) {
+        d[0][j] = j;
+        continue;
+      }
+      let cost = term[i-1] == word[j-1] ? 0 : 1;
+      d[i][j] = Math.min(d[i-1][j] + 1, d[i][j-1] + 1, d[i-1][j-1] + cost);
+      if (i > 1 && j > 1 && term[i-1] == word[j-2] && term[i-2] == word[j-1]) {
+        d[i][j] = Math.min(d[i][j], d[i-2][j-2] + 1);
+      }
+      rowMin = Math.min(rowMin, d[i][j]);
+    }
+    if (i > 0 && rowMin > max) return undefined;
+  }
+  let best;
+  for (let j = Math.max(0, m - max); j <= n; j++) {
+    // prefer the prefix closest in length to the query word
+    if (!best || d[m][j] < best.distance ||
+        (d[m][j] == best.distance && Math.abs(j - m) < Math.abs(best.length - m))) {
+      best = {distance: d[m][j], length: j};
+    }
+  }
+  return best && best.distance <= max ? best : undefined;
+}
+
+/**
+ * Matches a query word against a word.
+ *
+ * @param {string} term - the query word
+ * @param {string} word - the word
+ * @param {boolean} fuzzy - whether to allow typos
+ * @returns {Object} The match as {score, length}, where length is the
+ *     length of the matching prefix of the word, or undefined if the words
+ *     don't match.
+ */
+function matchWord(term, word, fuzzy) {
+  if (word.startsWith(term)) {
+    return {score: word == term ? 4 : 2 * term.length / word.length,
+            length: term.length};
+  }
+  let max = fuzzy ? maxEdits(term) : 0;
+  let match = max > 0 ? prefixDistance(term, word, max) : undefined;
+  if (!match) return undefined;
+  return {score: 2 * match.length / word.length * (1 - 0.35 * match.distance),
+          length: match.length};
+}
+
+/**
+ * Finds the parts of a text that match the query words.
+ *
+ * @param {string} text - the text
+ * @param {Array} terms - the query words
+ * @param {boolean} fuzzy - whether to allow typos
+ * @returns {Array} The matching character ranges, as [[start, end], ...].
+ */
+function highlightRanges(text, terms, fuzzy) {
+  let ranges = [];
+  let pattern = new RegExp(wordPattern.source, 'gu');
+  let found;
+  while ((found = pattern.exec(text)) !== null) {
+    let word = found[0].toLowerCase();
+    let length = 0;
+    terms.forEach(term => {
+      let match = matchWord(term, word, fuzzy);
+      if (match && match.length > length) {
+        length = match.length;
+      }
+    });
+    if (length > 0) {
+      ranges.push([found.index, found.index + length]);
+    }
+  }
+  return ranges;
+}
+
+/**
+ * Creates an empty search index.
+ *
+ * @returns {Object} An object with functions to build and search the index.
+ */
+function SearchIndex() {
+  // the indexed documents, formatted as [{<field>: <text>}]
+  let documents = [];
+  let weights = {};
+  // map of words to where they occur, formatted as [{doc, field}]
+  let postings = new Map();
+  // the indexed words in sorted order, for prefix lookups
+  let words = [];
+
+  /**
+   * Indexes documents, replacing the previous documents.
+   *
+   * @param {Array} docs - the documents, formatted as [{<field>: <text>}]
+   * @param {object} fieldWeights - weight of each field in the ranking,
+   *     fields without a weight have weight 1
+   */
+  function build(docs, fieldWeights = {}) {
+    documents = docs;
+    weights = fieldWeights;
+    postings = new Map();
+    docs.forEach((doc, d) => {
+      Object.keys(doc).forEach(field => {
+        new Set(tokenize(doc[field])).forEach(word => {
+          if (!postings.has(word)) {
+            postings.set(word, []);
+          }
+          postings.get(word).push({doc: d, field: field});
+        });
+      });
+    });
+    words = [...postings.keys()].sort();
+  }
+
+  /**
+   * Returns the indexed words that start with a prefix.
+   *
+   * @param {string} prefix - the prefix
+   */
+  function wordsWithPrefix(prefix) {
+    let lo = 0, hi = words.length;
+    while (lo < hi) {
+      let mid = (lo + hi) >> 1;
+      if (words[mid] < prefix) lo = mid + 1; else hi = mid;
+    }
+    let found = [];
+    for (let i = lo; i < words.length && words[i].startsWith(prefix); i++) {
+      found.push(words[i]);
+    }
+    return found;
+  }
+
+  /**
+   * Returns the weight of a field.
+   *
+   * @param {string} field - the field name
+   */
+  function weight(field) {
+    return weights[field] !== undefined ? weights[field] : 1;
+  }
+
+  /**
+   * Returns the indexed words that match a query word, with their score.
+   *
+   * @param {string} term - the query word
+   * @param {boolean} fuzzy - whether to allow typos
+   * @returns {Array} The words, formatted as [{word, score}].
+   */
+  function matchingWords(term, fuzzy) {
+    let found = wordsWithPrefix(term).map(word => ({
+      word: word,
+      score: matchWord(term, word, false).score
+    }));
+    if (fuzzy && maxEdits(term) > 0) {
+      words.forEach(word => {
+        if (word.startsWith(term)) return;
+        let match = matchWord(term, word, true);
+        if (match) {
+          found.push({word: word, score: match.score});
+        }
+      });
+    }
+    return found;
+  }
+
+  /**
+   * Searches the index. Every word of the query has to match the start of
+   * a word in the document, with a typo or two for longer words. Exact word
+   * matches rank above prefix matches, which rank above matches with typos,
+   * and fields that equal or start with the whole query rank highest.
+   *
+   * @param {string} query - the search query
+   * @param {object} options - (optional) search options with the keys
+   *     limit (maximum number of results, default 20), fields (the fields
+   *     to search, default all) and fuzzy (whether to allow typos, default
+   *     true)
+   * @returns {Array} The matches, best first, formatted as [{doc, score,
+   *     field, text, highlights}], where doc is the document index, field
+   *     and text the best matching field and its text, and highlights the
+   *     matching character ranges of the text, as [[start, end], ...].
+   */
+  function search(query, options = {}) {
+    let limit = options.limit !== undefined ? options.limit : 20;
+    let fuzzy = options.fuzzy !== false;
+    let searched = field => !options.fields || options.fields.includes(field);
+    let terms = tokenize(query);
+    if (terms.length == 0) return [];
+
+    let scores;
+    terms.forEach(term => {
+      let termScores = new Map();
+      matchingWords(term, fuzzy).forEach(({word, score: s}) => {
+        postings.get(word).forEach(({doc, field}) => {
+          if (!searched(field)) return;
+          let score = s * weight(field);
+          let best = termScores.get(doc);
+          if (!best || score > best.score) {
+            termScores.set(doc, {score: score, field: field});
+          }
+        });
+      });
+      if (!scores) {
+        scores = termScores;
+        return;
+      }
+      // documents have to match all terms
+      scores.forEach((match, doc) => {
+        if (!termScores.has(doc)) {
+          scores.delete(doc);
+        } else {
+          match.score += termScores.get(doc).score;
+        }
+      });
+    });
+
+    let whole = query.trim().toLowerCase();
+    let results = [];
+    scores.forEach((match, doc) => {
+      let best = 0;
+      Object.keys(documents[doc]).filter(searched).forEach(field => {
+        let text = String(documents[doc][field]).toLowerCase();
+        let bonus = (text == whole ? 10 : text.startsWith(whole) ? 3 : 0) * weight(field);
+        if (bonus > best) {
+          best = bonus;
+          match.field = field;
+        }
+      });
+      match.score += best;
+      results.push({doc: doc,
+                    score: match.score,
+                    field: match.field,
+                    text: String(documents[doc][match.field])});
+    });
+    // prefer shorter texts among equal scores, as they match more closely
+    results.sort((a, b) => b.score - a.score || a.text.length - b.text.length ||
+                           a.doc - b.doc);
+    results = results.slice(0, limit);
+    results.forEach(result => {
+      result.highlights = highlightRanges(result.text, terms, fuzzy);
+    });
+    return results;
+  }
+
+  return {build, search};
+}
+
+export { SearchIndex };
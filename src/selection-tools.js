@@ -0,0 +1,118 @@
+/**
+ * @file This file contains helpers for the interactive selection tools of the
+ * Metabolic Atlas 3D Viewer.
+ */
+
+/**
+ * Creates an overlay element which draws the selection region on top of the
+ * viewer while dragging. The overlay uses page (client) coordinates.
+ *
+ * @param {Object} container - the viewer container element
+ * @returns {Object} An object with functions to draw and hide the region.
+ */
+function SelectionOverlay(container) {
+  let box = document.createElement('div');
+  box.style.position = 'fixed';
+  box.style.pointerEvents = 'none';
+  box.style.border = '1px dashed rgba(0,0,0,0.8)';
+  box.style.backgroundColor = 'rgba(255,255,255,0.2)';
+  box.style.display = 'none';
+  container.appendChild(box);
+
+  const svgNS = 'http://www.w3.org/2000/svg';
+  let svg = document.createElementNS(svgNS, 'svg');
+  svg.style.position = 'fixed';
+  svg.style.left = '0';
+  svg.style.top = '0';
+  svg.style.width = '100%';
+  svg.style.height = '100%';
+  svg.style.pointerEvents = 'none';
+  svg.style.display = 'none';
+  let lasso = document.createElementNS(svgNS, 'polygon');
+  lasso.setAttribute('fill', 'rgba(255,255,255,0.2)');
+  lasso.setAttribute('stroke', 'rgba(0,0,0,0.8)');
+  lasso.setAttribute('stroke-dasharray', '4 3');
+  svg.appendChild(lasso);
+  container.appendChild(svg);
+
+  /**
+   * Draws a rectangle between two corners.
+   *
+   * @param {Array} a - first corner as [x, y]
+   * @param {Array} b - opposite corner as [x, y]
+   */
+  function showBox(a, b) {
+    box.style.left = Math.min(a[0], b[0]) + 'px';
+    box.style.top = Math.min(a[1], b[1]) + 'px';
+    box.style.width = Math.abs(b[0] - a[0]) + 'px';
+    box.style.height = Math.abs(b[1] - a[1]) + 'px';
+    box.style.display = 'block';
+  }
+
+  /**
+   * Draws a freehand lasso, closed between the last and the first point.
+   *
+   * @param {Array} points - lasso points formatted as [[x, y], ...]
+   */
+  function showLasso(points) {
+    lasso.setAttribute('points', points.map(p => p.join(',')).join(' '));
+    svg.style.display = 'block';
+  }
+
+  /**
+   * Hides the selection region.
+   */
+  function hide() {
+    box.style.display = 'none';
+    svg.style.display = 'none';
+  }
+
+  /**
+   * Removes the overlay from the container.
+   */
+  function dispose() {
+    box.remove();
+    svg.remove();
+  }
+
+  return {dispose, hide, showBox, showLasso};
+}
+
+/**
+ * Returns the bounding rectangle of a list of points.
+ *
+ * @param {Array} points - points formatted as [[x, y], ...]
+ * @returns {Object} The bounds as {left, top, width, height}.
+ */
+function pointBounds(points) {
+  let xs = points.map(p => p[0]);
+  let ys = points.map(p => p[1]);
+  let left = xs.reduce((a, b) => Math.min(a, b), Infinity);
+  let top = ys.reduce((a, b) => Math.min(a, b), Infinity);
+  return {left: left,
+          top: top,
+          width: xs.reduce((a, b) => Math.max(a, b), -Infinity) - left,
+          height: ys.reduce((a, b) => Math.max(a, b), -Infinity) - top};
+}
+
+/**
+ * Tests whether a point is inside a polygon, using the even-odd rule.
+ *
+ * @param {number} x - x coordinate of the point
+ * @param {number} y - y coordinate of the point
+ * @param {Array} polygon - polygon points formatted as [[x, y], ...]
+ * @returns {boolean} True if the point is inside the polygon.
+ */
+function pointInPolygon(x, y, polygon) {
+  let inside = false;
+  for (let i = 0, j = polygon.length - 1; i < polygon.length; j = i++) {
+    let [xi, yi] = polygon[i];
+    let [xj, yj] = polygon[j];
+    if ((yi > y) != (yj > y) && x < (xj - xi) * (y - yi) / (yj - yi) + xi) {
+      inside = !inside;
+    }
+  }
+  return inside;
+}
+
+export { SelectionOverlay, pointBounds, pointInPolygon };
@@ -0,0 +1,176 @@
+/**
+ * @file This file contains the freehand drawing layer of the Metabolic Atlas
+ * 3D Viewer, for circling regions or drawing arrows while discussing a
+ * network, e.g. when sharing the screen. Strokes are drawn on a plane facing
+ * the camera, so they stay in place in the network when the camera moves.
+ * A stroke is formatted as:
+ *
+ *   {id, points, color, width}
+ *
+ * where points is the list of stroke points as [x, y, z], color is [r, g, b]
+ * and width is the line width in pixels.
+ */
+
+import {
+  BufferGeometry,
+  Float32BufferAttribute,
+  Group,
+  Uint8BufferAttribute,
+  Vector3,
+} from 'three';
+
+import { makeWideLineMesh } from './wide-lines';
+
+/**
+ * Creates a unique stroke ID.
+ *
+ * @returns {string} The ID.
+ */
+function strokeId() {
+  return 's' + Date.now().toString(36) + Math.random().toString(36).slice(2, 6);
+}
+
+/**
+ * Creates the drawing layer.
+ *
+ * @param {Object} scene - the scene to draw in
+ * @returns {Object} An object with functions to add, change, find and
+ *     remove strokes.
+ */
+function Sketch(scene) {
+  let group = new Group();
+  // strokes are drawn over the network, so that circled nodes stay visible
+  group.renderOrder = 10;
+  scene.add(group);
+  // the meshes of the strokes, by stroke ID
+  let meshes = new Map();
+
+  /**
+   * Creates the mesh of a stroke, with one wide line segment between each
+   * pair of consecutive points.
+   *
+   * @param {Object} stroke - the stroke
+   * @returns {Object} A three-js Mesh.
+   */
+  function makeMesh(stroke) {
+    let segments = Math.max(1, stroke.points.length - 1);
+    let positions = new Float32Array(segments * 6);
+    let colors = new Uint8Array(segments * 6);
+    for (let k = 0; k < segments; k++) {
+      let a = stroke.points[k];
+      // a single point is drawn as a dot
+      let b = stroke.points[Math.min(k + 1, stroke.points.length - 1)];
+      positions.set(a, k * 6);
+      positions.set(b, k * 6 + 3);
+      colors.set(stroke.color, k * 6);
+      colors.set(stroke.color, k * 6 + 3);
+    }
+    let lines = new BufferGeometry();
+    lines.setAttribute('position', new Float32BufferAttribute(positions, 3));
+    lines.setAttribute('color', new Uint8BufferAttribute(colors, 3, true));
+    let mesh = makeWideLineMesh(lines, new Array(segments).fill(stroke.width), 1);
+    mesh.material.depthTest = false;
+    mesh.material.fog = false;
+    mesh.renderOrder = group.renderOrder;
+    mesh.userData.stroke = stroke;
+    return mesh;
+  }
+
+  /**
+   * Removes the mesh of a stroke.
+   *
+   * @param {string} id - the stroke ID
+   */
+  function removeMesh(id) {
+    let mesh = meshes.get(id);
+    if (!mesh) return;
+    group.remove(mesh);
+    mesh.geometry.dispose();
+    mesh.material.dispose();
+    meshes.delete(id);
+  }
+
+  /**
+   * Adds a stroke, or redraws it after its points have changed.
+   *
+   * @param {Object} stroke - the stroke
+   */
+  function draw(stroke) {
+    removeMesh(stroke.id);
+    let mesh = makeMesh(stroke);
+    meshes.set(stroke.id, mesh);
+    group.add(mesh);
+  }
+
+  /**
+   * Removes a stroke.
+   *
+   * @param {string} id - the stroke ID
+   */
+  function erase(id) {
+    removeMesh(id);
+  }
+
+  /**
+   * Removes all strokes.
+   */
+  function clear() {
+    [...meshes.keys()].forEach(removeMesh);
+  }
+
+  /**
+   * Returns the strokes, oldest first.
+   *
+   * @returns {Array} The strokes.
+   */
+  function getStrokes() {
+    return [...meshes.values()].map(mesh => mesh.userData.stroke);
+  }
+
+  /**
+   * Returns the newest stroke passing close to a point on the screen.
+   *
+   * @param {number} x - x coordinate in pixels from the left of the canvas
+   * @param {number} y - y coordinate in pixels from the top of the canvas
+   * @param {Object} camera - the camera
+   * @param {Object} size - the canvas size as {width, height}
+   * @param {number} tolerance - the distance in pixels, added to half the
+   *     stroke width
+   * @returns {Object} The stroke, or undefined.
+   */
+  function strokeAt(x, y, camera, size, tolerance) {
+    let a = new Vector3();
+    let b = new Vector3();
+    const screen = p => [(p.x + 1) / 2 * size.width, (1 - p.y) / 2 * size.height];
+    return getStrokes().reverse().find(stroke => {
+      let limit = stroke.width / 2 + tolerance;
+      for (let k = 0; k < stroke.points.length; k++) {
+        a.fromArray(stroke.points[k]).project(camera);
+        b.fromArray(stroke.points[Math.min(k + 1, stroke.points.length - 1)]).project(camera);
+        if (Math.abs(a.z) > 1 || Math.abs(b.z) > 1) continue;
+        let [ax, ay] = screen(a);
+        let [bx, by] = screen(b);
+        let dx = bx - ax, dy = by - ay;
+        let lengthSq = dx*dx + dy*dy;
+        let t = lengthSq > 0 ? ((x - ax)*dx + (y - ay)*dy) / lengthSq : 0;
+        t = Math.max(0, Math.min(1, t));
+        if (Math.hypot(ax + t*dx - x, ay + t*dy - y) < limit) {
+          return true;
+        }
+      }
+      return false;
+    });
+  }
+
+  /**
+   * Removes the strokes and the layer from the scene.
+   */
+  function dispose() {
+    clear();
+    scene.remove(group);
+  }
+
+  return {clear, dispose, draw, erase, getStrokes, strokeAt};
+}
+
+export { Sketch, strokeId };
@@ -0,0 +1,155 @@
+/**
+ * @file This file contains the small multiples of the Metabolic Atlas 3D
+ * Viewer, the 3D equivalent of faceted plots: the network is drawn once per
+ * condition in a grid of panels, all seen from the same camera, and the
+ * viewer colors the nodes of each panel by its condition, see
+ * `setSmallMultiples` of the viewer. Each panel is labeled with its
+ * condition in its top left corner.
+ */
+
+import { PerspectiveCamera, Vector2, Vector4 } from 'three';
+
+/**
+ * Returns the number of columns and rows of a grid of panels, as square as
+ * possible with more columns than rows.
+ *
+ * @param {number} count - the number of panels
+ * @returns {Object} The grid size as {cols, rows}.
+ */
+function gridSize(count) {
+  let cols = Math.max(1, Math.ceil(Math.sqrt(count)));
+  return {cols: cols, rows: Math.max(1, Math.ceil(count / cols))};
+}
+
+/**
+ * Creates the small multiples renderer.
+ *
+ * @param {Object} renderer - the three-js renderer
+ * @param {Object} container - the element of the viewer, for the labels
+ * @returns {Object} An object with functions to set the panels, render
+ *     them and find the panel under the mouse pointer.
+ */
+function SmallMultiples(renderer, container) {
+  const size = new Vector2();
+  const viewport = new Vector4();
+  // the camera of the panels, a copy of the viewer camera with the aspect
+  // ratio of a panel
+  const panelCamera = new PerspectiveCamera();
+  let grid = gridSize(0);
+  let count = 0;
+  let labels = [];
+
+  /**
+   * Sets the panels, and labels them.
+   *
+   * @param {Array} names - the label of each panel, or an empty list for no
+   *     panels
+   */
+  function setPanels(names) {
+    labels.forEach(label => label.remove());
+    count = names.length;
+    grid = gridSize(count);
+    labels = names.map((name, k) => {
+      let label = document.createElement('div');
+      label.className = 'met-atlas-panel-label';
+      label.textContent = name;
+      Object.assign(label.style, {
+        position: 'absolute',
+        left: (k % grid.cols) / grid.cols * 100 + '%',
+        top: Math.floor(k / grid.cols) / grid.rows * 100 + '%',
+        margin: '6px',
+        padding: '2px 6px',
+        borderRadius: '3px',
+        backgroundColor: 'rgba(255,255,255,0.8)',
+        color: '#000000',
+        font: '12px sans-serif',
+        pointerEvents: 'none',
+      });
+      container.appendChild(label);
+      return label;
+    });
+  }
+
+  /**
+   * Returns whether there are panels to render.
+   */
+  function isActive() {
+    return count > 0;
+  }
+
+  /**
+   * Returns the camera of a panel.
+   *
+   * @param {Object} camera - the viewer camera
+   * @param {number} aspect - the aspect ratio of the panel
+   * @returns {Object} The panel camera.
+   */
+  function cellCamera(camera, aspect) {
+    panelCamera.copy(camera);
+    panelCamera.aspect = aspect;
+    panelCamera.updateProjectionMatrix();
+    return panelCamera;
+  }
+
+  /**
+   * Renders the panels, each in its own viewport.
+   *
+   * @param {Object} scene - the scene
+   * @param {Object} camera - the viewer camera
+   * @param {Function} beforePanel - called with the panel index before the
+   *     panel is rendered, to color the nodes
+   */
+  function render(scene, camera, beforePanel) {
+    let autoClear = renderer.autoClear;
+    renderer.getSize(size);
+    renderer.getViewport(viewport);
+    renderer.clear();
+    renderer.autoClear = false;
+    renderer.setScissorTest(true);
+    let width = size.width / grid.cols;
+    let height = size.height / grid.rows;
+    for (let k = 0; k < count; k++) {
+      beforePanel(k);
+      let x = (k % grid.cols) * width;
+      // viewports start at the bottom of the canvas
+      let y = (grid.rows - 1 - Math.floor(k / grid.cols)) * height;
+      renderer.setScissor(x, y, width, height);
+      renderer.setViewport(x, y, width, height);
+      renderer.render(scene, cellCamera(camera, width / height));
+    }
+    renderer.setScissorTest(false);
+    renderer.setViewport(viewport);
+    renderer.autoClear = autoClear;
+  }
+
+  /**
+   * Finds the panel at a point of the canvas, for picking.
+   *
+   * @param {number} x - x coordinate from the left of the canvas, from 0 to 1
+   * @param {number} y - y coordinate from the top of the canvas, from 0 to 1
+   * @param {Object} camera - the viewer camera
+   * @returns {Object} The panel as {index, x, y, camera}, where x and y are
+   *     the normalized device coordinates of the point in the panel, and
+   *     camera is the panel camera.
+   */
+  function locate(x, y, camera) {
+    let col = Math.min(grid.cols - 1, Math.floor(x * grid.cols));
+    let row = Math.min(grid.rows - 1, Math.floor(y * grid.rows));
+    renderer.getSize(size);
+    return {index: row * grid.cols + col,
+            x: (x * grid.cols - col) * 2 - 1,
+            y: 1 - (y * grid.rows - row) * 2,
+            camera: cellCamera(camera, size.width / grid.cols / (size.height / grid.rows))};
+  }
+
+  /**
+   * Removes the labels.
+   */
+  function dispose() {
+    setPanels([]);
+  }
+
+  return {dispose, isActive, locate, render, setPanels};
+}
+
+export { SmallMultiples };
@@ -0,0 +1,93 @@
+/**
+ * @file This file contains the memory accounting of the Metabolic Atlas 3D
+ * Viewer. It estimates how much GPU memory the vertex buffers and textures
+ * of the scenes take, so that integrators can budget memory for embedded
+ * deployments. The sizes are those of the uploaded data; drivers may add
+ * their own overhead.
+ */
+
+/**
+ * Returns the size in bytes of a texture on the GPU, including its mipmaps.
+ *
+ * @param {Object} texture - the three-js texture
+ * @returns {number} The size, or 0 if the image isn't loaded yet.
+ */
+function textureBytes(texture) {
+  let image = texture.image;
+  if (!image) return 0;
+  let width = image.width || image.videoWidth || 0;
+  let height = image.height || image.videoHeight || 0;
+  let depth = image.depth || 1;
+  // 8-bit RGBA, unless the texture holds typed data
+  let texel = image.data && image.data.BYTES_PER_ELEMENT ? image.data.BYTES_PER_ELEMENT * 4 : 4;
+  let bytes = width * height * depth * texel;
+  // a full mipmap chain adds a third
+  return texture.generateMipmaps ? Math.round(bytes * 4 / 3) : bytes;
+}
+
+/**
+ * Collects the textures used by a material, in its maps and uniforms.
+ *
+ * @param {Object} material - the three-js material
+ * @param {Set} textures - the set to add the textures to
+ */
+function materialTextures(material, textures) {
+  Object.keys(material).forEach(key => {
+    let value = material[key];
+    if (value && value.isTexture) textures.add(value);
+  });
+  if (material.uniforms) {
+    Object.keys(material.uniforms).forEach(key => {
+      let value = material.uniforms[key].value;
+      if (value && value.isTexture) textures.add(value);
+    });
+  }
+}
+
+/**
+ * Estimates the GPU memory used by the geometries and textures of scenes.
+ * Buffers and textures shared between objects or scenes are counted once.
+ *
+ * @param {Array} scenes - the three-js scenes
+ * @returns {Object} The memory formatted as {geometries, buffers,
+ *     bufferBytes, textures, textureBytes}, where geometries, buffers and
+ *     textures are counts and the bytes are sizes.
+ */
+function sceneMemory(scenes) {
+  let geometries = new Set();
+  let arrays = new Set();
+  let textures = new Set();
+  scenes.forEach(scene => scene.traverse(object => {
+    if (object.geometry) {
+      geometries.add(object.geometry);
+    }
+    if (object.material) {
+      [].concat(object.material).forEach(material => materialTextures(material, textures));
+    }
+    // instance matrices and colors are buffers of the object
+    ['instanceMatrix', 'instanceColor'].forEach(key => {
+      if (object[key]) arrays.add(object[key].array);
+    });
+  }));
+  geometries.forEach(geometry => {
+    Object.keys(geometry.attributes).forEach(key => {
+      let attribute = geometry.attributes[key];
+      // interleaved attributes share the array of their buffer
+      arrays.add(attribute.isInterleavedBufferAttribute ? attribute.data.array : attribute.array);
+    });
+    if (geometry.index) {
+      arrays.add(geometry.index.array);
+    }
+  });
+  let bufferBytes = 0;
+  arrays.forEach(array => { bufferBytes += array.byteLength || 0; });
+  let imageBytes = 0;
+  textures.forEach(texture => { imageBytes += textureBytes(texture); });
+  return {geometries: geometries.size,
+          buffers: arrays.size,
+          bufferBytes: bufferBytes,
+          textures: textures.size,
+          textureBytes: imageBytes};
+}
+
+export { sceneMemory };
@@ -0,0 +1,107 @@
+/**
+ * @file This file contains the stereo rendering of the Metabolic Atlas 3D
+ * Viewer, for 3D projection without VR hardware: red-cyan anaglyphs for
+ * paper glasses, and side-by-side images for passive 3D projectors and
+ * displays. Each eye is rendered once with the scene as it is, so stereo
+ * costs about one extra render per frame.
+ */
+
+import { StereoCamera, Vector2, Vector4 } from 'three';
+
+/**
+ * Creates a stereo renderer.
+ *
+ * @param {Object} renderer - the three-js renderer
+ * @returns {Object} An object with a function to render the scene in
+ *     stereo.
+ */
+function Stereo(renderer) {
+  const stereo = new StereoCamera();
+  const size = new Vector2();
+  const viewport = new Vector4();
+
+  /**
+   * Renders the scene in red-cyan anaglyph, the left eye to the red channel
+   * and the right eye to the green and blue channels. The channels are
+   * masked in WebGL directly, and three-js is kept from changing the mask
+   * while rendering.
+   *
+   * @param {Object} scene - the scene
+   * @param {Array} eyes - the eye cameras, left first
+   */
+  function renderAnaglyph(scene, eyes) {
+    let gl = renderer.getContext();
+    let colorBuffer = renderer.state.buffers.color;
+    let autoClear = renderer.autoClear;
+    renderer.clear();
+    renderer.autoClear = false;
+    colorBuffer.setMask(true);
+    colorBuffer.setLocked(true);
+
+    gl.colorMask(true, false, false, true);
+    renderer.render(scene, eyes[0]);
+    renderer.clearDepth();
+    gl.colorMask(false, true, true, true);
+    renderer.render(scene, eyes[1]);
+
+    // the mask matches the state three-js expects again
+    gl.colorMask(true, true, true, true);
+    colorBuffer.setLocked(false);
+    renderer.autoClear = autoClear;
+  }
+
+  /**
+   * Renders the scene side by side, the left eye on the left half of the
+   * canvas.
+   *
+   * @param {Object} scene - the scene
+   * @param {Array} eyes - the eye cameras, left first
+   */
+  function renderSideBySide(scene, eyes) {
+    let autoClear = renderer.autoClear;
+    renderer.getSize(size);
+    renderer.getViewport(viewport);
+    renderer.clear();
+    renderer.autoClear = false;
+    renderer.setScissorTest(true);
+    eyes.forEach((eye, k) => {
+      renderer.setScissor(k * size.width / 2, 0, size.width / 2, size.height);
+      renderer.setViewport(k * size.width / 2, 0, size.width / 2, size.height);
+      renderer.render(scene, eye);
+    });
+    renderer.setScissorTest(false);
+    renderer.setViewport(viewport);
+    renderer.autoClear = autoClear;
+  }
+
+  /**
+   * Renders the scene in stereo.
+   *
+   * @param {Object} scene - the scene
+   * @param {Object} camera - the camera, which is between the eyes
+   * @param {Object} options - stereo options with the keys mode ('anaglyph'
+   *     or 'side-by-side'), focus (distance from the camera to the plane
+   *     without parallax), eyeSeparation (distance between the eyes in graph
+   *     units) and swapEyes (whether to swap the left and right images)
+   */
+  function render(scene, camera, options) {
+    scene.updateMatrixWorld();
+    if (camera.parent === null) camera.updateMatrixWorld();
+    camera.focus = options.focus;
+    stereo.eyeSep = options.eyeSeparation;
+    // side by side images each show half of the view
+    stereo.aspect = options.mode == 'side-by-side' ? 0.5 : 1;
+    stereo.update(camera);
+    let eyes = options.swapEyes ? [stereo.cameraR, stereo.cameraL] :
+                                  [stereo.cameraL, stereo.cameraR];
+    if (options.mode == 'side-by-side') {
+      renderSideBySide(scene, eyes);
+    } else {
+      renderAnaglyph(scene, eyes);
+    }
+  }
+
+  return {render};
+}
+
+export { Stereo };
@@ -0,0 +1,131 @@
+/**
+ * @file This file contains the declarative stylesheet for the Metabolic Atlas
+ * 3D Viewer. A stylesheet is an ordered list of rules, each with a selector
+ * and a set of visual properties. Later rules override earlier ones.
+ *
+ * Selectors have the form `<kind>[<attribute> <operator> <value>]...`, where
+ * kind is 'node', 'link' or '*', and any number of attribute tests can
+ * follow, e.g. `node[g = "m"][degree >= 10]`. The operators are =, !=, <, <=,
+ * >, >=, ^= (starts with), $= (ends with) and *= (contains). A test with only
+ * an attribute name, like `link[reversible]`, matches elements where the
+ * attribute is truthy. Selectors can also be given as functions, which are
+ * called with the element attributes and the element kind.
+ *
+ * Style property values can be constants, functions of the element
+ * attributes, or data-driven mappers (see mappers.js) such as
+ * `{attr: 'flux', scale: 'linear', range: [1, 8]}`.
+ */
+
+import { isMapper, makeMapper } from './mappers';
+
+const selectorPattern = /^\s*(node|link|\*)\s*((?:\[[^\]]*\]\s*)*)$/;
+const testPattern = /\[\s*([\w.-]+)\s*(?:(=|!=|<=|>=|<|>|\^=|\$=|\*=)\s*("[^"]*"|'[^']*'|[^\]\s]+)\s*)?\]/g;
+
+const operators = {
+  '=': (a, b) => a == b,
+  '!=': (a, b) => a != b,
+  '<': (a, b) => a < b,
+  '<=': (a, b) => a <= b,
+  '>': (a, b) => a > b,
+  '>=': (a, b) => a >= b,
+  '^=': (a, b) => String(a).startsWith(b),
+  '$=': (a, b) => String(a).endsWith(b),
+  '*=': (a, b) => String(a).includes(b),
+};
+
+/**
+ * Returns whether a selector is a function or a well-formed selector string.
+ *
+ * @param {string|Function} selector - the selector
+ * @returns {boolean} True if the selector can be parsed.
+ */
+function isValidSelector(selector) {
+  return typeof selector === 'function' || selectorPattern.test(String(selector));
+}
+
+/**
+ * Parses a selector string into a match function.
+ *
+ * @param {string|Function} selector - the selector
+ * @returns {Function} A function taking (attributes, kind) which returns
+ *     true if the element matches the selector.
+ */
+function parseSelector(selector) {
+  if (typeof selector === 'function') {
+    return selector;
+  }
+
+  let match = selectorPattern.exec(selector);
+  if (!match) {
+    console.warn("invalid selector: '" + selector + "'.");
+    return () => false;
+  }
+  let kind = match[1];
+  let tests = [];
+  let test;
+  testPattern.lastIndex = 0;
+  while ((test = testPattern.exec(match[2])) !== null) {
+    let [, attribute, operator, value] = test;
+    if (operator === undefined) {
+      tests.push(attributes => !!attributes[attribute]);
+      continue;
+    }
+    if (/^["'].*["']$/.test(value)) {
+      value = value.slice(1, -1);
+    } else if (!isNaN(Number(value))) {
+      value = Number(value);
+    } else if (value == 'true' || value == 'false') {
+      value = value == 'true';
+    }
+    tests.push(attributes => attributes[attribute] !== undefined &&
+                             operators[operator](attributes[attribute], value));
+  }
+
+  return (attributes, elementKind) =>
+    (kind == '*' || kind == elementKind) && tests.every(t => t(attributes));
+}
+
+/**
+ * Computes the style of each element from a list of style rules.
+ *
+ * @param {Array} elements - element attributes, one object per element
+ * @param {string} kind - 'node' or 'link'
+ * @param {Array} rules - style rules formatted as [{selector: <selector>,
+ *     style: {<property>: <value>, ...}}, ...]. Property values can be
+ *     functions, which are called with the element attributes, or mapper
+ *     specifications, whose default domain is taken from the elements that
+ *     the rule's selector matches.
+ * @returns {Array} The computed style object of each element.
+ */
+function computeStyles(elements, kind, rules) {
+  let parsed = rules.map(rule => {
+    let match = parseSelector(rule.selector);
+    let style = Object.assign({}, rule.style);
+    let matched;
+    Object.keys(style).forEach(key => {
+      if (isMapper(style[key])) {
+        matched = matched || elements.filter(e => match(e, kind));
+        let spec = style[key];
+        style[key] = makeMapper(spec, matched.map(e => e[spec.attr]));
+      }
+    });
+    return {match: match, style: style};
+  });
+  return elements.map(attributes => {
+    let style = {};
+    parsed.forEach(rule => {
+      if (rule.match(attributes, kind)) {
+        Object.keys(rule.style).forEach(key => {
+          let value = rule.style[key];
+          value = typeof value === 'function' ? value(attributes) : value;
+          if (value !== undefined) {
+            style[key] = value;
+          }
+        });
+      }
+    });
+    return style;
+  });
+}
+
+export { computeStyles, isValidSelector, parseSelector };
@@ -0,0 +1,70 @@
+/**
+ * @file This file contains the subsystem filter of the Metabolic Atlas 3D
+ * Viewer, which narrows the network down to one or more subsystems or
+ * pathways, e.g. the TCA cycle and oxidative phosphorylation. The reactions
+ * of the subsystems are kept, with the nodes without subsystem linked to
+ * them, like their metabolites and enzymes. The links leaving the subsystems
+ * can be kept as boundary links, with the nodes they lead to as boundary
+ * nodes. Boundary nodes and links are copies with the extra key boundary,
+ * so that they can be styled, e.g. greyed out.
+ */
+
+/**
+ * Returns whether a node has no value for an attribute.
+ *
+ * @param {Object} node - the node data
+ * @param {string} attribute - the attribute
+ */
+function unassigned(node, attribute) {
+  let value = node[attribute];
+  return value === undefined || value === null || (Array.isArray(value) && value.length == 0);
+}
+
+/**
+ * Filters a graph to subsystems. Attributes holding lists, like the
+ * subsystems of a reaction, put the node in every subsystem of the list.
+ *
+ * @param {Object} graphData - the graph data formatted as {nodes, links}
+ * @param {Array} subsystems - the subsystems to keep
+ * @param {object} options - filter options with the keys attribute (the
+ *     node attribute holding the subsystem, default 'subsystem') and
+ *     boundary (whether to keep the boundary nodes and links)
+ * @returns {Object} The filtered graph data, formatted as {nodes, links}.
+ */
+function subsystemGraph(graphData, subsystems, options = {}) {
+  let attribute = options.attribute || 'subsystem';
+  let values = new Set(subsystems.map(String));
+  let byId = new Map(graphData.nodes.map(node => [node.id, node]));
+  let members = new Set(graphData.nodes.filter(node =>
+    !unassigned(node, attribute) &&
+    [].concat(node[attribute]).some(value => values.has(String(value)))).map(node => node.id));
+
+  // nodes without subsystem, like metabolites, are in the subsystems of the
+  // nodes they are linked to
+  let inside = new Set(members);
+  graphData.links.forEach(link => {
+    let s = byId.get(link.s);
+    let t = byId.get(link.t);
+    if (!s || !t) return;
+    if (members.has(link.s) && unassigned(t, attribute)) inside.add(link.t);
+    if (members.has(link.t) && unassigned(s, attribute)) inside.add(link.s);
+  });
+
+  let links = [];
+  let boundary = new Set();
+  graphData.links.forEach(link => {
+    let s = inside.has(link.s);
+    let t = inside.has(link.t);
+    if (s && t) {
+      links.push(link);
+    } else if (options.boundary && (s || t) && byId.has(s ? link.t : link.s)) {
+      boundary.add(s ? link.t : link.s);
+      links.push(Object.assign({}, link, {boundary: true}));
+    }
+  });
+  let nodes = graphData.nodes.filter(node => inside.has(node.id)).concat(
+    [...boundary].map(id => Object.assign({}, byId.get(id), {boundary: true})));
+  return {nodes: nodes, links: links};
+}
+
+export { subsystemGraph };
@@ -0,0 +1,161 @@
+/**
+ * @file This file contains the textual network summary of the Metabolic Atlas
+ * 3D Viewer. The summary describes the network in words (its size, its
+ * compartments, the subsystems in view and the selection), and is kept in an
+ * off-screen region of the page, so that screen reader users can follow what
+ * is shown on the canvas.
+ */
+
+/**
+ * Counts the values of a node attribute. Attributes holding lists, like the
+ * subsystems of a reaction, count every value.
+ *
+ * @param {Array} nodes - the node infos
+ * @param {string} attribute - the attribute of the node data
+ * @returns {Array} The values and counts as [[value, count], ...], most
+ *     common first.
+ */
+function countValues(nodes, attribute) {
+  let counts = new Map();
+  nodes.forEach(node => {
+    let value = node.data[attribute];
+    [].concat(value === undefined || value === null ? [] : value).forEach(v => {
+      counts.set(v, (counts.get(v) || 0) + 1);
+    });
+  });
+  return [...counts.entries()].sort((a, b) => b[1] - a[1] || String(a[0]).localeCompare(String(b[0])));
+}
+
+/**
+ * Formats a count with a noun, e.g. '1 node' or '1,234 nodes'.
+ *
+ * @param {number} count - the count
+ * @param {string} noun - the singular noun
+ */
+function plural(count, noun) {
+  return count.toLocaleString('en') + ' ' + noun + (count == 1 ? '' : 's');
+}
+
+/**
+ * Formats a list of at most `max` items, e.g. 'a, b, c and 4 more'.
+ *
+ * @param {Array} items - the items as strings
+ * @param {number} max - the number of items to list
+ */
+function list(items, max) {
+  let shown = items.slice(0, max).join(', ');
+  return items.length > max ? shown + ' and ' + (items.length - max) + ' more' : shown;
+}
+
+/**
+ * Describes a network view in words.
+ *
+ * @param {Object} view - the view, with the keys nodes (the node infos),
+ *     links (the number of links), visible (indices of the nodes in view)
+ *     and selected (indices of the selected nodes)
+ * @param {Object} options - summary options with the keys compartment and
+ *     subsystem (the node data attributes of the compartments and
+ *     subsystems) and maxItems (the number of items to list)
+ * @returns {Array} The sentences of the summary.
+ */
+function summarizeNetwork(view, options) {
+  let nodes = view.nodes;
+  let sentences = ['Network of ' + plural(nodes.length, 'node') + ' and ' +
+                   plural(view.links, 'link') + '.'];
+  if (nodes.length == 0) {
+    return sentences;
+  }
+  const counted = (counts, noun) =>
+    counts.map(([value, count]) => value + ' (' + plural(count, noun) + ')');
+
+  let compartments = countValues(nodes, options.compartment);
+  if (compartments.length > 0) {
+    sentences.push(plural(compartments.length, 'compartment') + ': ' +
+                   list(counted(compartments, 'node'), options.maxItems) + '.');
+  }
+
+  let visible = view.visible.map(i => nodes[i]);
+  if (visible.length == nodes.length) {
+    sentences.push('All nodes are in view.');
+  } else {
+    sentences.push(plural(visible.length, 'node') + ' in view.');
+  }
+  let subsystems = countValues(visible, options.subsystem);
+  if (subsystems.length > 0) {
+    sentences.push('Subsystems in view: ' +
+                   list(counted(subsystems, 'node'), options.maxItems) + '.');
+  }
+
+  if (view.selected.length == 0) {
+    sentences.push('Nothing is selected.');
+  } else {
+    let names = view.selected.map(i => nodes[i].n || nodes[i].id);
+    sentences.push('Selected ' + plural(names.length, 'node') + ': ' +
+                   list(names, options.maxItems) + '.');
+  }
+  return sentences;
+}
+
+/**
+ * Creates the off-screen summary region in the viewer container, and links
+ * it to the container as its description.
+ *
+ * @param {Object} container - the viewer container element
+ * @returns {Object} An object with functions to update and remove the
+ *     summary.
+ */
+function NetworkSummary(container) {
+  let region = document.createElement('div');
+  region.className = 'met-atlas-summary';
+  region.id = 'met-atlas-summary-' + Math.random().toString(36).slice(2, 10);
+  region.setAttribute('role', 'region');
+  region.setAttribute('aria-label', 'Network summary');
+  // off-screen, but still read by screen readers
+  Object.assign(region.style, {
+    position: 'absolute',
+    left: '-10000px',
+    width: '1px',
+    height: '1px',
+    overflow: 'hidden',
+  });
+  container.appendChild(region);
+  let describedBy = container.getAttribute('aria-describedby');
+  container.setAttribute('aria-describedby',
+                         describedBy ? describedBy + ' ' + region.id : region.id);
+  let current = '';
+
+  /**
+   * Replaces the summary.
+   *
+   * @param {Array} sentences - the sentences of the summary
+   */
+  function update(sentences) {
+    let text = sentences.join(' ');
+    if (text == current) return;
+    current = text;
+    region.innerHTML = '';
+    sentences.forEach(sentence => {
+      let p = document.createElement('p');
+      p.textContent = sentence;
+      region.appendChild(p);
+    });
+  }
+
+  /**
+   * Removes the summary and its link to the container.
+   */
+  function dispose() {
+    let ids = (container.getAttribute('aria-describedby') || '').split(' ')
+      .filter(id => id && id != region.id);
+    if (ids.length > 0) {
+      container.setAttribute('aria-describedby', ids.join(' '));
+    } else {
+      container.removeAttribute('aria-describedby');
+    }
+    region.remove();
+  }
+
+  return {dispose, update};
+}
+
+export { NetworkSummary, summarizeNetwork };
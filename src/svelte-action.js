@@ -0,0 +1,111 @@
+/**
+ * @file This file contains the Svelte binding of the Metabolic Atlas 3D
+ * Viewer, as a Svelte action which creates a viewer in the element it is used
+ * on, and keeps it in sync with its parameters:
+ *
+ *   <script>
+ *     import { writable } from 'svelte/store';
+ *     import { metAtlasViewer } from
+ *       '@metabolicatlas/3d-network-viewer/src/svelte-action.js';
+ *     const selection = writable([]);
+ *   </script>
+ *
+ *   <div use:metAtlasViewer={{data, style: rules, theme: 'dark', selection}}
+ *        on:nodeClick={e => console.log(e.detail.node)} />
+ *
+ * The selection is synchronized both ways with a writable store of node IDs.
+ * Viewer events (nodeClick, nodeHover, edgeClick, cameraChange, dataLoaded)
+ * are dispatched as CustomEvents on the element, and a 'ready' event with the
+ * viewer instance is dispatched once the viewer is created. The action only
+ * relies on the store contract, so Svelte itself is not imported.
+ */
+
+import { MetAtlasViewer } from './met-atlas-viewer';
+
+// Viewer events which are dispatched on the element
+const forwardedEvents = ['nodeClick', 'nodeHover', 'edgeClick', 'cameraChange',
+                         'dataLoaded'];
+
+/**
+ * Creates a viewer in an element.
+ *
+ * @param {Object} element - the element to create the viewer in
+ * @param {object} params - parameters with the optional keys:
+ *     - data: graph data formatted as {graphData, nodeTextures, nodeSize},
+ *       see `setData`
+ *     - style: style rules, see `setStyle`
+ *     - theme: 'light', 'dark' or a theme object, see `setTheme`
+ *     - selection: writable store holding the IDs of the selected nodes
+ * @returns {Object} The action object, with update and destroy functions.
+ */
+function metAtlasViewer(element, params = {}) {
+  let viewer = MetAtlasViewer(element);
+  let current = {};
+  let unsubscribe;
+  // the latest selection written to, or read from, the store
+  let storeSelection = [];
+
+  function sameIds(a, b) {
+    return a.length == b.length && a.every(id => b.includes(id));
+  }
+
+  viewer.on('selectionChange', ({ items }) => {
+    let ids = items.map(node => node.id);
+    if (current.selection && !sameIds(ids, storeSelection)) {
+      storeSelection = ids;
+      current.selection.set(ids);
+    }
+  });
+  forwardedEvents.forEach(type => {
+    viewer.on(type, detail => {
+      element.dispatchEvent(new CustomEvent(type, {detail: detail}));
+    });
+  });
+
+  /**
+   * Applies the parameters that have changed since the last update.
+   *
+   * @param {object} next - the new parameters
+   */
+  async function update(next = {}) {
+    let previous = current;
+    current = next;
+    if (next.theme && next.theme !== previous.theme) {
+      viewer.setTheme(next.theme);
+    }
+    if (next.style !== previous.style) {
+      viewer.setStyle(next.style);
+    }
+    if (next.selection !== previous.selection) {
+      if (unsubscribe) unsubscribe();
+      unsubscribe = next.selection ? next.selection.subscribe(ids => {
+        storeSelection = ids || [];
+        if (!sameIds(storeSelection, viewer.getSelection())) {
+          viewer.select(storeSelection);
+        }
+      }) : undefined;
+    }
+    if (next.data && next.data !== previous.data) {
+      await viewer.setData(next.data);
+      // the selection refers to node IDs that may only now exist
+      viewer.select(storeSelection);
+    }
+  }
+
+  /**
+   * Stops synchronizing the selection store, and disposes the viewer.
+   */
+  function destroy() {
+    if (unsubscribe) unsubscribe();
+    unsubscribe = undefined;
+    viewer.dispose();
+  }
+
+  update(params).then(() => {
+    element.dispatchEvent(new CustomEvent('ready', {detail: viewer}));
+  });
+
+  return {update, destroy};
+}
+
+export { metAtlasViewer };
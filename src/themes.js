@@ -0,0 +1,63 @@
+/**
+ * @file This file contains the built-in themes of the Metabolic Atlas 3D
+ * Viewer. A theme sets the background, fog, default node and connection
+ * colors, highlight colors (including search matches) and label colors.
+ */
+
+const themes = {
+  light: {
+    background: '#dddddd',
+    fog: '#dddddd',
+    nodeDefaultColor: [64, 64, 64],
+    connectionStartColor: [0, 127, 255],
+    connectionEndColor: [0, 127, 0],
+    nodeSelectColor: [255, 0, 0],
+    connectionSelectColor: [255, 170, 0],
+    hoverSelectColor: [255, 0, 255],
+    hoverConnectionColor: [255, 0, 0],
+    pathColor: [0, 160, 200],
+    matchColor: [230, 160, 0],
+    currentMatchColor: [230, 80, 0],
+    labelColor: 'rgba(0,0,0,0.9)',
+    labelBackground: 'rgba(255,255,255,0.7)',
+    infoColor: 'rgba(0,0,0,0.9)',
+    infoBackground: 'rgba(255,255,255,0.5)'
+  },
+  dark: {
+    background: '#222222',
+    fog: '#222222',
+    nodeDefaultColor: [255, 255, 255],
+    connectionStartColor: [0, 127, 255],
+    connectionEndColor: [0, 127, 0],
+    nodeSelectColor: [255, 99, 71],
+    connectionSelectColor: [255, 255, 0],
+    hoverSelectColor: [255, 0, 255],
+    hoverConnectionColor: [255, 0, 0],
+    pathColor: [0, 230, 230],
+    matchColor: [255, 200, 0],
+    currentMatchColor: [255, 120, 0],
+    labelColor: 'rgba(255,255,255,0.9)',
+    labelBackground: 'rgba(0,0,0,0.6)',
+    infoColor: 'rgba(255,255,255,0.9)',
+    infoBackground: 'rgba(0,0,0,0.5)'
+  }
+};
+
+/**
+ * Splits a CSS color into a color without alpha, which three-js colors
+ * accept, and its alpha, e.g. 'rgba(0,0,0,0.9)' into 'rgb(0,0,0)' and 0.9.
+ *
+ * @param {string|number} color - the CSS color, or a number like 0xffffff
+ * @returns {Object} The color formatted as {color, alpha}.
+ */
+function splitAlpha(color) {
+  let match = /^\s*(rgb|hsl)a?\(\s*([^,\s]+)\s*,\s*([^,\s]+)\s*,\s*([^,\s)]+)\s*(?:,\s*([^\s)]+)\s*)?\)\s*$/
+    .exec(String(color));
+  if (!match) return {color: color, alpha: 1};
+  let alpha = match[5] === undefined ? 1 :
+              match[5].endsWith('%') ? parseFloat(match[5]) / 100 : parseFloat(match[5]);
+  return {color: match[1] + '(' + match.slice(2, 5).join(',') + ')',
+          alpha: isNaN(alpha) ? 1 : Math.max(0, Math.min(1, alpha))};
+}
+
+export { splitAlpha, themes };
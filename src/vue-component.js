@@ -0,0 +1,108 @@
+/**
+ * @file This file contains the Vue 3 component of the Metabolic Atlas 3D
+ * Viewer. The component wraps a viewer instance, and keeps it in sync with
+ * its props:
+ *
+ *   <met-atlas-viewer :data="data" :graph-style="rules" theme="dark"
+ *                     v-model:selection="selectedIds"
+ *                     @node-click="onNodeClick" />
+ *
+ * Vue is not bundled with the viewer, so this file is imported directly:
+ *
+ *   import { MetAtlasViewerComponent } from
+ *     '@metabolicatlas/3d-network-viewer/src/vue-component.js';
+ *
+ * The viewer instance is available through the `viewer()` function on the
+ * component ref, for everything that isn't covered by the props.
+ */
+
+import { defineComponent, h, onBeforeUnmount, onMounted, ref, watch } from 'vue';
+import { MetAtlasViewer } from './met-atlas-viewer';
+
+// Viewer events which are re-emitted by the component
+const forwardedEvents = ['nodeClick', 'nodeHover', 'edgeClick', 'cameraChange',
+                         'dataLoaded'];
+
+const MetAtlasViewerComponent = defineComponent({
+  name: 'MetAtlasViewer',
+  props: {
+    // graph data formatted as {graphData, nodeTextures, nodeSize}, see
+    // `setData`
+    data: Object,
+    // style rules, see `setStyle`. Named graphStyle since `style` is the
+    // style attribute of the component element.
+    graphStyle: Array,
+    // IDs of the selected nodes, for use with v-model:selection
+    selection: Array,
+    // 'light', 'dark' or a theme object, see `setTheme`
+    theme: [String, Object],
+  },
+  emits: ['update:selection', 'ready'].concat(forwardedEvents),
+  setup(props, { emit, expose }) {
+    const element = ref(null);
+    let viewer;
+
+    /**
+     * Selects the nodes of the selection prop, unless they already are the
+     * selection of the viewer.
+     */
+    function syncSelection() {
+      if (!viewer || !props.selection) return;
+      let current = viewer.getSelection();
+      if (current.length != props.selection.length ||
+          current.some(id => !props.selection.includes(id))) {
+        viewer.select(props.selection);
+      }
+    }
+
+    onMounted(async () => {
+      viewer = MetAtlasViewer(element.value);
+      viewer.on('selectionChange', ({ items }) => {
+        emit('update:selection', items.map(node => node.id));
+      });
+      forwardedEvents.forEach(type => {
+        viewer.on(type, detail => emit(type, detail));
+      });
+
+      if (props.theme) {
+        viewer.setTheme(props.theme);
+      }
+      if (props.graphStyle) {
+        viewer.setStyle(props.graphStyle);
+      }
+      if (props.data) {
+        await viewer.setData(props.data);
+        syncSelection();
+      }
+      emit('ready', viewer);
+    });
+
+    onBeforeUnmount(() => {
+      if (viewer) viewer.dispose();
+      viewer = undefined;
+    });
+
+    watch(() => props.data, async data => {
+      if (!viewer || !data) return;
+      await viewer.setData(data);
+      syncSelection();
+    });
+    watch(() => props.graphStyle, rules => {
+      if (viewer) viewer.setStyle(rules);
+    }, { deep: true });
+    watch(() => props.theme, theme => {
+      if (viewer && theme) viewer.setTheme(theme);
+    }, { deep: true });
+    watch(() => props.selection, syncSelection, { deep: true });
+
+    expose({ viewer: () => viewer });
+
+    return () => h('div', {
+      ref: element,
+      class: 'met-atlas-viewer',
+      style: { width: '100%', height: '100%' },
+    });
+  },
+});
+
+export { MetAtlasViewerComponent };
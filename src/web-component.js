@@ -0,0 +1,188 @@
+/**
+ * @file This file contains the `<met-atlas-3d-viewer>` custom element, which
+ * embeds the Metabolic Atlas 3D Viewer in any page without a build step:
+ *
+ *   <script src="met-atlas-3d-viewer.js"></script>
+ *   <met-atlas-3d-viewer src="network.json" theme="dark" node-size="10"
+ *                        style="height: 600px"></met-atlas-3d-viewer>
+ *
+ * Attributes:
+ *  - src: url of the graph data, as JSON formatted as {graphData,
+ *    nodeTextures, nodeSize} (see `setData`), or as {nodes, links}
+ *  - theme: 'light' or 'dark'
+ *  - node-size: node size, if not given in the data (default 10)
+ *  - selection: space separated IDs of the selected nodes
+ *
+ * Properties:
+ *  - data: graph data formatted as {graphData, nodeTextures, nodeSize}
+ *  - graphStyle: style rules, see `setStyle`
+ *  - selection: IDs of the selected nodes
+ *  - viewer: the viewer instance, for everything else
+ *
+ * The viewer events (nodeClick, nodeHover, edgeClick, selectionChange,
+ * cameraChange and dataLoaded) are dispatched as CustomEvents on the element,
+ * along with the events the viewer dispatches on its container, such as
+ * 'select' and 'contextmenu'.
+ */
+
+import { MetAtlasViewer } from './met-atlas-viewer';
+
+// Viewer events which are dispatched on the element
+const forwardedEvents = ['nodeClick', 'nodeHover', 'edgeClick', 'selectionChange',
+                         'cameraChange', 'dataLoaded'];
+
+// Default sprites for the Metabolic Atlas node groups, used when the data
+// doesn't include node textures
+const defaultTextures = [
+  {group: 'e', sprite: 'sprite_round.png'},
+  {group: 'r', sprite: 'sprite_square.png'},
+  {group: 'm', sprite: 'sprite_triangle.png'},
+];
+
+class MetAtlas3DViewerElement extends HTMLElement {
+  static get observedAttributes() {
+    return ['src', 'theme', 'node-size', 'selection'];
+  }
+
+  constructor() {
+    super();
+    this._viewer = undefined;
+    this._data = undefined;
+    this._graphStyle = undefined;
+    this._selection = [];
+  }
+
+  connectedCallback() {
+    if (this._viewer) return;
+    if (!this.style.display) {
+      this.style.display = 'block';
+    }
+    this._viewer = MetAtlasViewer(this);
+    this._viewer.on('selectionChange', ({ items }) => {
+      this._selection = items.map(node => node.id);
+    });
+    forwardedEvents.forEach(type => {
+      this._viewer.on(type, detail => {
+        this.dispatchEvent(new CustomEvent(type, {detail: detail}));
+      });
+    });
+
+    if (this.getAttribute('theme')) {
+      this._viewer.setTheme(this.getAttribute('theme'));
+    }
+    if (this._graphStyle) {
+      this._viewer.setStyle(this._graphStyle);
+    }
+    if (this._data) {
+      this._load(this._data);
+    } else if (this.getAttribute('src')) {
+      this._fetch(this.getAttribute('src'));
+    }
+  }
+
+  disconnectedCallback() {
+    // the viewer is recreated if the element is attached again
+    if (this._viewer) {
+      this._viewer.dispose();
+      this._viewer = undefined;
+    }
+  }
+
+  attributeChangedCallback(name, oldValue, value) {
+    if (!this._viewer || oldValue === value) return;
+    switch (name) {
+      case 'src':
+        if (value) this._fetch(value);
+        break;
+      case 'theme':
+        if (value) this._viewer.setTheme(value);
+        break;
+      case 'selection':
+        this.selection = value ? value.split(/\s+/).filter(id => id) : [];
+        break;
+    }
+  }
+
+  get viewer() {
+    return this._viewer;
+  }
+
+  get data() {
+    return this._data;
+  }
+
+  set data(data) {
+    this._data = data;
+    if (this._viewer) {
+      this._load(data);
+    }
+  }
+
+  get graphStyle() {
+    return this._graphStyle;
+  }
+
+  set graphStyle(rules) {
+    this._graphStyle = rules;
+    if (this._viewer) {
+      this._viewer.setStyle(rules);
+    }
+  }
+
+  get selection() {
+    return this._selection.slice();
+  }
+
+  set selection(ids) {
+    this._selection = ids || [];
+    if (this._viewer) {
+      this._viewer.select(this._selection);
+    }
+  }
+
+  /**
+   * Fetches graph data from a url and shows it.
+   *
+   * @param {string} url - url of the JSON graph data
+   */
+  async _fetch(url) {
+    try {
+      let response = await fetch(url);
+      if (!response.ok) {
+        throw new Error(response.status + ' ' + response.statusText);
+      }
+      this.data = await response.json();
+    } catch (error) {
+      console.warn("could not load graph data from '" + url + "': " + error.message);
+      this.dispatchEvent(new CustomEvent('error', {detail: error}));
+    }
+  }
+
+  /**
+   * Shows graph data, accepting both the `setData` format and plain
+   * {nodes, links} data.
+   *
+   * @param {object} data - the graph data
+   */
+  async _load(data) {
+    if (!data.graphData) {
+      data = {graphData: data};
+    }
+    await this._viewer.setData({
+      graphData: data.graphData,
+      nodeTextures: data.nodeTextures || defaultTextures,
+      nodeSize: data.nodeSize || Number(this.getAttribute('node-size')) || 10,
+    });
+    let selection = this.getAttribute('selection');
+    if (this._selection.length == 0 && selection) {
+      this._selection = selection.split(/\s+/).filter(id => id);
+    }
+    this._viewer.select(this._selection);
+  }
+}
+
+if (!customElements.get('met-atlas-3d-viewer')) {
+  customElements.define('met-atlas-3d-viewer', MetAtlas3DViewerElement);
+}
+
+export { MetAtlas3DViewerElement };
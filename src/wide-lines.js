@@ -0,0 +1,159 @@
+/**
+ * @file This file contains functions for drawing links with individual widths
+ * in the Metabolic Atlas 3D Viewer. WebGL only draws lines one pixel wide on
+ * most platforms, so wide links are drawn as camera-facing quads, one
+ * instance per line segment.
+ */
+
+import {
+  Float32BufferAttribute,
+  InstancedBufferAttribute,
+  InstancedBufferGeometry,
+  InstancedInterleavedBuffer,
+  InterleavedBufferAttribute,
+  Mesh,
+  ShaderMaterial,
+  UniformsLib,
+  UniformsUtils,
+  Vector2,
+} from 'three';
+
+const wideLineVertexShader = `
+  attribute vec2 corner;
+  attribute vec3 instanceStart;
+  attribute vec3 instanceEnd;
+  attribute vec3 instanceColorStart;
+  attribute vec3 instanceColorEnd;
+  attribute float instanceWidth;
+  attribute float instanceCulled;
+  uniform vec2 resolution;
+  varying vec3 vColor;
+
+  #include <fog_pars_vertex>
+
+  void main() {
+    vec4 start = modelViewMatrix * vec4( instanceStart, 1.0 );
+    vec4 end = modelViewMatrix * vec4( instanceEnd, 1.0 );
+
+    // trim segments that cross the near plane, so that the end behind the
+    // camera doesn't flip the quad
+    float nearEstimate = - 0.5 * projectionMatrix[3][2] / projectionMatrix[2][2];
+    if ( start.z > nearEstimate && end.z < nearEstimate ) {
+      start.xyz = mix( start.xyz, end.xyz, ( nearEstimate - start.z ) / ( end.z - start.z ) );
+    } else if ( end.z > nearEstimate && start.z < nearEstimate ) {
+      end.xyz = mix( end.xyz, start.xyz, ( nearEstimate - end.z ) / ( start.z - end.z ) );
+    }
+
+    vec4 clipStart = projectionMatrix * start;
+    vec4 clipEnd = projectionMatrix * end;
+    vec2 dir = ( clipEnd.xy / clipEnd.w - clipStart.xy / clipStart.w ) * resolution;
+    dir = length( dir ) > 0.0 ? normalize( dir ) : vec2( 1.0, 0.0 );
+    vec2 normal = vec2( - dir.y, dir.x );
+
+    vec4 mvPosition = corner.x < 0.5 ? start : end;
+    vec4 clip = corner.x < 0.5 ? clipStart : clipEnd;
+    // offset by half the width on each side, in normalized device coordinates
+    clip.xy += normal * corner.y * instanceWidth / resolution * clip.w;
+    gl_Position = clip;
+    // links to nodes hidden by occlusion culling are moved out of view
+    if ( instanceCulled > 0.5 ) gl_Position = vec4( 2.0, 2.0, 2.0, 1.0 );
+
+    vColor = corner.x < 0.5 ? instanceColorStart : instanceColorEnd;
+
+    #include <fog_vertex>
+  }
+`;
+
+const wideLineFragmentShader = `
+  uniform float opacity;
+  varying vec3 vColor;
+
+  #include <fog_pars_fragment>
+
+  void main() {
+    gl_FragColor = vec4( vColor, opacity );
+
+    #include <fog_fragment>
+  }
+`;
+
+/**
+ * Creates a mesh which draws the segments of a line segments geometry as
+ * quads with individual widths. The mesh shares the position, color and
+ * culled arrays of the line geometry, and picks up color and culled changes
+ * made to the line geometry before each render.
+ *
+ * @param {Object} lineGeometry - geometry of a three-js LineSegments object,
+ *     with float positions, normalized byte colors and float culled flags
+ * @param {Array} widths - width in pixels of each line segment
+ * @param {number} opacity - (optional) line opacity
+ * @returns {Object} A three-js Mesh.
+ */
+function makeWideLineMesh(lineGeometry, widths, opacity = 0.67) {
+  let positions = lineGeometry.attributes.position;
+  let colors = lineGeometry.attributes.color;
+  let culled = lineGeometry.attributes.culled;
+
+  let geometry = new InstancedBufferGeometry();
+  // a unit quad, where x selects the segment start or end, and y the side
+  geometry.setIndex([0, 1, 2, 2, 1, 3]);
+  geometry.setAttribute('corner', new Float32BufferAttribute(
+    [0, -1, 1, -1, 0, 1, 1, 1], 2));
+
+  let positionBuffer = new InstancedInterleavedBuffer(positions.array, 6, 1);
+  geometry.setAttribute('instanceStart',
+                        new InterleavedBufferAttribute(positionBuffer, 3, 0));
+  geometry.setAttribute('instanceEnd',
+                        new InterleavedBufferAttribute(positionBuffer, 3, 3));
+
+  let colorBuffer = new InstancedInterleavedBuffer(colors.array, 6, 1);
+  geometry.setAttribute('instanceColorStart',
+                        new InterleavedBufferAttribute(colorBuffer, 3, 0, true));
+  geometry.setAttribute('instanceColorEnd',
+                        new InterleavedBufferAttribute(colorBuffer, 3, 3, true));
+
+  let culledBuffer = new InstancedInterleavedBuffer(culled.array, 2, 1);
+  geometry.setAttribute('instanceCulled',
+                        new InterleavedBufferAttribute(culledBuffer, 1, 0));
+
+  geometry.setAttribute('instanceWidth',
+                        new InstancedBufferAttribute(new Float32Array(widths), 1));
+  geometry.instanceCount = widths.length;
+
+  let material = new ShaderMaterial({
+    uniforms: UniformsUtils.merge([
+      UniformsLib.fog,
+      {
+        resolution: {value: new Vector2(1, 1)},
+        opacity: {value: opacity}
+      }
+    ]),
+    vertexShader: wideLineVertexShader,
+    fragmentShader: wideLineFragmentShader,
+    transparent: true,
+    depthTest: true,
+    fog: true
+  });
+
+  let mesh = new Mesh(geometry, material);
+  mesh.frustumCulled = false;
+
+  // the line colors and culled flags are updated through the line geometry,
+  // so copy the update flags over to the shared buffers
+  let colorVersion = colors.version;
+  let culledVersion = culled.version;
+  mesh.onBeforeRender = function(renderer) {
+    if (colors.version != colorVersion) {
+      colorVersion = colors.version;
+      colorBuffer.needsUpdate = true;
+    }
+    if (culled.version != culledVersion) {
+      culledVersion = culled.version;
+      culledBuffer.needsUpdate = true;
+    }
+    renderer.getSize(material.uniforms.resolution.value);
+  };
+  return mesh;
+}
+
+export { makeWideLineMesh };
@@ -0,0 +1,290 @@
+/**
+ * @file This file contains the immersive VR mode of the Metabolic Atlas 3D
+ * Viewer, using WebXR. The user stands in the network, points at nodes with
+ * the controller rays, selects them with the trigger, grabs the pointed at
+ * node with the grip button to move it, or the network to pull it around
+ * when no node is pointed at, and moves through it with the thumbsticks
+ * (forward and back along the ray, and snap turns).
+ *
+ * The viewer camera is put in a "dolly" group, which carries the user
+ * through the network. The headset moves the camera within the dolly, and
+ * the dolly scale sets how large the network appears.
+ */
+
+import {
+  BufferGeometry,
+  Group,
+  Line,
+  LineBasicMaterial,
+  Vector3,
+} from 'three';
+
+/**
+ * Creates the VR mode.
+ *
+ * @param {Object} renderer - the three-js renderer
+ * @param {Object} scene - the scene
+ * @param {Object} camera - the viewer camera
+ * @param {Object} callbacks - functions called by the VR mode:
+ *     - pick(origin, direction): returns the node hit by a ray, formatted as
+ *       {index, distance}, or undefined
+ *     - hover(index): called when the pointed at node changes, with
+ *       undefined when no node is pointed at
+ *     - select(index): called when a node is selected with the trigger
+ *     - drag(index, position): called every frame while a node is grabbed,
+ *       with its new position as [x, y, z]
+ *     - drop(index, position): called when a grabbed node is released
+ *     - end(): called when the VR session ends
+ * @returns {Object} An object with functions to enter, update and exit the
+ *     VR mode.
+ */
+function XRMode(renderer, scene, camera, callbacks) {
+  let dolly = new Group();
+  let session;
+  let controllers = [];
+  // the controller holding the network, with its last position in the
+  // dolly, or holding a node, with the node index and its distance along
+  // the ray
+  let grab;
+  let hovered;
+  let lastTime;
+  let options = {
+    scale: 1,
+    speed: 1.5,
+    turn: Math.PI / 6,
+    rayLength: 5,
+    rayColor: [255, 255, 255],
+    hoverColor: [255, 191, 0],
+  };
+
+  // reusable vectors for the per-frame update
+  const origin = new Vector3();
+  const direction = new Vector3();
+
+  /**
+   * Returns whether the browser supports immersive VR.
+   *
+   * @returns {Promise} A promise resolving to true or false.
+   */
+  function isSupported() {
+    if (!navigator.xr || !navigator.xr.isSessionSupported) {
+      return Promise.resolve(false);
+    }
+    return navigator.xr.isSessionSupported('immersive-vr').catch(() => false);
+  }
+
+  /**
+   * Sets a ray color.
+   *
+   * @param {Object} ray - the ray line
+   * @param {Array} color - the color as [r, g, b]
+   */
+  function setRayColor(ray, color) {
+    ray.material.color.setRGB(color[0]/255, color[1]/255, color[2]/255);
+  }
+
+  /**
+   * Sets up a controller with a pointing ray.
+   *
+   * @param {number} i - the controller index
+   * @returns {Object} The controller state, formatted as {controller, ray,
+   *     source, hovered, turned}.
+   */
+  function makeController(i) {
+    let controller = renderer.xr.getController(i);
+    let ray = new Line(
+      new BufferGeometry().setFromPoints([new Vector3(0, 0, 0), new Vector3(0, 0, -1)]),
+      new LineBasicMaterial());
+    setRayColor(ray, options.rayColor);
+    ray.scale.z = options.rayLength;
+    ray.visible = false;
+    controller.add(ray);
+
+    let state = {controller: controller, ray: ray, source: undefined,
+                 hovered: undefined, distance: 0, turned: false};
+    state.listeners = {
+      connected: event => { state.source = event.data; },
+      disconnected: () => { state.source = undefined; },
+      select: () => {
+        if (state.hovered !== undefined) {
+          callbacks.select(state.hovered);
+        }
+      },
+      squeezestart: () => {
+        grab = state.hovered !== undefined ?
+          {state: state, node: state.hovered, distance: state.distance} :
+          {state: state, last: controller.position.clone()};
+      },
+      squeezeend: () => {
+        if (grab && grab.state === state) {
+          if (grab.node !== undefined && grab.position) {
+            callbacks.drop(grab.node, grab.position);
+          }
+          grab = undefined;
+        }
+      },
+    };
+    Object.keys(state.listeners).forEach(type => {
+      controller.addEventListener(type, state.listeners[type]);
+    });
+    dolly.add(controller);
+    return state;
+  }
+
+  /**
+   * Removes a controller and its ray.
+   *
+   * @param {Object} state - the controller state
+   */
+  function removeController(state) {
+    Object.keys(state.listeners).forEach(type => {
+      state.controller.removeEventListener(type, state.listeners[type]);
+    });
+    state.controller.remove(state.ray);
+    state.ray.geometry.dispose();
+    state.ray.material.dispose();
+    dolly.remove(state.controller);
+  }
+
+  /**
+   * Starts an immersive VR session. Must be called from a user gesture,
+   * like a button click.
+   *
+   * @param {Object} pose - where the user starts, formatted as {position,
+   *     quaternion} (three-js objects)
+   * @param {Object} settings - (optional) VR options, see `enterVR` of the
+   *     viewer
+   * @returns {Promise} A promise resolving to whether the session started.
+   */
+  async function enter(pose, settings = {}) {
+    if (session) return true;
+    if (!navigator.xr) {
+      console.warn('WebXR is not supported by this browser.');
+      return false;
+    }
+    Object.assign(options, settings);
+    try {
+      session = await navigator.xr.requestSession('immersive-vr');
+    } catch (error) {
+      console.warn('could not start VR: ' + error.message);
+      session = undefined;
+      return false;
+    }
+    dolly.position.copy(pose.position);
+    dolly.quaternion.copy(pose.quaternion);
+    dolly.scale.setScalar(options.scale);
+    scene.add(dolly);
+    dolly.add(camera);
+    controllers = [0, 1].map(makeController);
+    lastTime = undefined;
+
+    renderer.xr.enabled = true;
+    renderer.xr.setReferenceSpaceType('local');
+    session.addEventListener('end', onSessionEnd);
+    await renderer.xr.setSession(session);
+    return true;
+  }
+
+  /**
+   * Ends the VR session.
+   */
+  function exit() {
+    if (session) {
+      session.end();
+    }
+  }
+
+  /**
+   * Restores the scene when the session ends, also when it's ended from the
+   * headset.
+   */
+  function onSessionEnd() {
+    session.removeEventListener('end', onSessionEnd);
+    session = undefined;
+    controllers.forEach(removeController);
+    controllers = [];
+    grab = undefined;
+    hovered = undefined;
+    scene.add(camera);
+    scene.remove(dolly);
+    renderer.xr.enabled = false;
+    callbacks.end();
+  }
+
+  /**
+   * Updates the rays, the pointed at node, and the movement. Called every
+   * frame of the session.
+   *
+   * @param {number} time - the frame time in milliseconds
+   */
+  function update(time) {
+    let dt = lastTime !== undefined ? Math.min(0.1, (time - lastTime) / 1000) : 0;
+    lastTime = time;
+    dolly.updateMatrixWorld(true);
+
+    let pointed;
+    controllers.forEach(state => {
+      state.ray.visible = !!state.source;
+      if (!state.source) return;
+      origin.setFromMatrixPosition(state.controller.matrixWorld);
+      direction.set(0, 0, -1).transformDirection(state.controller.matrixWorld);
+      let hit = callbacks.pick(origin, direction);
+      state.hovered = hit ? hit.index : undefined;
+      state.distance = hit ? hit.distance : 0;
+      state.ray.scale.z = hit ? hit.distance / dolly.scale.x : options.rayLength;
+      setRayColor(state.ray, hit ? options.hoverColor : options.rayColor);
+      if (pointed === undefined) {
+        pointed = state.hovered;
+      }
+
+      // fly along the ray with the thumbstick, and turn in steps
+      let gamepad = state.source.gamepad;
+      if (gamepad && gamepad.axes.length >= 4) {
+        let x = gamepad.axes[2];
+        let y = gamepad.axes[3];
+        if (Math.abs(y) > 0.2) {
+          dolly.position.addScaledVector(direction, -y * options.speed * dolly.scale.x * dt);
+        }
+        if (Math.abs(x) > 0.6) {
+          if (!state.turned) {
+            dolly.rotateY(-Math.sign(x) * options.turn);
+            state.turned = true;
+          }
+        } else {
+          state.turned = false;
+        }
+      }
+    });
+
+    // a grabbed node stays at the end of the ray
+    if (grab && grab.node !== undefined) {
+      let controller = grab.state.controller;
+      origin.setFromMatrixPosition(controller.matrixWorld);
+      direction.set(0, 0, -1).transformDirection(controller.matrixWorld);
+      grab.position = origin.addScaledVector(direction, grab.distance).toArray();
+      callbacks.drag(grab.node, grab.position);
+    // the network follows the grabbing hand, so the dolly moves the other way
+    } else if (grab) {
+      let controller = grab.state.controller;
+      dolly.position.add(grab.last.clone().sub(controller.position)
+        .applyQuaternion(dolly.quaternion).multiplyScalar(dolly.scale.x));
+      grab.last.copy(controller.position);
+    }
+
+    if (pointed !== hovered) {
+      hovered = pointed;
+      callbacks.hover(hovered);
+    }
+  }
+
+  /**
+   * Returns whether a VR session is running.
+   */
+  function isPresenting() {
+    return !!session;
+  }
+
+  return {enter, exit, isPresenting, isSupported, update};
+}
+
+export { XRMode };